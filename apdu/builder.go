@@ -0,0 +1,130 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package apdu
+
+import (
+	"fmt"
+
+	"github.com/hsanjuan/go-nfctype4/helpers"
+)
+
+// CommandBuilder allows to construct Command APDUs step by step,
+// taking care of the encoding of the Lc and Le fields. It is
+// obtained with NewCommand:
+//
+//	cApdu, err := apdu.NewCommand(0x00, apdu.INSRead).
+//	        P1(0x00).
+//	        P2(0x10).
+//	        ExpectLen(300).
+//	        Build()
+//
+// When the data or the expected response length do not fit in a
+// short APDU, both Lc and Le are encoded in extended form, as
+// required by ISO/IEC 7816-4.
+type CommandBuilder struct {
+	cla  byte
+	ins  byte
+	p1   byte
+	p2   byte
+	data []byte
+	le   int
+}
+
+// NewCommand returns a new CommandBuilder for a command with the
+// given class and instruction bytes.
+func NewCommand(cla, ins byte) *CommandBuilder {
+	return &CommandBuilder{
+		cla: cla,
+		ins: ins,
+	}
+}
+
+// P1 sets the first parameter byte.
+func (b *CommandBuilder) P1(p1 byte) *CommandBuilder {
+	b.p1 = p1
+	return b
+}
+
+// P2 sets the second parameter byte.
+func (b *CommandBuilder) P2(p2 byte) *CommandBuilder {
+	b.p2 = p2
+	return b
+}
+
+// Data sets the data field of the command.
+func (b *CommandBuilder) Data(data []byte) *CommandBuilder {
+	b.data = data
+	return b
+}
+
+// ExpectLen sets the maximum length of the response data (Le).
+// It goes from 0 (no response data expected) to 2^16.
+func (b *CommandBuilder) ExpectLen(n int) *CommandBuilder {
+	b.le = n
+	return b
+}
+
+// Build returns the CAPDU with the Lc and Le fields encoded
+// accordingly. It returns an error if the data or the expected
+// length are too large.
+func (b *CommandBuilder) Build() (*CAPDU, error) {
+	lc := len(b.data)
+	if lc > 65535 {
+		return nil, fmt.Errorf("CommandBuilder.Build: "+
+			"data cannot be larger than 65535 bytes (%d)", lc)
+	}
+	if b.le < 0 || b.le > 65536 {
+		return nil, fmt.Errorf("CommandBuilder.Build: "+
+			"expected length must be between 0 and 65536 (%d)", b.le)
+	}
+
+	cApdu := &CAPDU{
+		CLA:  b.cla,
+		INS:  b.ins,
+		P1:   b.p1,
+		P2:   b.p2,
+		Lc:   []byte{},
+		Data: b.data,
+		Le:   []byte{},
+	}
+	if cApdu.Data == nil {
+		cApdu.Data = []byte{}
+	}
+
+	extended := lc > 255 || b.le > 256
+	if !extended {
+		cApdu.SetLc(lc)
+		cApdu.SetLe(b.le)
+		return cApdu, nil
+	}
+
+	// Extended: Lc takes 3 bytes and Le takes 2 bytes when
+	// Lc is present and 3 bytes otherwise. 0000h means 2^16 in Le.
+	if lc > 0 {
+		lcBytes := helpers.Uint16ToBytes(uint16(lc))
+		cApdu.Lc = []byte{0x00, lcBytes[0], lcBytes[1]}
+	}
+	if b.le > 0 {
+		leBytes := helpers.Uint16ToBytes(uint16(b.le))
+		cApdu.Le = leBytes[:]
+		if lc == 0 {
+			cApdu.Le = []byte{0x00, leBytes[0], leBytes[1]}
+		}
+	}
+	return cApdu, nil
+}
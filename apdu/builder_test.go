@@ -0,0 +1,77 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package apdu
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCommandBuilder(t *testing.T) {
+	testcases := []struct {
+		Data     []byte
+		Le       int
+		Expected []byte
+	}{
+		{nil, 0, []byte{0x00, 0xB0, 0x01, 0x02}},
+		{nil, 256, []byte{0x00, 0xB0, 0x01, 0x02, 0x00}},
+		{nil, 300, []byte{0x00, 0xB0, 0x01, 0x02, 0x00, 0x01, 0x2C}},
+		{nil, 65536, []byte{0x00, 0xB0, 0x01, 0x02, 0x00, 0x00, 0x00}},
+		{[]byte{0xAA}, 0, []byte{0x00, 0xB0, 0x01, 0x02, 0x01, 0xAA}},
+		{[]byte{0xAA}, 10, []byte{0x00, 0xB0, 0x01, 0x02, 0x01, 0xAA, 0x0A}},
+		// Le needs extended length so Lc must be extended too
+		{[]byte{0xAA}, 300, []byte{0x00, 0xB0, 0x01, 0x02, 0x00, 0x00, 0x01, 0xAA, 0x01, 0x2C}},
+	}
+
+	for _, c := range testcases {
+		capdu, err := NewCommand(0x00, INSRead).
+			P1(0x01).
+			P2(0x02).
+			Data(c.Data).
+			ExpectLen(c.Le).
+			Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := capdu.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b, c.Expected) {
+			t.Errorf("Build: expected % 02X. Got % 02X", c.Expected, b)
+		}
+		if capdu.GetLe() != c.Le {
+			t.Errorf("Build: expected Le %d. Got %d", c.Le, capdu.GetLe())
+		}
+	}
+
+	capdu, err := NewCommand(0x00, INSUpdate).Data(make([]byte, 300)).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(capdu.Lc) != 3 || capdu.GetLc() != 300 {
+		t.Error("Build: Lc should be extended")
+	}
+
+	if _, err := NewCommand(0x00, INSRead).ExpectLen(65537).Build(); err == nil {
+		t.Error("Build: Le should not be larger than 65536")
+	}
+	if _, err := NewCommand(0x00, INSUpdate).Data(make([]byte, 65536)).Build(); err == nil {
+		t.Error("Build: Lc should not be larger than 65535")
+	}
+}
@@ -27,11 +27,20 @@ import (
 
 // CAPDU.INS relevant to the Type 4 Tag Specification
 const (
-	INSSelect = byte(0xA4)
-	INSRead   = byte(0xB0)
-	INSUpdate = byte(0xD6)
+	INSSelect      = byte(0xA4)
+	INSRead        = byte(0xB0)
+	INSReadODO     = byte(0xB1)
+	INSUpdate      = byte(0xD6)
+	INSUpdateODO   = byte(0xD7)
+	INSGetResponse = byte(0xC0)
+	INSVerify      = byte(0x20)
+	INSEnvelope    = byte(0xC2)
 )
 
+// CLAChaining is the bit set in the CLA byte of the commands which
+// are not the last one of a chain (ISO/IEC 7816-4 command chaining).
+const CLAChaining = byte(0x10)
+
 // CAPDU represents a Command APDU
 // (https://en.wikipedia.org/wiki/Smart_card_application_protocol_data_unit)
 // which is used to send instructions and data to the NFC devices.
@@ -82,85 +91,104 @@ func (apdu *CAPDU) String() string {
 // APDU and goes from 0 to 2^16-1.
 // Note this method will return
 // 0 if it cannot make sense of the Lc bytes.
-func (apdu *CAPDU) GetLc() uint16 {
+func (apdu *CAPDU) GetLc() int {
 	switch len(apdu.Lc) {
 	case 0:
-		return uint16(0) // This goes against spec
+		return 0 // This goes against spec
 	case 1:
-		return uint16(apdu.Lc[0])
+		return int(apdu.Lc[0])
 	case 3:
-		return helpers.BytesToUint16([2]byte{apdu.Lc[1], apdu.Lc[2]})
+		return int(helpers.BytesToUint16([2]byte{apdu.Lc[1], apdu.Lc[2]}))
 	default:
 		return 0
 	}
 }
 
 // SetLc allows to easily set the value of the Lc bytes making sure
-// they comply to the specification.
-func (apdu *CAPDU) SetLc(n uint16) {
-	if n == 0 {
-		apdu.Lc = []byte{}
-	} else if 1 <= n && n <= 255 { // 1-255
-		apdu.Lc = []byte{byte(n)}
-	} else {
-		nBytes := helpers.Uint16ToBytes(n)
-		apdu.Lc = []byte{0x00, nBytes[0], nBytes[1]}
+// they comply to the specification. Values outside the 0 to 2^16-1
+// range are ignored. Le is re-encoded when needed, so that both
+// fields use either the short or the extended form.
+func (apdu *CAPDU) SetLc(n int) {
+	if n < 0 || n > 65535 {
+		return
 	}
+	apdu.setLengths(n, apdu.GetLe())
 }
 
-// BUG(hector): APDU's Le field could theoretically be 65536 (2^16), but
-// this overflows uint16 so it's unsupported by SetLe and GetLe.
-// It only happens in the case when Le has two bytes and both are 0 and in this
-// case GetLe returns 2^16 -1.
-
 // GetLe computes the actual Le value from the Le bytes. Le
 // indicates the maximum length of the data to be received Command
 // APDU and goes from 0 to 2^16. Note this method will return
 // 0 if it cannot make sense of the Le bytes.
-func (apdu *CAPDU) GetLe() uint16 {
+func (apdu *CAPDU) GetLe() int {
 	switch len(apdu.Le) {
 	case 0:
-		return uint16(0)
+		return 0
 	case 1:
 		n := apdu.Le[0]
 		if n == 0 {
-			return uint16(256)
+			return 256
 		}
-		return uint16(n)
+		return int(n)
 	case 2:
-		n0 := apdu.Le[0]
-		n1 := apdu.Le[1]
-		if n0 == 0 && n1 == 0 {
-			//return uint16(65536) // Overflow! FIXME!
-			return uint16(65535)
-		}
-		return helpers.BytesToUint16([2]byte{n0, n1})
+		return extendedLength(apdu.Le[0], apdu.Le[1])
 	case 3:
-		return helpers.BytesToUint16([2]byte{apdu.Le[1], apdu.Le[2]})
+		return extendedLength(apdu.Le[1], apdu.Le[2])
 	default:
 		return 0
 	}
 }
 
 // SetLe allows to easily set the value of the Le bytes making sure
-// they comply to the specification.
-func (apdu *CAPDU) SetLe(n uint16) {
-	if n == 0 {
+// they comply to the specification. Values outside the 0 to 2^16
+// range are ignored. Lc is re-encoded when needed, so that both
+// fields use either the short or the extended form.
+func (apdu *CAPDU) SetLe(n int) {
+	if n < 0 || n > 65536 {
+		return
+	}
+	apdu.setLengths(apdu.GetLc(), n)
+}
+
+// setLengths encodes the Lc and Le fields. ISO/IEC 7816-4 does not
+// allow mixing short and extended fields, so both use the extended
+// form when one of them needs it. An extended Le takes 2 bytes after
+// an extended Lc and 3 bytes otherwise.
+func (apdu *CAPDU) setLengths(lc, le int) {
+	extended := lc > 255 || le > 256
+
+	lcBytes := helpers.Uint16ToBytes(uint16(lc))
+	switch {
+	case lc == 0:
+		apdu.Lc = []byte{}
+	case !extended:
+		apdu.Lc = []byte{byte(lc)}
+	default:
+		apdu.Lc = []byte{0x00, lcBytes[0], lcBytes[1]}
+	}
+
+	// 256 is coded as 00h and 65536 as 0000h
+	leBytes := helpers.Uint16ToBytes(uint16(le))
+	switch {
+	case le == 0:
 		apdu.Le = []byte{}
-	} else if 1 <= n && n <= 255 {
-		apdu.Le = []byte{byte(n)}
-	} else if n == 256 {
-		apdu.Le = []byte{byte(0)}
-	} else {
-		nBytes := helpers.Uint16ToBytes(n)
-		if len(apdu.Lc) > 0 { // Make it 2 bytes
-			apdu.Le = []byte{nBytes[0], nBytes[1]}
-		} else { // 3 bytes then
-			apdu.Le = []byte{0, nBytes[0], nBytes[1]}
-		}
+	case !extended:
+		apdu.Le = []byte{byte(le)}
+	case lc > 0:
+		apdu.Le = []byte{leBytes[0], leBytes[1]}
+	default:
+		apdu.Le = []byte{0x00, leBytes[0], leBytes[1]}
 	}
 }
 
+// extendedLength decodes the last two bytes of an extended Le
+// field, where 0000h means 2^16.
+func extendedLength(b1, b2 byte) int {
+	if b1 == 0 && b2 == 0 {
+		return 65536
+	}
+	return int(helpers.BytesToUint16([2]byte{b1, b2}))
+}
+
 // Check ensures that a CAPDU struct fields are in-line with the
 // specification.
 // This mostly means checking that Lc, Data, Le fields look ok.
@@ -208,7 +236,7 @@ func (apdu *CAPDU) check() error {
 			"APDU Le cannot have more 3 bytes")
 	}
 
-	if int(apdu.GetLc()) != len(apdu.Data) {
+	if apdu.GetLc() != len(apdu.Data) {
 		return errors.New("CAPDU.Check: " +
 			"APDU Lc value is differs from the actual data length")
 	}
@@ -292,14 +320,14 @@ func (apdu *CAPDU) Unmarshal(buf []byte) (rLen int, err error) {
 		// B4 and B2 are the Lc bytes of the data field
 		// No byte is used for Le valued to 0
 		apdu.Lc = helpers.GetBytes(bytesBuf, 3)
-		apdu.Data = helpers.GetBytes(bytesBuf, int(apdu.GetLc()))
+		apdu.Data = helpers.GetBytes(bytesBuf, apdu.GetLc())
 	case bodyLen == (5+int(helpers.BytesToUint16([2]byte{b2, b3}))) && b1 == 0 && (b2|b3) != 0:
 		//Case 4E - L= 5 + (B2||B3),(B1)=0 and (B2||B3)=0
 		// The Lc field consists of the first 3 bytes where B2 and B3 code Lc (!=0) valued from 1 to 65535
 		//B4 to Bl-2 are the Lc bytes of the data field
 		//The Le field consists of the last 2 bytes Bl-1 and Bl which code Le valued from 1 to 65536
 		apdu.Lc = helpers.GetBytes(bytesBuf, 3)
-		apdu.Data = helpers.GetBytes(bytesBuf, int(apdu.GetLc()))
+		apdu.Data = helpers.GetBytes(bytesBuf, apdu.GetLc())
 		apdu.Le = helpers.GetBytes(bytesBuf, 2)
 	}
 	rLen = len(buf) - bytesBuf.Len()
@@ -333,21 +361,28 @@ func (apdu *CAPDU) Marshal() ([]byte, error) {
 // which performs a Select operation by name with the NDEF
 // Application Name.
 func NewNDEFTagApplicationSelectAPDU() *CAPDU {
+	return NewSelectByNameAPDU([]byte{
+		0xD2,
+		0x76,
+		0x00,
+		0x00,
+		0x85,
+		0x01,
+		0x01}) // NDEF app name FIXME
+}
+
+// NewSelectByNameAPDU returns a new CAPDU which performs a Select
+// operation by name (DF name, usually an application identifier or
+// AID). The response may contain File Control Information (FCI).
+func NewSelectByNameAPDU(name []byte) *CAPDU {
 	cApdu := &CAPDU{
-		CLA: byte(0x00),
-		INS: byte(0xA4),
-		P1:  byte(0x04), // Select by name
-		P2:  byte(0x00), // First or only occurrence
-		Data: []byte{
-			0xD2,
-			0x76,
-			0x00,
-			0x00,
-			0x85,
-			0x01,
-			0x01}, // NDEF app name FIXME
+		CLA:  byte(0x00),
+		INS:  INSSelect,
+		P1:   byte(0x04), // Select by name
+		P2:   byte(0x00), // First or only occurrence
+		Data: name,
 	}
-	cApdu.SetLc(7)
+	cApdu.SetLc(len(name))
 	// This would set a single-byte Le to 0, meaning response data
 	// field might be present(and be up to 256 bytes according to Wikipedia)
 	cApdu.SetLe(256)
@@ -356,7 +391,7 @@ func NewNDEFTagApplicationSelectAPDU() *CAPDU {
 
 // NewReadBinaryAPDU returns a new CAPDU to perform a binary
 // read with the indicated offset and length.
-func NewReadBinaryAPDU(offset uint16, length uint16) *CAPDU {
+func NewReadBinaryAPDU(offset uint16, length int) *CAPDU {
 	offsetBytes := helpers.Uint16ToBytes(offset)
 	cApdu := &CAPDU{
 		CLA: byte(0x00),
@@ -370,16 +405,49 @@ func NewReadBinaryAPDU(offset uint16, length uint16) *CAPDU {
 
 // NewUpdateBinaryAPDU returns a new CAPDU to perform a binary
 // update operation with the provided data and offset.
+//
+// Up to 255 bytes of data can be sent in a short APDU. For larger
+// data, the extended-length variant (NewExtendedUpdateBinaryAPDU) is
+// returned instead, which only works with tags supporting it.
 func NewUpdateBinaryAPDU(data []byte, offset uint16) *CAPDU {
+	if len(data) > 255 {
+		return NewExtendedUpdateBinaryAPDU(data, offset)
+	}
 	offsetBytes := helpers.Uint16ToBytes(offset)
 	cApdu := &CAPDU{
 		CLA:  byte(0x00),
-		INS:  byte(0xD6),
+		INS:  INSUpdate,
 		P1:   offsetBytes[0],
 		P2:   offsetBytes[1],
 		Data: data,
 	}
-	cApdu.SetLc(uint16(len(data)))
+	cApdu.SetLc(len(data))
+	return cApdu
+}
+
+// NewExtendedUpdateBinaryAPDU returns a new CAPDU to perform a binary
+// update operation with the provided data and offset, using an
+// extended Lc field (3 bytes). This allows to send up to 65535 bytes
+// of data to tags which support extended-length APDUs (that is,
+// which advertise a MLc larger than 255 bytes).
+//
+// Larger data cannot be described by the Lc field, which is then left
+// empty: the returned CAPDU fails to Marshal.
+func NewExtendedUpdateBinaryAPDU(data []byte, offset uint16) *CAPDU {
+	offsetBytes := helpers.Uint16ToBytes(offset)
+	cApdu := &CAPDU{
+		CLA:  byte(0x00),
+		INS:  INSUpdate,
+		P1:   offsetBytes[0],
+		P2:   offsetBytes[1],
+		Lc:   []byte{},
+		Data: data,
+		Le:   []byte{},
+	}
+	if len(data) <= 65535 {
+		lcBytes := helpers.Uint16ToBytes(uint16(len(data)))
+		cApdu.Lc = []byte{0x00, lcBytes[0], lcBytes[1]}
+	}
 	return cApdu
 }
 
@@ -398,6 +466,83 @@ func NewSelectAPDU(fileID uint16) *CAPDU {
 	return cApdu
 }
 
+// NewGetResponseAPDU returns a new CAPDU to retrieve the
+// length bytes of response data which are still available
+// after a response with SW1 = 61h.
+func NewGetResponseAPDU(length int) *CAPDU {
+	cApdu := &CAPDU{
+		CLA: byte(0x00),
+		INS: INSGetResponse,
+		P1:  byte(0x00),
+		P2:  byte(0x00),
+	}
+	cApdu.SetLe(length)
+	return cApdu
+}
+
+// NewEnvelopeAPDU returns a new CAPDU to perform an ENVELOPE
+// operation carrying the provided data, which is usually a piece
+// of another command. Data should not be larger than 255 bytes.
+// The response to the tunneled command is obtained with GET RESPONSE
+// when the tag indicates that it is available (SW1 = 61h).
+func NewEnvelopeAPDU(data []byte) *CAPDU {
+	cApdu := &CAPDU{
+		CLA:  byte(0x00),
+		INS:  INSEnvelope,
+		P1:   byte(0x00),
+		P2:   byte(0x00),
+		Data: data,
+	}
+	cApdu.SetLc(len(data))
+	return cApdu
+}
+
+// NewEnvelopeAPDUs tunnels a command in a chain of ENVELOPE commands
+// using short APDUs. This allows to send extended-length commands
+// through drivers or tags which only support short frames.
+//
+// The command is serialized and split into pieces of 255 bytes at
+// most. All the ENVELOPE commands but the last one have the
+// CLAChaining bit set. It returns an error if the command cannot
+// be serialized.
+func NewEnvelopeAPDUs(cApdu *CAPDU) ([]*CAPDU, error) {
+	cApduBytes, err := cApdu.Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	var envelopes []*CAPDU
+	for len(cApduBytes) > 0 {
+		n := len(cApduBytes)
+		if n > 255 {
+			n = 255
+		}
+		envelope := NewEnvelopeAPDU(cApduBytes[:n])
+		cApduBytes = cApduBytes[n:]
+		if len(cApduBytes) > 0 {
+			envelope.CLA |= CLAChaining
+		}
+		envelopes = append(envelopes, envelope)
+	}
+	return envelopes, nil
+}
+
+// NewVerifyAPDU returns a new CAPDU to perform a VERIFY
+// operation, which presents the password with the given ID
+// (P1-P2) to the tag in order to gain access to protected files.
+func NewVerifyAPDU(passwordID uint16, password []byte) *CAPDU {
+	idBytes := helpers.Uint16ToBytes(passwordID)
+	cApdu := &CAPDU{
+		CLA:  byte(0x00),
+		INS:  INSVerify,
+		P1:   idBytes[0],
+		P2:   idBytes[1],
+		Data: password,
+	}
+	cApdu.SetLc(len(password))
+	return cApdu
+}
+
 // BUG(hector): Capability Containers with more than 15 bytes (because
 // they include optional TLV fields), will fail, as we only read
 // 15 bytes and the CCLEN will not match the parsed data size.
@@ -25,7 +25,7 @@ import (
 func TestGetLc(t *testing.T) {
 	testcases := []struct {
 		Lc       []byte
-		Expected uint16
+		Expected int
 	}{
 		{[]byte{}, 0},
 		{[]byte{253}, 253},
@@ -44,7 +44,7 @@ func TestGetLc(t *testing.T) {
 }
 
 func TestSetLc(t *testing.T) {
-	testcases := []uint16{0, 1, 255, 256, 0xFFFF}
+	testcases := []int{0, 1, 255, 256, 0xFFFF}
 	for _, c := range testcases {
 		apdu := &CAPDU{}
 		apdu.SetLc(c)
@@ -58,13 +58,15 @@ func TestSetLc(t *testing.T) {
 func TestGetLe(t *testing.T) {
 	testcases := []struct {
 		Le       []byte
-		Expected uint16
+		Expected int
 	}{
 		{[]byte{}, 0},
 		{[]byte{0}, 256},
 		{[]byte{1}, 1},
 		{[]byte{0xFF, 0xFE}, 65534},
 		{[]byte{0x00, 0xFF, 0xFE}, 65534},
+		{[]byte{0x00, 0x00}, 65536},
+		{[]byte{0x00, 0x00, 0x00}, 65536},
 	}
 
 	for _, c := range testcases {
@@ -79,7 +81,7 @@ func TestGetLe(t *testing.T) {
 }
 
 func TestSetLe(t *testing.T) {
-	testcases := []uint16{0, 1, 256, 65535}
+	testcases := []int{0, 1, 256, 65535, 65536}
 	for _, c := range testcases {
 		apdu := &CAPDU{}
 		apdu.SetLe(c)
@@ -96,6 +98,9 @@ func TestSetLe(t *testing.T) {
 	if len(apdu.Le) != 2 {
 		t.Error("apdu.Le should use 2 bytes in APDUs with Lc")
 	}
+	if len(apdu.Lc) != 3 || apdu.GetLc() != 54 {
+		t.Error("apdu.Lc should use 3 bytes with an extended Le")
+	}
 
 	apdu.SetLc(0)
 	apdu.SetLe(2222)
@@ -104,6 +109,51 @@ func TestSetLe(t *testing.T) {
 	}
 }
 
+func TestSetLcSetLe_extended(t *testing.T) {
+	// Short and extended fields are never mixed, whatever the order
+	// in which Lc and Le are set.
+	testcases := []struct {
+		lc, le   int
+		lcFirst  bool
+		expected []byte
+	}{
+		{54, 2222, true, []byte{0x00, 0x00, 0x36, 0x08, 0xAE}},
+		{54, 2222, false, []byte{0x00, 0x00, 0x36, 0x08, 0xAE}},
+		{300, 16, true, []byte{0x00, 0x01, 0x2C, 0x00, 0x10}},
+		{300, 16, false, []byte{0x00, 0x01, 0x2C, 0x00, 0x10}},
+		{54, 256, false, []byte{0x36, 0x00}},
+		{0, 65536, false, []byte{0x00, 0x00, 0x00}},
+		{1, 65536, true, []byte{0x00, 0x00, 0x01, 0x00, 0x00}},
+	}
+	for i, tc := range testcases {
+		apdu := &CAPDU{}
+		if tc.lcFirst {
+			apdu.SetLc(tc.lc)
+			apdu.SetLe(tc.le)
+		} else {
+			apdu.SetLe(tc.le)
+			apdu.SetLc(tc.lc)
+		}
+		lengths := append(append([]byte{}, apdu.Lc...), apdu.Le...)
+		if !bytes.Equal(lengths, tc.expected) {
+			t.Errorf("%d: expected % 02X. Got % 02X", i, tc.expected, lengths)
+		}
+		if apdu.GetLc() != tc.lc || apdu.GetLe() != tc.le {
+			t.Errorf("%d: expected Lc %d and Le %d. Got %d and %d",
+				i, tc.lc, tc.le, apdu.GetLc(), apdu.GetLe())
+		}
+	}
+
+	// Dropping the extended Lc makes Le short again
+	apdu := &CAPDU{}
+	apdu.SetLc(300)
+	apdu.SetLe(16)
+	apdu.SetLc(0)
+	if !bytes.Equal(apdu.Le, []byte{0x10}) {
+		t.Errorf("expected a short Le. Got % 02X", apdu.Le)
+	}
+}
+
 func TestCAPDUMarshalUnmarshal(t *testing.T) {
 	testcases := []struct {
 		Input    []byte
@@ -341,3 +391,97 @@ func TestCAPDUMarshalBad(t *testing.T) {
 		}
 	}
 }
+
+func TestNewGetResponseAPDU(t *testing.T) {
+	capdu := NewGetResponseAPDU(8)
+	capduBytes, err := capdu.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []byte{0x00, 0xC0, 0x00, 0x00, 0x08}
+	if !bytes.Equal(capduBytes, expected) {
+		t.Errorf("Expected % 02X. Got % 02X", expected, capduBytes)
+	}
+}
+
+func TestNewVerifyAPDU(t *testing.T) {
+	capdu := NewVerifyAPDU(0x0002, []byte{0x01, 0x02, 0x03})
+	capduBytes, err := capdu.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []byte{0x00, 0x20, 0x00, 0x02, 0x03, 0x01, 0x02, 0x03}
+	if !bytes.Equal(capduBytes, expected) {
+		t.Errorf("Expected % 02X. Got % 02X", expected, capduBytes)
+	}
+}
+
+func TestNewUpdateBinaryAPDU(t *testing.T) {
+	capdu := NewUpdateBinaryAPDU([]byte{0x01, 0x02}, 0x0010)
+	if len(capdu.Lc) != 1 {
+		t.Error("short data should use a short Lc")
+	}
+
+	capdu = NewExtendedUpdateBinaryAPDU([]byte{0x01, 0x02}, 0x0010)
+	capduBytes, err := capdu.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []byte{0x00, 0xD6, 0x00, 0x10, 0x00, 0x00, 0x02, 0x01, 0x02}
+	if !bytes.Equal(capduBytes, expected) {
+		t.Errorf("Expected % 02X. Got % 02X", expected, capduBytes)
+	}
+
+	capdu = NewUpdateBinaryAPDU(make([]byte, 300), 0x0010)
+	if len(capdu.Lc) != 3 || capdu.GetLc() != 300 {
+		t.Error("large data should use an extended Lc")
+	}
+	if _, err := capdu.Marshal(); err != nil {
+		t.Error(err)
+	}
+
+	capdu = NewUpdateBinaryAPDU(make([]byte, 65537), 0x0010)
+	if len(capdu.Lc) != 0 {
+		t.Errorf("expected no Lc. Got % 02X", capdu.Lc)
+	}
+	if _, err := capdu.Marshal(); err == nil {
+		t.Error("data larger than 65535 bytes should not marshal")
+	}
+}
+
+func TestNewEnvelopeAPDUs(t *testing.T) {
+	capdu := NewUpdateBinaryAPDU(make([]byte, 300), 0x0010)
+	capduBytes, err := capdu.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	envelopes, err := NewEnvelopeAPDUs(capdu)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(envelopes) != 2 {
+		t.Fatal("expected 2 envelopes. Got", len(envelopes))
+	}
+	if envelopes[0].CLA != CLAChaining || envelopes[1].CLA != 0x00 {
+		t.Error("only the first envelope should have the chaining bit")
+	}
+
+	var tunneled []byte
+	for _, e := range envelopes {
+		if e.INS != INSEnvelope {
+			t.Error("expected ENVELOPE instruction")
+		}
+		b, err := e.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(b) > 5+255 {
+			t.Error("envelopes should be short APDUs")
+		}
+		tunneled = append(tunneled, e.Data...)
+	}
+	if !bytes.Equal(tunneled, capduBytes) {
+		t.Error("envelopes do not carry the original command")
+	}
+}
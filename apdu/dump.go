@@ -0,0 +1,141 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package apdu
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hsanjuan/go-nfctype4/helpers"
+)
+
+// insNames holds the names of the instructions known by this package.
+var insNames = map[byte]string{
+	INSSelect:      "SELECT",
+	INSRead:        "READ BINARY",
+	INSReadODO:     "READ BINARY (ODO)",
+	INSUpdate:      "UPDATE BINARY",
+	INSUpdateODO:   "UPDATE BINARY (ODO)",
+	INSGetResponse: "GET RESPONSE",
+	INSVerify:      "VERIFY",
+	INSEnvelope:    "ENVELOPE",
+}
+
+// aidNames holds the names of well-known application identifiers.
+var aidNames = map[string]string{
+	"D2760000850100": "NDEF Tag Application v1",
+	"D2760000850101": "NDEF Tag Application",
+}
+
+// fileNames holds the names of well-known file identifiers.
+var fileNames = map[uint16]string{
+	0xE103: "Capability Container",
+}
+
+// Dump provides a decoded, human-readable view of the CAPDU, which
+// includes the name of the instruction, its parameters (offsets, file
+// IDs, AIDs...) and the Lc and Le values. It is meant for debugging.
+//
+// The data of VERIFY commands (the password) is not shown.
+func (apdu *CAPDU) Dump() string {
+	name, ok := insNames[apdu.INS]
+	if !ok {
+		name = "UNKNOWN"
+	}
+	parts := []string{
+		fmt.Sprintf("%s (%02X)", name, apdu.INS),
+		fmt.Sprintf("CLA: %02X", apdu.CLA),
+	}
+	p1p2 := helpers.BytesToUint16([2]byte{apdu.P1, apdu.P2})
+	showData := true
+
+	switch apdu.INS {
+	case INSSelect:
+		switch apdu.P1 {
+		case 0x00:
+			if len(apdu.Data) == 2 {
+				id := helpers.BytesToUint16([2]byte{apdu.Data[0], apdu.Data[1]})
+				parts = append(parts, "file ID: "+withName(
+					fmt.Sprintf("%04X", id), fileNames[id]))
+				showData = false
+			}
+		case 0x04:
+			aid := hexString(apdu.Data)
+			parts = append(parts, "AID: "+withName(aid, aidNames[aid]))
+			showData = false
+		default:
+			parts = append(parts, fmt.Sprintf("P1: %02X", apdu.P1))
+		}
+		parts = append(parts, fmt.Sprintf("P2: %02X", apdu.P2))
+	case INSRead, INSUpdate:
+		parts = append(parts, fmt.Sprintf("offset: %d", p1p2))
+	case INSReadODO, INSUpdateODO:
+		offset, rest, err := ParseOffsetDataObject(apdu.Data)
+		if err != nil {
+			break
+		}
+		parts = append(parts, fmt.Sprintf("offset: %d", offset))
+		if apdu.INS == INSUpdateODO {
+			parts = append(parts, "Data: "+hexString(rest))
+			showData = false
+		}
+	case INSVerify:
+		parts = append(parts, fmt.Sprintf("password ID: %04X", p1p2))
+		if len(apdu.Data) > 0 {
+			parts = append(parts, fmt.Sprintf("password: %d bytes",
+				len(apdu.Data)))
+		}
+		showData = false
+	default:
+		parts = append(parts,
+			fmt.Sprintf("P1: %02X", apdu.P1),
+			fmt.Sprintf("P2: %02X", apdu.P2))
+	}
+
+	if len(apdu.Lc) > 0 {
+		parts = append(parts, fmt.Sprintf("Lc: %d", apdu.GetLc()))
+	}
+	if showData && len(apdu.Data) > 0 {
+		parts = append(parts, "Data: "+hexString(apdu.Data))
+	}
+	if len(apdu.Le) > 0 {
+		parts = append(parts, fmt.Sprintf("Le: %d", apdu.GetLe()))
+	}
+	return strings.Join(parts, " | ")
+}
+
+// Dump provides a decoded, human-readable view of the RAPDU, which
+// includes the meaning of the status word. It is meant for debugging.
+func (apdu *RAPDU) Dump() string {
+	str := fmt.Sprintf("SW: %04X (%s)",
+		apdu.Status(),
+		StatusDescription(apdu.SW1, apdu.SW2))
+	if len(apdu.ResponseBody) > 0 {
+		str += fmt.Sprintf(" | Data (%d bytes): %s",
+			len(apdu.ResponseBody),
+			hexString(apdu.ResponseBody))
+	}
+	return str
+}
+
+func withName(value, name string) string {
+	if name == "" {
+		return value
+	}
+	return fmt.Sprintf("%s (%s)", value, name)
+}
@@ -0,0 +1,68 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package apdu
+
+import (
+	"testing"
+)
+
+func TestCAPDUDump(t *testing.T) {
+	updateODO := NewUpdateBinaryODOAPDU([]byte{0xAA, 0xBB}, 0x8000)
+	testcases := []struct {
+		capdu    *CAPDU
+		expected string
+	}{
+		{
+			NewNDEFTagApplicationSelectAPDU(),
+			"SELECT (A4) | CLA: 00 | AID: D2760000850101 (NDEF Tag Application) | P2: 00 | Lc: 7 | Le: 256",
+		},
+		{
+			NewSelectAPDU(0xE103),
+			"SELECT (A4) | CLA: 00 | file ID: E103 (Capability Container) | P2: 0C | Lc: 2",
+		},
+		{
+			NewReadBinaryAPDU(2, 300),
+			"READ BINARY (B0) | CLA: 00 | offset: 2 | Le: 300",
+		},
+		{
+			updateODO,
+			"UPDATE BINARY (ODO) (D7) | CLA: 00 | offset: 32768 | Data: 5302AABB | Lc: 9",
+		},
+		{
+			NewVerifyAPDU(0x0001, []byte{0x01, 0x02}),
+			"VERIFY (20) | CLA: 00 | password ID: 0001 | password: 2 bytes | Lc: 2",
+		},
+		{
+			&CAPDU{CLA: 0x90, INS: 0x60},
+			"UNKNOWN (60) | CLA: 90 | P1: 00 | P2: 00",
+		},
+	}
+	for _, c := range testcases {
+		if d := c.capdu.Dump(); d != c.expected {
+			t.Errorf("expected:\n%s\nGot:\n%s", c.expected, d)
+		}
+	}
+}
+
+func TestRAPDUDump(t *testing.T) {
+	rapdu := NewRAPDUEndOfFile([]byte{0x01, 0x02})
+	expected := "SW: 6282 (end of file reached before reading Le bytes) | Data (2 bytes): 0102"
+	if d := rapdu.Dump(); d != expected {
+		t.Errorf("expected:\n%s\nGot:\n%s", expected, d)
+	}
+}
@@ -0,0 +1,72 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package apdu
+
+import (
+	"testing"
+)
+
+// Fuzz targets for the parsing functions, which process bytes
+// coming from the tags. They must never panic, whatever the input.
+// Run them with "go test -fuzz FuzzCAPDUUnmarshal", for example.
+
+func FuzzCAPDUUnmarshal(f *testing.F) {
+	f.Add([]byte{0x00, 0xA4, 0x00, 0x0C, 0x02, 0xE1, 0x03})
+	f.Add([]byte{0x00, 0xB0, 0x00, 0x00, 0x00, 0x01, 0x00})
+	f.Add([]byte{0x00, 0xD6, 0x00, 0x00, 0x00, 0x00, 0x01, 0xAA, 0x01, 0x00})
+	f.Add([]byte{0x00})
+	f.Fuzz(func(t *testing.T, buf []byte) {
+		capdu := new(CAPDU)
+		if _, err := capdu.Unmarshal(buf); err != nil {
+			return
+		}
+		if _, err := capdu.Marshal(); err != nil {
+			t.Error("a parsed CAPDU should be serializable:", err)
+		}
+		capdu.GetLc()
+		capdu.GetLe()
+		_ = capdu.String()
+	})
+}
+
+func FuzzRAPDUUnmarshal(f *testing.F) {
+	f.Add([]byte{0x90, 0x00})
+	f.Add([]byte{0x01, 0x02, 0x62, 0x82})
+	f.Add([]byte{0x90})
+	f.Fuzz(func(t *testing.T, buf []byte) {
+		rapdu := new(RAPDU)
+		if _, err := rapdu.Unmarshal(buf); err != nil {
+			return
+		}
+		_ = rapdu.String()
+		StatusDescription(rapdu.SW1, rapdu.SW2)
+	})
+}
+
+func FuzzParseOffsetDataObject(f *testing.F) {
+	f.Add([]byte{0x54, 0x03, 0x00, 0x80, 0x00, 0x53, 0x01, 0xAA})
+	f.Add([]byte{0x54, 0x83, 0xFF, 0xFF, 0xFF})
+	f.Add([]byte{0x53, 0x82, 0x01})
+	f.Fuzz(func(t *testing.T, buf []byte) {
+		_, rest, err := ParseOffsetDataObject(buf)
+		if err != nil {
+			return
+		}
+		UnmarshalDataObject(rest)
+	})
+}
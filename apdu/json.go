@@ -0,0 +1,198 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package apdu
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Exchange holds a Command APDU and the Response APDU obtained
+// for it. Lists of exchanges (transcripts) can be serialized to JSON
+// to persist, compare and replay the communication with a tag.
+type Exchange struct {
+	Command  *CAPDU `json:"command"`
+	Response *RAPDU `json:"response"`
+}
+
+// capduJSON is the JSON representation of a CAPDU. All fields are
+// hex-encoded.
+type capduJSON struct {
+	CLA  string `json:"cla"`
+	INS  string `json:"ins"`
+	P1   string `json:"p1"`
+	P2   string `json:"p2"`
+	Lc   string `json:"lc,omitempty"`
+	Data string `json:"data,omitempty"`
+	Le   string `json:"le,omitempty"`
+}
+
+// rapduJSON is the JSON representation of a RAPDU. All fields are
+// hex-encoded.
+type rapduJSON struct {
+	Data string `json:"data,omitempty"`
+	SW1  string `json:"sw1"`
+	SW2  string `json:"sw2"`
+}
+
+// MarshalJSON returns the JSON representation of the CAPDU, where
+// every field is hex-encoded.
+func (apdu *CAPDU) MarshalJSON() ([]byte, error) {
+	return json.Marshal(capduJSON{
+		CLA:  hexString([]byte{apdu.CLA}),
+		INS:  hexString([]byte{apdu.INS}),
+		P1:   hexString([]byte{apdu.P1}),
+		P2:   hexString([]byte{apdu.P2}),
+		Lc:   hexString(apdu.Lc),
+		Data: hexString(apdu.Data),
+		Le:   hexString(apdu.Le),
+	})
+}
+
+// UnmarshalJSON parses the JSON representation of a CAPDU, as
+// produced by MarshalJSON. It returns an error if the fields cannot
+// be decoded or the CAPDU is not valid.
+func (apdu *CAPDU) UnmarshalJSON(buf []byte) error {
+	var j capduJSON
+	if err := json.Unmarshal(buf, &j); err != nil {
+		return err
+	}
+	apdu.Reset()
+	var err error
+	if apdu.CLA, err = hexByte(j.CLA, "cla"); err != nil {
+		return err
+	}
+	if apdu.INS, err = hexByte(j.INS, "ins"); err != nil {
+		return err
+	}
+	if apdu.P1, err = hexByte(j.P1, "p1"); err != nil {
+		return err
+	}
+	if apdu.P2, err = hexByte(j.P2, "p2"); err != nil {
+		return err
+	}
+	if apdu.Lc, err = hexBytes(j.Lc, "lc"); err != nil {
+		return err
+	}
+	if apdu.Data, err = hexBytes(j.Data, "data"); err != nil {
+		return err
+	}
+	if apdu.Le, err = hexBytes(j.Le, "le"); err != nil {
+		return err
+	}
+	return apdu.check()
+}
+
+// MarshalText returns the compact text representation of the CAPDU:
+// its serialized bytes in hexadecimal (i.e. "00A4000C02E103").
+func (apdu *CAPDU) MarshalText() ([]byte, error) {
+	b, err := apdu.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	return []byte(hexString(b)), nil
+}
+
+// UnmarshalText parses the compact text representation of a CAPDU,
+// as produced by MarshalText.
+func (apdu *CAPDU) UnmarshalText(text []byte) error {
+	b, err := hexBytes(string(text), "CAPDU")
+	if err != nil {
+		return err
+	}
+	_, err = apdu.Unmarshal(b)
+	return err
+}
+
+// MarshalJSON returns the JSON representation of the RAPDU, where
+// every field is hex-encoded.
+func (apdu *RAPDU) MarshalJSON() ([]byte, error) {
+	return json.Marshal(rapduJSON{
+		Data: hexString(apdu.ResponseBody),
+		SW1:  hexString([]byte{apdu.SW1}),
+		SW2:  hexString([]byte{apdu.SW2}),
+	})
+}
+
+// UnmarshalJSON parses the JSON representation of a RAPDU, as
+// produced by MarshalJSON.
+func (apdu *RAPDU) UnmarshalJSON(buf []byte) error {
+	var j rapduJSON
+	if err := json.Unmarshal(buf, &j); err != nil {
+		return err
+	}
+	apdu.Reset()
+	var err error
+	if apdu.ResponseBody, err = hexBytes(j.Data, "data"); err != nil {
+		return err
+	}
+	if apdu.SW1, err = hexByte(j.SW1, "sw1"); err != nil {
+		return err
+	}
+	if apdu.SW2, err = hexByte(j.SW2, "sw2"); err != nil {
+		return err
+	}
+	return nil
+}
+
+// MarshalText returns the compact text representation of the RAPDU:
+// its serialized bytes in hexadecimal (i.e. "9000").
+func (apdu *RAPDU) MarshalText() ([]byte, error) {
+	b, err := apdu.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	return []byte(hexString(b)), nil
+}
+
+// UnmarshalText parses the compact text representation of a RAPDU,
+// as produced by MarshalText.
+func (apdu *RAPDU) UnmarshalText(text []byte) error {
+	b, err := hexBytes(string(text), "RAPDU")
+	if err != nil {
+		return err
+	}
+	_, err = apdu.Unmarshal(b)
+	return err
+}
+
+func hexString(b []byte) string {
+	return strings.ToUpper(hex.EncodeToString(b))
+}
+
+func hexBytes(s string, field string) ([]byte, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("APDU: bad hex value for %s: %s",
+			field, err)
+	}
+	return b, nil
+}
+
+func hexByte(s string, field string) (byte, error) {
+	b, err := hexBytes(s, field)
+	if err != nil {
+		return 0, err
+	}
+	if len(b) != 1 {
+		return 0, fmt.Errorf("APDU: %s should be a single byte", field)
+	}
+	return b[0], nil
+}
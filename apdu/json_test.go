@@ -0,0 +1,111 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package apdu
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestCAPDUJSON(t *testing.T) {
+	capdu := NewUpdateBinaryAPDU([]byte{0x01, 0x02}, 0x0010)
+	b, err := json.Marshal(capdu)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"cla":"00","ins":"D6","p1":"00","p2":"10","lc":"02","data":"0102"}`
+	if string(b) != expected {
+		t.Errorf("expected %s. Got %s", expected, b)
+	}
+
+	capdu2 := new(CAPDU)
+	if err := json.Unmarshal(b, capdu2); err != nil {
+		t.Fatal(err)
+	}
+	b1, _ := capdu.Marshal()
+	b2, _ := capdu2.Marshal()
+	if !bytes.Equal(b1, b2) {
+		t.Errorf("expected % 02X. Got % 02X", b1, b2)
+	}
+
+	bad := []string{
+		`{"cla":"0","ins":"D6","p1":"00","p2":"10"}`,
+		`{"cla":"0000","ins":"D6","p1":"00","p2":"10"}`,
+		`{"cla":"00","ins":"D6","p1":"00","p2":"10","lc":"03","data":"0102"}`,
+	}
+	for _, c := range bad {
+		if err := json.Unmarshal([]byte(c), capdu2); err == nil {
+			t.Error("expected an error for", c)
+		}
+	}
+}
+
+func TestRAPDUJSON(t *testing.T) {
+	rapdu := &RAPDU{
+		ResponseBody: []byte{0xAB},
+		SW1:          0x62,
+		SW2:          0x82,
+	}
+	b, err := json.Marshal(rapdu)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"data":"AB","sw1":"62","sw2":"82"}`
+	if string(b) != expected {
+		t.Errorf("expected %s. Got %s", expected, b)
+	}
+	rapdu2 := new(RAPDU)
+	if err := json.Unmarshal(b, rapdu2); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(rapdu2.ResponseBody, rapdu.ResponseBody) ||
+		rapdu2.Status() != rapdu.Status() {
+		t.Error("unexpected RAPDU:", rapdu2)
+	}
+}
+
+func TestAPDUText(t *testing.T) {
+	capdu := NewSelectAPDU(0xE103)
+	text, err := capdu.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(text) != "00A4000C02E103" {
+		t.Error("unexpected text:", string(text))
+	}
+	capdu2 := new(CAPDU)
+	if err := capdu2.UnmarshalText([]byte("00a4000c02e103")); err != nil {
+		t.Fatal(err)
+	}
+	if capdu2.GetLc() != 2 || capdu2.Data[1] != 0x03 {
+		t.Error("unexpected CAPDU:", capdu2)
+	}
+
+	rapdu := new(RAPDU)
+	if err := rapdu.UnmarshalText([]byte("0102900")); err == nil {
+		t.Error("odd hex strings should fail")
+	}
+	if err := rapdu.UnmarshalText([]byte("01029000")); err != nil {
+		t.Fatal(err)
+	}
+	text, _ = rapdu.MarshalText()
+	if string(text) != "01029000" {
+		t.Error("unexpected text:", string(text))
+	}
+}
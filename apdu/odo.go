@@ -0,0 +1,175 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package apdu
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/hsanjuan/go-nfctype4/helpers"
+)
+
+// Tags of the data objects used by the ReadBinary and UpdateBinary
+// commands with odd instruction bytes (ISO/IEC 7816-4).
+const (
+	TagOffsetDataObject        = byte(0x54)
+	TagDiscretionaryDataObject = byte(0x53)
+)
+
+// MaxOffset is the largest offset which can be coded in P1-P2 for
+// the ReadBinary and UpdateBinary commands with even instruction
+// bytes. Larger offsets need an offset data object (ODO).
+const MaxOffset = 0x7FFF
+
+// MarshalDataObject returns the byte slice representation of a
+// simple BER-TLV data object with the given tag and value.
+func MarshalDataObject(tag byte, value []byte) []byte {
+	var buffer bytes.Buffer
+	buffer.WriteByte(tag)
+	n := len(value)
+	switch {
+	case n < 0x80:
+		buffer.WriteByte(byte(n))
+	case n <= 0xFF:
+		buffer.WriteByte(0x81)
+		buffer.WriteByte(byte(n))
+	case n <= 0xFFFF:
+		buffer.WriteByte(0x82)
+		nBytes := helpers.Uint16ToBytes(uint16(n))
+		buffer.Write(nBytes[:])
+	default:
+		buffer.WriteByte(0x83)
+		buffer.WriteByte(byte(n >> 16))
+		buffer.WriteByte(byte(n >> 8))
+		buffer.WriteByte(byte(n))
+	}
+	buffer.Write(value)
+	return buffer.Bytes()
+}
+
+// UnmarshalDataObject parses a simple BER-TLV data object from the
+// start of a byte slice. It returns the tag, the value and the number
+// of bytes parsed, or an error if the data object is malformed.
+func UnmarshalDataObject(buf []byte) (tag byte, value []byte, rLen int, err error) {
+	defer helpers.HandleErrorPanic(&err, "UnmarshalDataObject")
+	bytesBuf := bytes.NewBuffer(buf)
+	tag = helpers.GetByte(bytesBuf)
+	l0 := helpers.GetByte(bytesBuf)
+	n := 0
+	switch {
+	case l0 < 0x80:
+		n = int(l0)
+	case l0 >= 0x81 && l0 <= 0x83:
+		for _, b := range helpers.GetBytes(bytesBuf, int(l0&0x0F)) {
+			n = n<<8 | int(b)
+		}
+	default:
+		return tag, nil, 2, fmt.Errorf("UnmarshalDataObject: "+
+			"unsupported length byte %02xh", l0)
+	}
+	value = helpers.GetBytes(bytesBuf, n)
+	return tag, value, len(buf) - bytesBuf.Len(), nil
+}
+
+// DataObjectOverhead returns how many bytes, besides the value itself,
+// are needed to serialize a data object with a value of n bytes.
+func DataObjectOverhead(n int) int {
+	switch {
+	case n < 0x80:
+		return 2
+	case n <= 0xFF:
+		return 3
+	case n <= 0xFFFF:
+		return 4
+	default:
+		return 5
+	}
+}
+
+// ParseOffsetDataObject extracts the offset from the data field of a
+// ReadBinary or UpdateBinary command with odd instruction byte. It
+// returns the offset and the rest of the data field (which carries the
+// discretionary data object in the UpdateBinary case).
+func ParseOffsetDataObject(data []byte) (offset uint32, rest []byte, err error) {
+	tag, value, rLen, err := UnmarshalDataObject(data)
+	if err != nil {
+		return 0, nil, err
+	}
+	if tag != TagOffsetDataObject {
+		return 0, nil, errors.New("ParseOffsetDataObject: " +
+			"offset data object not found")
+	}
+	if len(value) == 0 || len(value) > 3 {
+		return 0, nil, errors.New("ParseOffsetDataObject: " +
+			"offset must be coded in 1 to 3 bytes")
+	}
+	for _, b := range value {
+		offset = offset<<8 | uint32(b)
+	}
+	return offset, data[rLen:], nil
+}
+
+// offsetDataObject returns the offset data object for the given
+// offset, which is always coded in 3 bytes.
+func offsetDataObject(offset uint32) []byte {
+	return MarshalDataObject(TagOffsetDataObject, []byte{
+		byte(offset >> 16),
+		byte(offset >> 8),
+		byte(offset)})
+}
+
+// NewReadBinaryODOAPDU returns a new CAPDU to perform a binary
+// read on the currently selected file with the indicated offset and
+// length, using an offset data object (odd instruction byte). This
+// allows offsets beyond MaxOffset.
+//
+// The response data is wrapped in a discretionary data object, which
+// is accounted for in the Le field.
+func NewReadBinaryODOAPDU(offset uint32, length int) *CAPDU {
+	data := offsetDataObject(offset)
+	cApdu := &CAPDU{
+		CLA:  byte(0x00),
+		INS:  INSReadODO,
+		P1:   byte(0x00), // Current file
+		P2:   byte(0x00),
+		Data: data,
+	}
+	cApdu.SetLc(len(data))
+	cApdu.SetLe(length + DataObjectOverhead(length))
+	return cApdu
+}
+
+// NewUpdateBinaryODOAPDU returns a new CAPDU to perform a binary
+// update on the currently selected file with the provided data and
+// offset, using an offset data object (odd instruction byte). This
+// allows offsets beyond MaxOffset.
+func NewUpdateBinaryODOAPDU(data []byte, offset uint32) *CAPDU {
+	var buffer bytes.Buffer
+	buffer.Write(offsetDataObject(offset))
+	buffer.Write(MarshalDataObject(TagDiscretionaryDataObject, data))
+	cApdu := &CAPDU{
+		CLA:  byte(0x00),
+		INS:  INSUpdateODO,
+		P1:   byte(0x00), // Current file
+		P2:   byte(0x00),
+		Data: buffer.Bytes(),
+	}
+	cApdu.SetLc(buffer.Len())
+	return cApdu
+}
@@ -0,0 +1,78 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package apdu
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDataObjectMarshalUnmarshal(t *testing.T) {
+	testcases := []int{0, 1, 0x7F, 0x80, 0xFF, 0x100, 0x10000}
+	for _, c := range testcases {
+		value := make([]byte, c)
+		do := MarshalDataObject(TagDiscretionaryDataObject, value)
+		if len(do) != c+DataObjectOverhead(c) {
+			t.Errorf("%d: unexpected overhead", c)
+		}
+		tag, v, rLen, err := UnmarshalDataObject(do)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tag != TagDiscretionaryDataObject || len(v) != c || rLen != len(do) {
+			t.Errorf("%d: data object did not round-trip", c)
+		}
+	}
+
+	_, _, _, err := UnmarshalDataObject([]byte{0x53, 0x81})
+	if err == nil {
+		t.Error("truncated data object should fail to parse")
+	}
+}
+
+func TestNewReadBinaryODOAPDU(t *testing.T) {
+	capdu := NewReadBinaryODOAPDU(0x012345, 0x0F)
+	capduBytes, err := capdu.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []byte{0x00, 0xB1, 0x00, 0x00, 0x05, 0x54, 0x03, 0x01, 0x23, 0x45, 0x11}
+	if !bytes.Equal(capduBytes, expected) {
+		t.Errorf("Expected % 02X. Got % 02X", expected, capduBytes)
+	}
+
+	offset, rest, err := ParseOffsetDataObject(capdu.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if offset != 0x012345 || len(rest) != 0 {
+		t.Error("offset data object did not round-trip")
+	}
+}
+
+func TestNewUpdateBinaryODOAPDU(t *testing.T) {
+	capdu := NewUpdateBinaryODOAPDU([]byte{0xAA, 0xBB}, 0x8000)
+	capduBytes, err := capdu.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []byte{0x00, 0xD7, 0x00, 0x00, 0x09, 0x54, 0x03, 0x00, 0x80, 0x00, 0x53, 0x02, 0xAA, 0xBB}
+	if !bytes.Equal(capduBytes, expected) {
+		t.Errorf("Expected % 02X. Got % 02X", expected, capduBytes)
+	}
+}
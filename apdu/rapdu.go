@@ -33,6 +33,35 @@ const (
 	RAPDUInactiveState
 )
 
+// Category classifies the status words of Response APDUs as defined
+// in ISO/IEC 7816-4.
+type Category int
+
+// Response categories.
+const (
+	CategoryUnknown        Category = iota
+	CategoryNormal                  // 9000h, 61XXh
+	CategoryWarning                 // 62XXh, 63XXh
+	CategoryExecutionError          // 64XXh-66XXh
+	CategoryCheckingError           // 67XXh-6FXXh
+)
+
+// String returns the name of the category.
+func (c Category) String() string {
+	switch c {
+	case CategoryNormal:
+		return "normal processing"
+	case CategoryWarning:
+		return "warning"
+	case CategoryExecutionError:
+		return "execution error"
+	case CategoryCheckingError:
+		return "checking error"
+	default:
+		return "unknown"
+	}
+}
+
 // RAPDU represents a Response APDU, which is received as an answer to
 // Command APDUs. Response APDUs may contain data, along with two trailer
 // bytes indicating the status.
@@ -89,16 +118,113 @@ func (apdu *RAPDU) Marshal() ([]byte, error) {
 	return buffer.Bytes(), nil
 }
 
+// Status returns the status word (SW1-SW2) of the RAPDU, which can
+// be compared with the SW constants.
+func (apdu *RAPDU) Status() uint16 {
+	return uint16(apdu.SW1)<<8 | uint16(apdu.SW2)
+}
+
 // CommandCompleted checks if the RAPDU indicates a successful
 // completion of a command.
 func (apdu *RAPDU) CommandCompleted() bool {
-	return apdu.SW1 == 0x90 && apdu.SW2 == 0x00
+	return apdu.Status() == SWCommandCompleted
 }
 
 // FileNotFound checks if the RAPDU indicates that a file
 // was not found (usually in response to a Select operation).
 func (apdu *RAPDU) FileNotFound() bool {
-	return apdu.SW1 == 0x6A && apdu.SW2 == 0x82
+	return apdu.Status() == SWFileNotFound
+}
+
+// EndOfFile checks if the RAPDU indicates that the end of the file
+// was reached before reading Le bytes (warning 6282h). The response
+// body is still valid, but shorter than requested.
+func (apdu *RAPDU) EndOfFile() bool {
+	return apdu.Status() == SWEndOfFile
+}
+
+// WrongLe checks if the RAPDU indicates that the Le field of the
+// command was wrong (SW1 = 6Ch). In this case, SW2 holds the
+// exact number of available data bytes (see CorrectLe).
+func (apdu *RAPDU) WrongLe() bool {
+	return apdu.SW1 == 0x6C
+}
+
+// CorrectLe returns the Le value indicated by SW2 in responses
+// with a wrong Le (see WrongLe). A SW2 of 0 means 256 bytes.
+func (apdu *RAPDU) CorrectLe() int {
+	return apdu.sw2Length()
+}
+
+// MoreDataAvailable checks if the RAPDU indicates that more response
+// data is available (SW1 = 61h). It can be obtained with a GET RESPONSE
+// command with the length given by RemainingLe.
+func (apdu *RAPDU) MoreDataAvailable() bool {
+	return apdu.SW1 == 0x61
+}
+
+// RemainingLe returns the number of bytes still available as
+// indicated by SW2 (see MoreDataAvailable). A SW2 of 0 means 256
+// bytes or more.
+func (apdu *RAPDU) RemainingLe() int {
+	return apdu.sw2Length()
+}
+
+func (apdu *RAPDU) sw2Length() int {
+	if apdu.SW2 == 0 {
+		return 256
+	}
+	return int(apdu.SW2)
+}
+
+// Category returns the category of the RAPDU according to its
+// status word.
+func (apdu *RAPDU) Category() Category {
+	switch {
+	case apdu.Status() == SWCommandCompleted || apdu.SW1 == 0x61:
+		return CategoryNormal
+	case apdu.SW1 == 0x62 || apdu.SW1 == 0x63:
+		return CategoryWarning
+	case apdu.SW1 >= 0x64 && apdu.SW1 <= 0x66:
+		return CategoryExecutionError
+	case apdu.SW1 >= 0x67 && apdu.SW1 <= 0x6F:
+		return CategoryCheckingError
+	default:
+		return CategoryUnknown
+	}
+}
+
+// IsWarning checks if the RAPDU indicates a warning (SW1 = 62h or
+// 63h). The command was processed, but something may be off (i.e.
+// the end of the file was reached while reading).
+func (apdu *RAPDU) IsWarning() bool {
+	return apdu.Category() == CategoryWarning
+}
+
+// IsError checks if the RAPDU indicates an execution or a checking
+// error.
+func (apdu *RAPDU) IsError() bool {
+	c := apdu.Category()
+	return c == CategoryExecutionError || c == CategoryCheckingError
+}
+
+// IsWrongLength checks if the RAPDU indicates a wrong length, either
+// in general (6700h) or in the Le field (6CXXh, see WrongLe).
+func (apdu *RAPDU) IsWrongLength() bool {
+	return apdu.Status() == SWWrongLength || apdu.WrongLe()
+}
+
+// IsSecurityNotSatisfied checks if the RAPDU indicates that the
+// security status is not satisfied (6982h), usually because a
+// password must be verified first.
+func (apdu *RAPDU) IsSecurityNotSatisfied() bool {
+	return apdu.Status() == SWSecurityNotSatisfied
+}
+
+// IsMemoryFailure checks if the RAPDU indicates a memory failure
+// (6581h), usually when writing.
+func (apdu *RAPDU) IsMemoryFailure() bool {
+	return apdu.Status() == SWMemoryFailure
 }
 
 // NewRAPDU provides a quick way to obtain some commonly
@@ -107,25 +233,13 @@ func (apdu *RAPDU) FileNotFound() bool {
 func NewRAPDU(which int) *RAPDU {
 	switch which {
 	case RAPDUCommandCompleted:
-		return &RAPDU{
-			SW1: 0x90,
-			SW2: 0x00,
-		}
+		return NewRAPDUStatus(SWCommandCompleted)
 	case RAPDUCommandNotAllowed:
-		return &RAPDU{
-			SW1: 0x69,
-			SW2: 0x00,
-		}
+		return NewRAPDUStatus(SWCommandNotAllowed)
 	case RAPDUFileNotFound:
-		return &RAPDU{
-			SW1: 0x6A,
-			SW2: 0x82,
-		}
+		return NewRAPDUStatus(SWFileNotFound)
 	case RAPDUInactiveState:
-		return &RAPDU{
-			SW1: 0x69,
-			SW2: 0x01,
-		}
+		return NewRAPDUStatus(SWInactiveState)
 	}
 	return nil
 }
@@ -40,6 +40,20 @@ func TestRAPDUMarshalUnmarshal(t *testing.T) {
 
 }
 
+func TestRAPDUUnmarshalShort(t *testing.T) {
+	testcases := [][]byte{
+		nil,
+		{},
+		{0x90},
+	}
+	for _, c := range testcases {
+		rapdu := &RAPDU{}
+		if _, err := rapdu.Unmarshal(c); err == nil {
+			t.Errorf("% 02X: expected an error", c)
+		}
+	}
+}
+
 func TestRAPDUNew(t *testing.T) {
 	testcases := []int{
 		RAPDUCommandCompleted,
@@ -55,3 +69,56 @@ func TestRAPDUNew(t *testing.T) {
 		}
 	}
 }
+
+func TestRAPDUWrongLe(t *testing.T) {
+	rapdu := &RAPDU{SW1: 0x6C, SW2: 0x0F}
+	if !rapdu.WrongLe() || rapdu.CorrectLe() != 15 {
+		t.Error("6C0F should indicate a correct Le of 15")
+	}
+	rapdu.SW2 = 0x00
+	if rapdu.CorrectLe() != 256 {
+		t.Error("6C00 should indicate a correct Le of 256")
+	}
+	if NewRAPDU(RAPDUCommandCompleted).WrongLe() {
+		t.Error("9000 is not a wrong Le response")
+	}
+}
+
+func TestRAPDUCategory(t *testing.T) {
+	testcases := []struct {
+		sw       uint16
+		category Category
+	}{
+		{0x9000, CategoryNormal},
+		{0x6110, CategoryNormal},
+		{0x6282, CategoryWarning},
+		{0x63C2, CategoryWarning},
+		{0x6581, CategoryExecutionError},
+		{0x6700, CategoryCheckingError},
+		{0x6A82, CategoryCheckingError},
+		{0x9100, CategoryUnknown},
+	}
+	for _, c := range testcases {
+		rapdu := NewRAPDUStatus(c.sw)
+		if cat := rapdu.Category(); cat != c.category {
+			t.Errorf("%04x: expected %s. Got %s", c.sw, c.category, cat)
+		}
+	}
+
+	if !NewRAPDUStatus(SWEndOfFile).IsWarning() {
+		t.Error("6282 is a warning")
+	}
+	if !NewRAPDUStatus(SWFileNotFound).IsError() {
+		t.Error("6A82 is an error")
+	}
+	if !NewRAPDUStatus(SWWrongLength).IsWrongLength() ||
+		!NewRAPDUWrongLength(10).IsWrongLength() {
+		t.Error("6700 and 6CXX are wrong length responses")
+	}
+	if !NewRAPDUSecurityNotSatisfied().IsSecurityNotSatisfied() {
+		t.Error("6982 is security not satisfied")
+	}
+	if !NewRAPDUStatus(SWMemoryFailure).IsMemoryFailure() {
+		t.Error("6581 is a memory failure")
+	}
+}
@@ -0,0 +1,233 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package apdu
+
+import (
+	"fmt"
+)
+
+// Interindustry status words (SW1-SW2) defined in ISO/IEC 7816-4
+// which are relevant to Type 4 Tags. Some status words have a
+// variable SW2 (61XXh, 63CXh and 6CXXh). For those, the constants
+// hold the value with SW2 set to 0.
+const (
+	SWCommandCompleted           = uint16(0x9000)
+	SWBytesRemaining             = uint16(0x6100) // 61XX
+	SWDataCorrupted              = uint16(0x6281)
+	SWEndOfFile                  = uint16(0x6282)
+	SWFileInvalidated            = uint16(0x6283)
+	SWFCINotFormatted            = uint16(0x6284)
+	SWVerificationFailed         = uint16(0x6300)
+	SWFileFilledUp               = uint16(0x6381)
+	SWVerificationTriesLeft      = uint16(0x63C0) // 63CX
+	SWExecutionError             = uint16(0x6400)
+	SWMemoryFailure              = uint16(0x6581)
+	SWWrongLength                = uint16(0x6700)
+	SWLogicalChannelUnsupported  = uint16(0x6881)
+	SWSecureMessagingUnsupported = uint16(0x6882)
+	SWLastCommandExpected        = uint16(0x6883)
+	SWCommandNotAllowed          = uint16(0x6900)
+	SWInactiveState              = uint16(0x6901)
+	SWIncompatibleFileStructure  = uint16(0x6981)
+	SWSecurityNotSatisfied       = uint16(0x6982)
+	SWAuthenticationBlocked      = uint16(0x6983)
+	SWReferenceDataNotUsable     = uint16(0x6984)
+	SWConditionsNotSatisfied     = uint16(0x6985)
+	SWNoCurrentFile              = uint16(0x6986)
+	SWSMDataObjectsMissing       = uint16(0x6987)
+	SWSMDataObjectsIncorrect     = uint16(0x6988)
+	SWIncorrectData              = uint16(0x6A80)
+	SWFunctionNotSupported       = uint16(0x6A81)
+	SWFileNotFound               = uint16(0x6A82)
+	SWRecordNotFound             = uint16(0x6A83)
+	SWNotEnoughMemory            = uint16(0x6A84)
+	SWLcInconsistentWithTLV      = uint16(0x6A85)
+	SWIncorrectP1P2              = uint16(0x6A86)
+	SWLcInconsistentWithP1P2     = uint16(0x6A87)
+	SWReferencedDataNotFound     = uint16(0x6A88)
+	SWWrongP1P2                  = uint16(0x6B00)
+	SWWrongLe                    = uint16(0x6C00) // 6CXX
+	SWINSNotSupported            = uint16(0x6D00)
+	SWCLANotSupported            = uint16(0x6E00)
+	SWNoPreciseDiagnosis         = uint16(0x6F00)
+)
+
+// statusWords holds the meaning of the interindustry status words
+// (SW1-SW2) defined in ISO/IEC 7816-4.
+var statusWords = map[uint16]string{
+	SWCommandCompleted:           "command completed",
+	SWDataCorrupted:              "part of returned data may be corrupted",
+	SWEndOfFile:                  "end of file reached before reading Le bytes",
+	SWFileInvalidated:            "selected file invalidated",
+	SWFCINotFormatted:            "FCI not formatted according to ISO/IEC 7816-4",
+	SWVerificationFailed:         "verification failed",
+	SWFileFilledUp:               "file filled up by the last write",
+	SWExecutionError:             "execution error",
+	SWMemoryFailure:              "memory failure",
+	SWWrongLength:                "wrong length",
+	SWLogicalChannelUnsupported:  "logical channel not supported",
+	SWSecureMessagingUnsupported: "secure messaging not supported",
+	SWLastCommandExpected:        "last command of the chain expected",
+	SWCommandNotAllowed:          "command not allowed",
+	SWInactiveState:              "command not accepted (inactive state)",
+	SWIncompatibleFileStructure:  "command incompatible with file structure",
+	SWSecurityNotSatisfied:       "security status not satisfied",
+	SWAuthenticationBlocked:      "authentication method blocked",
+	SWReferenceDataNotUsable:     "reference data not usable",
+	SWConditionsNotSatisfied:     "conditions of use not satisfied",
+	SWNoCurrentFile:              "command not allowed (no current file)",
+	SWSMDataObjectsMissing:       "expected secure messaging data objects missing",
+	SWSMDataObjectsIncorrect:     "incorrect secure messaging data objects",
+	SWIncorrectData:              "incorrect parameters in the data field",
+	SWFunctionNotSupported:       "function not supported",
+	SWFileNotFound:               "file or application not found",
+	SWRecordNotFound:             "record not found",
+	SWNotEnoughMemory:            "not enough memory space in the file",
+	SWLcInconsistentWithTLV:      "Lc inconsistent with TLV structure",
+	SWIncorrectP1P2:              "incorrect parameters P1-P2",
+	SWLcInconsistentWithP1P2:     "Lc inconsistent with P1-P2",
+	SWReferencedDataNotFound:     "referenced data not found",
+	SWWrongP1P2:                  "wrong parameters P1-P2 (offset outside the file)",
+	SWINSNotSupported:            "instruction code not supported or invalid",
+	SWCLANotSupported:            "class not supported",
+	SWNoPreciseDiagnosis:         "no precise diagnosis",
+}
+
+// StatusDescription returns a human-readable description of the
+// given status word.
+func StatusDescription(sw1, sw2 byte) string {
+	switch {
+	case sw1 == 0x61:
+		return fmt.Sprintf("%d response bytes still available",
+			(&RAPDU{SW1: sw1, SW2: sw2}).RemainingLe())
+	case sw1 == 0x6C:
+		return fmt.Sprintf("wrong Le field (%d bytes available)",
+			(&RAPDU{SW1: sw1, SW2: sw2}).CorrectLe())
+	case sw1 == 0x63 && sw2&0xF0 == 0xC0:
+		return fmt.Sprintf("verification failed (%d tries left)",
+			sw2&0x0F)
+	}
+	desc, ok := statusWords[(&RAPDU{SW1: sw1, SW2: sw2}).Status()]
+	if !ok {
+		return "unknown status"
+	}
+	return desc
+}
+
+// StatusError is an error caused by a Response APDU with a status
+// word which does not indicate success.
+type StatusError struct {
+	Op  string // The operation which failed
+	SW1 byte
+	SW2 byte
+}
+
+// Error returns the error message, which includes the description of
+// the status word.
+func (err *StatusError) Error() string {
+	return fmt.Sprintf("%s: %s. SW1: %02xh. SW2: %02xh",
+		err.Op,
+		err.Description(),
+		err.SW1,
+		err.SW2)
+}
+
+// Description returns a human-readable description of the status word.
+func (err *StatusError) Description() string {
+	return StatusDescription(err.SW1, err.SW2)
+}
+
+// Category returns the category of the status word, which allows to
+// react to classes of errors.
+func (err *StatusError) Category() Category {
+	return (&RAPDU{SW1: err.SW1, SW2: err.SW2}).Category()
+}
+
+// NewRAPDUStatus returns a new RAPDU without data and with the given
+// status word.
+func NewRAPDUStatus(sw uint16) *RAPDU {
+	return &RAPDU{
+		SW1: byte(sw >> 8),
+		SW2: byte(sw),
+	}
+}
+
+// NewRAPDUBytesRemaining returns a new RAPDU with the given data
+// indicating that n more bytes can be obtained with GET RESPONSE
+// (61XXh). n goes from 1 to 256 (or more).
+func NewRAPDUBytesRemaining(data []byte, n int) *RAPDU {
+	rapdu := NewRAPDUStatus(SWBytesRemaining | uint16(byte(n)))
+	if n > 255 {
+		rapdu.SW2 = 0
+	}
+	rapdu.ResponseBody = data
+	return rapdu
+}
+
+// NewRAPDUEndOfFile returns a new RAPDU with the given data
+// indicating that the end of the file was reached before reading Le
+// bytes (6282h).
+func NewRAPDUEndOfFile(data []byte) *RAPDU {
+	rapdu := NewRAPDUStatus(SWEndOfFile)
+	rapdu.ResponseBody = data
+	return rapdu
+}
+
+// NewRAPDUVerificationFailed returns a new RAPDU indicating that a
+// verification failed and how many tries are left (63CXh).
+func NewRAPDUVerificationFailed(triesLeft int) *RAPDU {
+	return NewRAPDUStatus(SWVerificationTriesLeft | uint16(triesLeft&0x0F))
+}
+
+// NewRAPDUWrongLength returns a new RAPDU indicating that the Le field
+// was wrong, along with the correct Le (6CXXh). correctLe goes from 1
+// to 256.
+func NewRAPDUWrongLength(correctLe int) *RAPDU {
+	return NewRAPDUStatus(SWWrongLe | uint16(byte(correctLe)))
+}
+
+// NewRAPDUSecurityNotSatisfied returns a new RAPDU indicating that
+// the security status is not satisfied (6982h), for example, when
+// reading a protected file without verifying the password first.
+func NewRAPDUSecurityNotSatisfied() *RAPDU {
+	return NewRAPDUStatus(SWSecurityNotSatisfied)
+}
+
+// NewRAPDUConditionsNotSatisfied returns a new RAPDU indicating that
+// the conditions of use are not satisfied (6985h).
+func NewRAPDUConditionsNotSatisfied() *RAPDU {
+	return NewRAPDUStatus(SWConditionsNotSatisfied)
+}
+
+// NewRAPDUWrongP1P2 returns a new RAPDU indicating that the parameters
+// are wrong (6B00h), for example, when the offset is outside the file.
+func NewRAPDUWrongP1P2() *RAPDU {
+	return NewRAPDUStatus(SWWrongP1P2)
+}
+
+// NewRAPDUINSNotSupported returns a new RAPDU indicating that the
+// instruction is not supported (6D00h).
+func NewRAPDUINSNotSupported() *RAPDU {
+	return NewRAPDUStatus(SWINSNotSupported)
+}
+
+// NewRAPDUCLANotSupported returns a new RAPDU indicating that the
+// class is not supported (6E00h).
+func NewRAPDUCLANotSupported() *RAPDU {
+	return NewRAPDUStatus(SWCLANotSupported)
+}
@@ -0,0 +1,88 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package apdu
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestStatusDescription(t *testing.T) {
+	testcases := []struct {
+		sw1, sw2 byte
+		desc     string
+	}{
+		{0x6A, 0x82, "file or application not found"},
+		{0x69, 0x82, "security status not satisfied"},
+		{0x67, 0x00, "wrong length"},
+		{0x63, 0xC3, "verification failed (3 tries left)"},
+		{0x6C, 0x10, "wrong Le field (16 bytes available)"},
+		{0x61, 0x00, "256 response bytes still available"},
+		{0x12, 0x34, "unknown status"},
+	}
+	for _, c := range testcases {
+		if d := StatusDescription(c.sw1, c.sw2); d != c.desc {
+			t.Errorf("%02x%02x: expected %q but got %q",
+				c.sw1, c.sw2, c.desc, d)
+		}
+	}
+}
+
+func TestStatusError(t *testing.T) {
+	var err error = &StatusError{
+		Op:  "Test",
+		SW1: 0x69,
+		SW2: 0x85,
+	}
+	if err.Error() != "Test: conditions of use not satisfied. SW1: 69h. SW2: 85h" {
+		t.Error("unexpected message:", err)
+	}
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.SW2 != 0x85 {
+		t.Error("expected a StatusError")
+	}
+	if statusErr.Category() != CategoryCheckingError {
+		t.Error("expected a checking error")
+	}
+}
+
+func TestNewRAPDUStatus(t *testing.T) {
+	testcases := []struct {
+		rapdu    *RAPDU
+		expected uint16
+	}{
+		{NewRAPDUStatus(SWFileNotFound), 0x6A82},
+		{NewRAPDU(RAPDUInactiveState), 0x6901},
+		{NewRAPDUWrongLength(16), 0x6C10},
+		{NewRAPDUWrongLength(256), 0x6C00},
+		{NewRAPDUBytesRemaining(nil, 300), 0x6100},
+		{NewRAPDUVerificationFailed(3), 0x63C3},
+		{NewRAPDUSecurityNotSatisfied(), 0x6982},
+		{NewRAPDUEndOfFile([]byte{0x01}), 0x6282},
+	}
+	for _, c := range testcases {
+		if sw := c.rapdu.Status(); sw != c.expected {
+			t.Errorf("expected %04x but got %04x", c.expected, sw)
+		}
+	}
+
+	rapdu := NewRAPDUWrongLength(16)
+	if !rapdu.WrongLe() || rapdu.CorrectLe() != 16 {
+		t.Error("expected a wrong Le response with 16 bytes")
+	}
+}
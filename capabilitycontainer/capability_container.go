@@ -30,6 +30,19 @@ import (
 // CCID is the Capability container ID.
 const CCID = uint16(0xE103)
 
+// ValidationMode controls how strictly a CapabilityContainer is validated
+// when parsing it.
+type ValidationMode int
+
+// Validation modes. Strict refuses Capability Containers which use
+// RFU values. Lenient accepts RFU values for CCLEN, MLe and MLc (as
+// long as the Capability Container can still be parsed) and records
+// them in the Warnings of the CapabilityContainer.
+const (
+	Strict ValidationMode = iota
+	Lenient
+)
+
 // CapabilityContainer represents a Capability Container File as defined in the
 // section 5.1 of the specification. The main function of the capability
 // container file is to store the NDEFFileControlTLV (see docs for that struct)
@@ -44,18 +57,52 @@ type CapabilityContainer struct {
 	MLe                uint16              // Maximum data read with ReadBinary. 000Fh-FFFFh
 	MLc                uint16              // Maximum data to write with UpdateBinary. 0001h-FFFFh
 	NDEFFileControlTLV *NDEFFileControlTLV // NDEF file information
-	TLVBlocks          []*ControlTLV       // Optional TLVs
+	// ExtendedNDEFFileControlTLV replaces the NDEFFileControlTLV
+	// in Capability Containers with mapping version 3.0 which
+	// point to an Extended NDEF File. Only one of them is set.
+	ExtendedNDEFFileControlTLV *ExtendedNDEFFileControlTLV
+	TLVBlocks                  []*ControlTLV // Optional TLVs
+	// IgnoredTLVBlocks holds the raw bytes of the optional TLV
+	// blocks with reserved types and of the NULL TLVs, which NFC
+	// Forum devices ignore. They are written back verbatim by
+	// Marshal.
+	IgnoredTLVBlocks [][]byte
+	// IgnoredTLVPositions holds, for each of the IgnoredTLVBlocks,
+	// the number of TLVBlocks found before it, so that Marshal
+	// writes it back in its original place. The blocks without a
+	// position are written after all the TLVBlocks.
+	IgnoredTLVPositions []int
+	// Terminator indicates that the TLV blocks end with a
+	// Terminator TLV. Marshal writes it after all the other TLV
+	// blocks.
+	Terminator bool
+	// Padding holds the bytes found after the Terminator TLV, up to
+	// CCLEN. Marshal writes them back verbatim after the Terminator.
+	Padding []byte
+
+	// Mode is the ValidationMode used by Unmarshal and Marshal.
+	// It is not modified by Reset.
+	Mode ValidationMode
+	// Warnings holds the RFU violations found by Unmarshal
+	// in Lenient mode.
+	Warnings []error
 }
 
 // Reset clears all the fields of the CapabilityContainer to their
-// default values.
+// default values, except for the Mode.
 func (cc *CapabilityContainer) Reset() {
 	cc.CCLEN = 0
 	cc.MappingVersion = 0
 	cc.MLe = 0
 	cc.MLc = 0
 	cc.NDEFFileControlTLV = nil
+	cc.ExtendedNDEFFileControlTLV = nil
 	cc.TLVBlocks = nil
+	cc.IgnoredTLVBlocks = nil
+	cc.IgnoredTLVPositions = nil
+	cc.Terminator = false
+	cc.Padding = nil
+	cc.Warnings = nil
 }
 
 // Unmarshal parses a byte slice and sets the CapabilityContainer fields
@@ -64,7 +111,9 @@ func (cc *CapabilityContainer) Reset() {
 // before parsing.
 //
 // It returns the number of bytes read and an error if something looks wrong
-// (it uses check() to check for the integrity of the result).
+// (it uses check() to check for the integrity of the result). In Lenient
+// mode, RFU values for CCLEN, MLe and MLc are recorded in Warnings
+// instead.
 func (cc *CapabilityContainer) Unmarshal(buf []byte) (rLen int, err error) {
 	defer helpers.HandleErrorPanic(&err, "RAPDU.Unmarshal")
 	bytesBuf := bytes.NewBuffer(buf)
@@ -88,29 +137,65 @@ func (cc *CapabilityContainer) Unmarshal(buf []byte) (rLen int, err error) {
 		helpers.GetByte(bytesBuf)})
 	i += 7
 
-	fcTLV := new(NDEFFileControlTLV)
-	parsed, err := fcTLV.Unmarshal(helpers.GetBytes(bytesBuf, 8))
-	if err != nil {
-		return len(buf) - bytesBuf.Len(), err
+	if buf[7] == TypeExtendedNDEFFileControlTLV {
+		efcTLV := new(ExtendedNDEFFileControlTLV)
+		parsed, err := efcTLV.Unmarshal(helpers.GetBytes(bytesBuf, 10))
+		if err != nil {
+			return len(buf) - bytesBuf.Len(), err
+		}
+		cc.ExtendedNDEFFileControlTLV = efcTLV
+		i += parsed
+	} else {
+		fcTLV := new(NDEFFileControlTLV)
+		parsed, err := fcTLV.Unmarshal(helpers.GetBytes(bytesBuf, 8))
+		if err != nil {
+			return len(buf) - bytesBuf.Len(), err
+		}
+		cc.NDEFFileControlTLV = fcTLV
+		i += parsed
 	}
-	cc.NDEFFileControlTLV = fcTLV
-	i += parsed
 
 	tlvBytes := bytesBuf.Bytes()
 	rLen = len(buf) - len(tlvBytes)
-	for rLen < int(cc.CCLEN) {
+	ccLen := int(cc.CCLEN)
+	lenientCCLEN := cc.Mode == Lenient && cc.checkCCLEN() != nil
+	if lenientCCLEN && ccLen > len(buf) {
+		ccLen = len(buf)
+	}
+	for rLen < ccLen {
 		// First parse a regular TLV so we can look at its type
 		extraTLV := new(TLV)
-		parsed, err = extraTLV.Unmarshal(buf[rLen:])
+		parsed, err := extraTLV.Unmarshal(buf[rLen:])
 		if err != nil {
 			rLen += parsed
 			return rLen, err
 		}
+		// Bytes after a Terminator TLV are padding.
+		if extraTLV.IsTerminatorTLV() {
+			cc.Terminator = true
+			rLen += parsed
+			end := ccLen
+			if end > len(buf) {
+				end = len(buf)
+			}
+			if end > rLen {
+				cc.Padding = append([]byte{}, buf[rLen:end]...)
+				rLen = end
+			}
+			break
+		}
 		// The Specs say: NFC Forum Devices shall ignore and
 		// jump over those TLV blocks that make use
 		// of reserved tag field values.
+		// We keep them so they are not lost when writing
+		// the Capability Container back.
 		if extraTLV.T != TypeNDEFFileControlTLV &&
 			extraTLV.T != TypePropietaryFileControlTLV {
+			ignored := make([]byte, parsed)
+			copy(ignored, buf[rLen:])
+			cc.IgnoredTLVBlocks = append(cc.IgnoredTLVBlocks, ignored)
+			cc.IgnoredTLVPositions = append(cc.IgnoredTLVPositions,
+				len(cc.TLVBlocks))
 			rLen += parsed
 			continue
 		}
@@ -124,7 +209,7 @@ func (cc *CapabilityContainer) Unmarshal(buf []byte) (rLen int, err error) {
 		}
 		cc.TLVBlocks = append(cc.TLVBlocks, extraControlTLV)
 	}
-	if rLen != int(cc.CCLEN) { // They'd better be equal
+	if rLen != int(cc.CCLEN) && !lenientCCLEN { // They'd better be equal
 		return rLen, fmt.Errorf("CapabilityContainer.Unmarshal: "+
 			"expected %d bytes but parsed %d bytes",
 			cc.CCLEN, i)
@@ -133,6 +218,9 @@ func (cc *CapabilityContainer) Unmarshal(buf []byte) (rLen int, err error) {
 	if err = cc.check(); err != nil {
 		return rLen, err
 	}
+	if cc.Mode == Lenient {
+		cc.Warnings = cc.rfuViolations()
+	}
 	return rLen, nil
 }
 
@@ -143,6 +231,35 @@ func (cc *CapabilityContainer) Marshal() ([]byte, error) {
 	if err := cc.check(); err != nil {
 		return nil, err
 	}
+	return cc.marshal()
+}
+
+// Finalize sets CCLEN to the size of the serialized Capability
+// Container, including the TLVBlocks and IgnoredTLVBlocks written by
+// Marshal. It is meant to be called before Marshal when building
+// Capability Containers programmatically.
+//
+// It returns an error if the Capability Container cannot be
+// serialized or is too large.
+func (cc *CapabilityContainer) Finalize() error {
+	ccBytes, err := cc.marshal()
+	if err != nil {
+		return err
+	}
+	if len(ccBytes) > 0xFFFE {
+		return errors.New("CapabilityContainer.Finalize: " +
+			"the Capability Container is too large")
+	}
+	cc.CCLEN = uint16(len(ccBytes))
+	return nil
+}
+
+// marshal serializes the CapabilityContainer without checking it.
+func (cc *CapabilityContainer) marshal() ([]byte, error) {
+	if cc.NDEFFileControlTLV == nil && cc.ExtendedNDEFFileControlTLV == nil {
+		return nil, errors.New("CapabilityContainer.Marshal: " +
+			"missing NDEF File Control TLV")
+	}
 
 	var buffer bytes.Buffer
 	cclen := helpers.Uint16ToBytes(cc.CCLEN)
@@ -152,12 +269,25 @@ func (cc *CapabilityContainer) Marshal() ([]byte, error) {
 	buffer.Write(mle[:])
 	mlc := helpers.Uint16ToBytes(cc.MLc)
 	buffer.Write(mlc[:])
-	fcTLVBytes, err := cc.NDEFFileControlTLV.Marshal()
+	var fcTLVBytes []byte
+	var err error
+	if cc.ExtendedNDEFFileControlTLV != nil {
+		fcTLVBytes, err = cc.ExtendedNDEFFileControlTLV.Marshal()
+	} else {
+		fcTLVBytes, err = cc.NDEFFileControlTLV.Marshal()
+	}
 	if err != nil {
 		return nil, err
 	}
 	buffer.Write(fcTLVBytes)
-	for _, tlv := range cc.TLVBlocks {
+	ignored := 0
+	for i, tlv := range cc.TLVBlocks {
+		for ignored < len(cc.IgnoredTLVBlocks) &&
+			ignored < len(cc.IgnoredTLVPositions) &&
+			cc.IgnoredTLVPositions[ignored] <= i {
+			buffer.Write(cc.IgnoredTLVBlocks[ignored])
+			ignored++
+		}
 		// Do not write TLV which are to be ignored
 		// by the NFC Forum devices according to the
 		// specs
@@ -172,31 +302,85 @@ func (cc *CapabilityContainer) Marshal() ([]byte, error) {
 		}
 		buffer.Write(tlvBytes)
 	}
+	for _, tlvBytes := range cc.IgnoredTLVBlocks[ignored:] {
+		buffer.Write(tlvBytes)
+	}
+	if cc.Terminator {
+		buffer.WriteByte(TypeTerminatorTLV)
+		buffer.Write(cc.Padding)
+	}
 	return buffer.Bytes(), nil
 }
 
-// BUG(hector): Currently we don't check that the CapabilityContainer
-// mapping version matches the specification version implemented by this
-// library.
+// UsesExtendedNDEFFile returns true when the Capability Container
+// points to an Extended NDEF File (mapping version 3.0), that is, when
+// it has an ExtendedNDEFFileControlTLV. The NDEF Message in those files
+// is preceded by a 4-byte length (ENLEN) instead of NLEN.
+func (cc *CapabilityContainer) UsesExtendedNDEFFile() bool {
+	return cc.ExtendedNDEFFileControlTLV != nil
+}
 
-// Check tests that a CapabilityContainer follows the specification and
-// returns an error if a problem is found.
-func (cc *CapabilityContainer) check() error {
-	if (0x0000 <= cc.CCLEN && cc.CCLEN <= 0x000e) || cc.CCLEN == 0xffff {
-		return errors.New("CapabilityContainer.check: CCLEN is RFU")
+// NDEFFiles returns the NDEF File Control TLVs in the Capability
+// Container: the NDEFFileControlTLV first, followed by those found
+// among the optional TLVBlocks, for tags which expose several NDEF
+// Files.
+func (cc *CapabilityContainer) NDEFFiles() []*NDEFFileControlTLV {
+	var files []*NDEFFileControlTLV
+	if cc.NDEFFileControlTLV != nil {
+		files = append(files, cc.NDEFFileControlTLV)
 	}
-
-	if 0x0000 <= cc.MLe && cc.MLe <= 0x000e {
-		return errors.New("CapabilityContainer.check: MLe is RFU")
+	for _, tlv := range cc.TLVBlocks {
+		if tlv.IsNDEFFileControlTLV() {
+			files = append(files, (*NDEFFileControlTLV)(tlv))
+		}
 	}
+	return files
+}
 
-	if 0x0000 == cc.MLc {
-		return errors.New("CapabilityContainer.check: MLc is RFU")
+// MajorVersion returns the major number of the MappingVersion
+// (4 most significant bits).
+func (cc *CapabilityContainer) MajorVersion() byte {
+	return cc.MappingVersion >> 4
+}
+
+// MinorVersion returns the minor number of the MappingVersion
+// (4 least significant bits).
+func (cc *CapabilityContainer) MinorVersion() byte {
+	return cc.MappingVersion & 0x0F
+}
+
+// Check tests that a CapabilityContainer follows the specification and
+// returns an error if a problem is found.
+//
+// In Lenient mode, RFU values for CCLEN, MLe and MLc are not considered
+// errors (see rfuViolations).
+func (cc *CapabilityContainer) check() error {
+	if cc.Mode != Lenient {
+		if v := cc.rfuViolations(); len(v) > 0 {
+			return v[0]
+		}
 	}
 
 	// Test that TLVs look ok
-	if err := (*ControlTLV)(cc.NDEFFileControlTLV).check(); err != nil {
-		return err
+	switch {
+	case cc.NDEFFileControlTLV != nil && cc.ExtendedNDEFFileControlTLV != nil:
+		return errors.New("CapabilityContainer.check: " +
+			"cannot have both NDEF and Extended NDEF File Control TLVs")
+	case cc.ExtendedNDEFFileControlTLV != nil:
+		if cc.MajorVersion() < 3 {
+			return errors.New("CapabilityContainer.check: " +
+				"Extended NDEF File Control TLV needs mapping version 3.0")
+		}
+		if err := cc.ExtendedNDEFFileControlTLV.check(); err != nil {
+			return err
+		}
+	case cc.NDEFFileControlTLV != nil:
+		if err := (*ControlTLV)(cc.NDEFFileControlTLV).check(); err != nil {
+			return err
+		}
+	default:
+		return errors.New("CapabilityContainer.check: " +
+			"missing NDEF File Control TLV")
 	}
 
 	for _, tlv := range cc.TLVBlocks {
@@ -206,3 +390,30 @@ func (cc *CapabilityContainer) check() error {
 	}
 	return nil
 }
+
+// rfuViolations returns the errors caused by RFU values in
+// CCLEN, MLe and MLc.
+func (cc *CapabilityContainer) rfuViolations() []error {
+	var errs []error
+	if err := cc.checkCCLEN(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if 0x0000 <= cc.MLe && cc.MLe <= 0x000e {
+		errs = append(errs,
+			errors.New("CapabilityContainer.check: MLe is RFU"))
+	}
+
+	if 0x0000 == cc.MLc {
+		errs = append(errs,
+			errors.New("CapabilityContainer.check: MLc is RFU"))
+	}
+	return errs
+}
+
+func (cc *CapabilityContainer) checkCCLEN() error {
+	if (0x0000 <= cc.CCLEN && cc.CCLEN <= 0x000e) || cc.CCLEN == 0xffff {
+		return errors.New("CapabilityContainer.check: CCLEN is RFU")
+	}
+	return nil
+}
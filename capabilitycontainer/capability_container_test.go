@@ -201,3 +201,275 @@ func TestMarshalUnmarshal(t *testing.T) {
 	}
 
 }
+
+func TestIgnoredTLVBlocks(t *testing.T) {
+	ccBytes := []byte{
+		0x00, 0x1B, 0x20, 0x00, 0x7f, 0x00, 0x7f, // CCLEN=27, v2.0, MLe, MLc
+		0x04, 0x06, 0xe1, 0x04, 0x00, 0x7f, 0x00, 0x00, // NDEF File Control TLV
+		0x06, 0x02, 0xAA, 0xBB, // Reserved TLV
+		0x05, 0x06, 0xe1, 0x05, 0x00, 0x10, 0x00, 0x00, // Propietary File Control TLV
+	}
+	cc := new(CapabilityContainer)
+	if _, err := cc.Unmarshal(ccBytes); err != nil {
+		t.Fatal(err)
+	}
+	if len(cc.TLVBlocks) != 1 || len(cc.IgnoredTLVBlocks) != 1 {
+		t.Fatal("expected one TLV block and one ignored TLV block")
+	}
+	if !bytes.Equal(cc.IgnoredTLVBlocks[0], []byte{0x06, 0x02, 0xAA, 0xBB}) {
+		t.Errorf("unexpected ignored TLV block: % 02X", cc.IgnoredTLVBlocks[0])
+	}
+
+	marshaled, err := cc.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Ignored blocks keep their place
+	if !bytes.Equal(marshaled, ccBytes) {
+		t.Errorf("expected % 02X. Got % 02X", ccBytes, marshaled)
+	}
+	cc2 := new(CapabilityContainer)
+	if _, err := cc2.Unmarshal(marshaled); err != nil {
+		t.Fatal(err)
+	}
+	if len(cc2.IgnoredTLVBlocks) != 1 {
+		t.Error("ignored TLV blocks should survive a round trip")
+	}
+}
+
+func TestIgnoredTLVBlocks_order(t *testing.T) {
+	ccBytes := []byte{
+		0x00, 0x24, 0x20, 0x00, 0x7f, 0x00, 0x7f, // CCLEN=36, v2.0, MLe, MLc
+		0x04, 0x06, 0xe1, 0x04, 0x00, 0x7f, 0x00, 0x00, // NDEF File Control TLV
+		0x00,                                           // NULL TLV
+		0x04, 0x06, 0xe1, 0x06, 0x00, 0x7f, 0x00, 0x00, // NDEF File Control TLV
+		0x07, 0x01, 0xAA, // Reserved TLV
+		0x05, 0x06, 0xe1, 0x05, 0x00, 0x10, 0x00, 0x00, // Propietary File Control TLV
+		0x00, // NULL TLV
+	}
+	cc := new(CapabilityContainer)
+	if _, err := cc.Unmarshal(ccBytes); err != nil {
+		t.Fatal(err)
+	}
+	if len(cc.TLVBlocks) != 2 || len(cc.IgnoredTLVBlocks) != 3 {
+		t.Fatal("expected two TLV blocks and three ignored TLV blocks")
+	}
+	marshaled, err := cc.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(marshaled, ccBytes) {
+		t.Errorf("expected % 02X. Got % 02X", ccBytes, marshaled)
+	}
+
+	// Blocks without a position go after the TLV blocks
+	cc.IgnoredTLVPositions = cc.IgnoredTLVPositions[:1]
+	marshaled, err = cc.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := append(append(append([]byte{}, ccBytes[:24]...),
+		ccBytes[27:35]...), 0x07, 0x01, 0xAA, 0x00)
+	if !bytes.Equal(marshaled, expected) {
+		t.Errorf("expected % 02X. Got % 02X", expected, marshaled)
+	}
+}
+
+func TestExtendedNDEFFileControlTLV(t *testing.T) {
+	ccBytes := []byte{
+		0x00, 0x11, 0x30, 0x00, 0xff, 0x00, 0xff, // CCLEN=17, v3.0, MLe, MLc
+		0x06, 0x08, 0xe1, 0x04, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, // Extended NDEF File Control TLV
+	}
+	cc := new(CapabilityContainer)
+	if _, err := cc.Unmarshal(ccBytes); err != nil {
+		t.Fatal(err)
+	}
+	if !cc.UsesExtendedNDEFFile() || cc.NDEFFileControlTLV != nil {
+		t.Fatal("expected an Extended NDEF File Control TLV")
+	}
+	efcTLV := cc.ExtendedNDEFFileControlTLV
+	if efcTLV.FileID != 0xE104 || efcTLV.MaximumFileSize != 0x10000 {
+		t.Errorf("unexpected TLV values: %+v", efcTLV)
+	}
+	if !efcTLV.IsFileReadable() || !efcTLV.IsFileWriteable() {
+		t.Error("the file should be readable and writeable")
+	}
+
+	marshaled, err := cc.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(marshaled, ccBytes) {
+		t.Errorf("expected % 02X. Got % 02X", ccBytes, marshaled)
+	}
+
+	// Version 2.0 cannot use it
+	ccBytes[2] = 0x20
+	if _, err := cc.Unmarshal(ccBytes); err == nil {
+		t.Error("Extended NDEF File Control TLVs need version 3.0")
+	}
+	ccBytes[2] = 0x30
+
+	// Bad size
+	ccBytes[11], ccBytes[12], ccBytes[13], ccBytes[14] = 0x00, 0x00, 0x00, 0x04
+	if _, err := cc.Unmarshal(ccBytes); err == nil {
+		t.Error("Maximum File Size should be RFU")
+	}
+}
+
+func TestLenientMode(t *testing.T) {
+	testcases := map[string][]byte{
+		"bad_mle":   {0x00, 0x0f, 0x20, 0x00, 0x01, 0x00, 0x7f, 0x04, 0x06, 0xe1, 0x04, 0x00, 0x7f, 0x00, 0x00},
+		"bad_mlc":   {0x00, 0x0f, 0x20, 0x00, 0x7f, 0x00, 0x00, 0x04, 0x06, 0xe1, 0x04, 0x00, 0x7f, 0x00, 0x00},
+		"bad_cclen": {0x00, 0x0e, 0x20, 0x00, 0x7f, 0x00, 0x7f, 0x04, 0x06, 0xe1, 0x04, 0x00, 0x7f, 0x00, 0x00},
+		"rfu_cclen": {0xff, 0xff, 0x20, 0x00, 0x7f, 0x00, 0x7f, 0x04, 0x06, 0xe1, 0x04, 0x00, 0x7f, 0x00, 0x00},
+	}
+	for k, c := range testcases {
+		cc := new(CapabilityContainer)
+		if _, err := cc.Unmarshal(c); err == nil {
+			t.Error(k, "should fail in Strict mode")
+		}
+
+		cc.Mode = Lenient
+		if _, err := cc.Unmarshal(c); err != nil {
+			t.Error(k, "should not fail in Lenient mode:", err)
+			continue
+		}
+		if len(cc.Warnings) != 1 {
+			t.Error(k, "should have 1 warning. Got", cc.Warnings)
+		}
+		if _, err := cc.Marshal(); err != nil {
+			t.Error(k, "should be marshaled in Lenient mode:", err)
+		}
+	}
+
+	// Other errors are still errors
+	cc := &CapabilityContainer{Mode: Lenient}
+	_, err := cc.Unmarshal([]byte{0x00, 0x0f, 0x20, 0x00, 0x7f, 0x00, 0x7f, 0x04, 0x06, 0xe1, 0x03, 0x00, 0x7f, 0x00, 0x00})
+	if err == nil {
+		t.Error("reserved File IDs should fail in Lenient mode")
+	}
+}
+
+func TestNDEFFiles(t *testing.T) {
+	ccBytes := []byte{
+		0x00, 0x1F, 0x20, 0x00, 0x7f, 0x00, 0x7f, // CCLEN=31, v2.0, MLe, MLc
+		0x04, 0x06, 0xe1, 0x04, 0x00, 0x7f, 0xff, 0xff, // NDEF File Control TLV
+		0x05, 0x06, 0xe1, 0x05, 0x00, 0x10, 0x00, 0x00, // Propietary File Control TLV
+		0x04, 0x06, 0xe1, 0x06, 0x01, 0x00, 0x00, 0x00, // NDEF File Control TLV
+	}
+	cc := new(CapabilityContainer)
+	if _, err := cc.Unmarshal(ccBytes); err != nil {
+		t.Fatal(err)
+	}
+	files := cc.NDEFFiles()
+	if len(files) != 2 {
+		t.Fatal("expected 2 NDEF Files but got", len(files))
+	}
+	if files[0].FileID != 0xE104 || files[1].FileID != 0xE106 {
+		t.Errorf("unexpected NDEF Files: %04X, %04X",
+			files[0].FileID, files[1].FileID)
+	}
+	if files[1].MaximumFileSize != 0x0100 {
+		t.Error("unexpected maximum file size:", files[1].MaximumFileSize)
+	}
+}
+
+func TestFinalize(t *testing.T) {
+	cc := &CapabilityContainer{
+		MappingVersion: 0x20,
+		MLe:            255,
+		MLc:            255,
+		NDEFFileControlTLV: &NDEFFileControlTLV{
+			T:               0x04,
+			L:               0x06,
+			FileID:          0xE104,
+			MaximumFileSize: 90,
+		},
+		TLVBlocks: []*ControlTLV{
+			&ControlTLV{
+				T:               0x05,
+				L:               0x06,
+				FileID:          0xE105,
+				MaximumFileSize: 0x05,
+			},
+		},
+		IgnoredTLVBlocks: [][]byte{{0x07, 0x01, 0xAA}},
+	}
+	if _, err := cc.Marshal(); err == nil {
+		t.Error("Marshal should fail before setting CCLEN")
+	}
+	if err := cc.Finalize(); err != nil {
+		t.Fatal(err)
+	}
+	if cc.CCLEN != 26 {
+		t.Error("expected CCLEN 26 but got", cc.CCLEN)
+	}
+	ccBytes, err := cc.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cc2 := new(CapabilityContainer)
+	if _, err := cc2.Unmarshal(ccBytes); err != nil {
+		t.Error(err)
+	}
+
+	if err := new(CapabilityContainer).Finalize(); err == nil {
+		t.Error("Finalize should fail without NDEF File Control TLV")
+	}
+}
+
+func TestNULLAndTerminatorTLVs(t *testing.T) {
+	ccBytes := []byte{
+		0x00, 0x1A, 0x20, 0x00, 0x7f, 0x00, 0x7f, // CCLEN=26, v2.0, MLe, MLc
+		0x04, 0x06, 0xe1, 0x04, 0x00, 0x7f, 0x00, 0x00, // NDEF File Control TLV
+		0x00, 0x00, // NULL TLVs
+		0x05, 0x06, 0xe1, 0x05, 0x00, 0x10, 0x00, 0x00, // Propietary File Control TLV
+		0xFE, // Terminator TLV
+	}
+	cc := new(CapabilityContainer)
+	if _, err := cc.Unmarshal(ccBytes); err != nil {
+		t.Fatal(err)
+	}
+	if len(cc.TLVBlocks) != 1 || len(cc.IgnoredTLVBlocks) != 2 {
+		t.Fatal("expected one TLV block and two NULL TLVs")
+	}
+	if !cc.Terminator {
+		t.Error("expected a Terminator TLV")
+	}
+
+	marshaled, err := cc.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(marshaled, ccBytes) {
+		t.Errorf("expected % 02X. Got % 02X", ccBytes, marshaled)
+	}
+
+	// Bytes after the Terminator are padding
+	ccBytes = []byte{
+		0x00, 0x12, 0x20, 0x00, 0x7f, 0x00, 0x7f, // CCLEN=18, v2.0, MLe, MLc
+		0x04, 0x06, 0xe1, 0x04, 0x00, 0x7f, 0x00, 0x00, // NDEF File Control TLV
+		0xFE, 0x04, 0x06, // Terminator TLV and padding
+	}
+	rLen, err := cc.Unmarshal(ccBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rLen != 18 || len(cc.TLVBlocks) != 0 || !cc.Terminator {
+		t.Error("the padding after the Terminator TLV should be skipped")
+	}
+
+	// The padding is written back, so CCLEN stays correct
+	marshaled, err = cc.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(marshaled, ccBytes) {
+		t.Errorf("expected % 02X. Got % 02X", ccBytes, marshaled)
+	}
+	cc2 := new(CapabilityContainer)
+	if _, err := cc2.Unmarshal(marshaled); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,40 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package capabilitycontainer
+
+import (
+	"testing"
+)
+
+// FuzzUnmarshal makes sure that parsing Capability Containers read
+// from tags never panics. Run it with "go test -fuzz FuzzUnmarshal".
+func FuzzUnmarshal(f *testing.F) {
+	f.Add([]byte{0x00, 0x0f, 0x20, 0x00, 0x7f, 0x00, 0x7f, 0x04, 0x06, 0xe1, 0x04, 0x00, 0x7f, 0x00, 0x00})
+	f.Add([]byte{0x00, 0x17, 0x20, 0x00, 0x7f, 0x00, 0x7f, 0x04, 0x06, 0xe1, 0x04, 0x00, 0x7f, 0x00, 0x00, 0x05, 0x06, 0xe1, 0x05, 0x00, 0x10, 0x00, 0x00})
+	f.Add([]byte{0x00, 0x0f, 0x20})
+	f.Fuzz(func(t *testing.T, buf []byte) {
+		cc := new(CapabilityContainer)
+		if _, err := cc.Unmarshal(buf); err != nil {
+			return
+		}
+		cc.MajorVersion()
+		if _, err := cc.Marshal(); err != nil {
+			t.Error("a parsed Capability Container should be serializable:", err)
+		}
+	})
+}
@@ -0,0 +1,110 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package capabilitycontainer
+
+import (
+	"fmt"
+)
+
+// String returns a short description of the CapabilityContainer.
+func (cc *CapabilityContainer) String() string {
+	fileID := uint16(0)
+	switch {
+	case cc.ExtendedNDEFFileControlTLV != nil:
+		fileID = cc.ExtendedNDEFFileControlTLV.FileID
+	case cc.NDEFFileControlTLV != nil:
+		fileID = cc.NDEFFileControlTLV.FileID
+	}
+	return fmt.Sprintf("Capability Container v%d.%d "+
+		"(CCLEN: %d, MLe: %d, MLc: %d, NDEF File: %04Xh)",
+		cc.MajorVersion(), cc.MinorVersion(),
+		cc.CCLEN, cc.MLe, cc.MLc, fileID)
+}
+
+// Inspect returns a human-readable, multi-line description of the
+// CapabilityContainer, including the file control TLVs with decoded
+// access conditions.
+func (cc *CapabilityContainer) Inspect() string {
+	var str string
+	str += fmt.Sprintf("CCLEN: %d\n", cc.CCLEN)
+	str += fmt.Sprintf("Mapping Version: %d.%d\n",
+		cc.MajorVersion(), cc.MinorVersion())
+	str += fmt.Sprintf("MLe: %d\n", cc.MLe)
+	str += fmt.Sprintf("MLc: %d\n", cc.MLc)
+	if cc.NDEFFileControlTLV != nil {
+		str += "NDEF File Control TLV:\n"
+		str += (*ControlTLV)(cc.NDEFFileControlTLV).inspect("  ")
+	}
+	if eTLV := cc.ExtendedNDEFFileControlTLV; eTLV != nil {
+		str += "Extended NDEF File Control TLV:\n"
+		str += inspectFile("  ", eTLV.FileID, uint32(eTLV.MaximumFileSize),
+			eTLV.FileReadAccessCondition, eTLV.FileWriteAccessCondition)
+	}
+	for _, tlv := range cc.TLVBlocks {
+		switch {
+		case tlv.IsNDEFFileControlTLV():
+			str += "NDEF File Control TLV:\n"
+		case tlv.IsPropietaryFileControlTLV():
+			str += "Propietary File Control TLV:\n"
+		default:
+			str += fmt.Sprintf("TLV (%02Xh):\n", tlv.T)
+		}
+		str += tlv.inspect("  ")
+	}
+	for _, tlvBytes := range cc.IgnoredTLVBlocks {
+		str += fmt.Sprintf("Ignored TLV: % 02X\n", tlvBytes)
+	}
+	if cc.Terminator {
+		str += "Terminator TLV\n"
+	}
+	for _, w := range cc.Warnings {
+		str += fmt.Sprintf("Warning: %s\n", w)
+	}
+	return str
+}
+
+func (cTLV *ControlTLV) inspect(indent string) string {
+	return inspectFile(indent, cTLV.FileID, uint32(cTLV.MaximumFileSize),
+		cTLV.FileReadAccessCondition, cTLV.FileWriteAccessCondition)
+}
+
+func inspectFile(indent string, fileID uint16, size uint32, read, write byte) string {
+	var str string
+	str += fmt.Sprintf("%sFile ID: %04Xh\n", indent, fileID)
+	str += fmt.Sprintf("%sMaximum File Size: %d\n", indent, size)
+	str += fmt.Sprintf("%sRead Access: %02Xh (%s)\n", indent, read,
+		accessConditionName(read))
+	str += fmt.Sprintf("%sWrite Access: %02Xh (%s)\n", indent, write,
+		accessConditionName(write))
+	return str
+}
+
+// accessConditionName returns a description for the value of the
+// read and write access condition fields of the control TLVs.
+func accessConditionName(c byte) string {
+	switch {
+	case c == 0x00:
+		return "granted"
+	case c == 0xFF:
+		return "no access"
+	case c >= 0x80:
+		return "proprietary"
+	default:
+		return "RFU"
+	}
+}
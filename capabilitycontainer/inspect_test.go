@@ -0,0 +1,58 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package capabilitycontainer
+
+import (
+	"testing"
+)
+
+func TestInspect(t *testing.T) {
+	cc := new(CapabilityContainer)
+	_, err := cc.Unmarshal([]byte{
+		0x00, 0x17, 0x20, 0x00, 0x7f, 0x00, 0x7f,
+		0x04, 0x06, 0xe1, 0x04, 0x00, 0x7f, 0x00, 0xff,
+		0x05, 0x06, 0xe1, 0x05, 0x00, 0x10, 0x80, 0x00,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "Capability Container v2.0 (CCLEN: 23, MLe: 127, MLc: 127, NDEF File: E104h)"
+	if str := cc.String(); str != expected {
+		t.Errorf("expected:\n%s\nGot:\n%s", expected, str)
+	}
+
+	expected = `CCLEN: 23
+Mapping Version: 2.0
+MLe: 127
+MLc: 127
+NDEF File Control TLV:
+  File ID: E104h
+  Maximum File Size: 127
+  Read Access: 00h (granted)
+  Write Access: FFh (no access)
+Propietary File Control TLV:
+  File ID: E105h
+  Maximum File Size: 16
+  Read Access: 80h (proprietary)
+  Write Access: 00h (granted)
+`
+	if str := cc.Inspect(); str != expected {
+		t.Errorf("expected:\n%s\nGot:\n%s", expected, str)
+	}
+}
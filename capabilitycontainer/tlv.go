@@ -25,10 +25,15 @@ import (
 	"github.com/hsanjuan/go-nfctype4/helpers"
 )
 
-// Values allowed for the T fields of TLV Blocks.
+// Values allowed for the T fields of TLV Blocks. NULL and Terminator
+// TLVs consist of the T field only: the first may be used for padding
+// and the second marks the end of the TLV blocks.
 const (
-	TypeNDEFFileControlTLV       = byte(0x04)
-	TypePropietaryFileControlTLV = byte(0x05)
+	TypeNULLTLV                    = byte(0x00)
+	TypeTerminatorTLV              = byte(0xFE)
+	TypeNDEFFileControlTLV         = byte(0x04)
+	TypePropietaryFileControlTLV   = byte(0x05)
+	TypeExtendedNDEFFileControlTLV = byte(0x06) // Mapping version 3.0
 )
 
 // TLV represents a plain TLV block which is just a container for some data.
@@ -59,6 +64,10 @@ func (tlv *TLV) Unmarshal(buf []byte) (rLen int, err error) {
 	tlv.Reset()
 
 	tlv.T = helpers.GetByte(bytesBuf)
+	if tlv.IsNULLTLV() || tlv.IsTerminatorTLV() {
+		// No length nor value fields
+		return 1, nil
+	}
 	if bytesBuf.Len() == 0 {
 		// No length field. pff
 		tlv.L = 0
@@ -96,6 +105,9 @@ func (tlv *TLV) Marshal() ([]byte, error) {
 	}
 	var buffer bytes.Buffer
 	buffer.WriteByte(tlv.T)
+	if tlv.IsNULLTLV() || tlv.IsTerminatorTLV() {
+		return buffer.Bytes(), nil
+	}
 	if tlv.L >= 0xFF { // 3 byte format
 		buffer.WriteByte(0xFF)
 		lBytes := helpers.Uint16ToBytes(tlv.L)
@@ -133,9 +145,23 @@ func (tlv *TLV) check() error {
 		return errors.New(
 			"TLV.check: L[ength] does not match the V[alue] length")
 	}
+	if (tlv.IsNULLTLV() || tlv.IsTerminatorTLV()) && tlv.L != 0 {
+		return errors.New(
+			"TLV.check: NULL and Terminator TLVs cannot have a value")
+	}
 	return nil
 }
 
+// IsNULLTLV returns true if the T field indicates a NULL TLV.
+func (tlv *TLV) IsNULLTLV() bool {
+	return tlv.T == TypeNULLTLV
+}
+
+// IsTerminatorTLV returns true if the T field indicates a Terminator TLV.
+func (tlv *TLV) IsTerminatorTLV() bool {
+	return tlv.T == TypeTerminatorTLV
+}
+
 /////////////////////////////////////////////////////////////////////////
 
 // ControlTLV is a specialized version of a TLV with a fixed size and a
@@ -217,13 +243,8 @@ func (cTLV *ControlTLV) Marshal() ([]byte, error) {
 // ControlTLV have a number of Rerserved values for FileIDs and
 // access conditions which should not be used.
 func (cTLV *ControlTLV) check() error {
-	switch cTLV.FileID {
-	case 0x000, 0xe102, 0xe103, 0x3f00, 0x3fff:
-		return errors.New(
-			"ControlTLV.check: File ID is reserved by ISO/IEC_7816-4")
-
-	case 0xffff:
-		return errors.New("ControlTLV.check: File ID is invalid (RFU)")
+	if err := checkFileID(cTLV.FileID, "ControlTLV.check"); err != nil {
+		return err
 	}
 
 	if 0x0000 <= cTLV.MaximumFileSize && cTLV.MaximumFileSize <= 0x0004 {
@@ -231,14 +252,35 @@ func (cTLV *ControlTLV) check() error {
 			"ControlTLV.check: Maximum File Size value is RFU")
 	}
 
-	if 0x01 <= cTLV.FileReadAccessCondition && cTLV.FileReadAccessCondition <= 0x7f {
+	return checkAccessConditions(cTLV.FileReadAccessCondition,
+		cTLV.FileWriteAccessCondition, "ControlTLV.check")
+}
+
+// checkFileID returns an error when the File ID of a control TLV
+// is reserved or invalid.
+func checkFileID(fileID uint16, op string) error {
+	switch fileID {
+	case 0x000, 0xe102, 0xe103, 0x3f00, 0x3fff:
 		return errors.New(
-			"ControlTLV.check: Read Access Condition has RFU value")
+			op + ": File ID is reserved by ISO/IEC_7816-4")
+
+	case 0xffff:
+		return errors.New(op + ": File ID is invalid (RFU)")
 	}
+	return nil
+}
 
-	if 0x01 <= cTLV.FileWriteAccessCondition && cTLV.FileWriteAccessCondition <= 0x7f {
+// checkAccessConditions returns an error when the read or write
+// access conditions of a control TLV have RFU values.
+func checkAccessConditions(read, write byte, op string) error {
+	if 0x01 <= read && read <= 0x7f {
 		return errors.New(
-			"ControlTLV.check: Write Access Condition has RFU value")
+			op + ": Read Access Condition has RFU value")
+	}
+
+	if 0x01 <= write && write <= 0x7f {
+		return errors.New(
+			op + ": Write Access Condition has RFU value")
 	}
 	return nil
 }
@@ -327,3 +369,140 @@ func (cTLV *ControlTLV) IsFileWriteable() bool {
 func (cTLV *ControlTLV) IsFileReadOnly() bool {
 	return cTLV.FileWriteAccessCondition == 0xFF && cTLV.IsFileReadable()
 }
+
+// IsFileReadProtected returns true when the ReadAccessCondition field
+// indicates a proprietary access condition (80h-FEh), which usually
+// means that the file is protected by a password.
+func (cTLV *ControlTLV) IsFileReadProtected() bool {
+	return 0x80 <= cTLV.FileReadAccessCondition &&
+		cTLV.FileReadAccessCondition <= 0xFE
+}
+
+// IsFileWriteProtected returns true when the WriteAccessCondition field
+// indicates a proprietary access condition (80h-FEh), which usually
+// means that the file is protected by a password.
+func (cTLV *ControlTLV) IsFileWriteProtected() bool {
+	return 0x80 <= cTLV.FileWriteAccessCondition &&
+		cTLV.FileWriteAccessCondition <= 0xFE
+}
+
+/////////////////////////////////////////////////////////////////////////
+
+// ExtendedNDEFFileControlTLV is used by Capability Containers with mapping
+// version 3.0 instead of the NDEFFileControlTLV. It allows NDEF Files
+// larger than 64KB, whose size is indicated with 4 bytes. The NDEF
+// Messages in these files are preceded by a 4-byte length (ENLEN)
+// instead of NLEN.
+type ExtendedNDEFFileControlTLV struct {
+	T byte // Should always be 06h
+	L byte // Size of the value field. Always 08h.
+	// A valid File ID: 0001h-E101h, E104h-3EFFh, 3F01h-3FFEh, 4000h-FFFEh.
+	FileID uint16
+	// Size of the file containing the NDEF message.
+	// 00000005h-FFFFFFFEh.
+	MaximumFileSize          uint32
+	FileReadAccessCondition  byte
+	FileWriteAccessCondition byte
+}
+
+// Unmarshal parses a byte slice and sets the ExtendedNDEFFileControlTLV
+// fields accordingly.
+// It returns the number of bytes parsed or an error if the result does
+// not follow the specification.
+func (eTLV *ExtendedNDEFFileControlTLV) Unmarshal(buf []byte) (rLen int, err error) {
+	// Parse it to a regular TLV
+	tlv := new(TLV)
+	rLen, err = tlv.Unmarshal(buf)
+	if err != nil {
+		return rLen, err
+	}
+	if rLen != 10 {
+		return rLen, fmt.Errorf("ExtendedNDEFFileControlTLV: "+
+			"Wrong size %d", rLen)
+	}
+
+	eTLV.T = tlv.T
+	eTLV.L = byte(tlv.L)
+	eTLV.FileID = helpers.BytesToUint16([2]byte{tlv.V[0], tlv.V[1]})
+	eTLV.MaximumFileSize = uint32(tlv.V[2])<<24 |
+		uint32(tlv.V[3])<<16 |
+		uint32(tlv.V[4])<<8 |
+		uint32(tlv.V[5])
+	eTLV.FileReadAccessCondition = tlv.V[6]
+	eTLV.FileWriteAccessCondition = tlv.V[7]
+
+	if err := eTLV.check(); err != nil {
+		return rLen, err
+	}
+	return rLen, nil
+}
+
+// Marshal returns the byte slice representation of an
+// ExtendedNDEFFileControlTLV. It returns an error if it does not
+// look correct.
+func (eTLV *ExtendedNDEFFileControlTLV) Marshal() ([]byte, error) {
+	if err := eTLV.check(); err != nil {
+		return nil, err
+	}
+
+	// Copy this to a regular TLV and leverage Marshal() from there
+	tlv := new(TLV)
+	tlv.T = eTLV.T
+	tlv.L = uint16(eTLV.L)
+	var v bytes.Buffer
+	fileID := helpers.Uint16ToBytes(eTLV.FileID)
+	v.Write(fileID[:])
+	v.Write([]byte{
+		byte(eTLV.MaximumFileSize >> 24),
+		byte(eTLV.MaximumFileSize >> 16),
+		byte(eTLV.MaximumFileSize >> 8),
+		byte(eTLV.MaximumFileSize)})
+	v.WriteByte(eTLV.FileReadAccessCondition)
+	v.WriteByte(eTLV.FileWriteAccessCondition)
+	tlv.V = v.Bytes()
+	return tlv.Marshal()
+}
+
+// Check makes sure that the ExtendedNDEFFileControlTLV is not breaking
+// the specification by checking its fields' values are acceptable. If
+// not, it returns an error.
+func (eTLV *ExtendedNDEFFileControlTLV) check() error {
+	if eTLV.T != TypeExtendedNDEFFileControlTLV {
+		return errors.New("ExtendedNDEFFileControlTLV.check: " +
+			"TLV is not an Extended NDEF File Control TLV")
+	}
+	if eTLV.L != 0x08 {
+		return errors.New("ExtendedNDEFFileControlTLV.check: " +
+			"L should be 08h")
+	}
+
+	if err := checkFileID(eTLV.FileID, "ExtendedNDEFFileControlTLV.check"); err != nil {
+		return err
+	}
+
+	if eTLV.MaximumFileSize <= 0x00000004 || eTLV.MaximumFileSize == 0xFFFFFFFF {
+		return errors.New("ExtendedNDEFFileControlTLV.check: " +
+			"Maximum File Size value is RFU")
+	}
+
+	return checkAccessConditions(eTLV.FileReadAccessCondition,
+		eTLV.FileWriteAccessCondition, "ExtendedNDEFFileControlTLV.check")
+}
+
+// IsFileReadable returns true when the ReadAccessCondition field indicates
+// that the NDEF File is readable.
+func (eTLV *ExtendedNDEFFileControlTLV) IsFileReadable() bool {
+	return eTLV.FileReadAccessCondition == 0x00
+}
+
+// IsFileWriteable returns true when the WriteAccessCondition field
+// indicates that the NDEF File is writeable.
+func (eTLV *ExtendedNDEFFileControlTLV) IsFileWriteable() bool {
+	return eTLV.FileWriteAccessCondition == 0x00
+}
+
+// IsFileReadOnly returns true when the access conditions indicate
+// that the NDEF File is read-only.
+func (eTLV *ExtendedNDEFFileControlTLV) IsFileReadOnly() bool {
+	return eTLV.FileWriteAccessCondition == 0xFF && eTLV.IsFileReadable()
+}
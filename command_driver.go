@@ -37,3 +37,18 @@ type CommandDriver interface {
 	// Sends and receive bytes to the NFC device
 	TransceiveBytes(tx []byte, rxLen int) ([]byte, error)
 }
+
+// TargetInfo holds information which identifies the physical tag
+// selected by a driver.
+type TargetInfo struct {
+	UID  []byte  // Unique identifier (or random ID) of the tag
+	ATQA [2]byte // Answer to request (ISO/IEC 14443 Type A)
+	SAK  byte    // Select acknowledge (ISO/IEC 14443 Type A)
+	ATS  []byte  // Answer to select, when available
+}
+
+// TargetInformer is implemented by the CommandDrivers which can
+// provide information about the selected tag after Initialize().
+type TargetInformer interface {
+	TargetInfo() (TargetInfo, error)
+}
@@ -18,12 +18,18 @@
 package nfctype4
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 
 	"github.com/hsanjuan/go-nfctype4/apdu"
 )
 
+// maxResponseLen is the largest response accepted, accumulating GET
+// RESPONSE commands, for commands without an Le field. It is the
+// largest Le which can be requested.
+const maxResponseLen = 65536
+
 // Commander can be used to perform the NDEF Type 4 Tag Command Set
 // operations: Select, ReadBinary and UpdateBinary
 //
@@ -33,105 +39,287 @@ import (
 type Commander struct {
 	// Driver is the CommandDriver in charge of communicating with the tags.
 	Driver CommandDriver
+	// ExtendedLength enables the use of extended Lc and Le fields
+	// (3 bytes), which allow ReadBinary and UpdateBinary transfers
+	// larger than 256 and 255 bytes respectively. Only enable it
+	// when the tag supports extended-length APDUs.
+	ExtendedLength bool
+	// MaxReadBinaryLen and MaxUpdateBinaryLen limit the amount of
+	// data transferred by a single ReadBinary and UpdateBinary
+	// command (MLe and MLc in the Capability Container). Larger
+	// operations are split into several commands. Zero means no
+	// limit other than the one imposed by the APDU format.
+	MaxReadBinaryLen   uint16
+	MaxUpdateBinaryLen uint16
+	// Progress, when set, is called after every command of
+	// ReadBinary and UpdateBinary operations.
+	Progress Progress
+	// Retries is the number of times that a command is sent again
+	// when the CommandDriver fails to exchange it with the tag.
+	// Errors indicated by the tag in the response are not retried.
+	Retries int
 }
 
+// Maximum data lengths which can be transferred with short and
+// extended APDUs.
+const (
+	maxShortLe    = 256
+	maxShortLc    = 255
+	maxExtendedLe = 65536
+	maxExtendedLc = 0xFFFF
+)
+
+// offsetDataObjectLen is the length of the offset data objects
+// produced by the apdu package (54h 03h XX XX XX).
+const offsetDataObjectLen = 5
+
 // Select perfoms a select operation by file ID
 // It returns an error if something fails, like cases when the
 // response does not indicate success.
+//
+// Errors caused by the status of the response are always of type
+// *apdu.StatusError in this and the rest of Commander operations.
 func (cmder *Commander) Select(fileID uint16) error {
 	if cmder.Driver == nil {
 		return errors.New("command driver not set")
 	}
 	cApdu := apdu.NewSelectAPDU(fileID)
-	cApduBytes, err := cApdu.Marshal()
-	if err != nil {
-		return err
-	}
 	maxRXLen := cApdu.GetLe() + 2 // For SW bytes
-	response, err := cmder.Driver.TransceiveBytes(cApduBytes, int(maxRXLen))
+	rApdu, err := cmder.transceive(cApdu, maxRXLen)
 	if err != nil {
 		return err
 	}
 
-	rApdu := new(apdu.RAPDU)
-	if _, err = rApdu.Unmarshal(response); err != nil {
-		return err
-	}
-
 	if rApdu.CommandCompleted() {
 		return nil
-	} else if rApdu.FileNotFound() {
-		return fmt.Errorf("Commander.Select: "+
-			"File %02xh not found", fileID)
-	} else {
-		return fmt.Errorf("Select: "+
-			"Unknown error. SW1: %02xh. SW2: %02xh",
-			rApdu.SW1,
-			rApdu.SW2)
 	}
+	return statusError("Commander.Select", rApdu)
 }
 
 // ReadBinary performs a read binary operation with the given
 // offset and length.
 // It returns the Payload of the response (which may be shorter
-// than the length provided), or an error if the operation is not
-// successful.
+// than the length provided when the end of the file is reached),
+// or an error if the operation is not successful.
+//
+// Reads larger than what a single command allows (see
+// MaxReadBinaryLen and ExtendedLength) are split into several
+// ReadBinary commands. Tags may also return less data than
+// requested, in which case the rest is requested with further
+// commands.
+//
+// When the tag complains about a wrong Le (SW1 = 6Ch), the
+// read is retried with the length indicated by the tag in SW2.
+// The end-of-file warning (6282h) is not an error: the response
+// is just shorter.
+//
+// Offsets beyond apdu.MaxOffset cannot be coded in P1-P2. Those
+// parts of the file are read with ReadBinary commands using the odd
+// instruction byte (see ReadBinaryODO).
 func (cmder *Commander) ReadBinary(offset uint16, length uint16) ([]byte, error) {
 	if cmder.Driver == nil {
 		return nil, errors.New("Command driver not set")
 	}
-	cApdu := apdu.NewReadBinaryAPDU(offset, length)
-	cApduBytes, err := cApdu.Marshal()
-	if err != nil {
-		return nil, err
+	return cmder.readBinaryChunks(uint32(offset), int(length), false,
+		"Commander.ReadBinary")
+}
+
+// ReadBinaryODO performs a read binary operation with the given
+// offset and length using the odd instruction byte, where the offset
+// is provided in an offset data object (ODO). This allows to read
+// files larger than 32KB.
+//
+// It behaves like ReadBinary otherwise, and returns the contents of
+// the discretionary data objects in the responses.
+func (cmder *Commander) ReadBinaryODO(offset uint32, length uint16) ([]byte, error) {
+	if cmder.Driver == nil {
+		return nil, errors.New("Command driver not set")
 	}
-	response, err := cmder.Driver.TransceiveBytes(cApduBytes, int(length)+2)
-	if err != nil {
-		return nil, err
+	return cmder.readBinaryChunks(offset, int(length), true,
+		"Commander.ReadBinaryODO")
+}
+
+// readBinaryChunks reads length bytes starting at offset, doing as
+// many ReadBinary commands as necessary. It stops early when the tag
+// signals the end of the file or does not return any data.
+func (cmder *Commander) readBinaryChunks(offset uint32, length int, odo bool, op string) ([]byte, error) {
+	var buffer bytes.Buffer // to hold what we are reading
+	for buffer.Len() < length {
+		pos := offset + uint32(buffer.Len())
+		useODO := odo || pos > apdu.MaxOffset
+		readLen := cmder.maxReadLen(useODO)
+		if rest := length - buffer.Len(); rest < readLen { // last round
+			readLen = rest
+		}
+
+		var cApdu *apdu.CAPDU
+		if useODO {
+			cApdu = apdu.NewReadBinaryODOAPDU(pos, readLen)
+		} else {
+			cApdu = apdu.NewReadBinaryAPDU(uint16(pos), readLen)
+		}
+		chunk, eof, err := cmder.readBinary(cApdu, useODO, op)
+		if err != nil {
+			return nil, err
+		}
+		if len(chunk) > readLen {
+			chunk = chunk[:readLen]
+		}
+		buffer.Write(chunk)
+		cmder.Progress.Report(buffer.Len(), length)
+		if eof || len(chunk) == 0 {
+			break
+		}
 	}
+	return buffer.Bytes(), nil
+}
 
-	rApdu := new(apdu.RAPDU)
-	if _, err = rApdu.Unmarshal(response); err != nil {
-		return nil, err
+// maxReadLen returns how many bytes of the file can be read with a
+// single ReadBinary command.
+func (cmder *Commander) maxReadLen(odo bool) int {
+	maxLen := maxShortLe
+	if cmder.ExtendedLength {
+		maxLen = maxExtendedLe
 	}
-	if rApdu.CommandCompleted() {
-		return rApdu.ResponseBody, nil
+	if cmder.MaxReadBinaryLen > 0 && int(cmder.MaxReadBinaryLen) < maxLen {
+		maxLen = int(cmder.MaxReadBinaryLen)
+	}
+	if odo { // The response data object needs some room too.
+		maxLen -= apdu.DataObjectOverhead(maxLen)
 	}
+	return maxLen
+}
 
-	return nil, fmt.Errorf("Commander.ReadBinary: "+
-		"Error. SW1: %02xh. SW2: %02xh",
-		rApdu.SW1,
-		rApdu.SW2)
+// readBinary sends a ReadBinary command and returns the data read and
+// whether the end of the file was reached.
+func (cmder *Commander) readBinary(cApdu *apdu.CAPDU, odo bool, op string) ([]byte, bool, error) {
+	maxRXLen := cApdu.GetLe() + 2 // For SW bytes
+	rApdu, err := cmder.transceive(cApdu, maxRXLen)
+	if err != nil {
+		return nil, false, err
+	}
+	if rApdu.WrongLe() {
+		cApdu.SetLe(rApdu.CorrectLe())
+		maxRXLen := cApdu.GetLe() + 2 // For SW bytes
+		rApdu, err = cmder.transceive(cApdu, maxRXLen)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	if !rApdu.CommandCompleted() && !rApdu.EndOfFile() {
+		return nil, false, statusError(op, rApdu)
+	}
+
+	eof := rApdu.EndOfFile()
+	body := rApdu.ResponseBody
+	if !odo || len(body) == 0 {
+		return body, eof, nil
+	}
+	tag, value, _, err := apdu.UnmarshalDataObject(body)
+	if err != nil {
+		return nil, false, err
+	}
+	if tag != apdu.TagDiscretionaryDataObject {
+		return nil, false, fmt.Errorf("%s: "+
+			"unexpected data object %02xh in response", op, tag)
+	}
+	return value, eof, nil
 }
 
 // UpdateBinary performs an update operation, which
 // allows to erase and write the NDEF file.
+//
+// Data larger than what a single command allows (see
+// MaxUpdateBinaryLen and ExtendedLength) is written with several
+// UpdateBinary commands.
+//
+// Offsets beyond apdu.MaxOffset cannot be coded in P1-P2. Those
+// parts of the file are written with UpdateBinary commands using the
+// odd instruction byte (see UpdateBinaryODO).
 func (cmder *Commander) UpdateBinary(buf []byte, offset uint16) error {
 	if cmder.Driver == nil {
 		return errors.New("Command driver not set")
 	}
-	cApdu := apdu.NewUpdateBinaryAPDU(buf, offset)
-	cApduBytes, err := cApdu.Marshal()
-	if err != nil {
-		return err
+	return cmder.updateBinaryChunks(buf, uint32(offset), false,
+		"Commander.UpdateBinary")
+}
+
+// UpdateBinaryODO performs an update operation using the odd
+// instruction byte, where the offset is provided in an offset data
+// object (ODO) and the data in a discretionary data object. This
+// allows to write files larger than 32KB.
+//
+// Note that the data objects take some room in the command, so less
+// data fits in each command than with UpdateBinary.
+func (cmder *Commander) UpdateBinaryODO(buf []byte, offset uint32) error {
+	if cmder.Driver == nil {
+		return errors.New("Command driver not set")
 	}
-	response, err := cmder.Driver.TransceiveBytes(cApduBytes, 2) // SW bytes
-	if err != nil {
-		return err
+	return cmder.updateBinaryChunks(buf, offset, true,
+		"Commander.UpdateBinaryODO")
+}
+
+// updateBinaryChunks writes buf starting at offset, doing as many
+// UpdateBinary commands as necessary.
+func (cmder *Commander) updateBinaryChunks(buf []byte, offset uint32, odo bool, op string) error {
+	totalWrite := 0
+	for {
+		pos := offset + uint32(totalWrite)
+		useODO := odo || pos > apdu.MaxOffset
+		writeLen := cmder.maxUpdateLen(useODO)
+		if writeLen < 1 {
+			return fmt.Errorf("%s: "+
+				"MaxUpdateBinaryLen is too small", op)
+		}
+		if rest := len(buf) - totalWrite; rest < writeLen { // last round
+			writeLen = rest
+		}
+
+		chunk := buf[totalWrite : totalWrite+writeLen]
+		var cApdu *apdu.CAPDU
+		if useODO {
+			cApdu = apdu.NewUpdateBinaryODOAPDU(chunk, pos)
+		} else {
+			cApdu = apdu.NewUpdateBinaryAPDU(chunk, uint16(pos))
+		}
+		if err := cmder.updateBinary(cApdu, op); err != nil {
+			return err
+		}
+		totalWrite += writeLen
+		cmder.Progress.Report(totalWrite, len(buf))
+		if totalWrite >= len(buf) {
+			return nil
+		}
 	}
+}
 
-	rApdu := new(apdu.RAPDU)
-	if _, err = rApdu.Unmarshal(response); err != nil {
+// maxUpdateLen returns how many bytes of data can be written with a
+// single UpdateBinary command.
+func (cmder *Commander) maxUpdateLen(odo bool) int {
+	maxLen := maxShortLc
+	if cmder.ExtendedLength {
+		maxLen = maxExtendedLc
+	}
+	if cmder.MaxUpdateBinaryLen > 0 && int(cmder.MaxUpdateBinaryLen) < maxLen {
+		maxLen = int(cmder.MaxUpdateBinaryLen)
+	}
+	if odo { // The data objects need some room too.
+		maxLen -= offsetDataObjectLen
+		maxLen -= apdu.DataObjectOverhead(maxLen)
+	}
+	return maxLen
+}
+
+func (cmder *Commander) updateBinary(cApdu *apdu.CAPDU, op string) error {
+	rApdu, err := cmder.transceive(cApdu, 2) // SW bytes
+	if err != nil {
 		return err
 	}
 	if rApdu.CommandCompleted() {
 		return nil
 	}
 
-	return fmt.Errorf("Commander.UpdateBinary: "+
-		"Error. SW1: %02xh. SW2: %02xh",
-		rApdu.SW1,
-		rApdu.SW2)
+	return statusError(op, rApdu)
 }
 
 // NDEFApplicationSelect performs a Select operation on the NDEF
@@ -143,30 +331,160 @@ func (cmder *Commander) NDEFApplicationSelect() error {
 			"Driver not set")
 	}
 	cApdu := apdu.NewNDEFTagApplicationSelectAPDU()
-	cApduBytes, err := cApdu.Marshal()
+	maxRXLen := cApdu.GetLe() + 2 // For SW bytes
+	rApdu, err := cmder.transceive(cApdu, maxRXLen)
 	if err != nil {
 		return err
 	}
-	maxRXLen := cApdu.GetLe() + 2 // For SW bytes
-	response, err := cmder.Driver.TransceiveBytes(cApduBytes, int(maxRXLen))
+
+	if rApdu.CommandCompleted() {
+		return nil
+	}
+	return statusError("Commander.NDEFApplicationSelect", rApdu)
+}
+
+// Verify performs a VERIFY operation presenting the password
+// with the given ID, which grants access to files protected by it
+// (as done by ST M24SR and ST25TA tags, for example). Usually, the
+// protected file must be selected first.
+//
+// It returns an error if the password is not accepted. In that
+// case, SW2 usually indicates how many tries are left (63CXh).
+func (cmder *Commander) Verify(passwordID uint16, password []byte) error {
+	if cmder.Driver == nil {
+		return errors.New("Commander.Verify: Driver not set")
+	}
+	cApdu := apdu.NewVerifyAPDU(passwordID, password)
+	rApdu, err := cmder.transceive(cApdu, 2) // SW bytes
 	if err != nil {
 		return err
 	}
 
+	if rApdu.CommandCompleted() {
+		return nil
+	}
+	return statusError("Commander.Verify", rApdu)
+}
+
+// SelectApplication performs a Select operation by name with the
+// given application identifier (AID). This allows to switch between
+// the NDEF Application and other applications in multi-application
+// cards within the same session.
+//
+// It returns the File Control Information (FCI) provided in the
+// response, which may be empty, or an error if the application
+// cannot be selected.
+func (cmder *Commander) SelectApplication(aid []byte) ([]byte, error) {
+	if cmder.Driver == nil {
+		return nil, errors.New("Commander.SelectApplication: " +
+			"Driver not set")
+	}
+	if len(aid) == 0 || len(aid) > 16 {
+		return nil, errors.New("Commander.SelectApplication: " +
+			"AID must have between 1 and 16 bytes")
+	}
+	cApdu := apdu.NewSelectByNameAPDU(aid)
+	maxRXLen := cApdu.GetLe() + 2 // For SW bytes
+	rApdu, err := cmder.transceive(cApdu, maxRXLen)
+	if err != nil {
+		return nil, err
+	}
+
+	if rApdu.CommandCompleted() {
+		return rApdu.ResponseBody, nil
+	}
+	return nil, statusError("Commander.SelectApplication", rApdu)
+}
+
+// Transceive sends an arbitrary Command APDU to the tag and returns
+// the Response APDU, without interpreting its status. This allows to
+// use vendor-specific commands within the current session.
+//
+// The maximum response length is derived from the Le field of the
+// command. Responses with SW1 = 61h are completed with GET RESPONSE
+// commands. It returns an error if the exchange itself fails.
+func (cmder *Commander) Transceive(cApdu *apdu.CAPDU) (*apdu.RAPDU, error) {
+	if cmder.Driver == nil {
+		return nil, errors.New("Commander.Transceive: Driver not set")
+	}
+	maxRXLen := cApdu.GetLe() + 2 // For SW bytes
+	return cmder.transceive(cApdu, maxRXLen)
+}
+
+// transceive serializes a Command APDU, sends it with the Driver
+// and parses the response into a Response APDU.
+//
+// When the tag indicates that more data is available (SW1 = 61h),
+// GET RESPONSE commands are issued until all of it has been
+// received. The returned RAPDU carries the concatenated data and
+// the status of the last response. In total, the tag may not send
+// more than the Le of the command (or maxResponseLen when it has no
+// Le field), so that a misbehaving tag cannot keep us reading forever.
+func (cmder *Commander) transceive(cApdu *apdu.CAPDU, rxLen int) (*apdu.RAPDU, error) {
+	rApdu, err := cmder.exchange(cApdu, rxLen)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := cApdu.GetLe()
+	if limit == 0 {
+		limit = maxResponseLen
+	}
+	body := rApdu.ResponseBody
+	for rApdu.MoreDataAvailable() {
+		if len(body) >= limit {
+			return nil, responseTooLong(limit)
+		}
+		getResponse := apdu.NewGetResponseAPDU(rApdu.RemainingLe())
+		maxRXLen := getResponse.GetLe() + 2 // For SW bytes
+		rApdu, err = cmder.exchange(getResponse, maxRXLen)
+		if err != nil {
+			return nil, err
+		}
+		if len(rApdu.ResponseBody) == 0 && rApdu.MoreDataAvailable() {
+			return nil, errors.New("Commander: " +
+				"GET RESPONSE did not return any data")
+		}
+		body = append(body, rApdu.ResponseBody...)
+		if len(body) > limit {
+			return nil, responseTooLong(limit)
+		}
+	}
+	rApdu.ResponseBody = body
+	return rApdu, nil
+}
+
+func responseTooLong(limit int) error {
+	return fmt.Errorf("Commander: the response exceeds the %d "+
+		"bytes requested", limit)
+}
+
+// exchange performs a single Command-Response APDU exchange.
+func (cmder *Commander) exchange(cApdu *apdu.CAPDU, rxLen int) (*apdu.RAPDU, error) {
+	cApduBytes, err := cApdu.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	response, err := cmder.Driver.TransceiveBytes(cApduBytes, rxLen)
+	for retry := 0; err != nil && retry < cmder.Retries; retry++ {
+		response, err = cmder.Driver.TransceiveBytes(cApduBytes, rxLen)
+	}
+	if err != nil {
+		return nil, err
+	}
+
 	rApdu := new(apdu.RAPDU)
 	if _, err = rApdu.Unmarshal(response); err != nil {
-		return err
+		return nil, err
 	}
+	return rApdu, nil
+}
 
-	if rApdu.CommandCompleted() {
-		return nil
-	} else if rApdu.FileNotFound() {
-		return errors.New("Commander.NDEFApplicationSelect: " +
-			"NDEF Tag Application not found")
-	} else {
-		return fmt.Errorf("Commander.NDEFApplicationSelect: "+
-			"unknown error. SW1: %02xh. SW2: %02xh",
-			rApdu.SW1,
-			rApdu.SW2)
+// statusError returns an *apdu.StatusError for a failed operation.
+func statusError(op string, rApdu *apdu.RAPDU) error {
+	return &apdu.StatusError{
+		Op:  op,
+		SW1: rApdu.SW1,
+		SW2: rApdu.SW2,
 	}
 }
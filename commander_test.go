@@ -0,0 +1,301 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package nfctype4
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/hsanjuan/go-ndef"
+	"github.com/hsanjuan/go-ndef/types/generic"
+	"github.com/hsanjuan/go-nfctype4/apdu"
+	"github.com/hsanjuan/go-nfctype4/drivers/swtag"
+	"github.com/hsanjuan/go-nfctype4/tags/static"
+)
+
+// countingDriver counts the commands sent to the tag.
+type countingDriver struct {
+	CommandDriver
+	count int
+}
+
+func (d *countingDriver) TransceiveBytes(tx []byte, rxLen int) ([]byte, error) {
+	d.count++
+	return d.CommandDriver.TransceiveBytes(tx, rxLen)
+}
+
+// flakyDriver fails every other exchange, before sending the command
+// to the tag.
+type flakyDriver struct {
+	CommandDriver
+	count int
+}
+
+func (d *flakyDriver) TransceiveBytes(tx []byte, rxLen int) ([]byte, error) {
+	d.count++
+	if d.count%2 == 1 {
+		return nil, errors.New("communication error")
+	}
+	return d.CommandDriver.TransceiveBytes(tx, rxLen)
+}
+
+func newLargeMessageCommander(t *testing.T) (*Commander, *countingDriver) {
+	tag := static.New()
+	payload := &generic.Payload{
+		Payload: make([]byte, 1000),
+	}
+	tag.SetMessage(ndef.NewMessage(ndef.NFCForumWellKnownType, "local", "", payload))
+	if err := tag.SetMaxDataLengths(0xFFFF, 0xFFFF); err != nil {
+		t.Fatal(err)
+	}
+	driver := &countingDriver{CommandDriver: &swtag.Driver{Tag: tag}}
+	cmder := &Commander{
+		Driver: driver,
+	}
+	if err := cmder.NDEFApplicationSelect(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cmder.Select(static.NDEFFileAddress); err != nil {
+		t.Fatal(err)
+	}
+	return cmder, driver
+}
+
+func TestCommander_ExtendedLength(t *testing.T) {
+	cmder, driver := newLargeMessageCommander(t)
+
+	testcases := []struct {
+		extended bool
+		commands int
+	}{
+		{false, 2},
+		{true, 1},
+	}
+	for _, c := range testcases {
+		cmder.ExtendedLength = c.extended
+		driver.count = 0
+		data, err := cmder.ReadBinary(0, 300)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(data) != 300 {
+			t.Error("ReadBinary should read 300 bytes. Got", len(data))
+		}
+		if driver.count != c.commands {
+			t.Errorf("extended: %t. Expected %d ReadBinary commands. Got %d",
+				c.extended, c.commands, driver.count)
+		}
+
+		driver.count = 0
+		err = cmder.UpdateBinary(data, 2)
+		if err != nil {
+			t.Error(err)
+		}
+		if driver.count != c.commands {
+			t.Errorf("extended: %t. Expected %d UpdateBinary commands. Got %d",
+				c.extended, c.commands, driver.count)
+		}
+	}
+}
+
+func TestCommander_MaxLen(t *testing.T) {
+	cmder, driver := newLargeMessageCommander(t)
+	cmder.MaxReadBinaryLen = 100
+	cmder.MaxUpdateBinaryLen = 60
+
+	driver.count = 0
+	data, err := cmder.ReadBinary(0, 250)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 250 || driver.count != 3 {
+		t.Errorf("expected 250 bytes in 3 commands. Got %d bytes in %d",
+			len(data), driver.count)
+	}
+	odd, err := cmder.ReadBinaryODO(0, 250)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, odd) {
+		t.Error("ReadBinaryODO returned different data")
+	}
+
+	driver.count = 0
+	if err := cmder.UpdateBinary(data, 0); err != nil {
+		t.Fatal(err)
+	}
+	if driver.count != 5 {
+		t.Error("expected 5 UpdateBinary commands. Got", driver.count)
+	}
+	if err := cmder.UpdateBinaryODO(data, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	var reports []int
+	cmder.Progress = func(done, total int) {
+		reports = append(reports, done)
+	}
+	if err := cmder.UpdateBinary(data, 0); err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 5 || reports[4] != 250 {
+		t.Error("unexpected progress reports:", reports)
+	}
+	cmder.Progress = nil
+
+	cmder.MaxUpdateBinaryLen = 5
+	if err := cmder.UpdateBinaryODO(data, 0); err == nil {
+		t.Error("data objects should not fit in 5 bytes")
+	}
+}
+
+func TestCommander_ReadBinaryODO(t *testing.T) {
+	tag := static.New()
+	tag.SetMessage(ndef.NewTextMessage("odd instruction bytes", "en"))
+	cmder := &Commander{
+		Driver: &swtag.Driver{Tag: tag},
+	}
+	if err := cmder.NDEFApplicationSelect(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cmder.Select(static.NDEFFileAddress); err != nil {
+		t.Fatal(err)
+	}
+
+	even, err := cmder.ReadBinary(0, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	odd, err := cmder.ReadBinaryODO(0, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(even, odd) {
+		t.Errorf("ReadBinaryODO: expected % 02X. Got % 02X", even, odd)
+	}
+
+	if err := cmder.UpdateBinaryODO([]byte{0x00, 0x00}, 0); err != nil {
+		t.Fatal(err)
+	}
+	if tag.GetMessage() != nil {
+		t.Error("UpdateBinaryODO should have cleared NLEN")
+	}
+}
+
+func TestCommander_Retries(t *testing.T) {
+	driver := &flakyDriver{CommandDriver: &swtag.Driver{Tag: static.New()}}
+	cmder := &Commander{Driver: driver}
+	if err := cmder.NDEFApplicationSelect(); err == nil {
+		t.Error("the command should fail without retries")
+	}
+	driver.count = 0
+	cmder.Retries = 1
+	if err := cmder.NDEFApplicationSelect(); err != nil {
+		t.Error(err)
+	}
+	if driver.count != 2 {
+		t.Error("expected 2 exchanges. Got", driver.count)
+	}
+}
+
+func TestCommander_Transceive(t *testing.T) {
+	cmder := &Commander{}
+	if _, err := cmder.Transceive(apdu.NewSelectAPDU(0xE103)); err == nil {
+		t.Error("Transceive without driver should fail")
+	}
+
+	cmder.Driver = &swtag.Driver{Tag: static.New()}
+	rapdu, err := cmder.Transceive(apdu.NewNDEFTagApplicationSelectAPDU())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rapdu.CommandCompleted() {
+		t.Error("NDEF Application select should have succeeded:", rapdu)
+	}
+
+	// Unknown instruction: the status is returned, not an error
+	rapdu, err = cmder.Transceive(&apdu.CAPDU{CLA: 0x90, INS: 0x60})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rapdu.CommandCompleted() {
+		t.Error("unknown instruction should not have succeeded")
+	}
+}
+
+// endlessDriver always answers that more data is available.
+type endlessDriver struct {
+	CommandDriver
+	count int
+}
+
+func (d *endlessDriver) TransceiveBytes(tx []byte, rxLen int) ([]byte, error) {
+	d.count++
+	return append(make([]byte, 16), 0x61, 0x10), nil
+}
+
+func TestCommander_GetResponseLimit(t *testing.T) {
+	testcases := []struct {
+		le       int
+		commands int
+	}{
+		{0, 4096},
+		{16, 1},
+		{40, 3},
+	}
+	for i, c := range testcases {
+		driver := &endlessDriver{}
+		cmder := &Commander{Driver: driver}
+		capdu := &apdu.CAPDU{CLA: 0x90, INS: 0x60}
+		capdu.SetLe(c.le)
+		if _, err := cmder.Transceive(capdu); err == nil {
+			t.Errorf("%d: an endless response should fail", i)
+		}
+		if driver.count != c.commands {
+			t.Errorf("%d: expected %d exchanges. Got %d",
+				i, c.commands, driver.count)
+		}
+	}
+}
+
+func TestCommander_SelectApplication(t *testing.T) {
+	cmder := &Commander{
+		Driver: &swtag.Driver{Tag: static.New()},
+	}
+	fci, err := cmder.SelectApplication([]byte{0xD2, 0x76, 0x00, 0x00, 0x85, 0x01, 0x01})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fci) != 0 {
+		t.Error("static tags do not return FCI")
+	}
+
+	_, err = cmder.SelectApplication([]byte{0xA0, 0x00, 0x00, 0x03, 0x08})
+	var statusErr *apdu.StatusError
+	if !errors.As(err, &statusErr) {
+		t.Fatal("expected a status error:", err)
+	}
+	if statusErr.SW1 != 0x6A || statusErr.SW2 != 0x82 {
+		t.Errorf("unexpected status: %02x%02x", statusErr.SW1, statusErr.SW2)
+	}
+
+	if _, err = cmder.SelectApplication(nil); err == nil {
+		t.Error("empty AIDs should not be allowed")
+	}
+}
@@ -18,13 +18,31 @@
 package nfctype4
 
 import (
-	"bytes"
+	"encoding/binary"
 	"errors"
 	"fmt"
 
 	"github.com/hsanjuan/go-ndef"
 	"github.com/hsanjuan/go-nfctype4/capabilitycontainer"
 	"github.com/hsanjuan/go-nfctype4/helpers"
+	"github.com/hsanjuan/go-nfctype4/signature"
+)
+
+// ErrUnsupportedVersion is returned (wrapped) by the Device operations when
+// the Capability Container of a tag indicates a mapping version whose major
+// number is not supported by the Device. Use errors.Is() to check for it.
+var ErrUnsupportedVersion = errors.New("unsupported mapping version")
+
+// minMLe is the smallest valid MLe value. It is used to read the
+// Capability Container before knowing the MLe of the tag.
+const minMLe = uint16(0x000F)
+
+// Password IDs used with the VERIFY command when the NDEF File has
+// proprietary access conditions. These follow the convention of
+// ST M24SR and ST25TA tags.
+const (
+	ReadPasswordID  = uint16(0x0001)
+	WritePasswordID = uint16(0x0002)
 )
 
 // Device represents an NFC Forum device, that is, an application
@@ -37,19 +55,58 @@ import (
 // The `nfctype4/drivers/libnfc` driver, for example, supports using a
 // libnfc-supported reader to talk to a real NFC Type 4 Tag.
 type Device struct {
-	MajorVersion byte // 2
-	MinorVersion byte // 0
-	commander    *Commander
+	// MajorVersion and MinorVersion indicate the mapping version
+	// followed by the Device (2.0 by default). Set MajorVersion to
+	// 3 to operate on tags with an Extended NDEF File (mapping
+	// version 3.0), whose NDEF Message is preceded by a 4-byte
+	// ENLEN instead of NLEN.
+	MajorVersion byte
+	MinorVersion byte
+	// IgnoreMappingVersion allows to operate on tags whose
+	// Capability Container indicates an unsupported mapping
+	// version. Only useful for experimentation.
+	IgnoreMappingVersion bool
+	// LenientCapabilityContainer allows to operate on tags whose
+	// Capability Container uses RFU values for CCLEN, MLe or MLc,
+	// as long as it can be parsed (see capabilitycontainer.Lenient).
+	LenientCapabilityContainer bool
+	// ReadPassword and WritePassword are presented to the tag with
+	// a VERIFY command when the access conditions of the NDEF File
+	// indicate that it is protected (proprietary values 80h-FEh).
+	ReadPassword  []byte
+	WritePassword []byte
+	// NDEFFileID and NDEFFileIndex select which NDEF File to
+	// operate on when the Capability Container declares several
+	// of them. NDEFFileID selects the file with that ID.
+	// NDEFFileIndex selects the n-th file (starting at 1). By
+	// default, the first readable NDEF File is used.
+	NDEFFileID    uint16
+	NDEFFileIndex int
+	// Progress, when set, is called while the NDEF Message is read
+	// or written, after every ReadBinary or UpdateBinary command.
+	Progress Progress
+	// Retries is the number of times that a command is sent again
+	// when the communication with the tag fails (see
+	// Commander.Retries).
+	Retries int
+	// Verifier, when set, is used by Read to verify the Signature
+	// records (NFC Forum Signature RTD) of the message. The results
+	// are available with Signatures. Read does not fail because of
+	// invalid signatures.
+	Verifier   *signature.Verifier
+	commander  *Commander
+	cc         *capabilitycontainer.CapabilityContainer
+	signatures []signature.Result
 }
 
 // tagState is used to store the relevant information obtained from a
 // NDEF Detection Procedure
 type tagState struct {
-	NLEN               uint16
-	MaxReadBinaryLen   uint16
-	MaxUpdateBinaryLen uint16
-	MaxNDEFLen         uint16
-	ReadOnly           bool
+	NLEN           uint32 // or ENLEN
+	NLENSize       uint32 // 2, or 4 for Extended NDEF Files
+	MaxNDEFLen     uint32
+	ReadOnly       bool
+	WriteProtected bool
 }
 
 // New returns a pointer to a new Device configured
@@ -81,12 +138,16 @@ func (dev *Device) Setup(cmdDriver CommandDriver) {
 // Read performs the NDEF Detect Procedure and, if successful,
 // performs a read operation on the NDEF File.
 //
+// When a Verifier is configured, the Signature records of the
+// message are verified afterwards (see Signatures).
+//
 // It returns the NDEFMessage stored in the tag, or an error
 // if something went wrong.
 func (dev *Device) Read() (*ndef.Message, error) {
 	if err := dev.checkReady(); err != nil {
 		return nil, err
 	}
+	dev.signatures = nil
 
 	// Initialize driver and make sure we close it at the end
 	err := dev.commander.Driver.Initialize()
@@ -106,38 +167,31 @@ func (dev *Device) Read() (*ndef.Message, error) {
 	}
 
 	// Message detected
-	// readLen represents what is the maximum amount of data we are going
-	// to read from the Tag in one go.
-	// It needs to be the minimum between maxReadBinaryLen and nlen
-	readLen := detectState.MaxReadBinaryLen
-	nlen := detectState.NLEN
-	if nlen < readLen {
-		readLen = nlen
-	}
-	// Read messages doing as many ReadBinary calls as necessary
-	totalRead := uint16(0)
-	var buffer bytes.Buffer // to hold what we are reading
-	for totalRead < nlen {
-		if nlen-totalRead < readLen { //last round
-			readLen = nlen - totalRead
-		}
-		// Always offset the nlen bytes (2)
-		chunk, err := dev.commander.ReadBinary(2+totalRead, readLen)
-		if err != nil {
-			return nil, err
-		}
-		buffer.Write(chunk)
-		totalRead += readLen
+	// The Commander does as many ReadBinary calls as necessary to
+	// collect NLEN bytes, without exceeding MLe, switching to the
+	// odd instruction byte for offsets beyond 32KB.
+	// Always offset the nlen bytes.
+	dev.commander.Progress = dev.Progress
+	ndefBytes, err := dev.commander.readBinaryChunks(detectState.NLENSize,
+		int(detectState.NLEN), false, "Commander.ReadBinary")
+	dev.commander.Progress = nil
+	if err != nil {
+		return nil, err
+	}
+	if len(ndefBytes) < int(detectState.NLEN) {
+		return nil, errors.New(
+			"Device.Read: unexpected end of NDEF File")
 	}
-
-	ndefBytes := buffer.Bytes()
-
 	// We finally have the NDEF Message. Parse it.
 	ndefMessage := new(ndef.Message)
 	if _, err := ndefMessage.Unmarshal(ndefBytes); err != nil {
 		return nil, err
 	}
 
+	if dev.Verifier != nil {
+		dev.signatures = dev.Verifier.Verify(ndefMessage)
+	}
+
 	// Finally, return the parsed NDEF Message
 	return ndefMessage, nil
 }
@@ -157,6 +211,24 @@ func (dev *Device) Read() (*ndef.Message, error) {
 // Update returns an error when there is a problem at some point
 // in the process.
 func (dev *Device) Update(m *ndef.Message) error {
+	messageBytes, err := m.Marshal()
+	if err != nil {
+		return err
+	}
+	return dev.UpdateBytes(messageBytes)
+}
+
+// UpdateBytes works like Update, but takes an already serialized NDEF
+// Message, which is written verbatim. This allows to restore exact
+// dumps of tags.
+//
+// The bytes are not validated: it is up to the caller to make sure
+// that they are a well-formed NDEF Message. An empty buffer is
+// rejected, as it would format the tag.
+func (dev *Device) UpdateBytes(messageBytes []byte) error {
+	if len(messageBytes) == 0 {
+		return errors.New("Device.UpdateBytes: empty NDEF Message")
+	}
 	if err := dev.checkReady(); err != nil {
 		return err
 	}
@@ -173,56 +245,37 @@ func (dev *Device) Update(m *ndef.Message) error {
 		return err
 	}
 
-	if detectState.ReadOnly {
-		return errors.New("Device.Update: the tag is read-only")
-	}
-
-	messageBytes, err := m.Marshal()
-	if err != nil {
+	if err := dev.checkWriteAccess(detectState); err != nil {
 		return err
 	}
 
-	if len(messageBytes) > int(detectState.MaxNDEFLen-2) {
+	maxLen := detectState.MaxNDEFLen - detectState.NLENSize
+	if uint64(len(messageBytes)) > uint64(maxLen) {
 		return fmt.Errorf("Message is too large. Max size is %d",
-			detectState.MaxNDEFLen-2)
-	}
-
-	// Per above, this can be done without risking overflows
-	msgLen := uint16(len(messageBytes))
-
-	// The number of bytes to write will be the maximum or,
-	// if that's more than the message, just the message size
-	writeLen := detectState.MaxUpdateBinaryLen
-	if msgLen < writeLen {
-		writeLen = msgLen
+			maxLen)
 	}
 
-	// If the msgLen + 2 fits inside the MaxUpdateBinaryLen
-	// then we could do this in a single UpdateBinary command.
-	// For the moment we do the slow way which works always.
-	// Write 0000h in the NLEN field first
-	err = dev.commander.UpdateBinary([]byte{0x00, 0x00}, 0)
+	// Write 0 in the NLEN field first
+	nlenSize := detectState.NLENSize
+	err = dev.commander.UpdateBinary(make([]byte, nlenSize), 0)
 	if err != nil {
 		return err
 	}
 
-	// Write the message doing as many UpdateBinary calls as necessary
-	totalWrite := uint16(0)
-	for totalWrite < msgLen {
-		if msgLen-totalWrite < writeLen { //last round
-			writeLen = msgLen - totalWrite
-		}
-		err = dev.commander.UpdateBinary(
-			messageBytes[totalWrite:totalWrite+writeLen],
-			totalWrite+2) // Always offset the 2 NLEN bytes
-		if err != nil {
-			return err
-		}
-		totalWrite += writeLen
+	// Write the message. The Commander takes care of doing as
+	// many UpdateBinary calls as necessary to not exceed MLc.
+	dev.commander.Progress = dev.Progress
+	err = dev.commander.updateBinaryChunks(messageBytes, nlenSize, false,
+		"Commander.UpdateBinary") // Always offset the NLEN bytes
+	dev.commander.Progress = nil
+	if err != nil {
+		return err
 	}
-	// Finally write NLEN
-	msgLenBytes := helpers.Uint16ToBytes(msgLen)
-	err = dev.commander.UpdateBinary(msgLenBytes[:], 0)
+	// Finally write NLEN. Per above, this can be done without
+	// risking overflows.
+	msgLenBytes := make([]byte, 4)
+	binary.BigEndian.PutUint32(msgLenBytes, uint32(len(messageBytes)))
+	err = dev.commander.UpdateBinary(msgLenBytes[4-nlenSize:], 0)
 	if err != nil {
 		return err
 	}
@@ -259,11 +312,11 @@ func (dev *Device) Format() error {
 		return err
 	}
 
-	if detectState.ReadOnly {
-		return errors.New("Device.Update: the tag is read-only")
+	if err := dev.checkWriteAccess(detectState); err != nil {
+		return err
 	}
 
-	err = dev.commander.UpdateBinary([]byte{0, 0}, 0)
+	err = dev.commander.UpdateBinary(make([]byte, detectState.NLENSize), 0)
 	if err != nil {
 		return err
 	}
@@ -273,6 +326,13 @@ func (dev *Device) Format() error {
 
 func (dev *Device) ndefDetectProcedure() (*tagState, error) {
 	state := new(tagState)
+	// Forget the limits of previously detected tags.
+	dev.cc = nil
+	dev.commander.ExtendedLength = false
+	dev.commander.MaxReadBinaryLen = 0
+	dev.commander.MaxUpdateBinaryLen = 0
+	dev.commander.Retries = dev.Retries
+
 	// Select NDEF Application
 	if err := dev.commander.NDEFApplicationSelect(); err != nil {
 		return nil, err
@@ -293,9 +353,17 @@ func (dev *Device) ndefDetectProcedure() (*tagState, error) {
 			"invalid Capability Container: should be 15 bytes")
 	}
 
-	// Read the remainder of the Capability Container based on CCLEN.
+	// Read the remainder of the Capability Container based on CCLEN,
+	// in chunks which do not exceed MLe. MLe cannot be trusted before
+	// parsing the Capability Container, so never use less than the
+	// minimum valid value.
 	ccLen := helpers.BytesToUint16([2]byte{ccBytes[0], ccBytes[1]})
 	if ccLen > 15 {
+		mle := helpers.BytesToUint16([2]byte{ccBytes[3], ccBytes[4]})
+		if mle < minMLe {
+			mle = minMLe
+		}
+		dev.commander.MaxReadBinaryLen = mle
 		ccBytesExtra, err := dev.commander.ReadBinary(15, ccLen-15)
 		if err != nil {
 			return nil, err
@@ -305,34 +373,70 @@ func (dev *Device) ndefDetectProcedure() (*tagState, error) {
 
 	// Parse the Capability Container
 	cc := new(capabilitycontainer.CapabilityContainer)
+	if dev.LenientCapabilityContainer {
+		cc.Mode = capabilitycontainer.Lenient
+	}
 	if _, err := cc.Unmarshal(ccBytes); err != nil {
 		return nil, err
 	}
+	dev.cc = cc
+
+	if err := dev.checkMappingVersion(cc); err != nil {
+		return nil, err
+	}
+
+	fcTlv, err := dev.selectNDEFFile(cc)
+	if err != nil {
+		return nil, err
+	}
 
 	// Check that we can read the tag
-	fcTlv := cc.NDEFFileControlTLV
-	if !(*capabilitycontainer.ControlTLV)(fcTlv).IsFileReadable() {
+	readProtected := fcTlv.IsFileReadProtected()
+	if !fcTlv.IsFileReadable() && !(readProtected && dev.ReadPassword != nil) {
 		return nil, errors.New(
 			"Device.Read: NDEF File is marked as not readable.")
 	}
 
-	state.MaxReadBinaryLen = cc.MLe
-	state.MaxUpdateBinaryLen = cc.MLc
-	state.MaxNDEFLen = fcTlv.MaximumFileSize
-	state.ReadOnly = (*capabilitycontainer.ControlTLV)(fcTlv).IsFileReadOnly()
+	dev.commander.MaxReadBinaryLen = cc.MLe
+	dev.commander.MaxUpdateBinaryLen = cc.MLc
+	// Tags advertising MLe or MLc values which cannot be used with
+	// short APDUs do support extended-length APDUs.
+	dev.commander.ExtendedLength = cc.MLe > maxShortLe || cc.MLc > maxShortLc
+	state.NLENSize = 2
+	state.MaxNDEFLen = uint32(fcTlv.MaximumFileSize)
+	if cc.UsesExtendedNDEFFile() {
+		state.NLENSize = 4
+		state.MaxNDEFLen = cc.ExtendedNDEFFileControlTLV.MaximumFileSize
+	}
+	state.ReadOnly = fcTlv.IsFileReadOnly()
+	state.WriteProtected = fcTlv.IsFileWriteProtected()
 
 	// Select the NDEF File
 	if err := dev.commander.Select(fcTlv.FileID); err != nil {
 		return nil, err
 	}
 
+	if readProtected {
+		err := dev.commander.Verify(ReadPasswordID, dev.ReadPassword)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// Detect NDEF Message procedure 5.4.1
-	nlenBytes, err := dev.commander.ReadBinary(0, 2)
+	nlenBytes, err := dev.commander.ReadBinary(0, uint16(state.NLENSize))
 	if err != nil {
 		return nil, err
 	}
-	nlen := helpers.BytesToUint16([2]byte{nlenBytes[0], nlenBytes[1]})
-	if nlen > state.MaxNDEFLen-2 {
+	if len(nlenBytes) < int(state.NLENSize) {
+		return nil, errors.New(
+			"Device.Read: could not read NLEN from the NDEF File")
+	}
+	nlen := uint32(0)
+	for _, b := range nlenBytes[:state.NLENSize] {
+		nlen = nlen<<8 | uint32(b)
+	}
+	if uint64(nlen) > uint64(state.MaxNDEFLen)-uint64(state.NLENSize) {
 		return nil, errors.New(
 			"Device.Read: Device is not in a valid state")
 	}
@@ -340,6 +444,95 @@ func (dev *Device) ndefDetectProcedure() (*tagState, error) {
 	return state, nil
 }
 
+// CapabilityContainer returns the Capability Container read from the
+// tag during the last operation, or nil if it could not be read.
+func (dev *Device) CapabilityContainer() *capabilitycontainer.CapabilityContainer {
+	return dev.cc
+}
+
+// Signatures returns the results of verifying the Signature records
+// of the message obtained by the last Read, in order. It is empty
+// when no Verifier is configured or when the message has no Signature
+// records. Records which are not covered by any valid result should
+// not be considered authenticated.
+func (dev *Device) Signatures() []signature.Result {
+	return dev.signatures
+}
+
+// selectNDEFFile returns the File Control TLV for the NDEF File
+// which the Device should operate on, according to NDEFFileID and
+// NDEFFileIndex. For Extended NDEF Files, only the ID and the access
+// conditions are set in the result.
+func (dev *Device) selectNDEFFile(cc *capabilitycontainer.CapabilityContainer) (*capabilitycontainer.ControlTLV, error) {
+	var files []*capabilitycontainer.ControlTLV
+	for _, f := range cc.NDEFFiles() {
+		files = append(files, (*capabilitycontainer.ControlTLV)(f))
+	}
+	if eTLV := cc.ExtendedNDEFFileControlTLV; eTLV != nil {
+		files = append(files, &capabilitycontainer.ControlTLV{
+			T:                        eTLV.T,
+			FileID:                   eTLV.FileID,
+			FileReadAccessCondition:  eTLV.FileReadAccessCondition,
+			FileWriteAccessCondition: eTLV.FileWriteAccessCondition,
+		})
+	}
+	switch {
+	case dev.NDEFFileID != 0:
+		for _, f := range files {
+			if f.FileID == dev.NDEFFileID {
+				return f, nil
+			}
+		}
+		return nil, fmt.Errorf("Device.Read: NDEF File %04Xh not found",
+			dev.NDEFFileID)
+	case dev.NDEFFileIndex > 0:
+		if dev.NDEFFileIndex > len(files) {
+			return nil, fmt.Errorf("Device.Read: NDEF File %d not found "+
+				"(the tag has %d)", dev.NDEFFileIndex, len(files))
+		}
+		return files[dev.NDEFFileIndex-1], nil
+	}
+
+	for _, f := range files {
+		if f.IsFileReadable() ||
+			(f.IsFileReadProtected() && dev.ReadPassword != nil) {
+			return f, nil
+		}
+	}
+	// None is readable. Return the first one to report it.
+	return files[0], nil
+}
+
+// checkWriteAccess makes sure that the NDEF File can be written,
+// verifying the WritePassword when the file is protected.
+func (dev *Device) checkWriteAccess(state *tagState) error {
+	if state.ReadOnly {
+		return errors.New("Device.Update: the tag is read-only")
+	}
+	if state.WriteProtected {
+		if dev.WritePassword == nil {
+			return errors.New("Device.Update: the tag is write-protected")
+		}
+		return dev.commander.Verify(WritePasswordID, dev.WritePassword)
+	}
+	return nil
+}
+
+// checkMappingVersion makes sure that the major version in the
+// Capability Container is one the Device can handle: tags with a major
+// version higher than the Device's must not be accessed.
+func (dev *Device) checkMappingVersion(cc *capabilitycontainer.CapabilityContainer) error {
+	if dev.IgnoreMappingVersion {
+		return nil
+	}
+	major := cc.MajorVersion()
+	if major == 0 || major > dev.MajorVersion {
+		return fmt.Errorf("Device: %w %d.%d",
+			ErrUnsupportedVersion, major, cc.MinorVersion())
+	}
+	return nil
+}
+
 func (dev *Device) checkReady() error {
 	if dev.commander == nil {
 		return errors.New("The Device has not been setup. " +
@@ -19,124 +19,24 @@ package nfctype4
 
 import (
 	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"math/big"
 	"testing"
+	"time"
 
 	"github.com/hsanjuan/go-ndef"
 	"github.com/hsanjuan/go-ndef/types/generic"
 	"github.com/hsanjuan/go-nfctype4/drivers/dummy"
 	"github.com/hsanjuan/go-nfctype4/drivers/swtag"
+	"github.com/hsanjuan/go-nfctype4/signature"
 	"github.com/hsanjuan/go-nfctype4/tags/static"
 )
 
-var dummyTestSets = map[string][][]byte{
-	"yubikey_ok": {
-		{0x90, 0x00}, // NDEF app select
-		{0x90, 0x00}, // CC select
-		{0x00, 0x0f, 0x20, 0x00, 0x7f, 0x00, 0x7f, 0x04, 0x06, 0xe1, 0x04, 0x00, 0x7f, 0x00, 0x00, 0x90, 0x00}, // CC binary read
-		{0x90, 0x00},             // NDEF File Select
-		{0x00, 0x43, 0x90, 0x00}, // NDEF File detect
-		{0xd1, 0x01, 0x3f, 0x55, 0x04, 0x6d, 0x79, 0x2e, 0x79, 0x75, 0x62, 0x69, 0x63, 0x6f, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x6e, 0x65, 0x6f, 0x2f, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x90, 0x00}, // NDEF File Read
-	},
-	"long_cc_ok": {
-		{0x90, 0x00}, // NDEF app select
-		{0x90, 0x00}, // CC select
-		{0x00, 0x17, 0x20, 0x01, 0x00, 0x00, 0xff, 0x04, 0x06, 0xe1, 0x04, 0x01, 0x00, 0x00, 0x00, 0x90, 0x00}, // CC start read
-		{0x05, 0x06, 0xe1, 0x05, 0x00, 0x80, 0x82, 0x83, 0x90, 0x00},                                           // CC finish read
-		{0x90, 0x00},             // NDEF File Select
-		{0x00, 0x10, 0x90, 0x00}, // NDEF File detect
-		{0xd1, 0x01, 0x0c, 0x55, 0x04, 0x65, 0x78, 0x61, 0x6d, 0x70, 0x6c, 0x65, 0x2e, 0x63, 0x6f, 0x6d, 0x90, 0x00}, // NDEF File Read
-
-	},
-}
-
-var dummyTestSetsBad = map[string][][]byte{
-	"bad_ndef_select": {
-		{0x00, 0x00}, // NDEF app select
-	},
-	"cc_file_not_found": {
-		{0x90, 0x00}, // NDEF app select
-		{0x6A, 0x82}, // CC select (bad result)
-	},
-	"bad_cc_cclen": {
-		{0x90, 0x00}, // NDEF app select
-		{0x90, 0x00}, // CC select
-		{0x00, 0x0e, 0x20, 0x00, 0x7f, 0x00, 0x7f, 0x04, 0x06, 0xe1, 0x04, 0x00, 0x7f, 0x00, 0x00, 0x90, 0x00}, // CC binary read. Set CCLEN to 0x000e
-	},
-	"bad_cc_read": {
-		{0x90, 0x00}, // NDEF app select
-		{0x90, 0x00}, // CC select
-		{0x00, 0x00, 0x20, 0x00, 0x7f, 0x00, 0x7f, 0x04, 0x06, 0xe1, 0x04, 0x00, 0x7f, 0x00, 0x90, 0x00}, // CC binary read. removed 1 byte from response
-	},
-	"bad_cc_mle": {
-		{0x90, 0x00}, // NDEF app select
-		{0x90, 0x00}, // CC select
-		{0x00, 0x0f, 0x20, 0x00, 0x01, 0x00, 0x7f, 0x04, 0x06, 0xe1, 0x04, 0x00, 0x7f, 0x00, 0x00, 0x90, 0x00}, // CC binary read. Mle to 0x00,0x01 (RFU)
-	},
-	"bad_cc_mlc": {
-		{0x90, 0x00}, // NDEF app select
-		{0x90, 0x00}, // CC select
-		{0x00, 0x0f, 0x20, 0x00, 0x7f, 0x00, 0x00, 0x04, 0x06, 0xe1, 0x04, 0x00, 0x7f, 0x00, 0x00, 0x90, 0x00}, // CC binary read. Mlc to 0x00,0x00 (RFU)
-	},
-	"bad_cc_control_tlv_type": {
-		{0x90, 0x00}, // NDEF app select
-		{0x90, 0x00}, // CC select
-		{0x00, 0x0f, 0x20, 0x00, 0x7f, 0x00, 0x7f, 0x05, 0x06, 0xe1, 0x04, 0x00, 0x7f, 0x00, 0x00, 0x90, 0x00}, // CC binary read. TLV type is 0x05 instead of 0x04
-	},
-	"bad_cc_control_tlv_access_conditions": {
-		{0x90, 0x00}, // NDEF app select
-		{0x90, 0x00}, // CC select
-		{0x00, 0x0f, 0x20, 0x00, 0x7f, 0x00, 0x7f, 0x04, 0x06, 0xe1, 0x04, 0x00, 0x7f, 0x01, 0x01, 0x90, 0x00}, // CC binary read. Access condition bytes set to 0x01 (RFU)
-	},
-	"ndef_file_read_protected": {
-		{0x90, 0x00}, // NDEF app select
-		{0x90, 0x00}, // CC select
-		{0x00, 0x0f, 0x20, 0x00, 0x7f, 0x00, 0x7f, 0x04, 0x06, 0xe1, 0x04, 0x00, 0x7f, 0x80, 0x00, 0x90, 0x00}, // CC binary read. Read access flag set to 0x80 (propietary)
-	},
-	"ndef_file_not_found": {
-		{0x90, 0x00}, // NDEF app select
-		{0x90, 0x00}, // CC select
-		{0x00, 0x0f, 0x20, 0x00, 0x7f, 0x00, 0x7f, 0x04, 0x06, 0xe1, 0x04, 0x00, 0x7f, 0x00, 0x00, 0x90, 0x00}, // CC binary read
-		{0x6A, 0x82}, // NDEF File Select. Not found
-	},
-	"ndef_file_select_error": {
-		{0x90, 0x00}, // NDEF app select
-		{0x90, 0x00}, // CC select
-		{0x00, 0x0f, 0x20, 0x00, 0x7f, 0x00, 0x7f, 0x04, 0x06, 0xe1, 0x04, 0x00, 0x7f, 0x00, 0x00, 0x90, 0x00}, // CC binary read
-		{0x00, 0x00}, // NDEF File Select
-	},
-	"ndef_file_zero_length": {
-		{0x90, 0x00}, // NDEF app select
-		{0x90, 0x00}, // CC select
-		{0x00, 0x0f, 0x20, 0x00, 0x7f, 0x00, 0x7f, 0x04, 0x06, 0xe1, 0x04, 0x00, 0x7f, 0x00, 0x00, 0x90, 0x00}, // CC binary read
-		{0x90, 0x00},             // NDEF File Select
-		{0x00, 0x00, 0x90, 0x00}, // NDEF File detect. Size to 0
-	},
-	"device_invalid_state": {
-		{0x90, 0x00}, // NDEF app select
-		{0x90, 0x00}, // CC select
-		{0x00, 0x0f, 0x20, 0x00, 0x7f, 0x00, 0x7f, 0x04, 0x06, 0xe1, 0x04, 0x00, 0x7f, 0x00, 0x00, 0x90, 0x00}, // CC binary read
-		{0x90, 0x00},             // NDEF File Select
-		{0xFF, 0xFF, 0x90, 0x00}, // NDEF File detect. Set size to 0xFFFF
-	},
-	"ndef_file_read_error": {
-		{0x90, 0x00}, // NDEF app select
-		{0x90, 0x00}, // CC select
-		{0x00, 0x0f, 0x20, 0x00, 0x7f, 0x00, 0x7f, 0x04, 0x06, 0xe1, 0x04, 0x00, 0x7f, 0x00, 0x00, 0x90, 0x00}, // CC binary read
-		{0x90, 0x00},             // NDEF File Select
-		{0x00, 0x43, 0x90, 0x00}, // NDEF File detect
-		{0xd1, 0x01, 0x3f, 0x55, 0x04, 0x6d, 0x79, 0x2e, 0x79, 0x75, 0x62, 0x69, 0x63, 0x6f, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x6e, 0x65, 0x6f, 0x2f, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x00, 0x00}, // NDEF File Read. Changed SW1 to 0x00
-	},
-	"ndef_file_bad_record": {
-		{0x90, 0x00}, // NDEF app select
-		{0x90, 0x00}, // CC select
-		{0x00, 0x0f, 0x20, 0x00, 0x7f, 0x00, 0x7f, 0x04, 0x06, 0xe1, 0x04, 0x00, 0x7f, 0x00, 0x00, 0x90, 0x00}, // CC binary read
-		{0x90, 0x00},             // NDEF File Select
-		{0x00, 0x43, 0x90, 0x00}, // NDEF File detect
-		{0xf1, 0x01, 0x3f, 0x55, 0x04, 0x6d, 0x79, 0x2e, 0x79, 0x75, 0x62, 0x69, 0x63, 0x6f, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x6e, 0x65, 0x6f, 0x2f, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x63, 0x90, 0x00}, // NDEF File Read. Changed first byte to enable CF
-	},
-}
-
 func mockDriver() CommandDriver {
 	yubikeyMock := static.New()
 	yubikeyMock.SetMessage(ndef.NewURIMessage("https://my.yubico.com/neo/cccccccccccccccccccccccccccccccccccccccccccc"))
@@ -182,48 +82,34 @@ func ExampleDevice_Update() {
 	// urn:nfc:wkt:T:Hey this is a test!
 }
 
+func loadScript(t *testing.T, path string) *dummy.Script {
+	script, err := dummy.LoadScript(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return script
+}
+
 func TestRead_goodExamples(t *testing.T) {
-	dummyDriver := new(dummy.Driver)
-	device := New(dummyDriver)
-	for name, byteSet := range dummyTestSets {
-		t.Log("Testing:", name)
-		dummyDriver.ReceiveBytes = byteSet
-		dummyDriver.ReceiveBytesPos = 0
+	script := loadScript(t, "testdata/read_ok.yaml")
+	for _, c := range script.Cases {
+		t.Log("Testing:", c.Name)
+		device := New(c.Driver())
 		_, err := device.Read()
 		if err != nil {
-			t.Fail()
+			t.Error(c.Name, err)
 		}
 	}
 }
 
 func TestRead_badExamples(t *testing.T) {
-	expectedMessages := map[string]string{
-		"bad_ndef_select":                      "Commander.NDEFApplicationSelect: unknown error. SW1: 00h. SW2: 00h",
-		"cc_file_not_found":                    "Commander.Select: File e103h not found",
-		"bad_cc_read":                          "invalid Capability Container: should be 15 bytes",
-		"bad_cc_size":                          "CapabilityContainer.ParseBytes: not enough bytes to parse",
-		"bad_cc_cclen":                         "CapabilityContainer.Unmarshal: expected 14 bytes but parsed 15 bytes",
-		"bad_cc_mlc":                           "CapabilityContainer.check: MLc is RFU",
-		"bad_cc_mle":                           "CapabilityContainer.check: MLe is RFU",
-		"bad_cc_control_tlv_type":              "NDEFFileControlTLV.Unmarshal: TLV is not a NDEF File Control TLV",
-		"bad_cc_control_tlv_access_conditions": "ControlTLV.check: Read Access Condition has RFU value",
-		"ndef_file_read_protected":             "Device.Read: NDEF File is marked as not readable.",
-		"ndef_file_not_found":                  "Commander.Select: File e104h not found",
-		"ndef_file_select_error":               "Select: Unknown error. SW1: 00h. SW2: 00h",
-		"ndef_file_zero_length":                "Device.Read: no NDEF Message detected.",
-		"device_invalid_state":                 "Device.Read: Device is not in a valid state",
-		"ndef_file_read_error":                 "Commander.ReadBinary: Error. SW1: 00h. SW2: 00h",
-		"ndef_file_bad_record":                 "NDEF Record Check: A single record cannot have the Chunk flag set",
-	}
-	for name, byteSet := range dummyTestSetsBad {
-		dummyDriver := &dummy.Driver{
-			ReceiveBytes: byteSet,
-		}
-		device := New(dummyDriver)
-		t.Log("Testing:", name)
+	script := loadScript(t, "testdata/read_bad.yaml")
+	for _, c := range script.Cases {
+		device := New(c.Driver())
+		t.Log("Testing:", c.Name)
 		_, err := device.Read()
 		if err != nil {
-			if err.Error() != expectedMessages[name] {
+			if err.Error() != c.Error {
 				t.Error("Failed with unexpected message:", err)
 			} else {
 				t.Log("OK err: ", err)
@@ -234,6 +120,233 @@ func TestRead_badExamples(t *testing.T) {
 	}
 }
 
+func TestDevice_CapabilityContainer(t *testing.T) {
+	script := loadScript(t, "testdata/read_ok.yaml")
+	device := New(script.Case("yubikey_ok").Driver())
+	if device.CapabilityContainer() != nil {
+		t.Error("no Capability Container expected before reading")
+	}
+	if _, err := device.Read(); err != nil {
+		t.Fatal(err)
+	}
+	cc := device.CapabilityContainer()
+	if cc == nil {
+		t.Fatal("the Capability Container should be available")
+	}
+	if cc.MLe != 0x7f || cc.NDEFFileControlTLV.FileID != 0xe104 {
+		t.Error("unexpected Capability Container:", cc)
+	}
+
+	bad := loadScript(t, "testdata/read_bad.yaml")
+	device.Setup(bad.Case("bad_ndef_select").Driver())
+	if _, err := device.Read(); err == nil {
+		t.Fatal("Device.Read should have errored")
+	}
+	if device.CapabilityContainer() != nil {
+		t.Error("the Capability Container of the last tag was kept")
+	}
+}
+
+func TestRead_ignoreMappingVersion(t *testing.T) {
+	byteSet := [][]byte{
+		{0x90, 0x00}, // NDEF app select
+		{0x90, 0x00}, // CC select
+		{0x00, 0x0f, 0x30, 0x00, 0x7f, 0x00, 0x7f, 0x04, 0x06, 0xe1, 0x04, 0x00, 0x7f, 0x00, 0x00, 0x90, 0x00}, // CC binary read. Mapping version 3.0
+		{0x90, 0x00},             // NDEF File Select
+		{0x00, 0x10, 0x90, 0x00}, // NDEF File detect
+		{0xd1, 0x01, 0x0c, 0x55, 0x04, 0x65, 0x78, 0x61, 0x6d, 0x70, 0x6c, 0x65, 0x2e, 0x63, 0x6f, 0x6d, 0x90, 0x00}, // NDEF File Read
+	}
+
+	dummyDriver := &dummy.Driver{
+		ReceiveBytes: byteSet,
+	}
+	device := New(dummyDriver)
+	_, err := device.Read()
+	if !errors.Is(err, ErrUnsupportedVersion) {
+		t.Error("expected ErrUnsupportedVersion but got:", err)
+	}
+
+	dummyDriver.ReceiveBytesPos = 0
+	device.IgnoreMappingVersion = true
+	_, err = device.Read()
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRead_lenientCapabilityContainer(t *testing.T) {
+	byteSet := [][]byte{
+		{0x90, 0x00}, // NDEF app select
+		{0x90, 0x00}, // CC select
+		{0x00, 0x0f, 0x20, 0x00, 0x7f, 0x00, 0x00, 0x04, 0x06, 0xe1, 0x04, 0x00, 0x7f, 0x00, 0x00, 0x90, 0x00}, // CC binary read. Mlc to 0x00,0x00 (RFU)
+		{0x90, 0x00},             // NDEF File Select
+		{0x00, 0x10, 0x90, 0x00}, // NDEF File detect
+		{0xd1, 0x01, 0x0c, 0x55, 0x04, 0x65, 0x78, 0x61, 0x6d, 0x70, 0x6c, 0x65, 0x2e, 0x63, 0x6f, 0x6d, 0x90, 0x00}, // NDEF File Read
+	}
+
+	dummyDriver := &dummy.Driver{
+		ReceiveBytes: byteSet,
+	}
+	device := New(dummyDriver)
+	_, err := device.Read()
+	if err == nil || err.Error() != "CapabilityContainer.check: MLc is RFU" {
+		t.Error("expected an RFU error but got:", err)
+	}
+
+	dummyDriver.ReceiveBytesPos = 0
+	device.LenientCapabilityContainer = true
+	_, err = device.Read()
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRead_multipleNDEFFiles(t *testing.T) {
+	ccBytes := [][]byte{
+		{0x90, 0x00}, // NDEF app select
+		{0x90, 0x00}, // CC select
+		{0x00, 0x17, 0x20, 0x00, 0x7f, 0x00, 0x7f, 0x04, 0x06, 0xe1, 0x04, 0x00, 0x7f, 0xff, 0xff, 0x90, 0x00}, // CC start read. First NDEF File not readable
+		{0x04, 0x06, 0xe1, 0x05, 0x00, 0x7f, 0x00, 0x00, 0x90, 0x00},                                           // CC finish read. Second NDEF File
+	}
+	ndefFileBytes := [][]byte{
+		{0x90, 0x00},             // NDEF File Select
+		{0x00, 0x10, 0x90, 0x00}, // NDEF File detect
+		{0xd1, 0x01, 0x0c, 0x55, 0x04, 0x65, 0x78, 0x61, 0x6d, 0x70, 0x6c, 0x65, 0x2e, 0x63, 0x6f, 0x6d, 0x90, 0x00}, // NDEF File Read
+	}
+	dummyDriver := &dummy.Driver{
+		ReceiveBytes: append(ccBytes, ndefFileBytes...),
+	}
+	device := New(dummyDriver)
+
+	// The first readable file is used by default
+	if _, err := device.Read(); err != nil {
+		t.Error(err)
+	}
+
+	dummyDriver.ReceiveBytesPos = 0
+	device.NDEFFileIndex = 2
+	if _, err := device.Read(); err != nil {
+		t.Error(err)
+	}
+
+	dummyDriver.ReceiveBytesPos = 0
+	device.NDEFFileIndex = 3
+	_, err := device.Read()
+	if err == nil || err.Error() != "Device.Read: NDEF File 3 not found (the tag has 2)" {
+		t.Error("expected a not found error but got:", err)
+	}
+
+	dummyDriver.ReceiveBytesPos = 0
+	device.NDEFFileIndex = 0
+	device.NDEFFileID = 0xE104
+	_, err = device.Read()
+	if err == nil || err.Error() != "Device.Read: NDEF File is marked as not readable." {
+		t.Error("expected a not readable error but got:", err)
+	}
+
+	dummyDriver.ReceiveBytesPos = 0
+	device.NDEFFileID = 0xE106
+	_, err = device.Read()
+	if err == nil || err.Error() != "Device.Read: NDEF File E106h not found" {
+		t.Error("expected a not found error but got:", err)
+	}
+}
+
+// recordingDriver keeps the commands sent to the tag.
+type recordingDriver struct {
+	CommandDriver
+	sent [][]byte
+}
+
+func (d *recordingDriver) TransceiveBytes(tx []byte, rxLen int) ([]byte, error) {
+	d.sent = append(d.sent, tx)
+	return d.CommandDriver.TransceiveBytes(tx, rxLen)
+}
+
+func TestRead_longCapabilityContainer(t *testing.T) {
+	byteSet := [][]byte{
+		{0x90, 0x00}, // NDEF app select
+		{0x90, 0x00}, // CC select
+		{0x00, 0x27, 0x20, 0x00, 0x0f, 0x00, 0x0f, 0x04, 0x06, 0xe1, 0x04, 0x00, 0x7f, 0x00, 0x00, 0x90, 0x00}, // CC start read. CCLEN 39, MLe 15
+		{0x05, 0x06, 0xe1, 0x05, 0x00, 0x80, 0x82, 0x83, 0x05, 0x06, 0xe1, 0x06, 0x00, 0x80, 0x82, 0x90, 0x00}, // CC read. 15 bytes
+		{0x83, 0x05, 0x06, 0xe1, 0x07, 0x00, 0x80, 0x82, 0x83, 0x90, 0x00},                                     // CC read. Last 9 bytes
+		{0x90, 0x00},             // NDEF File Select
+		{0x00, 0x0c, 0x90, 0x00}, // NDEF File detect
+		{0xd1, 0x01, 0x08, 0x55, 0x04, 0x65, 0x78, 0x61, 0x2e, 0x63, 0x6f, 0x6d, 0x90, 0x00}, // NDEF File Read
+	}
+	driver := &recordingDriver{
+		CommandDriver: &dummy.Driver{ReceiveBytes: byteSet},
+	}
+	device := New(driver)
+	if _, err := device.Read(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The CC reads should not exceed MLe.
+	for i, le := range []byte{15, 15, 9} {
+		cmd := driver.sent[2+i]
+		if got := cmd[len(cmd)-1]; got != le {
+			t.Errorf("CC read %d: expected Le %d but got %d", i, le, got)
+		}
+	}
+}
+
+func TestRead_password(t *testing.T) {
+	byteSet := [][]byte{
+		{0x90, 0x00}, // NDEF app select
+		{0x90, 0x00}, // CC select
+		{0x00, 0x0f, 0x20, 0x00, 0x7f, 0x00, 0x7f, 0x04, 0x06, 0xe1, 0x04, 0x00, 0x7f, 0x80, 0x00, 0x90, 0x00}, // CC binary read. Read access protected (0x80)
+		{0x90, 0x00},             // NDEF File Select
+		{0x90, 0x00},             // Verify
+		{0x00, 0x10, 0x90, 0x00}, // NDEF File detect
+		{0xd1, 0x01, 0x0c, 0x55, 0x04, 0x65, 0x78, 0x61, 0x6d, 0x70, 0x6c, 0x65, 0x2e, 0x63, 0x6f, 0x6d, 0x90, 0x00}, // NDEF File Read
+	}
+	dummyDriver := &dummy.Driver{
+		ReceiveBytes: byteSet,
+	}
+	device := New(dummyDriver)
+	device.ReadPassword = make([]byte, 16)
+	if _, err := device.Read(); err != nil {
+		t.Error(err)
+	}
+
+	// Wrong password
+	byteSet[4] = []byte{0x63, 0xc2}
+	dummyDriver.ReceiveBytesPos = 0
+	_, err := device.Read()
+	if err == nil || err.Error() != "Commander.Verify: verification failed (2 tries left). SW1: 63h. SW2: c2h" {
+		t.Error("unexpected error:", err)
+	}
+}
+
+func TestUpdate_password(t *testing.T) {
+	byteSet := [][]byte{
+		{0x90, 0x00}, // NDEF app select
+		{0x90, 0x00}, // CC select
+		{0x00, 0x0f, 0x20, 0x00, 0x7f, 0x00, 0x7f, 0x04, 0x06, 0xe1, 0x04, 0x00, 0x7f, 0x00, 0x80, 0x90, 0x00}, // CC binary read. Write access protected (0x80)
+		{0x90, 0x00},             // NDEF File Select
+		{0x00, 0x00, 0x90, 0x00}, // NDEF File detect
+		{0x90, 0x00},             // Verify
+		{0x90, 0x00},             // NLEN reset
+		{0x90, 0x00},             // NDEF Message write
+		{0x90, 0x00},             // NLEN write
+	}
+	dummyDriver := &dummy.Driver{
+		ReceiveBytes: byteSet,
+	}
+	device := New(dummyDriver)
+	err := device.Update(ndef.NewURIMessage("example.com"))
+	if err == nil || err.Error() != "Device.Update: the tag is write-protected" {
+		t.Error("unexpected error:", err)
+	}
+
+	dummyDriver.ReceiveBytesPos = 0
+	device.WritePassword = make([]byte, 16)
+	if err := device.Update(ndef.NewURIMessage("example.com")); err != nil {
+		t.Error(err)
+	}
+}
+
 func TestUpdate(t *testing.T) {
 	// We will use the software tags
 
@@ -312,6 +425,90 @@ func TestUpdate(t *testing.T) {
 	}
 }
 
+func TestUpdateBytes(t *testing.T) {
+	tag := static.New()
+	device := New(&swtag.Driver{Tag: tag})
+
+	if err := device.UpdateBytes(nil); err == nil {
+		t.Error("UpdateBytes should reject an empty message")
+	}
+
+	msg := ndef.NewTextMessage("verbatim", "en")
+	msgBytes, err := msg.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := device.UpdateBytes(msgBytes); err != nil {
+		t.Fatal(err)
+	}
+	readMsg, err := device.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	readBytes, err := readMsg.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(msgBytes, readBytes) {
+		t.Errorf("expected % 02X. Got % 02X", msgBytes, readBytes)
+	}
+}
+
+func TestDevice_Progress(t *testing.T) {
+	tag := static.New()
+	device := New(&swtag.Driver{Tag: tag})
+
+	var calls int
+	var done, total int
+	device.Progress = func(d, tot int) {
+		if d <= done && tot == total {
+			t.Errorf("progress did not advance: %d/%d", d, tot)
+		}
+		calls++
+		done, total = d, tot
+	}
+
+	payload := &generic.Payload{
+		Payload: make([]byte, 1000),
+	}
+	msg := ndef.NewMessage(ndef.NFCForumWellKnownType, "local", "", payload)
+	msgBytes, err := msg.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := device.Update(msg); err != nil {
+		t.Fatal(err)
+	}
+	// MLe and MLc are 15 by default
+	commands := (len(msgBytes) + 14) / 15
+	if calls != commands || done != len(msgBytes) || total != len(msgBytes) {
+		t.Errorf("unexpected progress on Update: %d calls, %d/%d",
+			calls, done, total)
+	}
+
+	calls, done, total = 0, 0, 0
+	if _, err := device.Read(); err != nil {
+		t.Fatal(err)
+	}
+	if calls != commands || done != len(msgBytes) || total != len(msgBytes) {
+		t.Errorf("unexpected progress on Read: %d calls, %d/%d",
+			calls, done, total)
+	}
+}
+
+func TestDevice_Retries(t *testing.T) {
+	tag := static.New()
+	tag.SetMessage(ndef.NewTextMessage("retried", "en"))
+	device := New(&flakyDriver{CommandDriver: &swtag.Driver{Tag: tag}})
+	if _, err := device.Read(); err == nil {
+		t.Error("Read should fail without retries")
+	}
+	device.Retries = 1
+	if _, err := device.Read(); err != nil {
+		t.Error(err)
+	}
+}
+
 func TestFormat(t *testing.T) {
 	// We will use the software tags
 
@@ -341,3 +538,64 @@ func TestFormat(t *testing.T) {
 		}
 	}
 }
+
+func TestDevice_Signatures(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template,
+		key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := &signature.Signer{
+		Key:          key,
+		Certificates: []*x509.Certificate{cert},
+	}
+	msg, err := signer.SignMessage(ndef.NewTextMessage("signed", "en"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tag := static.New()
+	device := New(&swtag.Driver{Tag: tag})
+	if err := device.Update(msg); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := device.Read(); err != nil {
+		t.Fatal(err)
+	}
+	if device.Signatures() != nil {
+		t.Error("signatures should not be verified without Verifier")
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	device.Verifier = &signature.Verifier{Roots: roots}
+	if _, err := device.Read(); err != nil {
+		t.Fatal(err)
+	}
+	results := device.Signatures()
+	if len(results) != 1 || results[0].Status != signature.StatusValid {
+		t.Fatalf("expected a valid signature: %+v", results)
+	}
+
+	device.Verifier.Roots = x509.NewCertPool()
+	if _, err := device.Read(); err != nil {
+		t.Fatal(err)
+	}
+	results = device.Signatures()
+	if len(results) != 1 || results[0].Status != signature.StatusUntrusted {
+		t.Fatalf("expected an untrusted signature: %+v", results)
+	}
+}
@@ -0,0 +1,315 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+// Package acr122u provides a CommandDriver implementation for the
+// ACS ACR122U reader, which also gives access to its LEDs, buzzer and
+// firmware version.
+//
+// The ACR122U is a PN532 behind a USB CCID interface. The commands
+// for the PN532 are wrapped in the pseudo-APDUs of the reader (Direct
+// Transmit, class FFh), which are delivered by a transport
+// CommandDriver: the ccid driver by default, or any other driver able
+// to send APDUs to the reader, like a PC/SC one.
+package acr122u
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/hsanjuan/go-nfctype4"
+	"github.com/hsanjuan/go-nfctype4/drivers/ccid"
+	"github.com/hsanjuan/go-nfctype4/drivers/internal/pn532"
+)
+
+// Common errors
+var (
+	ErrNoTargetsDetected = pn532.ErrNoTargetsDetected
+	ErrNotISO14443_4     = pn532.ErrNotISO14443_4
+)
+
+// Pseudo-APDU parameters (P1) of the reader commands.
+const (
+	cmdDirectTransmit    = byte(0x00)
+	cmdLEDBuzzer         = byte(0x40)
+	cmdFirmwareVersion   = byte(0x48)
+	cmdBuzzerOnDetection = byte(0x52)
+)
+
+// maxExchangeData is the maximum amount of data sent with a single
+// InDataExchange command, so that the command (D4h 40h Tg) fits in
+// the 255 bytes of a Direct Transmit pseudo-APDU.
+const maxExchangeData = 255 - 3
+
+// LED state control bits, to be combined in LEDBuzzer.State.
+const (
+	LEDRedFinal          = 0x01 // Final state of the red LED (on)
+	LEDGreenFinal        = 0x02 // Final state of the green LED (on)
+	LEDRedMask           = 0x04 // Update the state of the red LED
+	LEDGreenMask         = 0x08 // Update the state of the green LED
+	LEDRedBlinkInitial   = 0x10 // Initial blinking state of the red LED
+	LEDGreenBlinkInitial = 0x20 // Initial blinking state of the green LED
+	LEDRedBlink          = 0x40 // Blink the red LED
+	LEDGreenBlink        = 0x80 // Blink the green LED
+)
+
+// Buzzer modes for LEDBuzzer.Buzzer.
+const (
+	BuzzerOff  = 0x00
+	BuzzerT1   = 0x01 // Buzz during T1
+	BuzzerT2   = 0x02 // Buzz during T2
+	BuzzerBoth = 0x03 // Buzz during T1 and T2
+)
+
+// LEDBuzzer describes a sequence for the LEDs and the buzzer of the
+// reader. The LEDs blink Repetitions times, staying T1 in the initial
+// blinking state and T2 in the opposite one, and are left in their
+// final state. Durations are rounded to multiples of 100ms.
+type LEDBuzzer struct {
+	State       byte // Combination of the LED state control bits
+	T1          time.Duration
+	T2          time.Duration
+	Repetitions byte
+	Buzzer      byte // Buzzer mode
+}
+
+// Driver implements the CommandDriver interface for an ACR122U. It
+// allows `Device` to communicate with the first ISO/IEC 14443-4 Type
+// A tag found by the reader.
+//
+// The tag must be in the field of the reader when Initialize is
+// called. The LED, buzzer and firmware methods only need the reader,
+// so they can be used after Open.
+type Driver struct {
+	// Transport delivers the pseudo-APDUs to the reader. It is
+	// initialized by Open and closed by Close. Defaults to a
+	// ccid.Driver using the first CCID reader found.
+	Transport nfctype4.CommandDriver
+	// Trace, when set, receives the bytes exchanged with the tag.
+	Trace nfctype4.Tracer
+
+	transport nfctype4.CommandDriver
+	pn532     *pn532.PN532
+}
+
+// Open initializes the transport, giving access to the reader but
+// without looking for a tag. Initialize calls it.
+func (driver *Driver) Open() error {
+	driver.Close()
+	transport := driver.Transport
+	if transport == nil {
+		transport = &ccid.Driver{}
+	}
+	if err := transport.Initialize(); err != nil {
+		return err
+	}
+	driver.transport = transport
+	return nil
+}
+
+// Initialize opens the reader, configures its PN532 and selects the
+// first target available (or fails).
+//
+// It returns an error when some step fails.
+func (driver *Driver) Initialize() error {
+	if err := driver.Open(); err != nil {
+		return err
+	}
+	driver.pn532 = pn532.New(&apduConn{transport: driver.transport})
+	driver.pn532.MaxExchangeData = maxExchangeData
+	return driver.pn532.Setup()
+}
+
+// String returns information about the reader and the selected
+// target. It should be used after calling Initialize().
+func (driver *Driver) String() string {
+	str := "ACR122U Driver.\n"
+	if driver.pn532 != nil {
+		str += driver.pn532.String()
+	}
+	return str
+}
+
+// TransceiveBytes sends the bytes to the target with InDataExchange
+// and returns the response. Data longer than what fits in a single
+// InDataExchange command is chained.
+//
+// It returns an error if the reader reports an error or if the
+// response is longer than rxLen.
+func (driver *Driver) TransceiveBytes(tx []byte, rxLen int) ([]byte, error) {
+	if driver.pn532 == nil {
+		return nil, errors.New("Driver.TransceiveBytes: " +
+			"Driver not initialized")
+	}
+	driver.Trace.Trace(true, tx)
+	rx, err := driver.pn532.TransceiveBytes(tx, rxLen)
+	if err != nil {
+		return nil, err
+	}
+	driver.Trace.Trace(false, rx)
+	return rx, nil
+}
+
+// Close closes the transport.
+func (driver *Driver) Close() {
+	if driver.transport != nil {
+		driver.transport.Close()
+	}
+	driver.transport = nil
+	driver.pn532 = nil
+}
+
+// Firmware returns the firmware version of the reader, i.e.
+// "ACR122U207".
+func (driver *Driver) Firmware() (string, error) {
+	if driver.transport == nil {
+		return "", errors.New("Driver.Firmware: Driver not opened")
+	}
+	resp, err := driver.transport.TransceiveBytes(
+		pseudoAPDU(cmdFirmwareVersion, 0x00, nil), 64)
+	if err != nil {
+		return "", err
+	}
+	// The version comes without status word, unless the command
+	// failed.
+	if len(resp) == 2 && resp[0] == 0x63 {
+		return "", errors.New("Driver.Firmware: command failed")
+	}
+	return string(resp), nil
+}
+
+// SetLEDBuzzer runs the given LED and buzzer sequence and returns the
+// resulting state of the LEDs (bit 0 red, bit 1 green).
+func (driver *Driver) SetLEDBuzzer(seq LEDBuzzer) (byte, error) {
+	if driver.transport == nil {
+		return 0, errors.New("Driver.SetLEDBuzzer: Driver not opened")
+	}
+	data := []byte{
+		toUnits(seq.T1),
+		toUnits(seq.T2),
+		seq.Repetitions,
+		seq.Buzzer,
+	}
+	resp, err := driver.transport.TransceiveBytes(
+		pseudoAPDU(cmdLEDBuzzer, seq.State, data), 2)
+	if err != nil {
+		return 0, err
+	}
+	if len(resp) != 2 || resp[0] != 0x90 {
+		return 0, fmt.Errorf("Driver.SetLEDBuzzer: "+
+			"command failed (% 02x)", resp)
+	}
+	return resp[1], nil
+}
+
+// SetBuzzerOnDetection enables or disables the beep that the reader
+// emits when a card is detected. The setting is kept until the reader
+// is unplugged.
+func (driver *Driver) SetBuzzerOnDetection(enable bool) error {
+	if driver.transport == nil {
+		return errors.New("Driver.SetBuzzerOnDetection: " +
+			"Driver not opened")
+	}
+	var p2 byte
+	if enable {
+		p2 = 0xFF
+	}
+	resp, err := driver.transport.TransceiveBytes(
+		pseudoAPDU(cmdBuzzerOnDetection, p2, nil), 2)
+	if err != nil {
+		return err
+	}
+	if len(resp) != 2 || resp[0] != 0x90 {
+		return fmt.Errorf("Driver.SetBuzzerOnDetection: "+
+			"command failed (% 02x)", resp)
+	}
+	return nil
+}
+
+// pseudoAPDU builds a pseudo-APDU for the reader. The data is
+// preceded by its length, which is 00h when there is no data.
+func pseudoAPDU(cmd, p2 byte, data []byte) []byte {
+	buf := []byte{0xFF, 0x00, cmd, p2, byte(len(data))}
+	return append(buf, data...)
+}
+
+// toUnits converts a duration to the 100ms units used by the reader.
+func toUnits(d time.Duration) byte {
+	units := d / (100 * time.Millisecond)
+	if units > 0xFF {
+		units = 0xFF
+	}
+	return byte(units)
+}
+
+// apduConn implements pn532.Conn by sending the command frames to the
+// PN532 of the reader inside Direct Transmit pseudo-APDUs. The reader
+// does not return ACK frames, so they are made up.
+type apduConn struct {
+	transport nfctype4.CommandDriver
+	frames    [][]byte // Frames to be returned by NextFrame
+}
+
+// Write sends the data of the frame with a Direct Transmit
+// pseudo-APDU and queues the ACK and the response frames.
+func (conn *apduConn) Write(frame []byte) (int, error) {
+	data, _, err := pn532.ReadFrame(bytes.NewReader(frame))
+	if err != nil {
+		return 0, err
+	}
+	if len(data) > 0xFF {
+		return 0, errors.New("ACR122U: command too long")
+	}
+	resp, err := conn.transport.TransceiveBytes(
+		pseudoAPDU(cmdDirectTransmit, 0x00, data), pn532.MaxFrameData+2)
+	if err != nil {
+		return 0, err
+	}
+	// The response may be left for a GET RESPONSE (61h XX), as
+	// some readers do with T=0.
+	for len(resp) >= 2 && resp[len(resp)-2] == 0x61 {
+		more, err := conn.transport.TransceiveBytes(
+			[]byte{0xFF, 0xC0, 0x00, 0x00, resp[len(resp)-1]},
+			pn532.MaxFrameData+2)
+		if err != nil {
+			return 0, err
+		}
+		resp = append(resp[:len(resp)-2], more...)
+	}
+	n := len(resp)
+	if n < 2 {
+		return 0, errors.New("ACR122U: malformed Direct Transmit response")
+	}
+	if resp[n-2] != 0x90 || resp[n-1] != 0x00 {
+		return 0, fmt.Errorf("ACR122U: Direct Transmit failed (% 02x)",
+			resp[n-2:])
+	}
+	conn.frames = [][]byte{pn532.AckFrame, pn532.MarshalFrame(resp[:n-2])}
+	return len(frame), nil
+}
+
+// NextFrame returns the next queued frame.
+func (conn *apduConn) NextFrame() (io.Reader, error) {
+	if len(conn.frames) == 0 {
+		return nil, errors.New("ACR122U: no response available")
+	}
+	frame := conn.frames[0]
+	conn.frames = conn.frames[1:]
+	return bytes.NewReader(frame), nil
+}
@@ -0,0 +1,176 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package acr122u
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hsanjuan/go-ndef"
+	"github.com/hsanjuan/go-nfctype4"
+	"github.com/hsanjuan/go-nfctype4/drivers/internal/pn532/pn532test"
+	"github.com/hsanjuan/go-nfctype4/tags"
+	"github.com/hsanjuan/go-nfctype4/tags/static"
+)
+
+// fakeReader emulates the pseudo-APDUs of an ACR122U, with an
+// emulated PN532 behind.
+type fakeReader struct {
+	emu     *pn532test.Emulator
+	lastLED []byte
+	buzzer  byte
+	maxLc   int
+	closed  bool
+}
+
+func newFakeReader(target []byte, tag tags.Tag) *fakeReader {
+	return &fakeReader{
+		emu: &pn532test.Emulator{Target: target, Tag: tag},
+	}
+}
+
+func (r *fakeReader) Initialize() error {
+	return nil
+}
+
+func (r *fakeReader) String() string {
+	return "fake ACR122U"
+}
+
+func (r *fakeReader) TransceiveBytes(tx []byte, rxLen int) ([]byte, error) {
+	if len(tx) < 5 || tx[0] != 0xFF || tx[1] != 0x00 ||
+		len(tx) != 5+int(tx[4]) {
+		return []byte{0x6A, 0x81}, nil
+	}
+	data := tx[5:]
+	switch tx[2] {
+	case cmdDirectTransmit:
+		if len(data) > r.maxLc {
+			r.maxLc = len(data)
+		}
+		return append(r.emu.Handle(data), 0x90, 0x00), nil
+	case cmdFirmwareVersion:
+		return []byte("ACR122U207"), nil
+	case cmdLEDBuzzer:
+		r.lastLED = append([]byte{tx[3]}, data...)
+		return []byte{0x90, tx[3] & 0x03}, nil
+	case cmdBuzzerOnDetection:
+		r.buzzer = tx[3]
+		return []byte{0x90, 0x00}, nil
+	}
+	return []byte{0x63, 0x00}, nil
+}
+
+func (r *fakeReader) Close() {
+	r.closed = true
+}
+
+func TestDriver(t *testing.T) {
+	tag := static.New()
+	if err := tag.SetMaxDataLengths(0x0400, 0x0400); err != nil {
+		t.Fatal(err)
+	}
+	reader := newFakeReader(pn532test.ISOTarget, tag)
+	driver := &Driver{Transport: reader}
+	device := nfctype4.New(driver)
+
+	msg := ndef.NewTextMessage(strings.Repeat("acr122u ", 100), "en")
+	if err := device.Update(msg); err != nil {
+		t.Fatal(err)
+	}
+	readMsg, err := device.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if readMsg.String() != msg.String() {
+		t.Error("unexpected message:", readMsg)
+	}
+	if reader.maxLc > 0xFF {
+		t.Error("pseudo-APDU data longer than 255 bytes:", reader.maxLc)
+	}
+	if !reader.closed {
+		t.Error("the transport should have been closed")
+	}
+}
+
+func TestDriver_Initialize(t *testing.T) {
+	driver := &Driver{
+		Transport: newFakeReader(pn532test.NoTarget, static.New()),
+	}
+	if err := driver.Initialize(); err != ErrNoTargetsDetected {
+		t.Error("expected ErrNoTargetsDetected but got:", err)
+	}
+
+	driver = &Driver{
+		Transport: newFakeReader(pn532test.MifareTarget, static.New()),
+	}
+	if err := driver.Initialize(); err != ErrNotISO14443_4 {
+		t.Error("expected ErrNotISO14443_4 but got:", err)
+	}
+
+	driver = &Driver{}
+	if _, err := driver.TransceiveBytes([]byte{0x00}, 2); err == nil {
+		t.Error("TransceiveBytes should fail before Initialize")
+	}
+	if _, err := driver.Firmware(); err == nil {
+		t.Error("Firmware should fail before Open")
+	}
+}
+
+func TestDriver_Peripherals(t *testing.T) {
+	reader := newFakeReader(pn532test.NoTarget, static.New())
+	driver := &Driver{Transport: reader}
+	if err := driver.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer driver.Close()
+
+	fw, err := driver.Firmware()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fw != "ACR122U207" {
+		t.Error("unexpected firmware:", fw)
+	}
+
+	state, err := driver.SetLEDBuzzer(LEDBuzzer{
+		State:       LEDGreenFinal | LEDGreenMask,
+		T1:          500 * time.Millisecond,
+		T2:          200 * time.Millisecond,
+		Repetitions: 2,
+		Buzzer:      BuzzerT1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state != 0x02 {
+		t.Errorf("unexpected LED state: %02x", state)
+	}
+	want := []byte{0x0A, 0x05, 0x02, 0x02, 0x01}
+	if string(reader.lastLED) != string(want) {
+		t.Errorf("unexpected LED command: % 02x", reader.lastLED)
+	}
+
+	if err := driver.SetBuzzerOnDetection(true); err != nil {
+		t.Fatal(err)
+	}
+	if reader.buzzer != 0xFF {
+		t.Error("the buzzer should have been enabled")
+	}
+}
@@ -0,0 +1,36 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package auto
+
+import (
+	"github.com/hsanjuan/go-nfctype4"
+	"github.com/hsanjuan/go-nfctype4/drivers/cryptotokenkit"
+)
+
+// systemBackends returns the PC/SC-class backends, which are tried
+// first. On this system, it uses CryptoTokenKit.
+func systemBackends() []Backend {
+	return []Backend{
+		{
+			Name: "cryptotokenkit",
+			New: func() nfctype4.CommandDriver {
+				return new(cryptotokenkit.Driver)
+			},
+		},
+	}
+}
@@ -0,0 +1,43 @@
+//go:build !nolibnfc
+
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package auto
+
+import (
+	"github.com/hsanjuan/go-nfctype4"
+	"github.com/hsanjuan/go-nfctype4/drivers/libnfc"
+)
+
+// libnfcBackends returns the libnfc backend, which is tried after the
+// system ones. Build with the nolibnfc tag to leave it out, so that
+// this package does not need libnfc.
+func libnfcBackends() []Backend {
+	return []Backend{
+		{
+			Name: "libnfc",
+			New: func() nfctype4.CommandDriver {
+				return new(libnfc.Driver)
+			},
+		},
+	}
+}
+
+// libnfcNoTargetErrors are the errors with which the libnfc backend
+// reports a reader without a tag.
+var libnfcNoTargetErrors = []error{libnfc.ErrNoTargetsDetected}
@@ -0,0 +1,224 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+// Package auto provides a CommandDriver which detects which backend
+// can be used to talk to the tag, trying each of them in order and
+// using the first one which initializes successfully.
+//
+// The built-in backends are tried in this order: the PC/SC-class
+// driver of the system (winscard on Windows, cryptotokenkit on macOS
+// and ccid on Linux), libnfc, a PN532 on a serial port (/dev/ttyUSB0)
+// and a PN532 on the I2C bus. Other backends can be added with
+// Register.
+//
+// The libnfc backend needs cgo and the libnfc headers. Build with the
+// nolibnfc tag to leave it out.
+package auto
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/hsanjuan/go-nfctype4"
+	"github.com/hsanjuan/go-nfctype4/drivers/ccid"
+	"github.com/hsanjuan/go-nfctype4/drivers/cryptotokenkit"
+	"github.com/hsanjuan/go-nfctype4/drivers/linuxnfc"
+	"github.com/hsanjuan/go-nfctype4/drivers/pn532i2c"
+	"github.com/hsanjuan/go-nfctype4/drivers/pn532uart"
+	"github.com/hsanjuan/go-nfctype4/drivers/ufr"
+	"github.com/hsanjuan/go-nfctype4/drivers/winscard"
+)
+
+// DefaultSerialPort is the serial port used by the pn532uart backend.
+const DefaultSerialPort = "/dev/ttyUSB0"
+
+// Backend is a driver which can be tried by the auto Driver.
+type Backend struct {
+	Name string
+	// New returns a new, not initialized, driver.
+	New func() nfctype4.CommandDriver
+}
+
+var (
+	backendsMux sync.Mutex
+	backends    = append(append(systemBackends(), libnfcBackends()...), []Backend{
+		{
+			Name: "pn532uart",
+			New: func() nfctype4.CommandDriver {
+				return &pn532uart.Driver{Port: DefaultSerialPort}
+			},
+		},
+		{
+			Name: "pn532i2c",
+			New: func() nfctype4.CommandDriver {
+				return new(pn532i2c.Driver)
+			},
+		},
+	}...)
+)
+
+// noTargetErrors are the errors which indicate that a reader was
+// found but there was no tag in its field. The PN532-based drivers
+// (pn532uart, pn532i2c and acr122u) share the same error.
+var noTargetErrors = append([]error{
+	pn532uart.ErrNoTargetsDetected,
+	winscard.ErrNoTargetsDetected,
+	cryptotokenkit.ErrNoTargetsDetected,
+	ccid.ErrNoTargetsDetected,
+	linuxnfc.ErrNoTargetsDetected,
+	ufr.ErrNoTargetsDetected,
+}, libnfcNoTargetErrors...)
+
+// IsNoTarget returns true if the error, or any error it wraps,
+// indicates that one of the drivers of this library found a reader
+// but there was no tag in its field. Applications polling for tags
+// can use it to tell an empty reader from an actual failure.
+func IsNoTarget(err error) bool {
+	for _, noTarget := range noTargetErrors {
+		if errors.Is(err, noTarget) {
+			return true
+		}
+	}
+	return false
+}
+
+// Register adds a backend, which will be tried after the ones
+// already registered. If prepend is true, it is tried first instead.
+func Register(name string, newDriver func() nfctype4.CommandDriver, prepend bool) {
+	backendsMux.Lock()
+	defer backendsMux.Unlock()
+	b := Backend{Name: name, New: newDriver}
+	if prepend {
+		backends = append([]Backend{b}, backends...)
+		return
+	}
+	backends = append(backends, b)
+}
+
+// Backends returns the registered backends, in the order in which
+// they are tried.
+func Backends() []Backend {
+	backendsMux.Lock()
+	defer backendsMux.Unlock()
+	return append([]Backend{}, backends...)
+}
+
+// Driver implements the CommandDriver interface by delegating on the
+// first backend which initializes successfully.
+type Driver struct {
+	// Backends to try. When empty, the registered ones are used.
+	Backends []Backend
+
+	driver nfctype4.CommandDriver
+	name   string
+}
+
+// Initialize tries to initialize every backend, in order, and keeps
+// the first one which succeeds.
+//
+// When all of them fail, it returns the error of the first backend
+// which found a reader but no tag (so that callers can wait for the
+// tag to appear), or an error listing the failure of every backend.
+func (driver *Driver) Initialize() error {
+	driver.Close()
+	candidates := driver.Backends
+	if len(candidates) == 0 {
+		candidates = Backends()
+	}
+
+	var msgs []string
+	var noTargetErr error
+	for _, b := range candidates {
+		d := b.New()
+		err := d.Initialize()
+		if err == nil {
+			driver.driver = d
+			driver.name = b.Name
+			return nil
+		}
+		d.Close()
+		if noTargetErr == nil && IsNoTarget(err) {
+			noTargetErr = err
+		}
+		msgs = append(msgs, fmt.Sprintf("%s: %s", b.Name, err))
+	}
+	if noTargetErr != nil {
+		return noTargetErr
+	}
+	if len(msgs) == 0 {
+		return errors.New("Driver.Initialize: no backends available")
+	}
+	return fmt.Errorf("Driver.Initialize: no backend could be "+
+		"initialized (%s)", strings.Join(msgs, "; "))
+}
+
+// Selected returns the name of the backend in use, or an empty string
+// if none has been initialized.
+func (driver *Driver) Selected() string {
+	return driver.name
+}
+
+// String returns information about this driver and the selected
+// backend.
+func (driver *Driver) String() string {
+	if driver.driver == nil {
+		return "Auto driver. No backend selected."
+	}
+	return fmt.Sprintf("Auto driver. Using %s: %s",
+		driver.name, driver.driver)
+}
+
+// TransceiveBytes sends the bytes using the selected backend.
+//
+// It returns an error if no backend has been initialized.
+func (driver *Driver) TransceiveBytes(tx []byte, rxLen int) ([]byte, error) {
+	if driver.driver == nil {
+		return nil, errors.New("Driver.TransceiveBytes: " +
+			"Driver not initialized")
+	}
+	return driver.driver.TransceiveBytes(tx, rxLen)
+}
+
+// TargetInfo returns the information about the selected tag provided
+// by the backend in use.
+//
+// It returns an error if no backend has been initialized or if the
+// backend does not implement nfctype4.TargetInformer.
+func (driver *Driver) TargetInfo() (nfctype4.TargetInfo, error) {
+	if driver.driver == nil {
+		return nfctype4.TargetInfo{}, errors.New("Driver.TargetInfo: " +
+			"Driver not initialized")
+	}
+	informer, ok := driver.driver.(nfctype4.TargetInformer)
+	if !ok {
+		return nfctype4.TargetInfo{}, fmt.Errorf("Driver.TargetInfo: "+
+			"the %s backend does not provide target information",
+			driver.name)
+	}
+	return informer.TargetInfo()
+}
+
+// Close closes the selected backend.
+func (driver *Driver) Close() {
+	if driver.driver != nil {
+		driver.driver.Close()
+	}
+	driver.driver = nil
+	driver.name = ""
+}
@@ -0,0 +1,231 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package auto
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/hsanjuan/go-ndef"
+	"github.com/hsanjuan/go-nfctype4"
+	"github.com/hsanjuan/go-nfctype4/drivers/ccid"
+	"github.com/hsanjuan/go-nfctype4/drivers/linuxnfc"
+	"github.com/hsanjuan/go-nfctype4/drivers/pn532uart"
+	"github.com/hsanjuan/go-nfctype4/drivers/swtag"
+	"github.com/hsanjuan/go-nfctype4/drivers/ufr"
+	"github.com/hsanjuan/go-nfctype4/tags/static"
+)
+
+type failingDriver struct {
+	swtag.Driver
+	err error
+}
+
+func (driver *failingDriver) Initialize() error {
+	return driver.err
+}
+
+func failing(name string, err error) Backend {
+	return Backend{
+		Name: name,
+		New: func() nfctype4.CommandDriver {
+			return &failingDriver{err: err}
+		},
+	}
+}
+
+type informerDriver struct {
+	swtag.Driver
+}
+
+func (driver *informerDriver) TargetInfo() (nfctype4.TargetInfo, error) {
+	return nfctype4.TargetInfo{UID: []byte{0x04, 0x01, 0x02, 0x03}}, nil
+}
+
+func TestDriver(t *testing.T) {
+	tag := static.New()
+	msg := ndef.NewTextMessage("detected", "en")
+	tag.SetMessage(msg)
+	driver := &Driver{
+		Backends: []Backend{
+			failing("broken", errors.New("no reader")),
+			{
+				Name: "swtag",
+				New: func() nfctype4.CommandDriver {
+					return &swtag.Driver{Tag: tag}
+				},
+			},
+		},
+	}
+	readMsg, err := nfctype4.New(driver).Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if readMsg.String() != msg.String() {
+		t.Error("unexpected message:", readMsg)
+	}
+
+	if err := driver.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	if driver.Selected() != "swtag" {
+		t.Error("unexpected backend:", driver.Selected())
+	}
+	_ = driver.String()
+	driver.Close()
+	if driver.Selected() != "" {
+		t.Error("Close should unselect the backend")
+	}
+}
+
+func TestDriver_TargetInfo(t *testing.T) {
+	driver := &Driver{
+		Backends: []Backend{{
+			Name: "swtag",
+			New: func() nfctype4.CommandDriver {
+				return &swtag.Driver{Tag: static.New()}
+			},
+		}},
+	}
+	if _, err := driver.TargetInfo(); err == nil {
+		t.Error("TargetInfo should fail before Initialize")
+	}
+	if err := driver.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := driver.TargetInfo(); err == nil {
+		t.Error("swtag does not provide target information")
+	}
+
+	driver.Backends = []Backend{{
+		Name: "informer",
+		New: func() nfctype4.CommandDriver {
+			return &informerDriver{swtag.Driver{Tag: static.New()}}
+		},
+	}}
+	if err := driver.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	info, err := driver.TargetInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(info.UID) != 4 || info.UID[0] != 0x04 {
+		t.Error("unexpected target information:", info)
+	}
+	driver.Close()
+}
+
+func TestDriver_errors(t *testing.T) {
+	driver := &Driver{}
+	if _, err := driver.TransceiveBytes([]byte{0x00}, 2); err == nil {
+		t.Error("TransceiveBytes should fail before Initialize")
+	}
+
+	driver.Backends = []Backend{
+		failing("a", errors.New("no reader")),
+		failing("b", errors.New("no bus")),
+	}
+	err := driver.Initialize()
+	if err == nil || !strings.Contains(err.Error(), "a: no reader; b: no bus") {
+		t.Error("unexpected error:", err)
+	}
+
+	driver.Backends = []Backend{
+		failing("a", pn532uart.ErrNoTargetsDetected),
+		failing("b", errors.New("no bus")),
+	}
+	if err := driver.Initialize(); err != pn532uart.ErrNoTargetsDetected {
+		t.Error("expected ErrNoTargetsDetected but got:", err)
+	}
+
+	// A reader without a tag does not stop the search
+	driver.Backends = []Backend{
+		failing("a", pn532uart.ErrNoTargetsDetected),
+		{
+			Name: "swtag",
+			New: func() nfctype4.CommandDriver {
+				return &swtag.Driver{Tag: static.New()}
+			},
+		},
+	}
+	if err := driver.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	if driver.Selected() != "swtag" {
+		t.Error("unexpected backend:", driver.Selected())
+	}
+	driver.Close()
+}
+
+func TestIsNoTarget(t *testing.T) {
+	testcases := []struct {
+		err      error
+		noTarget bool
+	}{
+		{nil, false},
+		{errors.New("no reader"), false},
+		{pn532uart.ErrNoTargetsDetected, true},
+		{linuxnfc.ErrNoTargetsDetected, true},
+		{ufr.ErrNoTargetsDetected, true},
+		{fmt.Errorf("polling: %w", ccid.ErrNoTargetsDetected), true},
+	}
+	for i, c := range testcases {
+		if IsNoTarget(c.err) != c.noTarget {
+			t.Errorf("%d: expected %t for %v", i, c.noTarget, c.err)
+		}
+	}
+}
+
+func TestBackends(t *testing.T) {
+	var names []string
+	for _, b := range Backends() {
+		names = append(names, b.Name)
+	}
+	system := map[string]string{
+		"windows": "winscard",
+		"darwin":  "cryptotokenkit",
+		"linux":   "ccid",
+	}[runtime.GOOS]
+	want := "pn532uart pn532i2c"
+	for _, b := range libnfcBackends() {
+		want = b.Name + " " + want
+	}
+	if system != "" {
+		want = system + " " + want
+	}
+	if got := strings.Join(names, " "); !strings.HasPrefix(got, want) {
+		t.Errorf("expected the backends %q, got %q", want, got)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	previous := Backends()
+	n := len(previous)
+	Register("first", func() nfctype4.CommandDriver { return nil }, true)
+	Register("last", func() nfctype4.CommandDriver { return nil }, false)
+	backends := Backends()
+	if len(backends) != n+2 || backends[0].Name != "first" ||
+		backends[n+1].Name != "last" ||
+		backends[1].Name != previous[0].Name {
+		t.Error("backends not registered in order")
+	}
+}
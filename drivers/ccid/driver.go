@@ -0,0 +1,280 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+// Package ccid provides a CommandDriver implementation which talks to
+// USB smart card readers using the CCID protocol directly, without
+// pcscd or libnfc. This allows to use contactless readers in minimal
+// systems, like containers.
+//
+// The driver powers on the card in the reader and exchanges the APDUs
+// with PC_to_RDR_XfrBlock messages, over the bulk endpoints of the
+// reader. It needs a reader which works at short or extended APDU
+// level (most contactless readers do). On Linux, the reader is
+// accessed through usbfs (/dev/bus/usb), which requires write
+// permissions on the device and no kernel driver bound to it.
+package ccid
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/hsanjuan/go-nfctype4"
+)
+
+// Common errors
+var (
+	ErrNoReadersDetected = errors.New("no CCID readers detected")
+	ErrNoTargetsDetected = errors.New("no card present in the reader")
+)
+
+// Default values for the Driver configuration.
+const (
+	DefaultTimeout          = 5 * time.Second
+	DefaultMaxMessageLength = 271
+)
+
+// Driver implements the CommandDriver interface for a CCID reader. It
+// allows `Device` to communicate with the card (tag) present in the
+// reader.
+//
+// The tag must be in the field of the reader when Initialize is
+// called.
+type Driver struct {
+	// Device is the usbfs path of the reader, i.e.
+	// /dev/bus/usb/001/004. When empty, the first CCID reader
+	// found is used.
+	Device  string
+	Slot    byte          // Slot of the reader. Usually 0.
+	Timeout time.Duration // Defaults to DefaultTimeout
+	// MaxMessageLength is the maximum size of the CCID messages,
+	// including the header. When 0, the value advertised by the
+	// reader is used, or DefaultMaxMessageLength.
+	MaxMessageLength int
+	// Conn, when set, is used to communicate with the reader instead
+	// of opening Device. Writes go to the bulk-OUT endpoint and
+	// reads come from the bulk-IN one. It is not closed by Close.
+	Conn io.ReadWriteCloser
+	// Trace, when set, receives the bytes exchanged with the tag.
+	Trace nfctype4.Tracer
+
+	conn    io.ReadWriteCloser
+	maxLen  int
+	seq     byte
+	atr     []byte
+	pending []byte // Bytes read but not parsed yet
+}
+
+// ListReaders returns the usbfs paths of the CCID readers connected to
+// the system, which can be used to select them with the Device field.
+// Readers whose descriptors cannot be read (i.e. because of the
+// permissions) are not listed.
+func ListReaders() ([]string, error) {
+	return listUSB()
+}
+
+// Initialize opens the reader and powers on the card.
+//
+// It returns ErrNoTargetsDetected if there is no card in the reader,
+// or an error when some other step fails.
+func (driver *Driver) Initialize() error {
+	driver.Close()
+	conn := driver.Conn
+	maxLen := DefaultMaxMessageLength
+	if conn == nil {
+		var err error
+		var readerMaxLen int
+		conn, readerMaxLen, err = openUSB(driver.Device, driver.timeout())
+		if err != nil {
+			return err
+		}
+		if readerMaxLen > headerLen {
+			maxLen = readerMaxLen
+		}
+	}
+	if driver.MaxMessageLength > headerLen {
+		maxLen = driver.MaxMessageLength
+	}
+	driver.conn = conn
+	driver.maxLen = maxLen
+
+	resp, err := driver.transact(&message{
+		msgType: msgIccPowerOn,
+		params:  [3]byte{0x00}, // Automatic voltage selection
+	})
+	if err != nil {
+		driver.Close()
+		return err
+	}
+	driver.atr = resp.data
+	return nil
+}
+
+// ATR returns the Answer To Reset of the card, which for contactless
+// cards is built by the reader from the ATS.
+func (driver *Driver) ATR() []byte {
+	return driver.atr
+}
+
+// String returns information about the reader and the card.
+func (driver *Driver) String() string {
+	str := fmt.Sprintf("CCID Driver. Device: %s. Slot: %d.\n",
+		driver.Device, driver.Slot)
+	if driver.atr != nil {
+		str += fmt.Sprintf("ATR: % 02x\n", driver.atr)
+	} else {
+		str += fmt.Sprintln("No card information.")
+	}
+	return str
+}
+
+// TransceiveBytes sends the bytes to the card with XfrBlock messages
+// and returns the response. APDUs which do not fit in a message are
+// chained.
+//
+// It returns an error if the reader reports an error or if the
+// response is longer than rxLen.
+func (driver *Driver) TransceiveBytes(tx []byte, rxLen int) ([]byte, error) {
+	if driver.conn == nil {
+		return nil, errors.New("Driver.TransceiveBytes: " +
+			"Driver not initialized")
+	}
+	driver.Trace.Trace(true, tx)
+
+	maxData := driver.maxLen - headerLen
+	level := chainNone
+	for len(tx) > maxData {
+		if level == chainNone {
+			level = chainBegin
+		} else {
+			level = chainContinue
+		}
+		if _, err := driver.xfrBlock(tx[:maxData], level); err != nil {
+			return nil, err
+		}
+		tx = tx[maxData:]
+	}
+	if level != chainNone {
+		level = chainEnd
+	}
+	resp, err := driver.xfrBlock(tx, level)
+	if err != nil {
+		return nil, err
+	}
+
+	rx := append([]byte{}, resp.data...)
+	chain := resp.params[2]
+	for chain == chainBegin || chain == chainContinue {
+		resp, err = driver.xfrBlock(nil, chainMore)
+		if err != nil {
+			return nil, err
+		}
+		rx = append(rx, resp.data...)
+		chain = resp.params[2]
+	}
+
+	if len(rx) > rxLen {
+		return nil, fmt.Errorf("Driver.TransceiveBytes: "+
+			"received %d bytes but expected %d at most", len(rx), rxLen)
+	}
+	driver.Trace.Trace(false, rx)
+	return rx, nil
+}
+
+// Close powers off the card and closes the reader. Conn is left open,
+// as it belongs to the caller.
+func (driver *Driver) Close() {
+	if driver.conn == nil {
+		return
+	}
+	driver.transact(&message{msgType: msgIccPowerOff})
+	if driver.Conn == nil {
+		driver.conn.Close()
+	}
+	driver.conn = nil
+	driver.atr = nil
+	driver.pending = nil
+}
+
+// xfrBlock sends a XfrBlock message with the given data and level
+// parameter.
+func (driver *Driver) xfrBlock(data []byte, level byte) (*message, error) {
+	// bBWI, wLevelParameter (little endian)
+	return driver.transact(&message{
+		msgType: msgXfrBlock,
+		params:  [3]byte{0x00, level, 0x00},
+		data:    data,
+	})
+}
+
+// transact sends a message to the reader and waits for its response,
+// skipping the time extension requests.
+func (driver *Driver) transact(msg *message) (*message, error) {
+	driver.seq++
+	msg.slot = driver.Slot
+	msg.seq = driver.seq
+	if _, err := driver.conn.Write(msg.marshal()); err != nil {
+		return nil, err
+	}
+	for {
+		resp, err := driver.readMessage()
+		if err != nil {
+			return nil, err
+		}
+		if resp.seq != msg.seq || resp.slot != msg.slot {
+			continue // Stale response
+		}
+		if resp.status()&cmdStatusMask == cmdTimeExtension {
+			continue
+		}
+		if err := resp.err(); err != nil {
+			return nil, err
+		}
+		return resp, nil
+	}
+}
+
+// readMessage reads a complete message from the reader, which may
+// need several reads. Bytes read beyond the message are kept for the
+// next one.
+func (driver *Driver) readMessage() (*message, error) {
+	chunk := make([]byte, driver.maxLen)
+	for {
+		l := messageLen(driver.pending)
+		if l >= 0 && len(driver.pending) >= l {
+			msg, err := parseMessage(driver.pending[:l])
+			driver.pending = append([]byte{}, driver.pending[l:]...)
+			return msg, err
+		}
+		n, err := driver.conn.Read(chunk)
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			return nil, io.ErrUnexpectedEOF
+		}
+		driver.pending = append(driver.pending, chunk[:n]...)
+	}
+}
+
+func (driver *Driver) timeout() time.Duration {
+	if driver.Timeout == 0 {
+		return DefaultTimeout
+	}
+	return driver.Timeout
+}
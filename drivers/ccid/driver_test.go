@@ -0,0 +1,204 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package ccid
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/hsanjuan/go-ndef"
+	"github.com/hsanjuan/go-nfctype4"
+	"github.com/hsanjuan/go-nfctype4/drivers/swtag"
+	"github.com/hsanjuan/go-nfctype4/tags/static"
+)
+
+// fakeReader emulates a CCID reader at extended APDU level with a
+// software tag as card. Responses are returned in small reads and
+// preceded by a time extension request.
+type fakeReader struct {
+	tag       *swtag.Driver
+	maxData   int
+	noCard    bool
+	pending   bytes.Buffer
+	command   []byte
+	response  []byte
+	powerOffs int
+}
+
+func (r *fakeReader) reply(req *message, status, chain byte, data []byte) {
+	ext := &message{msgType: msgDataBlock, slot: req.slot, seq: req.seq,
+		params: [3]byte{cmdTimeExtension}}
+	r.pending.Write(ext.marshal())
+	resp := &message{msgType: msgDataBlock, slot: req.slot, seq: req.seq,
+		params: [3]byte{status, 0x00, chain}, data: data}
+	r.pending.Write(resp.marshal())
+}
+
+func (r *fakeReader) Write(b []byte) (int, error) {
+	req, err := parseMessage(b)
+	if err != nil {
+		return 0, err
+	}
+	switch req.msgType {
+	case msgIccPowerOn:
+		if r.noCard {
+			r.reply(req, cmdFailed|iccNotPresent, 0, nil)
+			break
+		}
+		r.reply(req, 0, 0, []byte{0x3B, 0x80, 0x80, 0x01, 0x01})
+	case msgIccPowerOff:
+		r.powerOffs++
+		r.reply(req, 0, 0, nil)
+	case msgXfrBlock:
+		level := req.params[1]
+		switch level {
+		case chainNone, chainBegin, chainContinue, chainEnd:
+			r.command = append(r.command, req.data...)
+			if level == chainBegin || level == chainContinue {
+				r.reply(req, 0, chainMore, nil)
+				break
+			}
+			r.response, _ = r.tag.TransceiveBytes(r.command, 65538)
+			r.command = nil
+			fallthrough
+		case chainMore:
+			chain := chainNone
+			if level == chainMore {
+				chain = chainEnd
+			}
+			data := r.response
+			if len(data) > r.maxData {
+				data = data[:r.maxData]
+				if level == chainMore {
+					chain = chainContinue
+				} else {
+					chain = chainBegin
+				}
+			}
+			r.response = r.response[len(data):]
+			r.reply(req, 0, chain, data)
+		}
+	}
+	return len(b), nil
+}
+
+func (r *fakeReader) Read(b []byte) (int, error) {
+	if len(b) > 7 {
+		b = b[:7]
+	}
+	return r.pending.Read(b)
+}
+
+func (r *fakeReader) Close() error {
+	return nil
+}
+
+func TestDriver(t *testing.T) {
+	tag := static.New()
+	reader := &fakeReader{tag: &swtag.Driver{Tag: tag}, maxData: 64}
+	driver := &Driver{Conn: reader, MaxMessageLength: headerLen + 64}
+	device := nfctype4.New(driver)
+
+	msg := ndef.NewTextMessage(strings.Repeat("usb ", 100), "en")
+	if err := device.Update(msg); err != nil {
+		t.Fatal(err)
+	}
+	if tag.GetMessage().String() != msg.String() {
+		t.Error("the message did not reach the tag")
+	}
+	readMsg, err := device.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if readMsg.String() != msg.String() {
+		t.Error("unexpected message:", readMsg)
+	}
+	if reader.powerOffs == 0 {
+		t.Error("the card should be powered off on Close")
+	}
+
+	if err := driver.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(driver.ATR(), []byte{0x3B, 0x80, 0x80, 0x01, 0x01}) {
+		t.Errorf("unexpected ATR: % X", driver.ATR())
+	}
+	_ = driver.String()
+	driver.Close()
+}
+
+func TestDriver_errors(t *testing.T) {
+	driver := &Driver{}
+	if _, err := driver.TransceiveBytes([]byte{0x00}, 2); err == nil {
+		t.Error("TransceiveBytes should fail before Initialize")
+	}
+
+	reader := &fakeReader{noCard: true}
+	driver = &Driver{Conn: reader}
+	if err := driver.Initialize(); err != ErrNoTargetsDetected {
+		t.Error("expected ErrNoTargetsDetected but got:", err)
+	}
+
+	reader = &fakeReader{tag: &swtag.Driver{Tag: static.New()}, maxData: 256}
+	driver = &Driver{Conn: reader}
+	if err := driver.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	selectBytes := []byte{0x00, 0xA4, 0x04, 0x00, 0x07,
+		0xD2, 0x76, 0x00, 0x00, 0x85, 0x01, 0x01, 0x00}
+	if _, err := driver.TransceiveBytes(selectBytes, 1); err == nil {
+		t.Error("TransceiveBytes should fail with long responses")
+	}
+}
+
+func TestFindCCIDInterface(t *testing.T) {
+	desc := []byte{
+		// Device
+		0x12, 0x01, 0x00, 0x02, 0x00, 0x00, 0x00, 0x40, 0x2F, 0x07,
+		0x2B, 0x22, 0x00, 0x02, 0x01, 0x02, 0x00, 0x01,
+		// Configuration
+		0x09, 0x02, 0x5D, 0x00, 0x01, 0x01, 0x00, 0x80, 0x32,
+		// Interface 0, class 0Bh
+		0x09, 0x04, 0x00, 0x00, 0x03, 0x0B, 0x00, 0x00, 0x00,
+		// CCID class descriptor (dwMaxCCIDMessageLength = 0x010F)
+		0x36, 0x21, 0x10, 0x01, 0x00, 0x07, 0x03, 0x00, 0x00, 0x00,
+		0xC0, 0x12, 0x00, 0x00, 0xC0, 0x12, 0x00, 0x00, 0x00, 0x67,
+		0x32, 0x00, 0x00, 0xCE, 0x99, 0x0C, 0x00, 0x00, 0xFE, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0xB0, 0x04, 0x02, 0x00, 0x0F, 0x01, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x01,
+		// Endpoints: interrupt IN, bulk OUT, bulk IN
+		0x07, 0x05, 0x81, 0x03, 0x08, 0x00, 0x0A,
+		0x07, 0x05, 0x02, 0x02, 0x40, 0x00, 0x00,
+		0x07, 0x05, 0x83, 0x02, 0x40, 0x00, 0x00,
+	}
+	iface, ok := findCCIDInterface(desc)
+	if !ok {
+		t.Fatal("CCID interface not found")
+	}
+	if iface.number != 0 || iface.epIn != 0x83 || iface.epOut != 0x02 ||
+		iface.maxMessage != 0x010F {
+		t.Errorf("unexpected interface: %+v", iface)
+	}
+
+	desc[32] = 0x03 // HID
+	if _, ok := findCCIDInterface(desc); ok {
+		t.Error("HID interfaces should be ignored")
+	}
+}
@@ -0,0 +1,121 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package ccid
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Message types of the CCID bulk messages used by the driver.
+const (
+	msgIccPowerOn  = byte(0x62)
+	msgIccPowerOff = byte(0x63)
+	msgXfrBlock    = byte(0x6F)
+	msgDataBlock   = byte(0x80)
+	msgSlotStatus  = byte(0x81)
+)
+
+// headerLen is the size of the header of every CCID message.
+const headerLen = 10
+
+// Bits of the bStatus field of the responses.
+const (
+	iccStatusMask    = byte(0x03)
+	iccNotPresent    = byte(0x02)
+	cmdStatusMask    = byte(0xC0)
+	cmdFailed        = byte(0x40)
+	cmdTimeExtension = byte(0x80)
+)
+
+// Values of wLevelParameter (commands) and bChainParameter
+// (responses) used to chain APDUs longer than a message.
+const (
+	chainNone     = byte(0x00) // The APDU fits in the message
+	chainBegin    = byte(0x01) // First part, more follow
+	chainEnd      = byte(0x02) // Last part
+	chainContinue = byte(0x03) // Intermediate part, more follow
+	chainMore     = byte(0x10) // Empty, waiting for the next part
+)
+
+// message is a CCID bulk message. For commands, params holds the
+// three message-specific bytes. For responses, they are bStatus,
+// bError and a message-specific byte (bChainParameter for DataBlock).
+type message struct {
+	msgType byte
+	slot    byte
+	seq     byte
+	params  [3]byte
+	data    []byte
+}
+
+// marshal returns the bytes of the message.
+func (msg *message) marshal() []byte {
+	buf := make([]byte, headerLen+len(msg.data))
+	buf[0] = msg.msgType
+	binary.LittleEndian.PutUint32(buf[1:], uint32(len(msg.data)))
+	buf[5] = msg.slot
+	buf[6] = msg.seq
+	copy(buf[7:headerLen], msg.params[:])
+	copy(buf[headerLen:], msg.data)
+	return buf
+}
+
+// messageLen returns the total length of the message starting in buf,
+// or -1 if the header is not complete.
+func messageLen(buf []byte) int {
+	if len(buf) < headerLen {
+		return -1
+	}
+	return headerLen + int(binary.LittleEndian.Uint32(buf[1:]))
+}
+
+// parseMessage parses a complete message.
+func parseMessage(buf []byte) (*message, error) {
+	n := messageLen(buf)
+	if n < 0 || len(buf) != n {
+		return nil, errors.New("parseMessage: malformed message")
+	}
+	msg := &message{
+		msgType: buf[0],
+		slot:    buf[5],
+		seq:     buf[6],
+		data:    buf[headerLen:],
+	}
+	copy(msg.params[:], buf[7:headerLen])
+	return msg, nil
+}
+
+// status returns the bStatus field of a response.
+func (msg *message) status() byte {
+	return msg.params[0]
+}
+
+// err returns an error if the response indicates that the command
+// failed.
+func (msg *message) err() error {
+	if msg.status()&cmdStatusMask != cmdFailed {
+		return nil
+	}
+	if msg.status()&iccStatusMask == iccNotPresent {
+		return ErrNoTargetsDetected
+	}
+	return fmt.Errorf("CCID: the reader reported error %02xh",
+		msg.params[1])
+}
@@ -0,0 +1,84 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package ccid
+
+import (
+	"encoding/binary"
+)
+
+// USB descriptor types and values used to find CCID readers.
+const (
+	descInterface   = byte(0x04)
+	descEndpoint    = byte(0x05)
+	descCCID        = byte(0x21)
+	classSmartCard  = byte(0x0B)
+	endpointIn      = byte(0x80)
+	transferBulk    = byte(0x02)
+	transferTypeMsk = byte(0x03)
+)
+
+// ccidInterface describes the CCID interface of a USB device.
+type ccidInterface struct {
+	number     int
+	epIn       byte
+	epOut      byte
+	maxMessage int // dwMaxCCIDMessageLength, 0 if unknown
+}
+
+// findCCIDInterface walks the descriptors of a USB device (the
+// device descriptor followed by the configuration descriptors, as
+// read from usbfs) and returns the first smart card interface with
+// bulk IN and OUT endpoints.
+func findCCIDInterface(desc []byte) (ccidInterface, bool) {
+	var iface ccidInterface
+	inCCID := false
+	for len(desc) >= 2 {
+		l := int(desc[0])
+		if l < 2 || l > len(desc) {
+			break
+		}
+		d := desc[:l]
+		desc = desc[l:]
+
+		switch d[1] {
+		case descInterface:
+			if inCCID && iface.epIn != 0 && iface.epOut != 0 {
+				return iface, true
+			}
+			inCCID = l >= 9 && d[5] == classSmartCard
+			iface = ccidInterface{number: int(d[2])}
+		case descCCID:
+			if inCCID && l >= 48 {
+				iface.maxMessage = int(binary.LittleEndian.Uint32(d[44:]))
+			}
+		case descEndpoint:
+			if !inCCID || l < 7 || d[3]&transferTypeMsk != transferBulk {
+				continue
+			}
+			if d[2]&endpointIn != 0 {
+				iface.epIn = d[2]
+			} else {
+				iface.epOut = d[2]
+			}
+		}
+	}
+	if inCCID && iface.epIn != 0 && iface.epOut != 0 {
+		return iface, true
+	}
+	return ccidInterface{}, false
+}
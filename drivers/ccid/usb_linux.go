@@ -0,0 +1,185 @@
+//go:build linux && !mips && !mipsle && !mips64 && !mips64le && !ppc64 && !ppc64le
+
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package ccid
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// bulkTransfer mirrors struct usbdevfs_bulktransfer.
+type bulkTransfer struct {
+	ep      uint32
+	len     uint32
+	timeout uint32 // in milliseconds
+	data    unsafe.Pointer
+}
+
+// usbfs ioctl requests. The encoding (_IOC) is the generic one, which
+// is not used by the architectures excluded in the build tags.
+var (
+	usbdevfsBulk             = ioc(3, 2, unsafe.Sizeof(bulkTransfer{}))
+	usbdevfsClaimInterface   = ioc(2, 15, 4)
+	usbdevfsReleaseInterface = ioc(2, 16, 4)
+)
+
+func ioc(dir, nr, size uintptr) uintptr {
+	return dir<<30 | size<<16 | 'U'<<8 | nr
+}
+
+// usbConn implements the bulk transfers with a CCID interface
+// through usbfs.
+type usbConn struct {
+	f       *os.File
+	iface   ccidInterface
+	timeout time.Duration
+}
+
+// openUSB opens the given usbfs device, or the first CCID reader
+// found when empty, and claims its CCID interface. It returns the
+// connection and the maximum message length advertised by the
+// reader.
+func openUSB(device string, timeout time.Duration) (io.ReadWriteCloser, int, error) {
+	devices := []string{device}
+	if device == "" {
+		var err error
+		devices, err = filepath.Glob("/dev/bus/usb/*/*")
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+	for _, dev := range devices {
+		desc, err := os.ReadFile(dev)
+		if err != nil {
+			if device != "" {
+				return nil, 0, err
+			}
+			continue
+		}
+		iface, ok := findCCIDInterface(desc)
+		if !ok {
+			if device != "" {
+				return nil, 0, fmt.Errorf("openUSB: %s is not a "+
+					"CCID reader", dev)
+			}
+			continue
+		}
+		conn, err := claim(dev, iface, timeout)
+		if err != nil {
+			return nil, 0, err
+		}
+		return conn, iface.maxMessage, nil
+	}
+	return nil, 0, ErrNoReadersDetected
+}
+
+// listUSB returns the usbfs paths of the CCID readers.
+func listUSB() ([]string, error) {
+	devices, err := filepath.Glob("/dev/bus/usb/*/*")
+	if err != nil {
+		return nil, err
+	}
+	var readers []string
+	for _, dev := range devices {
+		desc, err := os.ReadFile(dev)
+		if err != nil {
+			continue
+		}
+		if _, ok := findCCIDInterface(desc); ok {
+			readers = append(readers, dev)
+		}
+	}
+	return readers, nil
+}
+
+// claim opens the device and claims the interface.
+func claim(device string, iface ccidInterface, timeout time.Duration) (*usbConn, error) {
+	f, err := os.OpenFile(device, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	number := uint32(iface.number)
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(),
+		usbdevfsClaimInterface, uintptr(unsafe.Pointer(&number)))
+	if errno != 0 {
+		f.Close()
+		return nil, fmt.Errorf("openUSB: cannot claim interface %d "+
+			"of %s (is a kernel driver bound to it?): %s",
+			iface.number, device, errno)
+	}
+	return &usbConn{
+		f:       f,
+		iface:   iface,
+		timeout: timeout,
+	}, nil
+}
+
+// bulk performs a bulk transfer with the given endpoint.
+func (conn *usbConn) bulk(ep byte, buf []byte) (int, error) {
+	if len(buf) == 0 {
+		return 0, nil
+	}
+	bt := bulkTransfer{
+		ep:      uint32(ep),
+		len:     uint32(len(buf)),
+		timeout: uint32(conn.timeout / time.Millisecond),
+		data:    unsafe.Pointer(&buf[0]),
+	}
+	n, _, errno := syscall.Syscall(syscall.SYS_IOCTL, conn.f.Fd(),
+		usbdevfsBulk, uintptr(unsafe.Pointer(&bt)))
+	runtime.KeepAlive(buf)
+	if errno == syscall.ETIMEDOUT {
+		return 0, io.ErrUnexpectedEOF
+	}
+	if errno != 0 {
+		return 0, errno
+	}
+	return int(n), nil
+}
+
+// Write sends the bytes to the bulk-OUT endpoint.
+func (conn *usbConn) Write(b []byte) (int, error) {
+	return conn.bulk(conn.iface.epOut, b)
+}
+
+// Read receives bytes from the bulk-IN endpoint.
+func (conn *usbConn) Read(b []byte) (int, error) {
+	return conn.bulk(conn.iface.epIn, b)
+}
+
+// Close releases the interface and closes the device.
+func (conn *usbConn) Close() error {
+	if conn.f == nil {
+		return errors.New("usbConn.Close: already closed")
+	}
+	number := uint32(conn.iface.number)
+	syscall.Syscall(syscall.SYS_IOCTL, conn.f.Fd(),
+		usbdevfsReleaseInterface, uintptr(unsafe.Pointer(&number)))
+	err := conn.f.Close()
+	conn.f = nil
+	return err
+}
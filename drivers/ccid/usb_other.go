@@ -0,0 +1,37 @@
+//go:build !linux || mips || mipsle || mips64 || mips64le || ppc64 || ppc64le
+
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package ccid
+
+import (
+	"errors"
+	"io"
+	"time"
+)
+
+// openUSB is only implemented on Linux. Other systems can use the
+// Conn field of the Driver.
+func openUSB(device string, timeout time.Duration) (io.ReadWriteCloser, int, error) {
+	return nil, 0, errors.New("openUSB: USB is only supported on Linux")
+}
+
+// listUSB is only implemented on Linux.
+func listUSB() ([]string, error) {
+	return nil, errors.New("listUSB: USB is only supported on Linux")
+}
@@ -0,0 +1,142 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+// Package chaos provides a CommandDriver wrapper which injects delays,
+// truncated responses and transport errors around any other driver.
+//
+// It is meant to stress-test how a Device, and the retry logic built
+// on top of it, copes with slow and unreliable links. The faulty tag
+// does the same on the tag side.
+package chaos
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/hsanjuan/go-nfctype4"
+)
+
+// ErrInjected is returned by the operations which fail on purpose.
+var ErrInjected = errors.New("chaos: injected transport error")
+
+// Policy describes which faults are injected. The zero value injects
+// no faults.
+type Policy struct {
+	// Time to wait before every operation.
+	Delay time.Duration
+	// Maximum random time added to Delay.
+	Jitter time.Duration
+	// Probability (0 to 1) of failing Initialize with ErrInjected.
+	InitErrorRate float64
+	// Probability (0 to 1) of failing TransceiveBytes with
+	// ErrInjected. The bytes are not sent to the wrapped driver.
+	ErrorRate float64
+	// Probability (0 to 1) of returning only part of the bytes
+	// received from the wrapped driver.
+	TruncateRate float64
+	// Seed for the random number generator, which makes the
+	// injected faults reproducible.
+	Seed int64
+}
+
+// Driver wraps a CommandDriver and disturbs the communication with it
+// according to a Policy. It implements the CommandDriver interface.
+//
+// Please use chaos.New() to create drivers.
+type Driver struct {
+	driver nfctype4.CommandDriver
+	policy Policy
+
+	mux  sync.Mutex
+	rand *rand.Rand
+}
+
+// New returns a new *Driver which wraps the given one and injects
+// faults according to the given Policy.
+func New(driver nfctype4.CommandDriver, policy Policy) *Driver {
+	return &Driver{
+		driver: driver,
+		policy: policy,
+		rand:   rand.New(rand.NewSource(policy.Seed)),
+	}
+}
+
+// Initialize initializes the wrapped driver, unless an error is
+// injected.
+func (driver *Driver) Initialize() error {
+	driver.wait()
+	if driver.chance(driver.policy.InitErrorRate) {
+		return ErrInjected
+	}
+	return driver.driver.Initialize()
+}
+
+// String returns information about this driver.
+func (driver *Driver) String() string {
+	return fmt.Sprintf("Chaos driver. Wrapping: %s", driver.driver)
+}
+
+// TransceiveBytes forwards the bytes to the wrapped driver and returns
+// its response, possibly delayed, truncated or replaced by
+// ErrInjected.
+func (driver *Driver) TransceiveBytes(tx []byte, rxLen int) ([]byte, error) {
+	driver.wait()
+	if driver.chance(driver.policy.ErrorRate) {
+		return nil, ErrInjected
+	}
+	rx, err := driver.driver.TransceiveBytes(tx, rxLen)
+	if err != nil || len(rx) == 0 {
+		return rx, err
+	}
+	if driver.chance(driver.policy.TruncateRate) {
+		driver.mux.Lock()
+		rx = rx[:driver.rand.Intn(len(rx))]
+		driver.mux.Unlock()
+	}
+	return rx, nil
+}
+
+// Close closes the wrapped driver.
+func (driver *Driver) Close() {
+	driver.driver.Close()
+}
+
+// chance returns true with the given probability.
+func (driver *Driver) chance(p float64) bool {
+	if p <= 0 {
+		return false
+	}
+	driver.mux.Lock()
+	defer driver.mux.Unlock()
+	return driver.rand.Float64() < p
+}
+
+// wait sleeps for the Delay plus a random Jitter.
+func (driver *Driver) wait() {
+	d := driver.policy.Delay
+	if driver.policy.Jitter > 0 {
+		driver.mux.Lock()
+		d += time.Duration(driver.rand.Int63n(int64(driver.policy.Jitter)))
+		driver.mux.Unlock()
+	}
+	if d > 0 {
+		time.Sleep(d)
+	}
+}
@@ -0,0 +1,86 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package chaos
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hsanjuan/go-ndef"
+	"github.com/hsanjuan/go-nfctype4"
+	"github.com/hsanjuan/go-nfctype4/apdu"
+	"github.com/hsanjuan/go-nfctype4/drivers/swtag"
+	"github.com/hsanjuan/go-nfctype4/tags/static"
+)
+
+var selectBytes, _ = apdu.NewNDEFTagApplicationSelectAPDU().Marshal()
+
+func TestDriver_noFaults(t *testing.T) {
+	tag := static.New()
+	msg := ndef.NewTextMessage("calm", "en")
+	tag.SetMessage(msg)
+	driver := New(&swtag.Driver{Tag: tag}, Policy{})
+	readMsg, err := nfctype4.New(driver).Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if readMsg.String() != msg.String() {
+		t.Error("unexpected message:", readMsg)
+	}
+	_ = driver.String()
+}
+
+func TestDriver_errors(t *testing.T) {
+	driver := New(&swtag.Driver{Tag: static.New()},
+		Policy{InitErrorRate: 1, ErrorRate: 1})
+	if err := driver.Initialize(); err != ErrInjected {
+		t.Error("Initialize should fail:", err)
+	}
+	if _, err := driver.TransceiveBytes(selectBytes, 2); err != ErrInjected {
+		t.Error("TransceiveBytes should fail:", err)
+	}
+	if _, err := nfctype4.New(driver).Read(); err == nil {
+		t.Error("Read should fail")
+	}
+}
+
+func TestDriver_truncate(t *testing.T) {
+	swDriver := &swtag.Driver{Tag: static.New()}
+	swDriver.Initialize()
+	driver := New(swDriver, Policy{TruncateRate: 1, Seed: 7})
+	for i := 0; i < 20; i++ {
+		rx, err := driver.TransceiveBytes(selectBytes, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rx) >= 2 {
+			t.Fatal("the response should have been truncated")
+		}
+	}
+}
+
+func TestDriver_delay(t *testing.T) {
+	driver := New(&swtag.Driver{Tag: static.New()},
+		Policy{Delay: 10 * time.Millisecond, Jitter: 10 * time.Millisecond})
+	driver.Initialize()
+	start := time.Now()
+	driver.TransceiveBytes(selectBytes, 2)
+	if time.Since(start) < 10*time.Millisecond {
+		t.Error("operations should be delayed")
+	}
+}
@@ -0,0 +1,208 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+// Package cryptotokenkit provides a CommandDriver implementation for
+// macOS which uses the smart card support built in the system
+// (CryptoTokenKit's TKSmartCard), so contactless readers work without
+// installing libnfc or other stacks.
+//
+// The driver needs cgo. Applications running in the App Sandbox need
+// the com.apple.security.smartcard entitlement.
+package cryptotokenkit
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hsanjuan/go-nfctype4"
+)
+
+// Common errors
+var (
+	ErrNoReadersDetected = errors.New("no smart card readers detected")
+	ErrNoTargetsDetected = errors.New("no card present in the reader")
+)
+
+// pollInterval is the time between checks of the slot states while
+// waiting for a card.
+const pollInterval = 250 * time.Millisecond
+
+// Slot states (TKSmartCardSlotState).
+const (
+	slotMissing   = 0
+	slotEmpty     = 1
+	slotProbing   = 2
+	slotMuteCard  = 3
+	slotValidCard = 4
+)
+
+// slotManager gives access to the smart card slots (readers) of the
+// system.
+type slotManager interface {
+	slotNames() ([]string, error)
+	slotState(name string) (int, error)
+	// connect begins a session with the card in the slot. It returns
+	// ErrNoTargetsDetected when there is no valid card.
+	connect(name string) (smartCard, error)
+}
+
+// smartCard is a session with a card.
+type smartCard interface {
+	transmit(tx []byte, rxLen int) ([]byte, error)
+	close()
+}
+
+// Driver implements the CommandDriver interface using CryptoTokenKit.
+// It allows `Device` to communicate with the card (tag) present in
+// the reader.
+type Driver struct {
+	// Slot selects the reader whose name contains the given string.
+	// Defaults to the first reader.
+	Slot string
+	// WaitForCard makes Initialize wait until a card is present in
+	// one of the readers, instead of failing.
+	WaitForCard bool
+	// WaitTimeout limits the time that Initialize waits for a card.
+	// 0 means no limit.
+	WaitTimeout time.Duration
+	// Trace, when set, receives the bytes exchanged with the tag.
+	Trace nfctype4.Tracer
+
+	card smartCard
+	slot string
+}
+
+// Initialize begins a session with the card in the reader, waiting
+// for it when WaitForCard is set.
+//
+// It returns ErrNoReadersDetected or ErrNoTargetsDetected when no
+// reader or card is available, or an error when some other step
+// fails.
+func (driver *Driver) Initialize() error {
+	driver.Close()
+	mgr, err := newSlotManager()
+	if err != nil {
+		return err
+	}
+
+	var deadline time.Time
+	if driver.WaitTimeout > 0 {
+		deadline = time.Now().Add(driver.WaitTimeout)
+	}
+	for {
+		slot, err := driver.findSlot(mgr)
+		if err == nil {
+			var card smartCard
+			card, err = mgr.connect(slot)
+			if err == nil {
+				driver.card = card
+				driver.slot = slot
+				return nil
+			}
+		}
+		if err != ErrNoReadersDetected && err != ErrNoTargetsDetected {
+			return err
+		}
+		if !driver.WaitForCard ||
+			!deadline.IsZero() && time.Now().After(deadline) {
+			return err
+		}
+		time.Sleep(pollInterval)
+	}
+}
+
+// ListReaders returns the names of the smart card readers (slots) of
+// the system, which can be used to select them with the Slot field.
+func ListReaders() ([]string, error) {
+	mgr, err := newSlotManager()
+	if err != nil {
+		return nil, err
+	}
+	return mgr.slotNames()
+}
+
+// findSlot returns the first matching slot with a valid card, or the
+// first matching slot when none has one.
+func (driver *Driver) findSlot(mgr slotManager) (string, error) {
+	names, err := mgr.slotNames()
+	if err != nil {
+		return "", err
+	}
+	var first string
+	for _, name := range names {
+		if !strings.Contains(name, driver.Slot) {
+			continue
+		}
+		if first == "" {
+			first = name
+		}
+		state, err := mgr.slotState(name)
+		if err != nil {
+			return "", err
+		}
+		if state == slotValidCard {
+			return name, nil
+		}
+	}
+	if first == "" {
+		return "", ErrNoReadersDetected
+	}
+	return first, nil
+}
+
+// String returns information about the reader.
+// It should be used after calling Initialize().
+func (driver *Driver) String() string {
+	if driver.slot == "" {
+		return fmt.Sprintln("CryptoTokenKit Driver. No reader information.")
+	}
+	return fmt.Sprintf("CryptoTokenKit Driver. Reader: %s\n", driver.slot)
+}
+
+// TransceiveBytes sends the bytes to the card and returns the
+// response.
+//
+// It returns an error if the reader reports an error or if the
+// response is longer than rxLen.
+func (driver *Driver) TransceiveBytes(tx []byte, rxLen int) ([]byte, error) {
+	if driver.card == nil {
+		return nil, errors.New("Driver.TransceiveBytes: " +
+			"Driver not initialized")
+	}
+	driver.Trace.Trace(true, tx)
+	rx, err := driver.card.transmit(tx, rxLen)
+	if err != nil {
+		return nil, err
+	}
+	driver.Trace.Trace(false, rx)
+	if len(rx) > rxLen {
+		return rx, errors.New("Driver.TransceiveBytes: " +
+			"The length of the response is larger than expected")
+	}
+	return rx, nil
+}
+
+// Close ends the session with the card.
+func (driver *Driver) Close() {
+	if driver.card != nil {
+		driver.card.close()
+	}
+	driver.card = nil
+	driver.slot = ""
+}
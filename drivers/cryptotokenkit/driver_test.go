@@ -0,0 +1,168 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package cryptotokenkit
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hsanjuan/go-ndef"
+	"github.com/hsanjuan/go-nfctype4"
+	"github.com/hsanjuan/go-nfctype4/drivers/swtag"
+	"github.com/hsanjuan/go-nfctype4/tags/static"
+)
+
+// fakeManager emulates the slots of the system. The card becomes
+// valid after the given number of state checks.
+type fakeManager struct {
+	tag    *swtag.Driver
+	slots  []string
+	checks int
+	closed bool
+}
+
+func (mgr *fakeManager) slotNames() ([]string, error) {
+	return mgr.slots, nil
+}
+
+func (mgr *fakeManager) slotState(name string) (int, error) {
+	if !strings.Contains(name, "Contactless") {
+		return slotEmpty, nil
+	}
+	if mgr.checks > 0 {
+		mgr.checks--
+		return slotProbing, nil
+	}
+	return slotValidCard, nil
+}
+
+func (mgr *fakeManager) connect(name string) (smartCard, error) {
+	if state, _ := mgr.slotState(name); state != slotValidCard {
+		return nil, ErrNoTargetsDetected
+	}
+	return &fakeCard{mgr}, nil
+}
+
+type fakeCard struct {
+	mgr *fakeManager
+}
+
+func (card *fakeCard) transmit(tx []byte, rxLen int) ([]byte, error) {
+	return card.mgr.tag.TransceiveBytes(tx, 65538)
+}
+
+func (card *fakeCard) close() {
+	card.mgr.closed = true
+}
+
+func useFakeManager(t *testing.T, mgr *fakeManager) {
+	orig := newSlotManager
+	newSlotManager = func() (slotManager, error) {
+		return mgr, nil
+	}
+	t.Cleanup(func() { newSlotManager = orig })
+}
+
+func TestDriver(t *testing.T) {
+	tag := static.New()
+	if err := tag.SetMaxDataLengths(0x0400, 0x0400); err != nil {
+		t.Fatal(err)
+	}
+	mgr := &fakeManager{
+		tag:   &swtag.Driver{Tag: tag},
+		slots: []string{"Contact Reader", "Contactless Reader"},
+	}
+	useFakeManager(t, mgr)
+	driver := &Driver{}
+	device := nfctype4.New(driver)
+
+	msg := ndef.NewTextMessage(strings.Repeat("tkcard ", 100), "en")
+	if err := device.Update(msg); err != nil {
+		t.Fatal(err)
+	}
+	readMsg, err := device.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if readMsg.String() != msg.String() {
+		t.Error("unexpected message:", readMsg)
+	}
+	if !mgr.closed {
+		t.Error("the session should have been ended")
+	}
+}
+
+func TestDriver_Initialize(t *testing.T) {
+	useFakeManager(t, &fakeManager{})
+	driver := &Driver{}
+	if err := driver.Initialize(); err != ErrNoReadersDetected {
+		t.Error("expected ErrNoReadersDetected but got:", err)
+	}
+
+	useFakeManager(t, &fakeManager{slots: []string{"Contact Reader"}})
+	if err := driver.Initialize(); err != ErrNoTargetsDetected {
+		t.Error("expected ErrNoTargetsDetected but got:", err)
+	}
+
+	useFakeManager(t, &fakeManager{slots: []string{"Contactless Reader"}})
+	driver = &Driver{Slot: "Other"}
+	if err := driver.Initialize(); err != ErrNoReadersDetected {
+		t.Error("expected ErrNoReadersDetected but got:", err)
+	}
+
+	driver = &Driver{}
+	if _, err := driver.TransceiveBytes([]byte{0x00}, 2); err == nil {
+		t.Error("TransceiveBytes should fail before Initialize")
+	}
+}
+
+func TestDriver_WaitForCard(t *testing.T) {
+	useFakeManager(t, &fakeManager{
+		tag:    &swtag.Driver{Tag: static.New()},
+		slots:  []string{"Contactless Reader"},
+		checks: 2,
+	})
+	driver := &Driver{WaitForCard: true, WaitTimeout: 5 * time.Second}
+	if err := driver.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	defer driver.Close()
+	if !strings.Contains(driver.String(), "Contactless Reader") {
+		t.Error("String should include the reader name")
+	}
+
+	useFakeManager(t, &fakeManager{slots: []string{"Contact Reader"}})
+	driver = &Driver{WaitForCard: true, WaitTimeout: time.Millisecond}
+	if err := driver.Initialize(); err != ErrNoTargetsDetected {
+		t.Error("expected ErrNoTargetsDetected but got:", err)
+	}
+}
+
+func TestListReaders(t *testing.T) {
+	useFakeManager(t, &fakeManager{
+		slots: []string{"Reader", "Reader Contactless"},
+	})
+	readers, err := ListReaders()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(readers) != 2 || readers[1] != "Reader Contactless" {
+		t.Error("unexpected readers:", readers)
+	}
+}
@@ -0,0 +1,233 @@
+//go:build darwin && cgo
+
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package cryptotokenkit
+
+/*
+#cgo CFLAGS: -x objective-c -fobjc-arc
+#cgo LDFLAGS: -framework Foundation -framework CryptoTokenKit
+
+#import <Foundation/Foundation.h>
+#import <CryptoTokenKit/CryptoTokenKit.h>
+#include <stdlib.h>
+#include <string.h>
+
+static char *tk_error(NSError *error) {
+	NSString *desc = @"unknown error";
+	if (error != nil) {
+		desc = error.localizedDescription;
+	}
+	return strdup(desc.UTF8String);
+}
+
+static int tk_available(void) {
+	return [TKSmartCardSlotManager defaultManager] != nil;
+}
+
+// tk_slot_names returns the names of the slots separated by NULs.
+static char *tk_slot_names(int *n) {
+	@autoreleasepool {
+		NSArray<NSString *> *names =
+			[TKSmartCardSlotManager defaultManager].slotNames;
+		NSMutableData *buf = [NSMutableData data];
+		for (NSString *name in names) {
+			const char *s = name.UTF8String;
+			[buf appendBytes:s length:strlen(s) + 1];
+		}
+		*n = (int)buf.length;
+		char *out = malloc(buf.length + 1);
+		memcpy(out, buf.bytes, buf.length);
+		return out;
+	}
+}
+
+static TKSmartCardSlot *tk_slot(const char *name) {
+	__block TKSmartCardSlot *slot = nil;
+	dispatch_semaphore_t sem = dispatch_semaphore_create(0);
+	[[TKSmartCardSlotManager defaultManager]
+		getSlotWithName:[NSString stringWithUTF8String:name]
+		reply:^(TKSmartCardSlot *s) {
+			slot = s;
+			dispatch_semaphore_signal(sem);
+		}];
+	dispatch_semaphore_wait(sem, DISPATCH_TIME_FOREVER);
+	return slot;
+}
+
+// tk_slot_state returns the state of the slot, or -1 if it does not
+// exist.
+static int tk_slot_state(const char *name) {
+	@autoreleasepool {
+		TKSmartCardSlot *slot = tk_slot(name);
+		if (slot == nil) {
+			return -1;
+		}
+		return (int)slot.state;
+	}
+}
+
+// tk_connect begins a session with the card in the slot. It returns
+// NULL without error when there is no valid card.
+static void *tk_connect(const char *name, char **err) {
+	@autoreleasepool {
+		TKSmartCardSlot *slot = tk_slot(name);
+		if (slot == nil) {
+			*err = strdup("slot not found");
+			return NULL;
+		}
+		TKSmartCard *card = [slot makeSmartCard];
+		if (card == nil) {
+			return NULL;
+		}
+		__block BOOL ok = NO;
+		__block NSError *sessionErr = nil;
+		dispatch_semaphore_t sem = dispatch_semaphore_create(0);
+		[card beginSessionWithReply:^(BOOL success, NSError *error) {
+			ok = success;
+			sessionErr = error;
+			dispatch_semaphore_signal(sem);
+		}];
+		dispatch_semaphore_wait(sem, DISPATCH_TIME_FOREVER);
+		if (!ok) {
+			*err = tk_error(sessionErr);
+			return NULL;
+		}
+		return (void *)CFBridgingRetain(card);
+	}
+}
+
+// tk_transmit sends an APDU and copies the response to rx. It returns
+// the length of the response, or -1 on error.
+static int tk_transmit(void *ref, const void *tx, int txLen,
+		void *rx, int rxCap, char **err) {
+	@autoreleasepool {
+		TKSmartCard *card = (__bridge TKSmartCard *)ref;
+		__block NSData *resp = nil;
+		__block NSError *respErr = nil;
+		dispatch_semaphore_t sem = dispatch_semaphore_create(0);
+		[card transmitRequest:[NSData dataWithBytes:tx length:txLen]
+			reply:^(NSData *response, NSError *error) {
+				resp = response;
+				respErr = error;
+				dispatch_semaphore_signal(sem);
+			}];
+		dispatch_semaphore_wait(sem, DISPATCH_TIME_FOREVER);
+		if (resp == nil) {
+			*err = tk_error(respErr);
+			return -1;
+		}
+		int n = (int)resp.length;
+		memcpy(rx, resp.bytes, n < rxCap ? n : rxCap);
+		return n;
+	}
+}
+
+static void tk_close(void *ref) {
+	@autoreleasepool {
+		TKSmartCard *card = (TKSmartCard *)CFBridgingRelease(ref);
+		[card endSession];
+	}
+}
+*/
+import "C"
+
+import (
+	"bytes"
+	"errors"
+	"unsafe"
+)
+
+// goError converts an error string allocated by the C functions.
+func goError(err *C.char) error {
+	defer C.free(unsafe.Pointer(err))
+	return errors.New(C.GoString(err))
+}
+
+type tkSlotManager struct{}
+
+var newSlotManager = func() (slotManager, error) {
+	if C.tk_available() == 0 {
+		return nil, errors.New("newSlotManager: " +
+			"smart card support is not available")
+	}
+	return tkSlotManager{}, nil
+}
+
+func (tkSlotManager) slotNames() ([]string, error) {
+	var n C.int
+	buf := C.tk_slot_names(&n)
+	defer C.free(unsafe.Pointer(buf))
+	var names []string
+	for _, name := range bytes.Split(C.GoBytes(unsafe.Pointer(buf), n), []byte{0}) {
+		if len(name) > 0 {
+			names = append(names, string(name))
+		}
+	}
+	return names, nil
+}
+
+func (tkSlotManager) slotState(name string) (int, error) {
+	cName := C.CString(name)
+	defer C.free(unsafe.Pointer(cName))
+	state := int(C.tk_slot_state(cName))
+	if state < 0 {
+		return 0, ErrNoReadersDetected
+	}
+	return state, nil
+}
+
+func (tkSlotManager) connect(name string) (smartCard, error) {
+	cName := C.CString(name)
+	defer C.free(unsafe.Pointer(cName))
+	var cErr *C.char
+	ref := C.tk_connect(cName, &cErr)
+	if cErr != nil {
+		return nil, goError(cErr)
+	}
+	if ref == nil {
+		return nil, ErrNoTargetsDetected
+	}
+	return &tkCard{ref}, nil
+}
+
+type tkCard struct {
+	ref unsafe.Pointer
+}
+
+func (card *tkCard) transmit(tx []byte, rxLen int) ([]byte, error) {
+	if len(tx) == 0 {
+		return nil, errors.New("tkCard.transmit: empty command")
+	}
+	// One extra byte to detect responses longer than rxLen
+	rx := make([]byte, rxLen+1)
+	var cErr *C.char
+	n := C.tk_transmit(card.ref, unsafe.Pointer(&tx[0]), C.int(len(tx)),
+		unsafe.Pointer(&rx[0]), C.int(len(rx)), &cErr)
+	if n < 0 {
+		return nil, goError(cErr)
+	}
+	if int(n) > len(rx) {
+		n = C.int(len(rx))
+	}
+	return rx[:n], nil
+}
+
+func (card *tkCard) close() {
+	C.tk_close(card.ref)
+}
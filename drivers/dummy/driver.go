@@ -16,11 +16,15 @@
 ***/
 
 // Package dummy provides a trivial CommandDriver implementation used for
-// testing and examples.
+// testing and examples, along with a strict Mock which checks the
+// commands it receives. Both can be built from transceive scripts
+// stored in JSON or YAML files (see LoadScript).
 package dummy
 
 import (
 	"fmt"
+
+	"github.com/hsanjuan/go-nfctype4/apdu"
 )
 
 // Driver implements a CommandDriver which does nothing
@@ -32,6 +36,27 @@ type Driver struct {
 	ReceiveBytesPos int
 }
 
+// NewReplay returns a Driver which replays the responses of the given
+// exchanges, for example, a transcript of the communication with a real
+// tag which has been persisted as JSON.
+//
+// It returns an error if any of the responses cannot be serialized.
+func NewReplay(exchanges []apdu.Exchange) (*Driver, error) {
+	driver := &Driver{}
+	for i, e := range exchanges {
+		if e.Response == nil {
+			return nil, fmt.Errorf("NewReplay: "+
+				"exchange %d has no response", i)
+		}
+		response, err := e.Response.Marshal()
+		if err != nil {
+			return nil, err
+		}
+		driver.ReceiveBytes = append(driver.ReceiveBytes, response)
+	}
+	return driver, nil
+}
+
 // Initialize does nothing because it is a DummyDriver.
 func (driver *Driver) Initialize() error {
 	return nil
@@ -18,7 +18,11 @@
 package dummy
 
 import (
+	"bytes"
+	"encoding/json"
 	"testing"
+
+	"github.com/hsanjuan/go-nfctype4/apdu"
 )
 
 func TestDriver(t *testing.T) {
@@ -43,6 +47,39 @@ func TestDriver(t *testing.T) {
 	if err == nil {
 		t.Fail()
 	}
-	d.String()
+	_ = d.String()
 	d.Close()
 }
+
+func TestNewReplay(t *testing.T) {
+	transcript := `[
+	{
+		"command": {"cla": "00", "ins": "A4", "p1": "00", "p2": "0C", "lc": "02", "data": "E103"},
+		"response": {"sw1": "90", "sw2": "00"}
+	},
+	{
+		"command": {"cla": "00", "ins": "B0", "p1": "00", "p2": "00", "le": "02"},
+		"response": {"data": "000F", "sw1": "90", "sw2": "00"}
+	}
+]`
+	var exchanges []apdu.Exchange
+	if err := json.Unmarshal([]byte(transcript), &exchanges); err != nil {
+		t.Fatal(err)
+	}
+	d, err := NewReplay(exchanges)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := d.TransceiveBytes(nil, 2)
+	if err != nil || !bytes.Equal(r, []byte{0x90, 0x00}) {
+		t.Error("unexpected first response:", r, err)
+	}
+	r, err = d.TransceiveBytes(nil, 4)
+	if err != nil || !bytes.Equal(r, []byte{0x00, 0x0F, 0x90, 0x00}) {
+		t.Error("unexpected second response:", r, err)
+	}
+
+	if _, err := NewReplay([]apdu.Exchange{{}}); err == nil {
+		t.Error("exchanges without response should fail")
+	}
+}
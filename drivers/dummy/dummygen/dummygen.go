@@ -0,0 +1,132 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+// Package dummygen generates transceive scripts for the dummy driver
+// by running Device operations against software tags.
+//
+// The exchanges between the Device and the tag are captured through
+// the swtag driver, so realistic test vectors for new features can
+// be produced automatically and stored as fixtures with
+// dummy.WriteScript:
+//
+//	tag := static.New()
+//	tag.SetMessage(ndef.NewTextMessage("hello", "en"))
+//	c, err := dummygen.Generate("read_text", tag, dummygen.Read)
+//	...
+//	err = dummy.WriteScript("testdata/read.yaml",
+//		&dummy.Script{Cases: []dummy.Case{*c}})
+package dummygen
+
+import (
+	"fmt"
+
+	"github.com/hsanjuan/go-ndef"
+	"github.com/hsanjuan/go-nfctype4"
+	"github.com/hsanjuan/go-nfctype4/apdu"
+	"github.com/hsanjuan/go-nfctype4/drivers/dummy"
+	"github.com/hsanjuan/go-nfctype4/drivers/swtag"
+	"github.com/hsanjuan/go-nfctype4/tags"
+)
+
+// Operation is performed on a Device whose exchanges are captured.
+type Operation func(device *nfctype4.Device) error
+
+// Read is an Operation which reads the NDEF Message from the tag.
+func Read(device *nfctype4.Device) error {
+	_, err := device.Read()
+	return err
+}
+
+// Format is an Operation which formats the tag.
+func Format(device *nfctype4.Device) error {
+	return device.Format()
+}
+
+// Update returns an Operation which writes the given message to the
+// tag.
+func Update(m *ndef.Message) Operation {
+	return func(device *nfctype4.Device) error {
+		return device.Update(m)
+	}
+}
+
+// Generate runs op on a Device which talks to the given tag and
+// returns a Case with the exchanges performed. Every Step carries the
+// bytes sent and received, and a comment describing the command.
+//
+// When op fails, its error is set as the expected error of the Case.
+// Generate itself only returns an error if the exchange with the tag
+// fails, since that cannot be represented in a script.
+func Generate(name string, tag tags.Tag, op Operation) (*dummy.Case, error) {
+	rec := &recorder{
+		driver: &swtag.Driver{Tag: tag},
+	}
+	c := &dummy.Case{
+		Name: name,
+	}
+	if err := op(nfctype4.New(rec)); err != nil {
+		if rec.err != nil {
+			return nil, fmt.Errorf("Generate: %s", rec.err)
+		}
+		c.Error = err.Error()
+	}
+	c.Steps = rec.steps
+	return c, nil
+}
+
+// recorder is a CommandDriver which wraps the swtag driver and keeps
+// the exchanges as Steps.
+type recorder struct {
+	driver *swtag.Driver
+	steps  []dummy.Step
+	err    error
+}
+
+func (rec *recorder) Initialize() error {
+	return rec.driver.Initialize()
+}
+
+func (rec *recorder) String() string {
+	return "dummygen recorder. Wrapping: " + rec.driver.String()
+}
+
+func (rec *recorder) TransceiveBytes(tx []byte, rxLen int) ([]byte, error) {
+	rx, err := rec.driver.TransceiveBytes(tx, rxLen)
+	if err != nil {
+		rec.err = err
+		return nil, err
+	}
+	rec.steps = append(rec.steps, dummy.Step{
+		Comment: describe(tx),
+		TX:      append([]byte{}, tx...),
+		RX:      append([]byte{}, rx...),
+	})
+	return rx, nil
+}
+
+func (rec *recorder) Close() {
+	rec.driver.Close()
+}
+
+// describe returns a human-readable description of a command.
+func describe(tx []byte) string {
+	capdu := &apdu.CAPDU{}
+	if _, err := capdu.Unmarshal(tx); err != nil {
+		return ""
+	}
+	return capdu.Dump()
+}
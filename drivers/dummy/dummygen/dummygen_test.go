@@ -0,0 +1,104 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package dummygen
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/hsanjuan/go-ndef"
+	"github.com/hsanjuan/go-nfctype4"
+	"github.com/hsanjuan/go-nfctype4/drivers/dummy"
+	"github.com/hsanjuan/go-nfctype4/tags/static"
+)
+
+func TestGenerate(t *testing.T) {
+	tag := static.New()
+	msg := ndef.NewTextMessage("Hey this is a test!", "en")
+	tag.SetMessage(msg)
+	c, err := Generate("read_text", tag, Read)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Name != "read_text" || c.Error != "" {
+		t.Fatal("unexpected case:", c.Name, c.Error)
+	}
+	if len(c.Steps) == 0 || c.Steps[0].Comment == "" {
+		t.Fatal("steps should be recorded with comments")
+	}
+
+	// Store it and replay it with a strict mock
+	path := filepath.Join(t.TempDir(), "script.yaml")
+	script := &dummy.Script{Cases: []dummy.Case{*c}}
+	if err := dummy.WriteScript(path, script); err != nil {
+		t.Fatal(err)
+	}
+	script, err = dummy.LoadScript(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mock := script.Case("read_text").Mock()
+	mock.Reporter = t
+	readMsg, err := nfctype4.New(mock).Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if readMsg.String() != msg.String() {
+		t.Error("unexpected message:", readMsg)
+	}
+	if err := mock.Verify(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGenerate_update(t *testing.T) {
+	msg := ndef.NewURIMessage("https://example.org")
+	c, err := Generate("update", static.New(), Update(msg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mock := c.Mock()
+	mock.Reporter = t
+	if err := nfctype4.New(mock).Update(msg); err != nil {
+		t.Fatal(err)
+	}
+	if err := mock.Verify(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGenerate_error(t *testing.T) {
+	tag := static.New()
+	tag.SetMessage(ndef.NewTextMessage("test", "en"))
+	c, err := Generate("format", tag, Format)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err = Generate("read_empty", tag, Read)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log(c.Error)
+	if c.Error == "" {
+		t.Error("the case should carry the error of the operation")
+	}
+	_, err = nfctype4.New(c.Driver()).Read()
+	if err == nil || err.Error() != c.Error {
+		t.Error("replay should fail with the same error:", err)
+	}
+}
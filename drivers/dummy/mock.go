@@ -0,0 +1,188 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package dummy
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/hsanjuan/go-nfctype4/apdu"
+)
+
+// Expectation describes a command expected by a Mock and the response
+// to return for it.
+type Expectation struct {
+	// TX are the exact bytes expected. They are ignored when Match
+	// is set.
+	TX []byte
+	// Match, when set, checks the parsed command instead of TX. It
+	// returns an error describing the mismatch.
+	Match func(capdu *apdu.CAPDU) error
+	RX    []byte // Response
+	Err   error  // Error returned instead of RX, when set
+}
+
+// Reporter is notified of the mismatches of a Mock. *testing.T
+// implements it.
+type Reporter interface {
+	Errorf(format string, args ...interface{})
+}
+
+// Mock implements a strict CommandDriver: every call to
+// TransceiveBytes must match the next Expectation, whose response is
+// returned. Unlike Driver, it fails on unexpected commands instead of
+// returning the next response regardless of what was sent.
+type Mock struct {
+	Expectations []Expectation
+	Pos          int // Next Expectation
+	// Reporter, when set, is notified of every mismatch, so that
+	// tests fail even when the errors returned by TransceiveBytes
+	// are handled by the caller.
+	Reporter Reporter
+
+	errs []error
+}
+
+// NewMock returns a Mock which expects the commands of the given
+// exchanges, in order, and returns their responses.
+//
+// It returns an error if any of the commands or responses cannot be
+// serialized.
+func NewMock(exchanges []apdu.Exchange) (*Mock, error) {
+	mock := &Mock{}
+	for i, e := range exchanges {
+		if e.Command == nil || e.Response == nil {
+			return nil, fmt.Errorf("NewMock: "+
+				"exchange %d is incomplete", i)
+		}
+		tx, err := e.Command.Marshal()
+		if err != nil {
+			return nil, err
+		}
+		rx, err := e.Response.Marshal()
+		if err != nil {
+			return nil, err
+		}
+		mock.Expect(tx, rx)
+	}
+	return mock, nil
+}
+
+// Expect adds an Expectation for the given bytes.
+func (mock *Mock) Expect(tx, rx []byte) *Mock {
+	mock.Expectations = append(mock.Expectations, Expectation{
+		TX: tx,
+		RX: rx,
+	})
+	return mock
+}
+
+// ExpectCommand adds an Expectation which checks the parsed command
+// with the given function.
+func (mock *Mock) ExpectCommand(match func(*apdu.CAPDU) error, rx []byte) *Mock {
+	mock.Expectations = append(mock.Expectations, Expectation{
+		Match: match,
+		RX:    rx,
+	})
+	return mock
+}
+
+// MatchHeader returns a function for Expectation.Match which checks
+// the CLA, INS, P1 and P2 bytes of the command.
+func MatchHeader(cla, ins, p1, p2 byte) func(*apdu.CAPDU) error {
+	return func(capdu *apdu.CAPDU) error {
+		got := []byte{capdu.CLA, capdu.INS, capdu.P1, capdu.P2}
+		want := []byte{cla, ins, p1, p2}
+		if !bytes.Equal(got, want) {
+			return fmt.Errorf("expected header % 02x but got % 02x",
+				want, got)
+		}
+		return nil
+	}
+}
+
+// Initialize does nothing because it is a Mock.
+func (mock *Mock) Initialize() error {
+	return nil
+}
+
+// String returns information about this driver.
+func (mock *Mock) String() string {
+	return fmt.Sprintf("Mock driver. Expectation %d of %d.",
+		mock.Pos, len(mock.Expectations))
+}
+
+// TransceiveBytes checks the bytes against the next Expectation and
+// returns its response.
+//
+// It returns an error if there are no more expectations, if the bytes
+// do not match or if the response is longer than rxLen. In that case,
+// the Expectation is not consumed.
+func (mock *Mock) TransceiveBytes(tx []byte, rxLen int) ([]byte, error) {
+	if mock.Pos >= len(mock.Expectations) {
+		return nil, mock.fail("unexpected command % 02x", tx)
+	}
+	e := mock.Expectations[mock.Pos]
+	if e.Match != nil {
+		capdu := &apdu.CAPDU{}
+		if _, err := capdu.Unmarshal(tx); err != nil {
+			return nil, mock.fail("expectation %d: bad command "+
+				"% 02x: %s", mock.Pos, tx, err)
+		}
+		if err := e.Match(capdu); err != nil {
+			return nil, mock.fail("expectation %d: %s",
+				mock.Pos, err)
+		}
+	} else if !bytes.Equal(tx, e.TX) {
+		return nil, mock.fail("expectation %d: expected % 02x "+
+			"but got % 02x", mock.Pos, e.TX, tx)
+	}
+	if e.Err == nil && len(e.RX) > rxLen {
+		return nil, mock.fail("expectation %d: the response is "+
+			"longer than %d bytes", mock.Pos, rxLen)
+	}
+	mock.Pos++
+	return e.RX, e.Err
+}
+
+// Close does nothing because this is a Mock.
+func (mock *Mock) Close() {
+}
+
+// Verify returns an error if any command did not match or if some
+// expectations were not used.
+func (mock *Mock) Verify() error {
+	if len(mock.errs) > 0 {
+		return mock.errs[0]
+	}
+	if mock.Pos < len(mock.Expectations) {
+		return fmt.Errorf("Mock.Verify: %d expectations not met",
+			len(mock.Expectations)-mock.Pos)
+	}
+	return nil
+}
+
+// fail records and reports a mismatch.
+func (mock *Mock) fail(format string, args ...interface{}) error {
+	err := fmt.Errorf("Mock.TransceiveBytes: "+format, args...)
+	mock.errs = append(mock.errs, err)
+	if mock.Reporter != nil {
+		mock.Reporter.Errorf("%s", err)
+	}
+	return err
+}
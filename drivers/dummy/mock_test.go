@@ -0,0 +1,148 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package dummy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/hsanjuan/go-ndef"
+	"github.com/hsanjuan/go-nfctype4"
+	"github.com/hsanjuan/go-nfctype4/apdu"
+)
+
+type recorder struct {
+	msgs []string
+}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.msgs = append(r.msgs, fmt.Sprintf(format, args...))
+}
+
+func TestMock(t *testing.T) {
+	rep := &recorder{}
+	mock := &Mock{Reporter: rep}
+	mock.Expect([]byte{0x00, 0xA4, 0x00, 0x0C, 0x02, 0xE1, 0x03},
+		[]byte{0x90, 0x00})
+	mock.ExpectCommand(MatchHeader(0x00, 0xB0, 0x00, 0x00),
+		[]byte{0x00, 0x0F, 0x90, 0x00})
+	mock.Expectations = append(mock.Expectations, Expectation{
+		TX:  []byte{0x00, 0xB0, 0x00, 0x02, 0x01},
+		Err: errors.New("tag lost"),
+	})
+	mock.Initialize()
+	defer mock.Close()
+
+	// Mismatch: the Expectation is not consumed
+	if _, err := mock.TransceiveBytes([]byte{0x00, 0xA4}, 2); err == nil {
+		t.Error("expected an error for a mismatch")
+	}
+	if len(rep.msgs) != 1 || !strings.Contains(rep.msgs[0], "expectation 0") {
+		t.Error("the mismatch should have been reported:", rep.msgs)
+	}
+	rx, err := mock.TransceiveBytes(
+		[]byte{0x00, 0xA4, 0x00, 0x0C, 0x02, 0xE1, 0x03}, 2)
+	if err != nil || !bytes.Equal(rx, []byte{0x90, 0x00}) {
+		t.Error("unexpected response:", rx, err)
+	}
+
+	if _, err := mock.TransceiveBytes([]byte{0x00, 0xB0, 0x00, 0x00, 0x02}, 1); err == nil {
+		t.Error("expected an error for a long response")
+	}
+	if _, err := mock.TransceiveBytes([]byte{0x00, 0xB0, 0x00, 0x01, 0x02}, 4); err == nil {
+		t.Error("expected an error for a header mismatch")
+	}
+	rx, err = mock.TransceiveBytes([]byte{0x00, 0xB0, 0x00, 0x00, 0x02}, 4)
+	if err != nil || !bytes.Equal(rx, []byte{0x00, 0x0F, 0x90, 0x00}) {
+		t.Error("unexpected response:", rx, err)
+	}
+
+	if err := mock.Verify(); err == nil {
+		t.Error("Verify should fail after mismatches")
+	}
+	if _, err := mock.TransceiveBytes([]byte{0x00, 0xB0, 0x00, 0x02, 0x01}, 3); err == nil ||
+		err.Error() != "tag lost" {
+		t.Error("expected the scripted error but got:", err)
+	}
+	if _, err := mock.TransceiveBytes([]byte{0x00}, 2); err == nil {
+		t.Error("expected an error for an unexpected command")
+	}
+	if len(rep.msgs) != 4 {
+		t.Error("expected 4 reported mismatches but got", len(rep.msgs))
+	}
+}
+
+func TestMock_Device(t *testing.T) {
+	msg := ndef.NewTextMessage("mock", "en")
+	ndefBytes, err := msg.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	nlen := []byte{0x00, byte(len(ndefBytes))}
+	ok := []byte{0x90, 0x00}
+	cc := []byte{0x00, 0x0F, 0x20, 0x00, 0x7F, 0x00, 0x7F,
+		0x04, 0x06, 0xE1, 0x04, 0x00, 0x7F, 0x00, 0x00}
+
+	mock := &Mock{Reporter: t}
+	mock.ExpectCommand(MatchHeader(0x00, 0xA4, 0x04, 0x00), ok)
+	mock.Expect([]byte{0x00, 0xA4, 0x00, 0x0C, 0x02, 0xE1, 0x03}, ok)
+	mock.ExpectCommand(MatchHeader(0x00, 0xB0, 0x00, 0x00),
+		append(cc, ok...))
+	mock.Expect([]byte{0x00, 0xA4, 0x00, 0x0C, 0x02, 0xE1, 0x04}, ok)
+	mock.ExpectCommand(MatchHeader(0x00, 0xB0, 0x00, 0x00),
+		append(nlen, ok...))
+	mock.ExpectCommand(MatchHeader(0x00, 0xB0, 0x00, 0x02),
+		append(ndefBytes, ok...))
+
+	readMsg, err := nfctype4.New(mock).Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if readMsg.String() != msg.String() {
+		t.Error("unexpected message:", readMsg)
+	}
+	if err := mock.Verify(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestNewMock(t *testing.T) {
+	exchanges := []apdu.Exchange{{
+		Command:  apdu.NewSelectAPDU(0xE103),
+		Response: &apdu.RAPDU{SW1: 0x90, SW2: 0x00},
+	}}
+	mock, err := NewMock(exchanges)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, _ := exchanges[0].Command.Marshal()
+	rx, err := mock.TransceiveBytes(tx, 2)
+	if err != nil || !bytes.Equal(rx, []byte{0x90, 0x00}) {
+		t.Error("unexpected response:", rx, err)
+	}
+	if err := mock.Verify(); err != nil {
+		t.Error(err)
+	}
+
+	if _, err := NewMock([]apdu.Exchange{{}}); err == nil {
+		t.Error("expected an error for an incomplete exchange")
+	}
+}
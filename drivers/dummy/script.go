@@ -0,0 +1,209 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package dummy
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hsanjuan/go-nfctype4/apdu"
+	"gopkg.in/yaml.v3"
+)
+
+// Hex is a byte slice which is serialized as an hexadecimal string.
+// Whitespace is ignored when parsing, so bytes can be grouped as in
+// "90 00".
+type Hex []byte
+
+// MarshalText encodes the bytes as space-separated hexadecimal pairs.
+func (h Hex) MarshalText() ([]byte, error) {
+	return []byte(fmt.Sprintf("% 02x", []byte(h))), nil
+}
+
+// UnmarshalText decodes an hexadecimal string.
+func (h *Hex) UnmarshalText(text []byte) error {
+	b, err := hex.DecodeString(strings.Join(strings.Fields(string(text)), ""))
+	if err != nil {
+		return fmt.Errorf("Hex.UnmarshalText: %s", err)
+	}
+	*h = b
+	return nil
+}
+
+// Step is a single exchange of a Case.
+type Step struct {
+	Comment string `json:"comment,omitempty" yaml:"comment,omitempty"`
+	// TX are the bytes expected by a Mock. When empty, any command
+	// is accepted.
+	TX Hex `json:"tx,omitempty" yaml:"tx,omitempty"`
+	RX Hex `json:"rx" yaml:"rx"`
+	// Repeat is the number of times that the exchange happens.
+	// Defaults to 1.
+	Repeat int `json:"repeat,omitempty" yaml:"repeat,omitempty"`
+}
+
+// Case is a named transceive script.
+type Case struct {
+	Name    string `json:"name" yaml:"name"`
+	Comment string `json:"comment,omitempty" yaml:"comment,omitempty"`
+	// Error is the error that the script is expected to cause,
+	// if any. It is not used by this package.
+	Error string `json:"error,omitempty" yaml:"error,omitempty"`
+	Steps []Step `json:"steps" yaml:"steps"`
+}
+
+// Script is a collection of cases, usually loaded from a file with
+// LoadScript.
+type Script struct {
+	Cases []Case `json:"cases" yaml:"cases"`
+}
+
+// LoadScript reads a Script from a JSON (.json) or YAML (.yaml, .yml)
+// file, for example:
+//
+//	cases:
+//	  - name: ndef_app_select
+//	    steps:
+//	      - comment: NDEF app select
+//	        tx: 00 a4 04 00 07 d2 76 00 00 85 01 01 00
+//	        rx: 90 00
+//
+// It returns an error if the file cannot be read or parsed, or if
+// the cases are not valid.
+func LoadScript(path string) (*Script, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	script := &Script{}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".json":
+		err = json.Unmarshal(data, script)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, script)
+	default:
+		return nil, fmt.Errorf("LoadScript: unknown extension %q", ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("LoadScript: %s: %s", path, err)
+	}
+	if err := script.check(); err != nil {
+		return nil, fmt.Errorf("LoadScript: %s: %s", path, err)
+	}
+	return script, nil
+}
+
+// WriteScript writes the Script to a JSON (.json) or YAML (.yaml,
+// .yml) file, so that it can be loaded with LoadScript.
+func WriteScript(path string, script *Script) error {
+	var data []byte
+	var err error
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".json":
+		data, err = json.MarshalIndent(script, "", "  ")
+		data = append(data, '\n')
+	case ".yaml", ".yml":
+		data, err = yaml.Marshal(script)
+	default:
+		return fmt.Errorf("WriteScript: unknown extension %q", ext)
+	}
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// check makes sure that names are unique and that repetitions are
+// valid.
+func (script *Script) check() error {
+	names := make(map[string]bool)
+	for _, c := range script.Cases {
+		if c.Name == "" {
+			return fmt.Errorf("case without name")
+		}
+		if names[c.Name] {
+			return fmt.Errorf("duplicate case %q", c.Name)
+		}
+		names[c.Name] = true
+		for i, s := range c.Steps {
+			if s.Repeat < 0 {
+				return fmt.Errorf("case %q: step %d: negative "+
+					"repeat", c.Name, i)
+			}
+		}
+	}
+	return nil
+}
+
+// Case returns the case with the given name, or nil.
+func (script *Script) Case(name string) *Case {
+	for i := range script.Cases {
+		if script.Cases[i].Name == name {
+			return &script.Cases[i]
+		}
+	}
+	return nil
+}
+
+// expand returns the steps of the case with the repetitions unrolled.
+func (c *Case) expand() []Step {
+	var steps []Step
+	for _, s := range c.Steps {
+		n := s.Repeat
+		if n == 0 {
+			n = 1
+		}
+		for i := 0; i < n; i++ {
+			steps = append(steps, s)
+		}
+	}
+	return steps
+}
+
+// Driver returns a Driver which returns the responses of the case,
+// regardless of what is sent.
+func (c *Case) Driver() *Driver {
+	driver := &Driver{}
+	for _, s := range c.expand() {
+		driver.ReceiveBytes = append(driver.ReceiveBytes, s.RX)
+	}
+	return driver
+}
+
+// Mock returns a Mock which expects the commands of the case. Steps
+// without TX accept any well-formed command.
+func (c *Case) Mock() *Mock {
+	mock := &Mock{}
+	for _, s := range c.expand() {
+		if len(s.TX) == 0 {
+			mock.ExpectCommand(matchAny, s.RX)
+			continue
+		}
+		mock.Expect(s.TX, s.RX)
+	}
+	return mock
+}
+
+// matchAny accepts any command.
+func matchAny(*apdu.CAPDU) error {
+	return nil
+}
@@ -0,0 +1,132 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package dummy
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var ndefAppSelect = []byte{0x00, 0xa4, 0x04, 0x00, 0x07, 0xd2, 0x76,
+	0x00, 0x00, 0x85, 0x01, 0x01, 0x00}
+
+func TestLoadScript(t *testing.T) {
+	script, err := LoadScript("testdata/script.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(script.Cases) != 2 {
+		t.Fatal("expected 2 cases")
+	}
+	c := script.Case("select")
+	if c == nil || c.Comment == "" {
+		t.Fatal("select case not loaded")
+	}
+	if script.Case("missing") != nil {
+		t.Error("missing case should be nil")
+	}
+
+	driver := c.Driver()
+	if len(driver.ReceiveBytes) != 3 {
+		t.Fatal("repeat should be unrolled")
+	}
+	if !bytes.Equal(driver.ReceiveBytes[2], []byte{0x90, 0x00}) {
+		t.Error("bad last response")
+	}
+
+	mock := c.Mock()
+	mock.Reporter = t
+	for i := 0; i < 3; i++ {
+		if _, err := mock.TransceiveBytes(ndefAppSelect, 2); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := mock.Verify(); err != nil {
+		t.Error(err)
+	}
+
+	mock = script.Case("any").Mock()
+	if _, err := mock.TransceiveBytes([]byte{0x00, 0xb0, 0x00, 0x00, 0x0f}, 2); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestLoadScript_yaml(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "script.yml")
+	data := []byte(`cases:
+  - name: read
+    error: "some error"
+    steps:
+      - comment: CC select
+        rx: 9000
+        repeat: 3
+`)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	script, err := LoadScript(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := script.Case("read")
+	if c == nil || c.Error != "some error" {
+		t.Fatal("read case not loaded")
+	}
+	if len(c.Driver().ReceiveBytes) != 3 {
+		t.Error("repeat should be unrolled")
+	}
+}
+
+func TestLoadScript_errors(t *testing.T) {
+	dir := t.TempDir()
+	scripts := map[string]string{
+		"ext.txt":        `cases: []`,
+		"hex.yaml":       "cases:\n  - name: a\n    steps:\n      - rx: 9g00\n",
+		"noname.yaml":    "cases:\n  - steps:\n      - rx: 9000\n",
+		"dup.json":       `{"cases": [{"name": "a"}, {"name": "a"}]}`,
+		"repeat.json":    `{"cases": [{"name": "a", "steps": [{"rx": "9000", "repeat": -1}]}]}`,
+		"malformed.json": `{"cases": `,
+	}
+	for name, content := range scripts {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadScript(path); err == nil {
+			t.Error(name, "should fail to load")
+		} else {
+			t.Log(name, err)
+		}
+	}
+	if _, err := LoadScript(filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("missing file should fail to load")
+	}
+}
+
+func TestHex_MarshalText(t *testing.T) {
+	text, err := Hex{0x90, 0x00}.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(text) != "90 00" {
+		t.Error("unexpected text:", string(text))
+	}
+}
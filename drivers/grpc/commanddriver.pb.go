@@ -0,0 +1,506 @@
+// Copyright (c) 2020, Hector Sanjuan
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// This file defines a gRPC service which exposes a nfctype4
+// CommandDriver, so that NFC readers (or software tags) attached to
+// one machine can be used from another one.
+//
+// It mirrors the protocol of the tcp driver: a client opens a Session
+// stream, which is bound to a single connection with the tag. The
+// first request must be an Initialize request. Then any number of
+// Transceive requests follow, and the session ends with a Close
+// request (or when the stream is closed). The server answers every
+// request with exactly one Response, in order.
+//
+// Servers are expected to serialize sessions, since a reader can only
+// talk to one tag at a time. Authentication is left to the transport:
+// servers should use TLS credentials and may require a bearer token
+// in the "authorization" metadata key of the Session call.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.33.0
+// 	protoc        (unknown)
+// source: commanddriver.proto
+
+package grpc
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// Request is sent by the client on a Session stream.
+type Request struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// Types that are assignable to Operation:
+	//	*Request_Initialize
+	//	*Request_Transceive
+	//	*Request_Close
+	Operation isRequest_Operation `protobuf_oneof:"operation"`
+}
+
+func (x *Request) Reset() {
+	*x = Request{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_commanddriver_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Request) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Request) ProtoMessage() {}
+
+func (x *Request) ProtoReflect() protoreflect.Message {
+	mi := &file_commanddriver_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Request.ProtoReflect.Descriptor instead.
+func (*Request) Descriptor() ([]byte, []int) {
+	return file_commanddriver_proto_rawDescGZIP(), []int{0}
+}
+
+func (m *Request) GetOperation() isRequest_Operation {
+	if m != nil {
+		return m.Operation
+	}
+	return nil
+}
+
+func (x *Request) GetInitialize() *Initialize {
+	if x, ok := x.GetOperation().(*Request_Initialize); ok {
+		return x.Initialize
+	}
+	return nil
+}
+
+func (x *Request) GetTransceive() *Transceive {
+	if x, ok := x.GetOperation().(*Request_Transceive); ok {
+		return x.Transceive
+	}
+	return nil
+}
+
+func (x *Request) GetClose() *Close {
+	if x, ok := x.GetOperation().(*Request_Close); ok {
+		return x.Close
+	}
+	return nil
+}
+
+type isRequest_Operation interface {
+	isRequest_Operation()
+}
+
+type Request_Initialize struct {
+	Initialize *Initialize `protobuf:"bytes,1,opt,name=initialize,proto3,oneof"`
+}
+
+type Request_Transceive struct {
+	Transceive *Transceive `protobuf:"bytes,2,opt,name=transceive,proto3,oneof"`
+}
+
+type Request_Close struct {
+	Close *Close `protobuf:"bytes,3,opt,name=close,proto3,oneof"`
+}
+
+func (*Request_Initialize) isRequest_Operation() {}
+
+func (*Request_Transceive) isRequest_Operation() {}
+
+func (*Request_Close) isRequest_Operation() {}
+
+// Initialize asks the server to initialize its driver, as
+// CommandDriver.Initialize() does.
+type Initialize struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+}
+
+func (x *Initialize) Reset() {
+	*x = Initialize{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_commanddriver_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Initialize) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Initialize) ProtoMessage() {}
+
+func (x *Initialize) ProtoReflect() protoreflect.Message {
+	mi := &file_commanddriver_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Initialize.ProtoReflect.Descriptor instead.
+func (*Initialize) Descriptor() ([]byte, []int) {
+	return file_commanddriver_proto_rawDescGZIP(), []int{1}
+}
+
+// Transceive asks the server to send bytes to the tag, as
+// CommandDriver.TransceiveBytes() does.
+type Transceive struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// The bytes to send to the tag (a marshaled Command APDU).
+	Tx []byte `protobuf:"bytes,1,opt,name=tx,proto3" json:"tx,omitempty"`
+	// The maximum number of bytes to receive.
+	RxLen uint32 `protobuf:"varint,2,opt,name=rx_len,json=rxLen,proto3" json:"rx_len,omitempty"`
+}
+
+func (x *Transceive) Reset() {
+	*x = Transceive{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_commanddriver_proto_msgTypes[2]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Transceive) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Transceive) ProtoMessage() {}
+
+func (x *Transceive) ProtoReflect() protoreflect.Message {
+	mi := &file_commanddriver_proto_msgTypes[2]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Transceive.ProtoReflect.Descriptor instead.
+func (*Transceive) Descriptor() ([]byte, []int) {
+	return file_commanddriver_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Transceive) GetTx() []byte {
+	if x != nil {
+		return x.Tx
+	}
+	return nil
+}
+
+func (x *Transceive) GetRxLen() uint32 {
+	if x != nil {
+		return x.RxLen
+	}
+	return 0
+}
+
+// Close asks the server to close its driver, as CommandDriver.Close()
+// does. The server ends the stream after answering it.
+type Close struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+}
+
+func (x *Close) Reset() {
+	*x = Close{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_commanddriver_proto_msgTypes[3]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Close) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Close) ProtoMessage() {}
+
+func (x *Close) ProtoReflect() protoreflect.Message {
+	mi := &file_commanddriver_proto_msgTypes[3]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Close.ProtoReflect.Descriptor instead.
+func (*Close) Descriptor() ([]byte, []int) {
+	return file_commanddriver_proto_rawDescGZIP(), []int{3}
+}
+
+// Response is sent by the server for every Request.
+type Response struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// The bytes received from the tag, for Transceive requests.
+	Rx []byte `protobuf:"bytes,1,opt,name=rx,proto3" json:"rx,omitempty"`
+	// The error message when the operation failed. Empty otherwise.
+	Error string `protobuf:"bytes,2,opt,name=error,proto3" json:"error,omitempty"`
+}
+
+func (x *Response) Reset() {
+	*x = Response{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_commanddriver_proto_msgTypes[4]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Response) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Response) ProtoMessage() {}
+
+func (x *Response) ProtoReflect() protoreflect.Message {
+	mi := &file_commanddriver_proto_msgTypes[4]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Response.ProtoReflect.Descriptor instead.
+func (*Response) Descriptor() ([]byte, []int) {
+	return file_commanddriver_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *Response) GetRx() []byte {
+	if x != nil {
+		return x.Rx
+	}
+	return nil
+}
+
+func (x *Response) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+var File_commanddriver_proto protoreflect.FileDescriptor
+
+var file_commanddriver_proto_rawDesc = []byte{
+	0x0a, 0x13, 0x63, 0x6f, 0x6d, 0x6d, 0x61, 0x6e, 0x64, 0x64, 0x72, 0x69, 0x76, 0x65, 0x72, 0x2e,
+	0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x0f, 0x6e, 0x66, 0x63, 0x74, 0x79, 0x70, 0x65, 0x34, 0x2e,
+	0x64, 0x72, 0x69, 0x76, 0x65, 0x72, 0x22, 0xc4, 0x01, 0x0a, 0x07, 0x52, 0x65, 0x71, 0x75, 0x65,
+	0x73, 0x74, 0x12, 0x3d, 0x0a, 0x0a, 0x69, 0x6e, 0x69, 0x74, 0x69, 0x61, 0x6c, 0x69, 0x7a, 0x65,
+	0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1b, 0x2e, 0x6e, 0x66, 0x63, 0x74, 0x79, 0x70, 0x65,
+	0x34, 0x2e, 0x64, 0x72, 0x69, 0x76, 0x65, 0x72, 0x2e, 0x49, 0x6e, 0x69, 0x74, 0x69, 0x61, 0x6c,
+	0x69, 0x7a, 0x65, 0x48, 0x00, 0x52, 0x0a, 0x69, 0x6e, 0x69, 0x74, 0x69, 0x61, 0x6c, 0x69, 0x7a,
+	0x65, 0x12, 0x3d, 0x0a, 0x0a, 0x74, 0x72, 0x61, 0x6e, 0x73, 0x63, 0x65, 0x69, 0x76, 0x65, 0x18,
+	0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1b, 0x2e, 0x6e, 0x66, 0x63, 0x74, 0x79, 0x70, 0x65, 0x34,
+	0x2e, 0x64, 0x72, 0x69, 0x76, 0x65, 0x72, 0x2e, 0x54, 0x72, 0x61, 0x6e, 0x73, 0x63, 0x65, 0x69,
+	0x76, 0x65, 0x48, 0x00, 0x52, 0x0a, 0x74, 0x72, 0x61, 0x6e, 0x73, 0x63, 0x65, 0x69, 0x76, 0x65,
+	0x12, 0x2e, 0x0a, 0x05, 0x63, 0x6c, 0x6f, 0x73, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0b, 0x32,
+	0x16, 0x2e, 0x6e, 0x66, 0x63, 0x74, 0x79, 0x70, 0x65, 0x34, 0x2e, 0x64, 0x72, 0x69, 0x76, 0x65,
+	0x72, 0x2e, 0x43, 0x6c, 0x6f, 0x73, 0x65, 0x48, 0x00, 0x52, 0x05, 0x63, 0x6c, 0x6f, 0x73, 0x65,
+	0x42, 0x0b, 0x0a, 0x09, 0x6f, 0x70, 0x65, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x22, 0x0c, 0x0a,
+	0x0a, 0x49, 0x6e, 0x69, 0x74, 0x69, 0x61, 0x6c, 0x69, 0x7a, 0x65, 0x22, 0x33, 0x0a, 0x0a, 0x54,
+	0x72, 0x61, 0x6e, 0x73, 0x63, 0x65, 0x69, 0x76, 0x65, 0x12, 0x0e, 0x0a, 0x02, 0x74, 0x78, 0x18,
+	0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x02, 0x74, 0x78, 0x12, 0x15, 0x0a, 0x06, 0x72, 0x78, 0x5f,
+	0x6c, 0x65, 0x6e, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x05, 0x72, 0x78, 0x4c, 0x65, 0x6e,
+	0x22, 0x07, 0x0a, 0x05, 0x43, 0x6c, 0x6f, 0x73, 0x65, 0x22, 0x30, 0x0a, 0x08, 0x52, 0x65, 0x73,
+	0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x0e, 0x0a, 0x02, 0x72, 0x78, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x0c, 0x52, 0x02, 0x72, 0x78, 0x12, 0x14, 0x0a, 0x05, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x18, 0x02,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x32, 0x53, 0x0a, 0x0d, 0x43,
+	0x6f, 0x6d, 0x6d, 0x61, 0x6e, 0x64, 0x44, 0x72, 0x69, 0x76, 0x65, 0x72, 0x12, 0x42, 0x0a, 0x07,
+	0x53, 0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x12, 0x18, 0x2e, 0x6e, 0x66, 0x63, 0x74, 0x79, 0x70,
+	0x65, 0x34, 0x2e, 0x64, 0x72, 0x69, 0x76, 0x65, 0x72, 0x2e, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73,
+	0x74, 0x1a, 0x19, 0x2e, 0x6e, 0x66, 0x63, 0x74, 0x79, 0x70, 0x65, 0x34, 0x2e, 0x64, 0x72, 0x69,
+	0x76, 0x65, 0x72, 0x2e, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x28, 0x01, 0x30, 0x01,
+	0x42, 0x2e, 0x5a, 0x2c, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x68,
+	0x73, 0x61, 0x6e, 0x6a, 0x75, 0x61, 0x6e, 0x2f, 0x67, 0x6f, 0x2d, 0x6e, 0x66, 0x63, 0x74, 0x79,
+	0x70, 0x65, 0x34, 0x2f, 0x64, 0x72, 0x69, 0x76, 0x65, 0x72, 0x73, 0x2f, 0x67, 0x72, 0x70, 0x63,
+	0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_commanddriver_proto_rawDescOnce sync.Once
+	file_commanddriver_proto_rawDescData = file_commanddriver_proto_rawDesc
+)
+
+func file_commanddriver_proto_rawDescGZIP() []byte {
+	file_commanddriver_proto_rawDescOnce.Do(func() {
+		file_commanddriver_proto_rawDescData = protoimpl.X.CompressGZIP(file_commanddriver_proto_rawDescData)
+	})
+	return file_commanddriver_proto_rawDescData
+}
+
+var file_commanddriver_proto_msgTypes = make([]protoimpl.MessageInfo, 5)
+var file_commanddriver_proto_goTypes = []interface{}{
+	(*Request)(nil),    // 0: nfctype4.driver.Request
+	(*Initialize)(nil), // 1: nfctype4.driver.Initialize
+	(*Transceive)(nil), // 2: nfctype4.driver.Transceive
+	(*Close)(nil),      // 3: nfctype4.driver.Close
+	(*Response)(nil),   // 4: nfctype4.driver.Response
+}
+var file_commanddriver_proto_depIdxs = []int32{
+	1, // 0: nfctype4.driver.Request.initialize:type_name -> nfctype4.driver.Initialize
+	2, // 1: nfctype4.driver.Request.transceive:type_name -> nfctype4.driver.Transceive
+	3, // 2: nfctype4.driver.Request.close:type_name -> nfctype4.driver.Close
+	0, // 3: nfctype4.driver.CommandDriver.Session:input_type -> nfctype4.driver.Request
+	4, // 4: nfctype4.driver.CommandDriver.Session:output_type -> nfctype4.driver.Response
+	4, // [4:5] is the sub-list for method output_type
+	3, // [3:4] is the sub-list for method input_type
+	3, // [3:3] is the sub-list for extension type_name
+	3, // [3:3] is the sub-list for extension extendee
+	0, // [0:3] is the sub-list for field type_name
+}
+
+func init() { file_commanddriver_proto_init() }
+func file_commanddriver_proto_init() {
+	if File_commanddriver_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_commanddriver_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Request); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_commanddriver_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Initialize); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_commanddriver_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Transceive); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_commanddriver_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Close); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_commanddriver_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Response); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	file_commanddriver_proto_msgTypes[0].OneofWrappers = []interface{}{
+		(*Request_Initialize)(nil),
+		(*Request_Transceive)(nil),
+		(*Request_Close)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_commanddriver_proto_rawDesc,
+			NumEnums:      0,
+			NumMessages:   5,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_commanddriver_proto_goTypes,
+		DependencyIndexes: file_commanddriver_proto_depIdxs,
+		MessageInfos:      file_commanddriver_proto_msgTypes,
+	}.Build()
+	File_commanddriver_proto = out.File
+	file_commanddriver_proto_rawDesc = nil
+	file_commanddriver_proto_goTypes = nil
+	file_commanddriver_proto_depIdxs = nil
+}
@@ -0,0 +1,174 @@
+// Copyright (c) 2020, Hector Sanjuan
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// This file defines a gRPC service which exposes a nfctype4
+// CommandDriver, so that NFC readers (or software tags) attached to
+// one machine can be used from another one.
+//
+// It mirrors the protocol of the tcp driver: a client opens a Session
+// stream, which is bound to a single connection with the tag. The
+// first request must be an Initialize request. Then any number of
+// Transceive requests follow, and the session ends with a Close
+// request (or when the stream is closed). The server answers every
+// request with exactly one Response, in order.
+//
+// Servers are expected to serialize sessions, since a reader can only
+// talk to one tag at a time. Authentication is left to the transport:
+// servers should use TLS credentials and may require a bearer token
+// in the "authorization" metadata key of the Session call.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: commanddriver.proto
+
+package grpc
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	CommandDriver_Session_FullMethodName = "/nfctype4.driver.CommandDriver/Session"
+)
+
+// CommandDriverClient is the client API for CommandDriver service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type CommandDriverClient interface {
+	// Session opens a connection with the tag on the remote driver.
+	Session(ctx context.Context, opts ...grpc.CallOption) (CommandDriver_SessionClient, error)
+}
+
+type commandDriverClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewCommandDriverClient(cc grpc.ClientConnInterface) CommandDriverClient {
+	return &commandDriverClient{cc}
+}
+
+func (c *commandDriverClient) Session(ctx context.Context, opts ...grpc.CallOption) (CommandDriver_SessionClient, error) {
+	stream, err := c.cc.NewStream(ctx, &CommandDriver_ServiceDesc.Streams[0], CommandDriver_Session_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &commandDriverSessionClient{stream}
+	return x, nil
+}
+
+type CommandDriver_SessionClient interface {
+	Send(*Request) error
+	Recv() (*Response, error)
+	grpc.ClientStream
+}
+
+type commandDriverSessionClient struct {
+	grpc.ClientStream
+}
+
+func (x *commandDriverSessionClient) Send(m *Request) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *commandDriverSessionClient) Recv() (*Response, error) {
+	m := new(Response)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// CommandDriverServer is the server API for CommandDriver service.
+// All implementations must embed UnimplementedCommandDriverServer
+// for forward compatibility
+type CommandDriverServer interface {
+	// Session opens a connection with the tag on the remote driver.
+	Session(CommandDriver_SessionServer) error
+	mustEmbedUnimplementedCommandDriverServer()
+}
+
+// UnimplementedCommandDriverServer must be embedded to have forward compatible implementations.
+type UnimplementedCommandDriverServer struct {
+}
+
+func (UnimplementedCommandDriverServer) Session(CommandDriver_SessionServer) error {
+	return status.Errorf(codes.Unimplemented, "method Session not implemented")
+}
+func (UnimplementedCommandDriverServer) mustEmbedUnimplementedCommandDriverServer() {}
+
+// UnsafeCommandDriverServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to CommandDriverServer will
+// result in compilation errors.
+type UnsafeCommandDriverServer interface {
+	mustEmbedUnimplementedCommandDriverServer()
+}
+
+func RegisterCommandDriverServer(s grpc.ServiceRegistrar, srv CommandDriverServer) {
+	s.RegisterService(&CommandDriver_ServiceDesc, srv)
+}
+
+func _CommandDriver_Session_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(CommandDriverServer).Session(&commandDriverSessionServer{stream})
+}
+
+type CommandDriver_SessionServer interface {
+	Send(*Response) error
+	Recv() (*Request, error)
+	grpc.ServerStream
+}
+
+type commandDriverSessionServer struct {
+	grpc.ServerStream
+}
+
+func (x *commandDriverSessionServer) Send(m *Response) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *commandDriverSessionServer) Recv() (*Request, error) {
+	m := new(Request)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// CommandDriver_ServiceDesc is the grpc.ServiceDesc for CommandDriver service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var CommandDriver_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "nfctype4.driver.CommandDriver",
+	HandlerType: (*CommandDriverServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Session",
+			Handler:       _CommandDriver_Session_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "commanddriver.proto",
+}
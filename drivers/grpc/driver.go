@@ -0,0 +1,182 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+// Package grpc provides a CommandDriver implementation which forwards
+// the communication with a tag to a remote Server using gRPC, along
+// with the Server, which wraps any local CommandDriver. This allows
+// to share NFC readers (or software tags) across machines.
+//
+// The service is defined in commanddriver.proto. The connection can be
+// secured with TLS credentials, and the Server can require a bearer
+// token from the clients.
+package grpc
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative commanddriver.proto
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+)
+
+// DefaultTimeout is the timeout used by the Driver when none is set.
+const DefaultTimeout = 10 * time.Second
+
+// authorizationKey is the metadata key carrying the bearer token.
+const authorizationKey = "authorization"
+
+// Driver implements the CommandDriver interface forwarding the bytes
+// to a Server, which sends them to the tag using its own driver. Every
+// Initialize opens a new Session with the Server, which lasts until
+// Close.
+type Driver struct {
+	Address string        // Address of the Server, i.e. "host:4444"
+	Timeout time.Duration // Timeout for every operation
+	// Credentials are used to secure the connection with the
+	// Server, i.e. credentials.NewTLS(). When nil, the connection
+	// is not encrypted.
+	Credentials credentials.TransportCredentials
+	// Token, when set, is sent to the Server as a bearer token.
+	Token string
+	// Conn, when set, is used to talk to the Server instead of
+	// dialing Address. It is not closed by Close.
+	Conn grpc.ClientConnInterface
+
+	conn   *grpc.ClientConn
+	stream CommandDriver_SessionClient
+	cancel context.CancelFunc
+}
+
+// Initialize opens a Session with the Server and waits for it to
+// initialize its driver.
+//
+// It returns an error if the connection fails or if the remote driver
+// cannot be initialized.
+func (driver *Driver) Initialize() error {
+	cc := driver.Conn
+	if cc == nil {
+		creds := driver.Credentials
+		if creds == nil {
+			creds = insecure.NewCredentials()
+		}
+		conn, err := grpc.NewClient(driver.Address,
+			grpc.WithTransportCredentials(creds))
+		if err != nil {
+			return err
+		}
+		driver.conn = conn
+		cc = conn
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if driver.Token != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx,
+			authorizationKey, "Bearer "+driver.Token)
+	}
+	driver.cancel = cancel
+	stream, err := NewCommandDriverClient(cc).Session(ctx)
+	if err != nil {
+		driver.Close()
+		return err
+	}
+	driver.stream = stream
+
+	req := &Request{Operation: &Request_Initialize{&Initialize{}}}
+	if _, err := driver.roundTrip(req); err != nil {
+		driver.Close()
+		return err
+	}
+	return nil
+}
+
+// String returns information about this driver.
+func (driver *Driver) String() string {
+	str := fmt.Sprintf("gRPC Driver. Server: %s. ", driver.Address)
+	if driver.stream == nil {
+		str += "Not connected."
+	} else {
+		str += "Connected."
+	}
+	return str
+}
+
+// TransceiveBytes sends the bytes to the Server and returns the bytes
+// received by it from the tag.
+//
+// It returns an error if the Driver is not connected, if the
+// communication with the Server fails or if the remote driver returns
+// an error.
+func (driver *Driver) TransceiveBytes(tx []byte, rxLen int) ([]byte, error) {
+	if driver.stream == nil {
+		return nil, errors.New("Driver.TransceiveBytes: " +
+			"Driver not initialized")
+	}
+	req := &Request{Operation: &Request_Transceive{&Transceive{
+		Tx:    tx,
+		RxLen: uint32(rxLen),
+	}}}
+	return driver.roundTrip(req)
+}
+
+// Close ends the Session, which closes the remote driver, and the
+// connection with the Server. Conn is left open, as it belongs to the
+// caller.
+func (driver *Driver) Close() {
+	if driver.stream != nil {
+		req := &Request{Operation: &Request_Close{&Close{}}}
+		driver.roundTrip(req)
+		driver.stream.CloseSend()
+		driver.stream = nil
+	}
+	if driver.cancel != nil {
+		driver.cancel()
+		driver.cancel = nil
+	}
+	if driver.conn != nil {
+		driver.conn.Close()
+		driver.conn = nil
+	}
+}
+
+// roundTrip sends a request and waits for the response. The Session is
+// cancelled if the response does not arrive before the Timeout.
+func (driver *Driver) roundTrip(req *Request) ([]byte, error) {
+	timeout := driver.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	timer := time.AfterFunc(timeout, driver.cancel)
+	defer timer.Stop()
+
+	if err := driver.stream.Send(req); err != nil {
+		return nil, err
+	}
+	resp, err := driver.stream.Recv()
+	if err != nil {
+		return nil, err
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("remote: %s", resp.Error)
+	}
+	return resp.Rx, nil
+}
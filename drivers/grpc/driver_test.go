@@ -0,0 +1,194 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package grpc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hsanjuan/go-ndef"
+	"github.com/hsanjuan/go-nfctype4"
+	"github.com/hsanjuan/go-nfctype4/drivers/swtag"
+	"github.com/hsanjuan/go-nfctype4/tags/static"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+type failingDriver struct {
+	swtag.Driver
+}
+
+func (driver *failingDriver) Initialize() error {
+	return errors.New("no reader")
+}
+
+// bufConn serves srv on an in-memory listener and returns a client
+// connection to it.
+func bufConn(t *testing.T, srv *Server) *grpc.ClientConn {
+	l := bufconn.Listen(1 << 20)
+	t.Cleanup(func() { l.Close() })
+	go srv.Serve(l)
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return l.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestDriver(t *testing.T) {
+	tag := static.New()
+	conn := bufConn(t, NewTagServer(tag))
+	device := nfctype4.New(&Driver{Conn: conn})
+
+	msg := ndef.NewTextMessage(strings.Repeat("remote ", 50), "en")
+	if err := device.Update(msg); err != nil {
+		t.Fatal(err)
+	}
+	if tag.GetMessage().String() != msg.String() {
+		t.Error("the message did not reach the tag")
+	}
+	readMsg, err := device.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if readMsg.String() != msg.String() {
+		t.Error("unexpected message:", readMsg)
+	}
+}
+
+func TestDriver_errors(t *testing.T) {
+	driver := &Driver{}
+	if _, err := driver.TransceiveBytes([]byte{0x00}, 2); err == nil {
+		t.Error("TransceiveBytes should fail before Initialize")
+	}
+
+	driver = &Driver{Conn: bufConn(t, NewServer(&failingDriver{}))}
+	err := driver.Initialize()
+	if err == nil || err.Error() != "remote: no reader" {
+		t.Error("expected the remote error but got:", err)
+	}
+
+	// Errors from the remote driver are forwarded
+	driver = &Driver{Conn: bufConn(t, NewServer(&swtag.Driver{}))}
+	if err := driver.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	defer driver.Close()
+	_, err = driver.TransceiveBytes([]byte{0x00, 0xA4, 0x00, 0x0C}, 2)
+	if err == nil || !strings.HasPrefix(err.Error(), "remote: ") {
+		t.Error("expected a remote error but got:", err)
+	}
+}
+
+func TestDriver_Token(t *testing.T) {
+	srv := NewTagServer(static.New())
+	srv.Token = "secret"
+	conn := bufConn(t, srv)
+
+	for _, token := range []string{"", "wrong"} {
+		driver := &Driver{Conn: conn, Token: token}
+		if err := driver.Initialize(); err == nil {
+			driver.Close()
+			t.Errorf("token %q should be rejected", token)
+		}
+	}
+
+	device := nfctype4.New(&Driver{Conn: conn, Token: "secret"})
+	if err := device.Update(ndef.NewTextMessage("authorized", "en")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testTLSConfig(t *testing.T) (*tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template,
+		key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, pool
+}
+
+func TestDriver_TLS(t *testing.T) {
+	cert, pool := testTLSConfig(t)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	tag := static.New()
+	srv := NewTagServer(tag)
+	srv.Token = "secret"
+	go srv.Serve(l, grpc.Creds(credentials.NewServerTLSFromCert(cert)))
+
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+	device := nfctype4.New(&Driver{
+		Address: "localhost:" + port,
+		Credentials: credentials.NewTLS(&tls.Config{
+			RootCAs: pool,
+		}),
+		Token: "secret",
+	})
+	msg := ndef.NewTextMessage("encrypted", "en")
+	if err := device.Update(msg); err != nil {
+		t.Fatal(err)
+	}
+	if tag.GetMessage().String() != msg.String() {
+		t.Error("the message did not reach the tag")
+	}
+
+	// Without TLS, the server cannot be reached
+	driver := &Driver{Address: "localhost:" + port, Token: "secret",
+		Timeout: time.Second}
+	if err := driver.Initialize(); err == nil {
+		driver.Close()
+		t.Error("a plaintext connection should fail")
+	}
+}
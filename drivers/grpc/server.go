@@ -0,0 +1,169 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package grpc
+
+import (
+	"crypto/subtle"
+	"errors"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/hsanjuan/go-nfctype4"
+	"github.com/hsanjuan/go-nfctype4/drivers/swtag"
+	"github.com/hsanjuan/go-nfctype4/tags"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Server implements the CommandDriver gRPC service, bridging the
+// Sessions opened by Drivers to a local CommandDriver.
+//
+// The local driver is initialized for every Session and closed when
+// it ends. Sessions are served one at a time: while a client is
+// connected, the rest wait for their turn.
+type Server struct {
+	UnimplementedCommandDriverServer
+
+	Driver nfctype4.CommandDriver
+	// Token, when set, must be sent by the clients as a bearer
+	// token. Sessions without it are rejected. Use it along with
+	// TLS credentials, since the token travels in the clear
+	// otherwise.
+	Token string
+
+	mux sync.Mutex
+}
+
+// NewServer returns a new *Server which bridges the Sessions to the
+// given driver.
+func NewServer(driver nfctype4.CommandDriver) *Server {
+	return &Server{
+		Driver: driver,
+	}
+}
+
+// NewTagServer returns a new *Server which bridges the Sessions to the
+// given software Tag.
+func NewTagServer(tag tags.Tag) *Server {
+	return NewServer(&swtag.Driver{Tag: tag})
+}
+
+// ListenAndServe listens on the given TCP address and serves the
+// CommandDriver service. The options are passed to grpc.NewServer,
+// i.e. grpc.Creds() to use TLS.
+func (srv *Server) ListenAndServe(address string, opts ...grpc.ServerOption) error {
+	l, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+	return srv.Serve(l, opts...)
+}
+
+// Serve serves the CommandDriver service on the Listener with a new
+// gRPC server. It returns when the Listener fails, for example,
+// because it has been closed.
+func (srv *Server) Serve(l net.Listener, opts ...grpc.ServerOption) error {
+	s := grpc.NewServer(opts...)
+	RegisterCommandDriverServer(s, srv)
+	return s.Serve(l)
+}
+
+// Session serves a Session until the client closes it. The first
+// request must be an Initialize request.
+func (srv *Server) Session(stream CommandDriver_SessionServer) error {
+	if err := srv.authorize(stream); err != nil {
+		return err
+	}
+
+	srv.mux.Lock()
+	defer srv.mux.Unlock()
+
+	req, err := stream.Recv()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if req.GetInitialize() == nil {
+		return status.Error(codes.FailedPrecondition,
+			"the Session must start with an Initialize request")
+	}
+	if srv.Driver == nil {
+		err := errors.New("Server.Session: Driver not set")
+		stream.Send(&Response{Error: err.Error()})
+		return err
+	}
+	if err := srv.Driver.Initialize(); err != nil {
+		stream.Send(&Response{Error: err.Error()})
+		return nil
+	}
+	defer srv.Driver.Close()
+	if err := stream.Send(&Response{}); err != nil {
+		return err
+	}
+
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch op := req.Operation.(type) {
+		case *Request_Transceive:
+			resp := new(Response)
+			rx, err := srv.Driver.TransceiveBytes(op.Transceive.Tx,
+				int(op.Transceive.RxLen))
+			if err != nil {
+				resp.Error = err.Error()
+			} else {
+				resp.Rx = rx
+			}
+			if err := stream.Send(resp); err != nil {
+				return err
+			}
+		case *Request_Close:
+			return stream.Send(&Response{})
+		default:
+			return status.Error(codes.FailedPrecondition,
+				"unexpected request in an initialized Session")
+		}
+	}
+}
+
+// authorize checks the bearer token of the Session, when the Server
+// requires one.
+func (srv *Server) authorize(stream grpc.ServerStream) error {
+	if srv.Token == "" {
+		return nil
+	}
+	md, _ := metadata.FromIncomingContext(stream.Context())
+	want := []byte("Bearer " + srv.Token)
+	for _, v := range md.Get(authorizationKey) {
+		if subtle.ConstantTimeCompare([]byte(v), want) == 1 {
+			return nil
+		}
+	}
+	return status.Error(codes.Unauthenticated, "invalid token")
+}
@@ -0,0 +1,145 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package pn532
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Frame identifiers (TFI) indicating the direction of a frame.
+const (
+	HostToPN532 = byte(0xD4)
+	PN532ToHost = byte(0xD5)
+)
+
+// PN532 commands used by the drivers.
+const (
+	CmdGetFirmwareVersion  = byte(0x02)
+	CmdSAMConfiguration    = byte(0x14)
+	CmdInDataExchange      = byte(0x40)
+	CmdInListPassiveTarget = byte(0x4A)
+)
+
+// MaxFrameData is the largest amount of data (TFI included) that
+// an extended information frame can carry.
+const MaxFrameData = 265
+
+// MaxFrameLen is the length of the largest frame: an extended frame
+// carrying MaxFrameData bytes.
+const MaxFrameLen = 8 + MaxFrameData + 2
+
+// AckFrame is sent by the PN532 to acknowledge a command frame.
+var AckFrame = []byte{0x00, 0x00, 0xFF, 0x00, 0xFF, 0x00}
+
+// MarshalFrame builds a normal or extended information frame
+// (depending on the length) with the given data, which includes the
+// TFI byte.
+func MarshalFrame(data []byte) []byte {
+	var buffer bytes.Buffer
+	buffer.Write([]byte{0x00, 0x00, 0xFF}) // Preamble and start code
+	if n := len(data); n < 0xFF {
+		buffer.WriteByte(byte(n))
+		buffer.WriteByte(byte(-n))
+	} else { // Extended frame
+		buffer.Write([]byte{0xFF, 0xFF, byte(n >> 8), byte(n)})
+		buffer.WriteByte(-(byte(n>>8) + byte(n)))
+	}
+	buffer.Write(data)
+	var dcs byte
+	for _, b := range data {
+		dcs -= b
+	}
+	buffer.WriteByte(dcs)
+	buffer.WriteByte(0x00) // Postamble
+	return buffer.Bytes()
+}
+
+// ReadFrame reads a frame from the given reader, skipping anything
+// before the start code. It returns the data of the frame (TFI
+// included), or nil and ack = true when the frame is an ACK frame.
+func ReadFrame(r io.Reader) (data []byte, ack bool, err error) {
+	b := make([]byte, 1)
+	// Look for the start code 00FFh
+	var prev byte = 0xFF
+	for {
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, false, err
+		}
+		if prev == 0x00 && b[0] == 0xFF {
+			break
+		}
+		prev = b[0]
+	}
+
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, false, err
+	}
+	var n int
+	switch {
+	case header[0] == 0x00 && header[1] == 0xFF:
+		_, err := io.ReadFull(r, b) // Postamble
+		return nil, true, err
+	case header[0] == 0xFF && header[1] == 0xFF: // Extended frame
+		ext := make([]byte, 3)
+		if _, err := io.ReadFull(r, ext); err != nil {
+			return nil, false, err
+		}
+		if ext[0]+ext[1]+ext[2] != 0 {
+			return nil, false, errors.New("ReadFrame: " +
+				"bad length checksum")
+		}
+		n = int(ext[0])<<8 | int(ext[1])
+	default:
+		if header[0]+header[1] != 0 {
+			return nil, false, errors.New("ReadFrame: " +
+				"bad length checksum")
+		}
+		n = int(header[0])
+	}
+
+	// Data, DCS and postamble
+	data = make([]byte, n+2)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, false, err
+	}
+	var sum byte
+	for _, b := range data[:n+1] {
+		sum += b
+	}
+	if sum != 0 {
+		return nil, false, errors.New("ReadFrame: bad data checksum")
+	}
+	return data[:n], false, nil
+}
+
+// ParseResponse checks that the data of a frame is the response to
+// the given command and returns its parameters.
+func ParseResponse(cmd byte, data []byte) ([]byte, error) {
+	if len(data) == 1 && data[0] == 0x7F {
+		return nil, errors.New("PN532: syntax error frame received")
+	}
+	if len(data) < 2 || data[0] != PN532ToHost || data[1] != cmd+1 {
+		return nil, fmt.Errorf("PN532: unexpected response to "+
+			"command %02xh", cmd)
+	}
+	return data[2:], nil
+}
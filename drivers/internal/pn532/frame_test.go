@@ -0,0 +1,58 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package pn532
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestMarshalReadFrame(t *testing.T) {
+	for _, n := range []int{1, 254, 255, MaxFrameData} {
+		data := bytes.Repeat([]byte{0xAB}, n)
+		frame := MarshalFrame(data)
+		if len(frame) > MaxFrameLen {
+			t.Errorf("frame with %d bytes is too long", n)
+		}
+		read, ack, err := ReadFrame(bytes.NewReader(
+			append([]byte{0x55, 0x00}, frame...)))
+		if err != nil || ack || !bytes.Equal(read, data) {
+			t.Errorf("frame with %d bytes not parsed: %s", n, err)
+		}
+		frame[len(frame)-2]++ // DCS
+		if _, _, err := ReadFrame(bytes.NewReader(frame)); err == nil {
+			t.Error("a bad checksum should be detected")
+		}
+	}
+	if _, ack, err := ReadFrame(bytes.NewReader(AckFrame)); !ack || err != nil {
+		t.Error("ACK frame not detected")
+	}
+}
+
+func TestParseResponse(t *testing.T) {
+	params, err := ParseResponse(CmdSAMConfiguration, []byte{PN532ToHost, 0x15, 0x01})
+	if err != nil || !bytes.Equal(params, []byte{0x01}) {
+		t.Error("response not parsed:", err)
+	}
+	if _, err := ParseResponse(CmdSAMConfiguration, []byte{0x7F}); err == nil {
+		t.Error("syntax error frames should fail")
+	}
+	if _, err := ParseResponse(CmdInDataExchange, []byte{PN532ToHost, 0x15}); err == nil {
+		t.Error("responses to other commands should fail")
+	}
+}
@@ -0,0 +1,207 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+// Package pn532 implements the host protocol of the NXP PN532 NFC
+// controller, which is shared by the drivers using different links
+// (UART, I2C) to talk to it.
+package pn532
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Common errors
+var (
+	ErrNoTargetsDetected = errors.New("no targets detected")
+	ErrNotISO14443_4     = errors.New("the target does not support ISO/IEC 14443-4")
+)
+
+// DefaultMaxExchangeData is the maximum amount of data sent with a
+// single InDataExchange command. Longer APDUs are chained.
+const DefaultMaxExchangeData = 262
+
+// Conn is a link with a PN532.
+type Conn interface {
+	// Write sends a frame to the PN532.
+	Write(frame []byte) (int, error)
+	// NextFrame returns a Reader from which the next frame sent by
+	// the PN532 can be read.
+	NextFrame() (io.Reader, error)
+}
+
+// PN532 talks to a PN532 acting as initiator through a Conn.
+type PN532 struct {
+	conn     Conn
+	Firmware []byte // IC, Ver, Rev and Support
+	UID      []byte // UID of the selected target
+	// MaxExchangeData limits the data sent with every
+	// InDataExchange command, for links which cannot carry full
+	// frames. Defaults to DefaultMaxExchangeData.
+	MaxExchangeData int
+	target          byte
+}
+
+// New returns a new PN532 using the given Conn.
+func New(conn Conn) *PN532 {
+	return &PN532{
+		conn: conn,
+	}
+}
+
+// Setup obtains the firmware version, configures the SAM and selects
+// the first ISO/IEC 14443-4 Type A target in the field (or fails).
+func (p *PN532) Setup() error {
+	firmware, err := p.Command(CmdGetFirmwareVersion, nil)
+	if err != nil {
+		return err
+	}
+	p.Firmware = firmware
+
+	// Normal mode, 1 second timeout, use the IRQ pin
+	if _, err := p.Command(CmdSAMConfiguration,
+		[]byte{0x01, 0x14, 0x01}); err != nil {
+		return err
+	}
+
+	// One target, 106 kbps Type A
+	resp, err := p.Command(CmdInListPassiveTarget, []byte{0x01, 0x00})
+	if err != nil {
+		return err
+	}
+	if len(resp) < 1 || resp[0] == 0 {
+		return ErrNoTargetsDetected
+	}
+	// NbTg, Tg, SENS_RES (2), SEL_RES, NFCIDLength, NFCID...
+	if len(resp) < 6 || len(resp) < 6+int(resp[5]) {
+		return errors.New("PN532.Setup: " +
+			"malformed InListPassiveTarget response")
+	}
+	if resp[4]&0x20 == 0 {
+		return ErrNotISO14443_4
+	}
+	p.target = resp[1]
+	p.UID = resp[6 : 6+int(resp[5])]
+	return nil
+}
+
+// String returns information about the PN532 and the selected target.
+func (p *PN532) String() string {
+	var str string
+	if len(p.Firmware) == 4 {
+		str += fmt.Sprintf("Firmware: IC %02xh, version %d.%d\n",
+			p.Firmware[0], p.Firmware[1], p.Firmware[2])
+	} else {
+		str += fmt.Sprintln("No device information.")
+	}
+	if p.UID != nil {
+		str += fmt.Sprintf("Target UID: % 02x\n", p.UID)
+	} else {
+		str += fmt.Sprintln("No target information.")
+	}
+	return str
+}
+
+// TransceiveBytes sends the bytes to the target with InDataExchange
+// and returns the response. Data longer than what fits in a single
+// InDataExchange command is chained.
+//
+// It returns an error if the PN532 reports an error or if the
+// response is longer than rxLen.
+func (p *PN532) TransceiveBytes(tx []byte, rxLen int) ([]byte, error) {
+	maxData := p.MaxExchangeData
+	if maxData == 0 {
+		maxData = DefaultMaxExchangeData
+	}
+	// Send the first parts of a long APDU with the MI bit set
+	for len(tx) > maxData {
+		if _, _, err := p.exchange(p.target|0x40,
+			tx[:maxData]); err != nil {
+			return nil, err
+		}
+		tx = tx[maxData:]
+	}
+	rx, more, err := p.exchange(p.target, tx)
+	if err != nil {
+		return nil, err
+	}
+	// Fetch the rest of a chained response
+	for more {
+		var data []byte
+		data, more, err = p.exchange(p.target, nil)
+		if err != nil {
+			return nil, err
+		}
+		rx = append(rx, data...)
+	}
+
+	if len(rx) > rxLen {
+		return rx, errors.New("PN532.TransceiveBytes: " +
+			"The length of the response is larger than expected")
+	}
+	return rx, nil
+}
+
+// Command sends a command to the PN532, waits for the ACK and
+// returns the parameters of the response.
+func (p *PN532) Command(cmd byte, params []byte) ([]byte, error) {
+	data := append([]byte{HostToPN532, cmd}, params...)
+	if len(data) > MaxFrameData {
+		return nil, errors.New("PN532: command too long")
+	}
+	if _, err := p.conn.Write(MarshalFrame(data)); err != nil {
+		return nil, err
+	}
+	r, err := p.conn.NextFrame()
+	if err != nil {
+		return nil, err
+	}
+	if _, ack, err := ReadFrame(r); err != nil {
+		return nil, err
+	} else if !ack {
+		return nil, errors.New("PN532: ACK frame expected")
+	}
+	r, err = p.conn.NextFrame()
+	if err != nil {
+		return nil, err
+	}
+	resp, _, err := ReadFrame(r)
+	if err != nil {
+		return nil, err
+	}
+	return ParseResponse(cmd, resp)
+}
+
+// exchange sends an InDataExchange command to the target with the
+// given Tg byte and data. It returns the data received and whether
+// the target has more data to send.
+func (p *PN532) exchange(tg byte, data []byte) ([]byte, bool, error) {
+	resp, err := p.Command(CmdInDataExchange, append([]byte{tg}, data...))
+	if err != nil {
+		return nil, false, err
+	}
+	if len(resp) < 1 {
+		return nil, false, errors.New("PN532: " +
+			"malformed InDataExchange response")
+	}
+	if code := resp[0] & 0x3F; code != 0 {
+		return nil, false, fmt.Errorf("PN532: "+
+			"InDataExchange failed with error %02xh", code)
+	}
+	return resp[1:], resp[0]&0x40 != 0, nil
+}
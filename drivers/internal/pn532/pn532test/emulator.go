@@ -0,0 +1,100 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+// Package pn532test provides an emulated PN532 with a software tag
+// in its field, to test the PN532 drivers.
+package pn532test
+
+import (
+	"github.com/hsanjuan/go-nfctype4/drivers/internal/pn532"
+	"github.com/hsanjuan/go-nfctype4/drivers/swtag"
+	"github.com/hsanjuan/go-nfctype4/tags"
+)
+
+// maxExchangeData is the maximum amount of data returned with a
+// single InDataExchange response.
+const maxExchangeData = 262
+
+// ISOTarget is an InListPassiveTarget response describing an
+// ISO/IEC 14443-4 Type A target with UID 01020304h.
+var ISOTarget = []byte{0x01, 0x01, 0x00, 0x04, 0x20, 0x04, 0x01, 0x02, 0x03, 0x04}
+
+// MifareTarget is an InListPassiveTarget response describing a
+// target which does not support ISO/IEC 14443-4.
+var MifareTarget = []byte{0x01, 0x01, 0x00, 0x04, 0x08, 0x04, 0x01, 0x02, 0x03, 0x04}
+
+// NoTarget is an InListPassiveTarget response without targets.
+var NoTarget = []byte{0x00}
+
+// Emulator processes the command frames sent to a PN532.
+type Emulator struct {
+	Target []byte // InListPassiveTarget response
+	Tag    tags.Tag
+
+	tx []byte
+	rx []byte
+}
+
+// Handle takes the data of a command frame and returns the data of
+// the response frame.
+func (emu *Emulator) Handle(data []byte) []byte {
+	if len(data) < 2 || data[0] != pn532.HostToPN532 {
+		return []byte{0x7F}
+	}
+	resp := []byte{pn532.PN532ToHost, data[1] + 1}
+	switch data[1] {
+	case pn532.CmdGetFirmwareVersion:
+		resp = append(resp, 0x32, 0x01, 0x06, 0x07)
+	case pn532.CmdSAMConfiguration:
+	case pn532.CmdInListPassiveTarget:
+		resp = append(resp, emu.Target...)
+	case pn532.CmdInDataExchange:
+		if len(data) < 3 {
+			return []byte{0x7F}
+		}
+		resp = append(resp, emu.exchange(data[2], data[3:])...)
+	default:
+		return []byte{0x7F}
+	}
+	return resp
+}
+
+// exchange relays data to the tag, handling chaining in both
+// directions.
+func (emu *Emulator) exchange(tg byte, data []byte) []byte {
+	emu.tx = append(emu.tx, data...)
+	if tg&0x40 != 0 {
+		return []byte{0x00}
+	}
+	if len(emu.tx) > 0 {
+		driver := &swtag.Driver{Tag: emu.Tag}
+		rx, err := driver.TransceiveBytes(emu.tx, 0x10002)
+		emu.tx = nil
+		if err != nil {
+			return []byte{0x01} // Timeout
+		}
+		emu.rx = rx
+	}
+	if len(emu.rx) > maxExchangeData {
+		chunk := emu.rx[:maxExchangeData]
+		emu.rx = emu.rx[maxExchangeData:]
+		return append([]byte{0x40}, chunk...)
+	}
+	chunk := emu.rx
+	emu.rx = nil
+	return append([]byte{0x00}, chunk...)
+}
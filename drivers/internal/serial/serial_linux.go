@@ -0,0 +1,93 @@
+//go:build linux
+
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package serial
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// baudRates maps the supported baud rates to their termios values.
+var baudRates = map[int]uint32{
+	9600:    syscall.B9600,
+	19200:   syscall.B19200,
+	38400:   syscall.B38400,
+	57600:   syscall.B57600,
+	115200:  syscall.B115200,
+	230400:  syscall.B230400,
+	460800:  syscall.B460800,
+	921600:  syscall.B921600,
+	1000000: b1000000,
+}
+
+// Open opens a serial port in raw mode (8N1) with the given baud
+// rate. Reads return when no data has been received for the given
+// timeout (up to 25.5 seconds).
+func Open(port string, baudRate int, timeout time.Duration) (io.ReadWriteCloser, error) {
+	speed, ok := baudRates[baudRate]
+	if !ok {
+		return nil, fmt.Errorf("Open: unsupported baud rate %d",
+			baudRate)
+	}
+	f, err := os.OpenFile(port, syscall.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	vtime := timeout / (100 * time.Millisecond)
+	if vtime > 0xFF {
+		vtime = 0xFF
+	} else if vtime < 1 {
+		vtime = 1
+	}
+	termios := syscall.Termios{
+		Cflag: speed | syscall.CS8 | syscall.CREAD | syscall.CLOCAL,
+	}
+	termios.Cc[syscall.VMIN] = 0
+	termios.Cc[syscall.VTIME] = uint8(vtime)
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(),
+		uintptr(syscall.TCSETS), uintptr(unsafe.Pointer(&termios)))
+	if errno != 0 {
+		f.Close()
+		return nil, fmt.Errorf("Open: cannot configure %s: %s",
+			port, errno)
+	}
+	return &serialPort{f}, nil
+}
+
+// serialPort wraps the file of a serial port so that reads which time
+// out return an error instead of (0, nil).
+type serialPort struct {
+	*os.File
+}
+
+// Read reads from the serial port. It returns io.ErrUnexpectedEOF
+// when nothing is received before the timeout.
+func (port *serialPort) Read(p []byte) (int, error) {
+	n, err := port.File.Read(p)
+	if n == 0 && err == nil && len(p) > 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	return n, err
+}
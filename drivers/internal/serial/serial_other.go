@@ -0,0 +1,32 @@
+//go:build !linux
+
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package serial
+
+import (
+	"errors"
+	"io"
+	"time"
+)
+
+// Open is only implemented on Linux. Other systems can use the Conn
+// field of the drivers.
+func Open(port string, baudRate int, timeout time.Duration) (io.ReadWriteCloser, error) {
+	return nil, errors.New("Open: serial ports are only supported on Linux")
+}
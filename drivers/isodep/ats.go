@@ -0,0 +1,155 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package isodep
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Frame sizes indexed by FSCI/FSDI (ISO/IEC 14443-4, 5.2.3). Higher,
+// reserved, values are treated as 256 bytes.
+var frameSizes = []int{16, 24, 32, 40, 48, 64, 96, 128, 256}
+
+// Defaults used when the ATS does not include the corresponding
+// interface bytes.
+const (
+	DefaultFSCI = 2 // 32 bytes
+	DefaultFWI  = 4
+)
+
+// etu16 is the time of 256*16/fc seconds used to compute the FWT and
+// the SFGT, where fc is the carrier frequency (13.56 MHz).
+const etu16 = 256 * 16 * time.Second / 13560000
+
+// frameSize returns the size for the given FSCI or FSDI.
+func frameSize(index byte) int {
+	if int(index) >= len(frameSizes) {
+		return frameSizes[len(frameSizes)-1]
+	}
+	return frameSizes[index]
+}
+
+// frameSizeIndex returns the largest FSDI whose size is not larger
+// than the given one.
+func frameSizeIndex(size int) byte {
+	var index byte
+	for i, s := range frameSizes {
+		if s <= size {
+			index = byte(i)
+		}
+	}
+	return index
+}
+
+// ATS holds the parameters of the Answer To Select sent by an
+// ISO/IEC 14443-4 target in response to RATS.
+type ATS struct {
+	FSCI         byte // Frame size for the card index
+	TA           byte // Supported bit rates
+	FWI          byte // Frame waiting time integer
+	SFGI         byte // Start-up frame guard time integer
+	NADSupported bool
+	CIDSupported bool
+	Historical   []byte // Historical bytes
+}
+
+// ParseATS parses the ATS, starting with the length byte (TL) and
+// without the CRC.
+//
+// It returns an error if the ATS is malformed.
+func ParseATS(b []byte) (*ATS, error) {
+	ats := &ATS{
+		FSCI: DefaultFSCI,
+		FWI:  DefaultFWI,
+	}
+	if len(b) < 1 || int(b[0]) != len(b) {
+		return nil, errors.New("ParseATS: bad length byte")
+	}
+	if len(b) == 1 { // Only TL
+		return ats, nil
+	}
+	t0 := b[1]
+	ats.FSCI = t0 & 0x0F
+	rest := b[2:]
+	next := func() (byte, error) {
+		if len(rest) == 0 {
+			return 0, errors.New("ParseATS: missing interface bytes")
+		}
+		v := rest[0]
+		rest = rest[1:]
+		return v, nil
+	}
+	if t0&0x10 != 0 { // TA
+		v, err := next()
+		if err != nil {
+			return nil, err
+		}
+		ats.TA = v
+	}
+	if t0&0x20 != 0 { // TB
+		v, err := next()
+		if err != nil {
+			return nil, err
+		}
+		ats.FWI = v >> 4
+		ats.SFGI = v & 0x0F
+	}
+	if t0&0x40 != 0 { // TC
+		v, err := next()
+		if err != nil {
+			return nil, err
+		}
+		ats.NADSupported = v&0x01 != 0
+		ats.CIDSupported = v&0x02 != 0
+	}
+	if ats.FWI == 15 {
+		ats.FWI = DefaultFWI // RFU
+	}
+	ats.Historical = rest
+	return ats, nil
+}
+
+// FSC returns the maximum frame size that the card can receive,
+// CRC included.
+func (ats *ATS) FSC() int {
+	return frameSize(ats.FSCI)
+}
+
+// FWT returns the frame waiting time: the time that the card can
+// take to respond to a block.
+func (ats *ATS) FWT() time.Duration {
+	return etu16 << ats.FWI
+}
+
+// SFGT returns the time to wait after the ATS before sending the
+// first block.
+func (ats *ATS) SFGT() time.Duration {
+	if ats.SFGI == 0 || ats.SFGI == 15 {
+		return 0
+	}
+	return etu16 << ats.SFGI
+}
+
+// String returns a description of the ATS parameters.
+func (ats *ATS) String() string {
+	return fmt.Sprintf("FSC: %d. FWT: %s. CID: %t. NAD: %t. "+
+		"Historical bytes: % 02x", ats.FSC(), ats.FWT(),
+		ats.CIDSupported, ats.NADSupported, ats.Historical)
+}
@@ -0,0 +1,102 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package isodep
+
+// Protocol Control Byte (PCB) values and bits (ISO/IEC 14443-4, 7.1.1).
+const (
+	pcbIBlock = byte(0x02) // I-block, without options
+	pcbRBlock = byte(0xA2) // R-block, without options
+	pcbSBlock = byte(0xC2) // S-block, without options
+
+	pcbBlockNumber = byte(0x01)
+	pcbNAD         = byte(0x04)
+	pcbCID         = byte(0x08)
+	pcbChaining    = byte(0x10) // I-blocks
+	pcbNAK         = byte(0x10) // R-blocks
+
+	pcbDeselect = pcbSBlock        // S(DESELECT)
+	pcbWTX      = pcbSBlock | 0x30 // S(WTX)
+
+	maxWTXM = 59
+)
+
+// Block types.
+const (
+	blockI = iota
+	blockR
+	blockS
+	blockInvalid
+)
+
+// blockType returns the type of the block with the given PCB.
+func blockType(pcb byte) int {
+	switch {
+	case pcb&0xE2 == 0x02:
+		return blockI
+	case pcb&0xE6 == 0xA2:
+		return blockR
+	case pcb&0xC7 == 0xC2:
+		return blockS
+	default:
+		return blockInvalid
+	}
+}
+
+// block is a parsed ISO-DEP block.
+type block struct {
+	pcb byte
+	inf []byte
+}
+
+// parseBlock parses a frame received from the card, dropping the CID
+// and NAD bytes. It returns false if the frame is not a valid block.
+func parseBlock(frame []byte) (block, bool) {
+	if len(frame) < 1 {
+		return block{}, false
+	}
+	b := block{pcb: frame[0]}
+	t := blockType(b.pcb)
+	if t == blockInvalid {
+		return b, false
+	}
+	rest := frame[1:]
+	if b.pcb&pcbCID != 0 {
+		if len(rest) < 1 {
+			return b, false
+		}
+		rest = rest[1:]
+	}
+	if t == blockI && b.pcb&pcbNAD != 0 {
+		if len(rest) < 1 {
+			return b, false
+		}
+		rest = rest[1:]
+	}
+	b.inf = rest
+	return b, true
+}
+
+// is checks the type of the block.
+func (b block) is(t int) bool {
+	return blockType(b.pcb) == t
+}
+
+// number returns the block number.
+func (b block) number() byte {
+	return b.pcb & pcbBlockNumber
+}
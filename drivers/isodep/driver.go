@@ -0,0 +1,300 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+// Package isodep implements the ISO/IEC 14443-4 (ISO-DEP) half-duplex
+// block transmission protocol on top of links which only exchange raw
+// frames with a target, like some NFC controllers in raw mode or
+// software defined radios.
+//
+// The Driver activates the protocol with RATS, uses the ATS to
+// negotiate the frame sizes and waiting times, and carries the APDUs
+// in I-blocks, chaining them when they do not fit in a frame. It
+// handles the waiting time extensions requested by the card and
+// recovers from lost or corrupted frames with R-blocks, as described
+// in the standard.
+package isodep
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hsanjuan/go-nfctype4"
+)
+
+// Default values for the Driver configuration.
+const (
+	DefaultFSD     = 256
+	DefaultRetries = 2
+)
+
+// rats is the start byte of the Request for Answer To Select.
+const rats = byte(0xE0)
+
+// ErrProtocol is returned when the card does not follow the block
+// protocol.
+var ErrProtocol = errors.New("ISO-DEP protocol error")
+
+// Link exchanges raw frames with an ISO/IEC 14443 Type A target.
+// Computing and checking the CRC is up to the Link.
+type Link interface {
+	// Initialize performs the anticollision and selects the target,
+	// leaving it ready to receive RATS.
+	Initialize() error
+	// TransceiveFrame sends a frame and returns the frame received
+	// in response, waiting for it at most the given time. It returns
+	// an error when nothing (or a corrupted frame) is received.
+	TransceiveFrame(tx []byte, timeout time.Duration) ([]byte, error)
+	Close()
+}
+
+// Driver implements the CommandDriver interface by carrying the bytes
+// with the ISO-DEP protocol over a Link.
+type Driver struct {
+	Link Link
+	// FSD is the maximum size of the frames that the Link can
+	// receive. Defaults to DefaultFSD.
+	FSD int
+	// CID is the card identifier (1 to 14) to use when the card
+	// supports it. By default, no CID is sent.
+	CID byte
+	// Retries is the number of times that a failed exchange is
+	// retried. Defaults to DefaultRetries. Use a negative value
+	// to disable retries.
+	Retries int
+	// Trace, when set, receives the bytes exchanged with the tag.
+	Trace nfctype4.Tracer
+
+	ats    *ATS
+	useCID bool
+	number byte // Current block number
+}
+
+// Initialize initializes the Link, sends RATS and configures the
+// protocol according to the ATS.
+//
+// It returns an error if the Link fails or if the ATS is not valid.
+func (driver *Driver) Initialize() error {
+	if driver.Link == nil {
+		return errors.New("Driver.Initialize: Link is not set")
+	}
+	if driver.CID > 14 {
+		return errors.New("Driver.Initialize: CID must be 0 to 14")
+	}
+	driver.ats = nil
+	if err := driver.Link.Initialize(); err != nil {
+		return err
+	}
+	fsd := driver.FSD
+	if fsd == 0 {
+		fsd = DefaultFSD
+	}
+	param := frameSizeIndex(fsd)<<4 | driver.CID
+	// The activation frame waiting time is 65536/fc
+	resp, err := driver.Link.TransceiveFrame([]byte{rats, param},
+		5*time.Millisecond)
+	if err != nil {
+		return err
+	}
+	ats, err := ParseATS(resp)
+	if err != nil {
+		return err
+	}
+	driver.ats = ats
+	driver.useCID = driver.CID != 0 && ats.CIDSupported
+	driver.number = 0
+	time.Sleep(ats.SFGT())
+	return nil
+}
+
+// ATS returns the ATS sent by the card, or nil when the driver has not
+// been initialized.
+func (driver *Driver) ATS() *ATS {
+	return driver.ats
+}
+
+// String returns information about this driver and the card.
+func (driver *Driver) String() string {
+	str := "ISO-DEP Driver. "
+	if driver.ats == nil {
+		return str + "Not initialized."
+	}
+	return str + driver.ats.String()
+}
+
+// TransceiveBytes sends the bytes to the card in I-blocks, chaining
+// them when they do not fit in the frame size of the card, and returns
+// the data of the I-blocks received in response.
+//
+// It returns an error if the driver has not been initialized, if the
+// exchange fails after all retries, if the card does not follow the
+// protocol or if the response is longer than rxLen.
+func (driver *Driver) TransceiveBytes(tx []byte, rxLen int) ([]byte, error) {
+	if driver.ats == nil {
+		return nil, errors.New("Driver.TransceiveBytes: " +
+			"Driver not initialized")
+	}
+	driver.Trace.Trace(true, tx)
+	// PCB, CID and CRC
+	maxInf := driver.ats.FSC() - 3
+	if driver.useCID {
+		maxInf--
+	}
+
+	// Chained blocks are acknowledged with R(ACK)
+	for len(tx) > maxInf {
+		resp, err := driver.exchange(driver.iBlock(tx[:maxInf], true))
+		if err != nil {
+			return nil, err
+		}
+		if !resp.is(blockR) || resp.pcb&pcbNAK != 0 ||
+			resp.number() != driver.number {
+			return nil, driver.protocolError(resp)
+		}
+		driver.number ^= 1
+		tx = tx[maxInf:]
+	}
+
+	resp, err := driver.exchange(driver.iBlock(tx, false))
+	if err != nil {
+		return nil, err
+	}
+	var rx []byte
+	for {
+		if !resp.is(blockI) || resp.number() != driver.number {
+			return nil, driver.protocolError(resp)
+		}
+		driver.number ^= 1
+		rx = append(rx, resp.inf...)
+		if resp.pcb&pcbChaining == 0 {
+			break
+		}
+		resp, err = driver.exchange(driver.rBlock(false))
+		if err != nil {
+			return nil, err
+		}
+	}
+	driver.Trace.Trace(false, rx)
+
+	if len(rx) > rxLen {
+		return rx, errors.New("Driver.TransceiveBytes: " +
+			"The length of the response is larger than expected")
+	}
+	return rx, nil
+}
+
+// Close deselects the card and closes the Link.
+func (driver *Driver) Close() {
+	if driver.ats != nil {
+		driver.Link.TransceiveFrame(driver.sBlock(pcbDeselect, nil),
+			driver.ats.FWT())
+	}
+	driver.ats = nil
+	if driver.Link != nil {
+		driver.Link.Close()
+	}
+}
+
+// exchange sends a block and returns the response. It answers the
+// waiting time extension requests and, when the exchange fails,
+// sends R(NAK) blocks and retransmits the last block when the card
+// asks for it.
+func (driver *Driver) exchange(frame []byte) (block, error) {
+	retries := driver.Retries
+	if retries == 0 {
+		retries = DefaultRetries
+	}
+	last := frame
+	fwt := driver.ats.FWT()
+	timeout := fwt
+	for {
+		resp, err := driver.Link.TransceiveFrame(frame, timeout)
+		timeout = fwt
+		b, ok := parseBlock(resp)
+		switch {
+		case err != nil || !ok:
+			if retries <= 0 {
+				if err == nil {
+					err = ErrProtocol
+				}
+				return b, err
+			}
+			retries--
+			frame = driver.rBlock(true)
+		case b.pcb&^pcbCID == pcbWTX:
+			if len(b.inf) < 1 {
+				return b, ErrProtocol
+			}
+			wtxm := b.inf[0] & 0x3F
+			if wtxm == 0 || wtxm > maxWTXM {
+				return b, ErrProtocol
+			}
+			timeout = fwt * time.Duration(wtxm)
+			frame = driver.sBlock(pcbWTX, []byte{wtxm})
+		case b.is(blockR) && b.pcb&pcbNAK == 0 &&
+			b.number() != driver.number:
+			// The card did not receive the last block
+			if retries <= 0 {
+				return b, ErrProtocol
+			}
+			retries--
+			frame = last
+		default:
+			return b, nil
+		}
+	}
+}
+
+// iBlock builds an I-block with the current block number.
+func (driver *Driver) iBlock(inf []byte, chaining bool) []byte {
+	pcb := pcbIBlock | driver.number
+	if chaining {
+		pcb |= pcbChaining
+	}
+	return driver.frame(pcb, inf)
+}
+
+// rBlock builds an R(ACK) or R(NAK) block with the current block
+// number.
+func (driver *Driver) rBlock(nak bool) []byte {
+	pcb := pcbRBlock | driver.number
+	if nak {
+		pcb |= pcbNAK
+	}
+	return driver.frame(pcb, nil)
+}
+
+// sBlock builds an S-block.
+func (driver *Driver) sBlock(pcb byte, inf []byte) []byte {
+	return driver.frame(pcb, inf)
+}
+
+// frame adds the CID, when used, to a block.
+func (driver *Driver) frame(pcb byte, inf []byte) []byte {
+	frame := []byte{pcb}
+	if driver.useCID {
+		frame[0] |= pcbCID
+		frame = append(frame, driver.CID)
+	}
+	return append(frame, inf...)
+}
+
+// protocolError describes an unexpected block.
+func (driver *Driver) protocolError(b block) error {
+	return fmt.Errorf("Driver.TransceiveBytes: %s: unexpected "+
+		"block with PCB %02xh", ErrProtocol, b.pcb)
+}
@@ -0,0 +1,269 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package isodep
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hsanjuan/go-ndef"
+	"github.com/hsanjuan/go-nfctype4"
+	"github.com/hsanjuan/go-nfctype4/drivers/swtag"
+	"github.com/hsanjuan/go-nfctype4/tags/static"
+)
+
+var errTimeout = errors.New("timeout")
+
+// card emulates an ISO-DEP card in front of a software tag.
+type card struct {
+	ats     []byte
+	fsc     int
+	tag     *swtag.Driver
+	number  byte
+	cmd     []byte
+	pending []byte // Response data not sent yet
+	last    []byte // Last block sent
+	wtx     int    // Number of WTX requests to send
+	wtxm    byte
+	lose    int // Number of frames to lose
+	loseRX  int // Number of responses to lose
+	frames  int
+	closed  bool
+}
+
+func newCard(t *testing.T, ats []byte, msg *ndef.Message) *card {
+	tag := static.New()
+	if err := tag.SetMaxDataLengths(0xFF, 0xFF); err != nil {
+		t.Fatal(err)
+	}
+	tag.SetMessage(msg)
+	parsed, err := ParseATS(ats)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &card{
+		ats:    ats,
+		number: 1,
+		fsc:    parsed.FSC(),
+		tag:    &swtag.Driver{Tag: tag},
+	}
+}
+
+func (c *card) Initialize() error {
+	c.number = 1
+	c.cmd = nil
+	c.pending = nil
+	return nil
+}
+
+func (c *card) Close() {
+	c.closed = true
+}
+
+func (c *card) TransceiveFrame(tx []byte, timeout time.Duration) ([]byte, error) {
+	c.frames++
+	if len(tx) == 2 && tx[0] == rats {
+		return c.ats, nil
+	}
+	if c.lose > 0 {
+		c.lose--
+		return nil, errTimeout
+	}
+	b, ok := parseBlock(tx)
+	if !ok {
+		return nil, errTimeout
+	}
+	resp := c.handle(b)
+	if resp != nil && resp[0] != pcbWTX {
+		c.last = resp
+	}
+	if c.loseRX > 0 {
+		c.loseRX--
+		return nil, errTimeout
+	}
+	return resp, nil
+}
+
+func (c *card) handle(b block) []byte {
+	switch {
+	case b.is(blockS):
+		if b.pcb == pcbDeselect {
+			return []byte{pcbDeselect}
+		}
+		return c.respond()
+	case b.is(blockR):
+		if b.number() == c.number {
+			return c.last
+		}
+		if b.pcb&pcbNAK != 0 {
+			return []byte{pcbRBlock | c.number}
+		}
+		c.number ^= 1
+		return c.nextBlock()
+	}
+	c.number ^= 1
+	c.cmd = append(c.cmd, b.inf...)
+	if b.pcb&pcbChaining != 0 {
+		return []byte{pcbRBlock | c.number}
+	}
+	return c.respond()
+}
+
+// respond processes the command, requesting waiting time extensions
+// first, when configured.
+func (c *card) respond() []byte {
+	if c.wtx > 0 {
+		c.wtx--
+		return []byte{pcbWTX, c.wtxm}
+	}
+	if c.cmd != nil {
+		rx, err := c.tag.TransceiveBytes(c.cmd, 0x10002)
+		if err != nil {
+			return nil
+		}
+		c.cmd = nil
+		c.pending = rx
+	}
+	return c.nextBlock()
+}
+
+func (c *card) nextBlock() []byte {
+	maxInf := c.fsc - 3
+	if len(c.pending) > maxInf {
+		chunk := c.pending[:maxInf]
+		c.pending = c.pending[maxInf:]
+		return append([]byte{pcbIBlock | pcbChaining | c.number}, chunk...)
+	}
+	chunk := c.pending
+	c.pending = nil
+	return append([]byte{pcbIBlock | c.number}, chunk...)
+}
+
+func TestParseATS(t *testing.T) {
+	// TL, T0 (TA, TB, TC, FSCI 8), TA, TB (FWI 7, SFGI 0), TC (CID),
+	// historical bytes
+	ats, err := ParseATS([]byte{0x08, 0x78, 0x00, 0x70, 0x02, 0x80, 0x31, 0xAB})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ats.FSC() != 256 || ats.FWI != 7 || !ats.CIDSupported ||
+		ats.NADSupported || !bytes.Equal(ats.Historical, []byte{0x80, 0x31, 0xAB}) {
+		t.Error("unexpected ATS:", ats)
+	}
+	if fwt := ats.FWT(); fwt < 38600*time.Microsecond ||
+		fwt > 38700*time.Microsecond {
+		t.Error("unexpected FWT:", ats.FWT())
+	}
+
+	ats, err = ParseATS([]byte{0x01})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ats.FSC() != 32 || ats.FWI != DefaultFWI {
+		t.Error("defaults expected:", ats)
+	}
+
+	bad := [][]byte{
+		{},
+		{0x03, 0x70},
+		{0x03, 0x70, 0x00},
+	}
+	for _, b := range bad {
+		if _, err := ParseATS(b); err == nil {
+			t.Errorf("% 02x should not parse", b)
+		}
+	}
+}
+
+func TestDriver(t *testing.T) {
+	msg := ndef.NewTextMessage(strings.Repeat("long text ", 50), "en")
+	atsSets := map[string][]byte{
+		"fsc16":  {0x05, 0x70, 0x00, 0x00, 0x00},
+		"fsc256": {0x05, 0x78, 0x00, 0x00, 0x00},
+		"cid":    {0x05, 0x72, 0x00, 0x00, 0x02},
+	}
+	for name, ats := range atsSets {
+		c := newCard(t, ats, msg)
+		d := &Driver{Link: c, CID: 3}
+		device := nfctype4.New(d)
+		if err := device.Update(msg); err != nil {
+			t.Fatal(name, err)
+		}
+		readMsg, err := device.Read()
+		if err != nil {
+			t.Fatal(name, err)
+		}
+		if readMsg.String() != msg.String() {
+			t.Error(name, "unexpected message")
+		}
+		d.Close()
+		if !c.closed {
+			t.Error(name, "the Link should be closed")
+		}
+	}
+}
+
+func TestDriver_recovery(t *testing.T) {
+	msg := ndef.NewTextMessage("hello", "en")
+	c := newCard(t, []byte{0x05, 0x70, 0x00, 0x00, 0x00}, msg)
+	c.wtx = 2
+	c.wtxm = 3
+	d := &Driver{Link: c}
+	if err := d.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	cmder := &nfctype4.Commander{Driver: d}
+	if err := cmder.NDEFApplicationSelect(); err != nil {
+		t.Fatal(err)
+	}
+	if c.frames != 4 { // RATS, I, WTX, WTX
+		t.Error("unexpected number of frames:", c.frames)
+	}
+
+	// Lost frames are recovered with R(NAK)
+	c.lose = 1
+	if err := cmder.NDEFApplicationSelect(); err != nil {
+		t.Fatal(err)
+	}
+
+	c.loseRX = 1
+	if err := cmder.NDEFApplicationSelect(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Too many lost frames
+	c.lose = 3
+	if err := cmder.NDEFApplicationSelect(); err != errTimeout {
+		t.Error("expected a timeout:", err)
+	}
+}
+
+func TestDriver_notInitialized(t *testing.T) {
+	d := &Driver{}
+	if err := d.Initialize(); err == nil {
+		t.Error("Initialize without Link should fail")
+	}
+	if _, err := d.TransceiveBytes([]byte{0x00}, 2); err == nil {
+		t.Error("TransceiveBytes should fail")
+	}
+	_ = d.String()
+}
@@ -24,8 +24,10 @@ package libnfc
 import (
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/clausecker/nfc/v2"
+	"github.com/hsanjuan/go-nfctype4"
 )
 
 // Common errors
@@ -35,8 +37,17 @@ var (
 	ErrNoTargetsDetected         = errors.New("no targets detected.")
 )
 
-// BUG(hector): Driver Modulation is hardcoded and cannot be specified by
-// the user.
+// Polling parameters for WaitForTarget. The period is the minimum
+// supported by libnfc and the number of polls the maximum performed
+// with a single call.
+const (
+	pollPeriod = 150 * time.Millisecond
+	pollTimes  = 254
+)
+
+// fallbackBaudRates are tried, in order, when no targets are detected
+// with the configured baud rate. Many tags only answer at 106 kbps.
+var fallbackBaudRates = []int{nfc.Nbr106, nfc.Nbr212, nfc.Nbr424}
 
 // Driver implements the CommandDriver interface allowing `Device` to
 // use any libnfc-supported hardware to communicate with a real NFC Tag.
@@ -46,11 +57,33 @@ var (
 // readers and poll the desired Targets (that is, detect the tags with which
 // we want to interact with).
 type Driver struct {
-	Modulation   nfc.Modulation // The modulation to use
-	DeviceNumber int            // The libnfc devices number to choose
-	device       *nfc.Device
-	deviceList   []string
-	target       *nfc.ISO14443aTarget
+	// Modulation to use. The Type defaults to ISO14443a, and can be
+	// set to ISO14443b for Type 4B tags. When the
+	// BaudRate is not set or no targets are detected with it, the
+	// rest of the baud rates (106, 212 and 424 kbps) are tried,
+	// unless DisableFallback is set.
+	Modulation      nfc.Modulation
+	DisableFallback bool
+	DeviceNumber    int // The libnfc devices number to choose
+	// WaitForTarget makes Initialize poll for a target until one
+	// appears or WaitTimeout expires, instead of failing when no
+	// target is in the field. A WaitTimeout of 0 waits forever.
+	WaitForTarget bool
+	WaitTimeout   time.Duration
+	// Connstring is the libnfc connection string of the device
+	// (i.e. "pn532_uart:/dev/ttyUSB0"). When set, it is used
+	// instead of DeviceNumber.
+	Connstring string
+	// EmulatedTarget is presented to readers by EmulateTag. When
+	// nil, DefaultEmulatedTarget is used.
+	EmulatedTarget *nfc.ISO14443aTarget
+	// Trace, when set, receives the bytes exchanged with the tag.
+	Trace nfctype4.Tracer
+
+	device     *nfc.Device
+	deviceList []string
+	target     nfc.Target     // ISO14443aTarget or ISO14443bTarget
+	modulation nfc.Modulation // The modulation in use
 }
 
 // Initialize performs the necessary operations to make sure that the
@@ -62,46 +95,158 @@ type Driver struct {
 // for initialization to work, the NFC device needs to be visible to the reader
 // already, as otherwise there is no target to work with.
 //
+// Targets are listed with each of the modulations given by Modulation
+// and the fallback baud rates, until some is found. With
+// WaitForTarget, the reader polls with all of them until a target
+// appears, and ErrNoTargetsDetected is returned only after the
+// WaitTimeout.
+//
 // It returns an error when some step fails.
 func (driver *Driver) Initialize() error {
-	driver.Modulation = nfc.Modulation{Type: nfc.ISO14443a, BaudRate: nfc.Nbr106}
-
-	deviceList, err := nfc.ListDevices()
+	err := driver.open()
 	if err != nil {
 		return err
 	}
-	driver.deviceList = deviceList
-
-	if len(deviceList) == 0 {
-		return ErrNoDevicesDetected
-	}
-	if len(deviceList) <= driver.DeviceNumber {
-		return ErrRequestedDeviceNotPresent
-	}
-	device, err := nfc.Open(deviceList[driver.DeviceNumber])
+	err = driver.device.InitiatorInit()
 	if err != nil {
 		return err
 	}
 
-	driver.device = &device
-	err = driver.device.InitiatorInit()
-	if err != nil {
-		return err
+	if driver.WaitForTarget {
+		// The polled target is already selected
+		target, err := driver.pollTarget()
+		if err != nil {
+			return err
+		}
+		driver.target = target
+		driver.modulation = target.Modulation()
+		return nil
 	}
 
 	var targets []nfc.Target
-	targets, err = driver.device.InitiatorListPassiveTargets(driver.Modulation)
+	for _, m := range driver.modulations() {
+		targets, err = driver.device.InitiatorListPassiveTargets(m)
+		if err == nil && len(targets) > 0 {
+			driver.modulation = m
+			break
+		}
+	}
 	if len(targets) == 0 {
 		return ErrNoTargetsDetected
 	}
-	driver.target = targets[0].(*nfc.ISO14443aTarget)
+	// The initialization data for ISO14443B is the AFI. nil
+	// selects any application family.
+	var initData []byte
+	switch target := targets[0].(type) {
+	case *nfc.ISO14443aTarget:
+		initData = target.UID[0:target.UIDLen]
+	case *nfc.ISO14443bTarget:
+	default:
+		return fmt.Errorf("Driver.Initialize: "+
+			"unsupported target type %d", target.Modulation().Type)
+	}
+	driver.target = targets[0]
 
 	_, err = driver.device.InitiatorSelectPassiveTarget(
-		driver.Modulation,
-		driver.target.UID[0:driver.target.UIDLen])
+		driver.modulation,
+		initData)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// pollTarget polls for a target with all the modulations until one
+// is found or the WaitTimeout expires.
+func (driver *Driver) pollTarget() (nfc.Target, error) {
+	modulations := driver.modulations()
+	deadline := time.Now().Add(driver.WaitTimeout)
+	for {
+		times := pollTimes
+		if driver.WaitTimeout > 0 {
+			remaining := time.Until(deadline)
+			if remaining <= 0 {
+				return nil, ErrNoTargetsDetected
+			}
+			n := int(remaining/(pollPeriod*time.Duration(len(modulations)))) + 1
+			if n < times {
+				times = n
+			}
+		}
+		n, target, err := driver.device.InitiatorPollTarget(
+			modulations, times, pollPeriod)
+		if nfcErr, ok := err.(nfc.Error); ok && nfcErr == nfc.ETIMEOUT {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if n > 0 && target != nil {
+			return target, nil
+		}
+	}
+}
+
+// modulations returns the modulations to try when listing targets:
+// the configured one first, followed by the fallback baud rates.
+func (driver *Driver) modulations() []nfc.Modulation {
+	m := driver.Modulation
+	if m.Type == 0 {
+		m.Type = nfc.ISO14443a
+	}
+	var modulations []nfc.Modulation
+	if m.BaudRate != 0 {
+		modulations = append(modulations, m)
+		if driver.DisableFallback {
+			return modulations
+		}
+	}
+	for _, br := range fallbackBaudRates {
+		if br != m.BaudRate {
+			modulations = append(modulations,
+				nfc.Modulation{Type: m.Type, BaudRate: br})
+		}
+	}
+	return modulations
+}
+
+// ListDevices returns the connection strings of the nfc devices
+// detected by libnfc, in the order used by DeviceNumber. They can be
+// used to select a device with the Connstring field.
+func ListDevices() ([]string, error) {
+	return nfc.ListDevices()
+}
+
+// open detects the available nfc devices and opens the selected one,
+// or opens the device given by the Connstring directly.
+func (driver *Driver) open() error {
+	if driver.Connstring != "" {
+		device, err := nfc.Open(driver.Connstring)
+		if err != nil {
+			return err
+		}
+		driver.deviceList = []string{driver.Connstring}
+		driver.device = &device
+		return nil
+	}
+
+	deviceList, err := nfc.ListDevices()
 	if err != nil {
 		return err
 	}
+	driver.deviceList = deviceList
+
+	if len(deviceList) == 0 {
+		return ErrNoDevicesDetected
+	}
+	if len(deviceList) <= driver.DeviceNumber {
+		return ErrRequestedDeviceNotPresent
+	}
+	device, err := nfc.Open(deviceList[driver.DeviceNumber])
+	if err != nil {
+		return err
+	}
+	driver.device = &device
 	return nil
 }
 
@@ -112,8 +257,8 @@ func (driver *Driver) String() string {
 	var str string
 	str += fmt.Sprintf("NeoRead uses libnfc %s\n", nfc.Version())
 	str += fmt.Sprintf("Modulation: Type: %d, BaudRate: %d\n",
-		driver.Modulation.Type,
-		driver.Modulation.BaudRate)
+		driver.modulation.Type,
+		driver.modulation.BaudRate)
 
 	str += fmt.Sprintln("Detected devices:")
 	for i, d := range driver.deviceList {
@@ -136,12 +281,40 @@ func (driver *Driver) String() string {
 	return str
 }
 
+// TargetInfo returns the UID, ATQA, SAK and ATS of the selected target.
+// For ISO14443B targets, the UID is the PUPI and the rest of fields
+// are not set.
+//
+// It returns an error if no target has been selected with
+// Initialize().
+func (driver *Driver) TargetInfo() (nfctype4.TargetInfo, error) {
+	switch target := driver.target.(type) {
+	case *nfc.ISO14443aTarget:
+		info := nfctype4.TargetInfo{
+			UID:  append([]byte{}, target.UID[:target.UIDLen]...),
+			ATQA: target.Atqa,
+			SAK:  target.Sak,
+		}
+		if target.AtsLen > 0 {
+			info.ATS = append([]byte{}, target.Ats[:target.AtsLen]...)
+		}
+		return info, nil
+	case *nfc.ISO14443bTarget:
+		return nfctype4.TargetInfo{
+			UID: append([]byte{}, target.Pupi[:]...),
+		}, nil
+	default:
+		return nfctype4.TargetInfo{}, errors.New("Driver.TargetInfo: " +
+			"no target selected")
+	}
+}
+
 // TransceiveBytes is used to send and receive bytes from the libnfc device.
 // It receives a byte slice to send, and an expected maximum length to receive.
 // It returns the received data or an error when something fails.
 func (driver *Driver) TransceiveBytes(tx []byte, rxLen int) ([]byte, error) {
 	rx := make([]byte, rxLen) //buffer to receive bytes
-	// fmt.Printf("T: % 02x\n", tx)
+	driver.Trace.Trace(true, tx)
 	n, err := driver.device.InitiatorTransceiveBytes(tx, rx, -1)
 	if err != nil {
 		if err.(nfc.Error) == nfc.EOVFLOW {
@@ -151,7 +324,7 @@ func (driver *Driver) TransceiveBytes(tx []byte, rxLen int) ([]byte, error) {
 		}
 		return nil, err
 	}
-	// fmt.Printf("R: % 02x\n", rx)
+	driver.Trace.Trace(false, rx[0:n])
 	return rx[0:n], nil
 }
 
@@ -21,7 +21,9 @@ package libnfc
 
 import (
 	"fmt"
+	"testing"
 
+	"github.com/clausecker/nfc/v2"
 	"github.com/hsanjuan/go-nfctype4"
 )
 
@@ -38,3 +40,78 @@ func ExampleDevice_Read_libnfcCommandDriver() {
 		fmt.Println(message)
 	}
 }
+
+func TestDriver_modulations(t *testing.T) {
+	driver := new(Driver)
+	m := driver.modulations()
+	if len(m) != 3 || m[0].Type != nfc.ISO14443a || m[0].BaudRate != nfc.Nbr106 ||
+		m[1].BaudRate != nfc.Nbr212 || m[2].BaudRate != nfc.Nbr424 {
+		t.Error("unexpected default modulations:", m)
+	}
+
+	driver.Modulation = nfc.Modulation{Type: nfc.ISO14443a, BaudRate: nfc.Nbr424}
+	m = driver.modulations()
+	if len(m) != 3 || m[0].BaudRate != nfc.Nbr424 ||
+		m[1].BaudRate != nfc.Nbr106 || m[2].BaudRate != nfc.Nbr212 {
+		t.Error("the configured baud rate should be tried first:", m)
+	}
+
+	driver.DisableFallback = true
+	m = driver.modulations()
+	if len(m) != 1 || m[0] != driver.Modulation {
+		t.Error("unexpected modulations without fallback:", m)
+	}
+}
+
+func TestDriver_connstring(t *testing.T) {
+	driver := &Driver{Connstring: "pn532_uart:/dev/nonexistent"}
+	err := driver.Initialize()
+	if err == nil || err == ErrNoDevicesDetected {
+		t.Error("the connstring should be opened directly:", err)
+	}
+}
+
+func TestDriver_TargetInfo(t *testing.T) {
+	driver := new(Driver)
+	if _, err := driver.TargetInfo(); err == nil {
+		t.Error("TargetInfo should fail without target")
+	}
+	driver.target = &nfc.ISO14443aTarget{
+		Atqa:   [2]byte{0x03, 0x44},
+		Sak:    0x20,
+		UIDLen: 7,
+		UID:    [10]byte{0x04, 0x11, 0x22, 0x33, 0x44, 0x55, 0x66},
+		AtsLen: 5,
+		Ats:    [254]byte{0x75, 0x77, 0x81, 0x02, 0x80},
+	}
+	var informer nfctype4.TargetInformer = driver
+	info, err := informer.TargetInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprintf("% X", info.UID) != "04 11 22 33 44 55 66" ||
+		info.ATQA != [2]byte{0x03, 0x44} || info.SAK != 0x20 ||
+		fmt.Sprintf("% X", info.ATS) != "75 77 81 02 80" {
+		t.Errorf("unexpected info: %+v", info)
+	}
+}
+
+func TestDriver_TargetInfo_ISO14443b(t *testing.T) {
+	driver := &Driver{
+		Modulation: nfc.Modulation{Type: nfc.ISO14443b},
+	}
+	m := driver.modulations()
+	if len(m) != 3 || m[0].Type != nfc.ISO14443b {
+		t.Error("unexpected modulations:", m)
+	}
+	driver.target = &nfc.ISO14443bTarget{
+		Pupi: [4]byte{0x01, 0x02, 0x03, 0x04},
+	}
+	info, err := driver.TargetInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprintf("% X", info.UID) != "01 02 03 04" || info.ATS != nil {
+		t.Errorf("unexpected info: %+v", info)
+	}
+}
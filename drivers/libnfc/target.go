@@ -0,0 +1,103 @@
+// +build !nolibnfc
+
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package libnfc
+
+import (
+	"github.com/clausecker/nfc/v2"
+	"github.com/hsanjuan/go-nfctype4/drivers/swtag"
+	"github.com/hsanjuan/go-nfctype4/tags"
+)
+
+// DefaultEmulatedTarget is the ISO14443A target presented to readers
+// by EmulateTag, unless Driver.EmulatedTarget is set.
+var DefaultEmulatedTarget = nfc.ISO14443aTarget{
+	Atqa:   [2]byte{0x00, 0x04},
+	Sak:    0x20, // ISO/IEC 14443-4 compliant
+	UIDLen: 4,
+	UID:    [10]byte{0x08, 0x00, 0xB0, 0x0B},
+}
+
+// maxEmulationFrame is the size of the buffers used to receive and
+// send frames in target mode.
+const maxEmulationFrame = 264
+
+// targetDevice is the part of a nfc.Device used in target mode.
+type targetDevice interface {
+	TargetInit(t nfc.Target, rx []byte, timeout int) (int, nfc.Target, error)
+	TargetSendBytes(tx []byte, timeout int) (int, error)
+	TargetReceiveBytes(rx []byte, timeout int) (int, error)
+}
+
+// EmulateTag sets up the libnfc device in Target mode, so that it
+// behaves like a tag, and answers the commands sent by a reader (for
+// example, a phone) using the given software Tag.
+//
+// It blocks until a reader selects the target and serves it until the
+// reader releases it, in which case it returns nil. To serve several
+// readers, call it in a loop. It returns an error when some step
+// fails.
+func (driver *Driver) EmulateTag(tag tags.Tag) error {
+	err := driver.open()
+	if err != nil {
+		return err
+	}
+	defer driver.Close()
+
+	target := driver.EmulatedTarget
+	if target == nil {
+		t := DefaultEmulatedTarget
+		target = &t
+	}
+	return emulate(*driver.device, target, tag)
+}
+
+// emulate runs the APDU loop of a tag emulated with the given device.
+func emulate(device targetDevice, target nfc.Target, tag tags.Tag) error {
+	rx := make([]byte, maxEmulationFrame)
+	n, _, err := device.TargetInit(target, rx, 0)
+	if err != nil {
+		return err
+	}
+	swDriver := &swtag.Driver{Tag: tag}
+	for {
+		tx, err := swDriver.TransceiveBytes(rx[:n], maxEmulationFrame)
+		if tx == nil || err != nil {
+			// Malformed command or no response: readers
+			// need an answer anyway.
+			tx = []byte{0x6F, 0x00}
+		}
+		if _, err := device.TargetSendBytes(tx, 0); err != nil {
+			return released(err)
+		}
+		n, err = device.TargetReceiveBytes(rx, 0)
+		if err != nil {
+			return released(err)
+		}
+	}
+}
+
+// released returns nil if the error signals that the reader released
+// the target, which is the normal end of the communication.
+func released(err error) error {
+	if nfcErr, ok := err.(nfc.Error); ok && nfcErr == nfc.ETGRELEASED {
+		return nil
+	}
+	return err
+}
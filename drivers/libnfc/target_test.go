@@ -0,0 +1,112 @@
+// +build !nolibnfc
+
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package libnfc
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/clausecker/nfc/v2"
+	"github.com/hsanjuan/go-ndef"
+	"github.com/hsanjuan/go-nfctype4"
+	"github.com/hsanjuan/go-nfctype4/drivers/swtag"
+	"github.com/hsanjuan/go-nfctype4/tags/static"
+)
+
+// fakeTarget is a targetDevice which plays the role of a reader by
+// sending the commands produced by a Device, and records the answers.
+type fakeTarget struct {
+	commands  [][]byte
+	responses [][]byte
+	err       error
+}
+
+func (ft *fakeTarget) TargetInit(t nfc.Target, rx []byte, timeout int) (int, nfc.Target, error) {
+	n, err := ft.TargetReceiveBytes(rx, timeout)
+	return n, t, err
+}
+
+func (ft *fakeTarget) TargetSendBytes(tx []byte, timeout int) (int, error) {
+	ft.responses = append(ft.responses, append([]byte{}, tx...))
+	return len(tx), nil
+}
+
+func (ft *fakeTarget) TargetReceiveBytes(rx []byte, timeout int) (int, error) {
+	if len(ft.commands) == 0 {
+		return 0, ft.err
+	}
+	n := copy(rx, ft.commands[0])
+	ft.commands = ft.commands[1:]
+	return n, nil
+}
+
+// recorder is a swtag Driver which records the exchanges.
+type recorder struct {
+	swtag.Driver
+	commands  [][]byte
+	responses [][]byte
+}
+
+func (r *recorder) TransceiveBytes(tx []byte, rxLen int) ([]byte, error) {
+	rx, err := r.Driver.TransceiveBytes(tx, rxLen)
+	r.commands = append(r.commands, tx)
+	r.responses = append(r.responses, rx)
+	return rx, err
+}
+
+func TestEmulate(t *testing.T) {
+	tag := static.New()
+	msg := ndef.NewTextMessage("emulated", "en")
+	tag.SetMessage(msg)
+
+	// Obtain the commands that a reader would send and the
+	// expected responses by reading the tag directly.
+	rec := &recorder{Driver: swtag.Driver{Tag: tag}}
+	if _, err := nfctype4.New(rec).Read(); err != nil {
+		t.Fatal(err)
+	}
+
+	ft := &fakeTarget{
+		commands: append(rec.commands, []byte{0x00}),
+		err:      nfc.Error(nfc.ETGRELEASED),
+	}
+	if err := emulate(ft, &DefaultEmulatedTarget, tag); err != nil {
+		t.Fatal(err)
+	}
+	if len(ft.responses) != len(rec.responses)+1 {
+		t.Fatal("unexpected number of responses:", len(ft.responses))
+	}
+	for i, r := range rec.responses {
+		if !bytes.Equal(r, ft.responses[i]) {
+			t.Errorf("response %d: expected % X but got % X",
+				i, r, ft.responses[i])
+		}
+	}
+	// The malformed command gets an error status
+	if !bytes.Equal(ft.responses[len(ft.responses)-1], []byte{0x6F, 0x00}) {
+		t.Error("malformed commands should be answered with 6F00h")
+	}
+
+	ft = &fakeTarget{err: errors.New("broken")}
+	if err := emulate(ft, &DefaultEmulatedTarget, tag); err == nil {
+		t.Error("expected an error")
+	}
+}
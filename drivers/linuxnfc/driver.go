@@ -0,0 +1,178 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+// Package linuxnfc provides a CommandDriver implementation which uses
+// the NFC subsystem of the Linux kernel, so that the NFC controllers
+// supported by the kernel (pn533, nxp-nci, st-nci...) work without
+// libnfc or PC/SC.
+//
+// The driver finds the device and polls for targets through the "nfc"
+// generic netlink family, and then exchanges the APDUs over a raw
+// AF_NFC socket connected to the target, with the kernel handling the
+// ISO-DEP protocol. The neard daemon, when running, may compete for
+// the device and should be stopped.
+package linuxnfc
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/hsanjuan/go-nfctype4"
+)
+
+// Common errors
+var (
+	ErrNoReadersDetected = errors.New("no NFC devices detected")
+	ErrNoTargetsDetected = errors.New("no targets detected")
+	ErrNotISODEP         = errors.New("the target does not support ISO-DEP")
+)
+
+// DefaultTimeout is the default time to wait for a target.
+const DefaultTimeout = 5 * time.Second
+
+// Driver implements the CommandDriver interface for the Linux kernel
+// NFC subsystem. It allows `Device` to communicate with the first
+// ISO/IEC 14443-4 (Type A or B) tag found by the NFC device.
+type Driver struct {
+	Device  string        // NFC device name, i.e. nfc0. Defaults to the first one
+	Timeout time.Duration // Time to wait for a target. Defaults to DefaultTimeout
+	// Conn, when set, is used to exchange frames with the target
+	// instead of polling with the kernel. It must behave like a raw
+	// NFC socket: the frames read are preceded by a header byte. It
+	// is not closed by Close.
+	Conn io.ReadWriteCloser
+	// Trace, when set, receives the bytes exchanged with the tag.
+	Trace nfctype4.Tracer
+
+	conn   io.ReadWriteCloser
+	device device
+	target target
+}
+
+// Initialize turns on the NFC device, waits for an ISO-DEP target
+// and connects to it.
+//
+// It returns ErrNoTargetsDetected if no target appears before the
+// timeout, or an error when some other step fails.
+func (driver *Driver) Initialize() error {
+	driver.Close()
+	if driver.Conn != nil {
+		driver.conn = driver.Conn
+		return nil
+	}
+	timeout := driver.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	conn, dev, tgt, err := openTarget(driver.Device, timeout)
+	if err != nil {
+		return err
+	}
+	driver.conn = conn
+	driver.device = dev
+	driver.target = tgt
+	return nil
+}
+
+// String returns information about the NFC device and the target.
+// It should be used after calling Initialize().
+func (driver *Driver) String() string {
+	str := fmt.Sprintf("Linux NFC Driver. Device: %s.\n", driver.device.name)
+	if driver.target.protocols != 0 {
+		str += fmt.Sprintf("Target index: %d. Protocols: %08xh\n",
+			driver.target.index, driver.target.protocols)
+		if driver.target.nfcid1 != nil {
+			str += fmt.Sprintf("Target UID: % 02x\n",
+				driver.target.nfcid1)
+		}
+	} else {
+		str += fmt.Sprintln("No target information.")
+	}
+	return str
+}
+
+// TargetInfo returns the UID, ATQA and SAK of a Type A target, or the
+// PUPI as UID of a Type B one. The ATS is not provided by the kernel.
+func (driver *Driver) TargetInfo() (nfctype4.TargetInfo, error) {
+	tgt := driver.target
+	if tgt.protocols == 0 {
+		return nfctype4.TargetInfo{}, errors.New("Driver.TargetInfo: " +
+			"no target information")
+	}
+	if tgt.protocol() == nfcProtoISO14443B {
+		// SENSB_RES: 50h, PUPI (4), ...
+		if len(tgt.sensbRes) < 5 {
+			return nfctype4.TargetInfo{}, nil
+		}
+		return nfctype4.TargetInfo{UID: tgt.sensbRes[1:5]}, nil
+	}
+	return nfctype4.TargetInfo{
+		UID:  tgt.nfcid1,
+		ATQA: [2]byte{byte(tgt.sensRes >> 8), byte(tgt.sensRes)},
+		SAK:  tgt.selRes,
+	}, nil
+}
+
+// TransceiveBytes sends the bytes to the target through the NFC
+// socket and returns the response.
+//
+// It returns an error if the kernel reports an error or if the
+// response is longer than rxLen.
+func (driver *Driver) TransceiveBytes(tx []byte, rxLen int) ([]byte, error) {
+	if driver.conn == nil {
+		return nil, errors.New("Driver.TransceiveBytes: " +
+			"Driver not initialized")
+	}
+	driver.Trace.Trace(true, tx)
+	if _, err := driver.conn.Write(tx); err != nil {
+		return nil, err
+	}
+	// One extra byte to detect responses longer than rxLen
+	buf := make([]byte, nfcHeaderLen+rxLen+1)
+	n, err := driver.conn.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+	if n < nfcHeaderLen {
+		return nil, errors.New("Driver.TransceiveBytes: " +
+			"empty frame received")
+	}
+	if buf[0] != 0 {
+		return nil, fmt.Errorf("Driver.TransceiveBytes: "+
+			"exchange failed with status %02xh", buf[0])
+	}
+	rx := buf[nfcHeaderLen:n]
+	driver.Trace.Trace(false, rx)
+	if len(rx) > rxLen {
+		return rx, errors.New("Driver.TransceiveBytes: " +
+			"The length of the response is larger than expected")
+	}
+	return rx, nil
+}
+
+// Close closes the NFC socket, which releases the target. Conn is
+// left open, as it belongs to the caller.
+func (driver *Driver) Close() {
+	if driver.conn != nil && driver.Conn == nil {
+		driver.conn.Close()
+	}
+	driver.conn = nil
+	driver.device = device{}
+	driver.target = target{}
+}
@@ -0,0 +1,141 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package linuxnfc
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/hsanjuan/go-ndef"
+	"github.com/hsanjuan/go-nfctype4"
+	"github.com/hsanjuan/go-nfctype4/drivers/swtag"
+	"github.com/hsanjuan/go-nfctype4/tags/static"
+)
+
+// fakeSocket behaves like a raw NFC socket connected to a software
+// tag.
+type fakeSocket struct {
+	tag    *swtag.Driver
+	status byte
+	frame  []byte
+}
+
+func (s *fakeSocket) Write(b []byte) (int, error) {
+	rx, err := s.tag.TransceiveBytes(b, 65538)
+	if err != nil {
+		return 0, err
+	}
+	s.frame = append([]byte{s.status}, rx...)
+	return len(b), nil
+}
+
+func (s *fakeSocket) Read(b []byte) (int, error) {
+	// Like SOCK_SEQPACKET, the rest of the frame is discarded
+	n := copy(b, s.frame)
+	s.frame = nil
+	return n, nil
+}
+
+func (s *fakeSocket) Close() error {
+	return nil
+}
+
+func TestDriver(t *testing.T) {
+	tag := static.New()
+	if err := tag.SetMaxDataLengths(0x0400, 0x0400); err != nil {
+		t.Fatal(err)
+	}
+	driver := &Driver{Conn: &fakeSocket{tag: &swtag.Driver{Tag: tag}}}
+	device := nfctype4.New(driver)
+
+	msg := ndef.NewTextMessage(strings.Repeat("kernel ", 100), "en")
+	if err := device.Update(msg); err != nil {
+		t.Fatal(err)
+	}
+	readMsg, err := device.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if readMsg.String() != msg.String() {
+		t.Error("unexpected message:", readMsg)
+	}
+}
+
+func TestDriver_TransceiveBytes(t *testing.T) {
+	sock := &fakeSocket{tag: &swtag.Driver{Tag: static.New()}}
+	driver := &Driver{Conn: sock}
+	if _, err := driver.TransceiveBytes([]byte{0x00}, 2); err == nil {
+		t.Error("TransceiveBytes should fail before Initialize")
+	}
+	if err := driver.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	defer driver.Close()
+
+	sel := []byte{0x00, 0xA4, 0x04, 0x00, 0x07,
+		0xD2, 0x76, 0x00, 0x00, 0x85, 0x01, 0x01, 0x00}
+	rx, err := driver.TransceiveBytes(sel, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(rx, []byte{0x90, 0x00}) {
+		t.Errorf("unexpected response: % 02x", rx)
+	}
+	if _, err := driver.TransceiveBytes(sel, 1); err == nil {
+		t.Error("expected an error for a long response")
+	}
+	sock.status = 0x01
+	if _, err := driver.TransceiveBytes(sel, 2); err == nil {
+		t.Error("expected an error for a failed exchange")
+	}
+}
+
+func TestDriver_TargetInfo(t *testing.T) {
+	driver := &Driver{}
+	if _, err := driver.TargetInfo(); err == nil {
+		t.Error("expected an error without target")
+	}
+
+	driver.target = target{
+		protocols: nfcProtoISO14443Mask,
+		sensRes:   0x0044,
+		selRes:    0x20,
+		nfcid1:    []byte{0x04, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06},
+	}
+	info, err := driver.TargetInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(info.UID, driver.target.nfcid1) ||
+		info.ATQA != [2]byte{0x00, 0x44} || info.SAK != 0x20 {
+		t.Errorf("unexpected target info: %+v", info)
+	}
+
+	driver.target = target{
+		protocols: nfcProtoISO14443BMask,
+		sensbRes:  []byte{0x50, 0xAA, 0xBB, 0xCC, 0xDD, 0x00},
+	}
+	info, err = driver.TargetInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(info.UID, []byte{0xAA, 0xBB, 0xCC, 0xDD}) {
+		t.Errorf("unexpected PUPI: % 02x", info.UID)
+	}
+}
@@ -0,0 +1,240 @@
+//go:build linux && !386
+
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package linuxnfc
+
+import (
+	"errors"
+	"io"
+	"os"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// netlinkConn is a generic netlink socket.
+type netlinkConn struct {
+	fd     int
+	seq    uint32
+	events []*message // Multicast messages received during requests
+}
+
+func dialNetlink() (*netlinkConn, error) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK,
+		syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, netlinkGeneric)
+	if err != nil {
+		return nil, err
+	}
+	err = syscall.Bind(fd, &syscall.SockaddrNetlink{
+		Family: syscall.AF_NETLINK,
+	})
+	if err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	return &netlinkConn{fd: fd}, nil
+}
+
+func (nl *netlinkConn) Close() error {
+	return syscall.Close(nl.fd)
+}
+
+// receive reads the messages available in the socket. It fails with
+// EAGAIN when the receive timeout expires.
+func (nl *netlinkConn) receive() ([]*message, error) {
+	buf := make([]byte, netlinkBufLen)
+	n, _, err := syscall.Recvfrom(nl.fd, buf, 0)
+	if err != nil {
+		return nil, err
+	}
+	return parseMessages(buf[:n])
+}
+
+// request sends a command and returns the attributes of the replies,
+// until the acknowledgement or the end of the dump.
+func (nl *netlinkConn) request(family, flags uint16, cmd byte, list ...attr) ([]attrs, error) {
+	nl.seq++
+	msg := &message{
+		typ:   family,
+		flags: nlmFRequest | nlmFAck | flags,
+		seq:   nl.seq,
+		cmd:   cmd,
+		attrs: list,
+	}
+	if err := syscall.Sendto(nl.fd, msg.marshal(), 0,
+		&syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		return nil, err
+	}
+
+	var replies []attrs
+	for {
+		msgs, err := nl.receive()
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range msgs {
+			if m.seq != nl.seq {
+				nl.events = append(nl.events, m)
+				continue
+			}
+			switch m.typ {
+			case nlmsgError:
+				if err := m.err(); err != nil {
+					return nil, err
+				}
+				return replies, nil
+			case nlmsgDone:
+				return replies, nil
+			}
+			_, a, err := m.genl()
+			if err != nil {
+				return nil, err
+			}
+			replies = append(replies, a)
+		}
+	}
+}
+
+// waitEvent waits until a multicast message with the given command
+// is received, or the timeout expires.
+func (nl *netlinkConn) waitEvent(cmd byte, timeout time.Duration) (attrs, error) {
+	tv := syscall.NsecToTimeval(timeout.Nanoseconds())
+	if err := syscall.SetsockoptTimeval(nl.fd, syscall.SOL_SOCKET,
+		syscall.SO_RCVTIMEO, &tv); err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		for len(nl.events) > 0 {
+			m := nl.events[0]
+			nl.events = nl.events[1:]
+			if c, a, err := m.genl(); err == nil && c == cmd {
+				return a, nil
+			}
+		}
+		if time.Now().After(deadline) {
+			return nil, syscall.EAGAIN
+		}
+		msgs, err := nl.receive()
+		if err != nil {
+			return nil, err
+		}
+		nl.events = append(nl.events, msgs...)
+	}
+}
+
+// openTarget polls with the given device (or the first one) for an
+// ISO-DEP target and connects a raw NFC socket to it.
+func openTarget(name string, timeout time.Duration) (io.ReadWriteCloser, device, target, error) {
+	nl, err := dialNetlink()
+	if err != nil {
+		return nil, device{}, target{}, err
+	}
+	defer nl.Close()
+
+	replies, err := nl.request(genlIDCtrl, 0, ctrlCmdGetFamily,
+		stringAttr(ctrlAttrFamilyName, nfcFamilyName))
+	if err != nil || len(replies) == 0 {
+		// The family is registered by the nfc module
+		return nil, device{}, target{}, ErrNoReadersDetected
+	}
+	family, group, err := parseFamily(replies[0], nfcEventsGroup)
+	if err != nil {
+		return nil, device{}, target{}, err
+	}
+
+	replies, err = nl.request(family, nlmFDump, nfcCmdGetDevice)
+	if err != nil {
+		return nil, device{}, target{}, err
+	}
+	var dev device
+	found := false
+	for _, a := range replies {
+		dev = parseDevice(a)
+		if name == "" || dev.name == name {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, device{}, target{}, ErrNoReadersDetected
+	}
+	devIndex := u32Attr(nfcAttrDeviceIndex, dev.index)
+
+	_, err = nl.request(family, 0, nfcCmdDevUp, devIndex)
+	if err != nil && err != syscall.EALREADY {
+		return nil, dev, target{}, err
+	}
+	if err := syscall.SetsockoptInt(nl.fd, solNetlink,
+		netlinkAddMembership, int(group)); err != nil {
+		return nil, dev, target{}, err
+	}
+	_, err = nl.request(family, 0, nfcCmdStartPoll, devIndex,
+		u32Attr(nfcAttrImProtocols, nfcProtoISO14443Mask|nfcProtoISO14443BMask))
+	if err != nil {
+		return nil, dev, target{}, err
+	}
+	if _, err := nl.waitEvent(nfcEventTargetsFound, timeout); err != nil {
+		nl.request(family, 0, nfcCmdStopPoll, devIndex)
+		if err == syscall.EAGAIN {
+			return nil, dev, target{}, ErrNoTargetsDetected
+		}
+		return nil, dev, target{}, err
+	}
+
+	replies, err = nl.request(family, nlmFDump, nfcCmdGetTarget, devIndex)
+	if err != nil {
+		return nil, dev, target{}, err
+	}
+	for _, a := range replies {
+		tgt := parseTarget(a)
+		if tgt.protocol() == 0 {
+			continue
+		}
+		conn, err := dialTarget(dev.index, tgt)
+		return conn, dev, tgt, err
+	}
+	return nil, dev, target{}, ErrNotISODEP
+}
+
+// dialTarget opens a raw NFC socket connected to the target.
+func dialTarget(devIndex uint32, tgt target) (io.ReadWriteCloser, error) {
+	fd, err := syscall.Socket(afNFC,
+		syscall.SOCK_SEQPACKET|syscall.SOCK_CLOEXEC, nfcSockProtoRaw)
+	if err != nil {
+		return nil, err
+	}
+	// struct sockaddr_nfc
+	var addr [sockaddrNFCLen]byte
+	nativeEndian.PutUint16(addr[0:], afNFC)
+	nativeEndian.PutUint32(addr[4:], devIndex)
+	nativeEndian.PutUint32(addr[8:], tgt.index)
+	nativeEndian.PutUint32(addr[12:], tgt.protocol())
+	_, _, errno := syscall.Syscall(syscall.SYS_CONNECT, uintptr(fd),
+		uintptr(unsafe.Pointer(&addr)), sockaddrNFCLen)
+	if errno != 0 {
+		syscall.Close(fd)
+		return nil, errno
+	}
+	f := os.NewFile(uintptr(fd), "nfc")
+	if f == nil {
+		return nil, errors.New("dialTarget: bad socket")
+	}
+	return f, nil
+}
@@ -0,0 +1,33 @@
+//go:build !linux || 386
+
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package linuxnfc
+
+import (
+	"errors"
+	"io"
+	"time"
+)
+
+// openTarget is not available on this system. The Conn field of the
+// Driver can be used instead.
+func openTarget(name string, timeout time.Duration) (io.ReadWriteCloser, device, target, error) {
+	return nil, device{}, target{}, errors.New("openTarget: " +
+		"the NFC subsystem is only available on Linux")
+}
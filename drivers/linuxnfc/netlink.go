@@ -0,0 +1,328 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package linuxnfc
+
+import (
+	"encoding/binary"
+	"errors"
+	"syscall"
+	"unsafe"
+)
+
+// Netlink and generic netlink constants (linux/netlink.h,
+// linux/genetlink.h).
+const (
+	netlinkGeneric       = 16
+	solNetlink           = 270
+	netlinkAddMembership = 1
+	netlinkBufLen        = 65536
+
+	nlmsgHdrLen = 16
+	genlHdrLen  = 4
+	nlaHdrLen   = 4
+	nlmsgError  = 2
+	nlmsgDone   = 3
+	nlmFRequest = 0x1
+	nlmFAck     = 0x4
+	nlmFDump    = 0x300
+	genlVersion = 1
+
+	genlIDCtrl          = 0x10
+	ctrlCmdGetFamily    = 3
+	ctrlAttrFamilyID    = 1
+	ctrlAttrFamilyName  = 2
+	ctrlAttrMcastGroups = 7
+	ctrlAttrMcastGrpNam = 1
+	ctrlAttrMcastGrpID  = 2
+)
+
+// NFC generic netlink family (linux/nfc.h).
+const (
+	nfcFamilyName  = "nfc"
+	nfcEventsGroup = "events"
+
+	nfcCmdGetDevice      = 1
+	nfcCmdDevUp          = 2
+	nfcCmdStartPoll      = 6
+	nfcCmdStopPoll       = 7
+	nfcCmdGetTarget      = 8
+	nfcEventTargetsFound = 9
+
+	nfcAttrDeviceIndex    = 1
+	nfcAttrDeviceName     = 2
+	nfcAttrProtocols      = 3
+	nfcAttrTargetIndex    = 4
+	nfcAttrTargetSensRes  = 5
+	nfcAttrTargetSelRes   = 6
+	nfcAttrTargetNFCID1   = 7
+	nfcAttrTargetSensbRes = 8
+	nfcAttrImProtocols    = 13
+
+	nfcProtoISO14443      = 4
+	nfcProtoISO14443B     = 6
+	nfcProtoISO14443Mask  = 1 << nfcProtoISO14443
+	nfcProtoISO14443BMask = 1 << nfcProtoISO14443B
+)
+
+// NFC sockets (linux/nfc.h). The frames read from raw sockets are
+// preceded by a header byte, which is 0 on success.
+const (
+	afNFC           = 39
+	nfcSockProtoRaw = 0
+	sockaddrNFCLen  = 16
+	nfcHeaderLen    = 1
+)
+
+// nativeEndian is the byte order of the integers in netlink messages.
+var nativeEndian binary.ByteOrder = binary.LittleEndian
+
+func init() {
+	x := uint16(1)
+	if *(*byte)(unsafe.Pointer(&x)) == 0 {
+		nativeEndian = binary.BigEndian
+	}
+}
+
+// attr is a netlink attribute.
+type attr struct {
+	typ  uint16
+	data []byte
+}
+
+func u32Attr(typ uint16, v uint32) attr {
+	data := make([]byte, 4)
+	nativeEndian.PutUint32(data, v)
+	return attr{typ, data}
+}
+
+func stringAttr(typ uint16, s string) attr {
+	return attr{typ, append([]byte(s), 0)}
+}
+
+// attrs maps attribute types to their data.
+type attrs map[uint16][]byte
+
+func (a attrs) u8(typ uint16) byte {
+	if len(a[typ]) < 1 {
+		return 0
+	}
+	return a[typ][0]
+}
+
+func (a attrs) u16(typ uint16) uint16 {
+	if len(a[typ]) < 2 {
+		return 0
+	}
+	return nativeEndian.Uint16(a[typ])
+}
+
+func (a attrs) u32(typ uint16) uint32 {
+	if len(a[typ]) < 4 {
+		return 0
+	}
+	return nativeEndian.Uint32(a[typ])
+}
+
+func (a attrs) string(typ uint16) string {
+	b := a[typ]
+	for i, c := range b {
+		if c == 0 {
+			return string(b[:i])
+		}
+	}
+	return string(b)
+}
+
+func align(n int) int {
+	return (n + 3) &^ 3
+}
+
+// marshalAttrs serializes the attributes, padding each of them to 4
+// bytes.
+func marshalAttrs(list []attr) []byte {
+	var buf []byte
+	for _, a := range list {
+		hdr := make([]byte, nlaHdrLen)
+		nativeEndian.PutUint16(hdr[0:], uint16(nlaHdrLen+len(a.data)))
+		nativeEndian.PutUint16(hdr[2:], a.typ)
+		buf = append(buf, hdr...)
+		buf = append(buf, a.data...)
+		buf = append(buf, make([]byte, align(len(a.data))-len(a.data))...)
+	}
+	return buf
+}
+
+// parseAttrs parses a sequence of attributes. The nested and byte
+// order flags are removed from the types.
+func parseAttrs(b []byte) (attrs, error) {
+	a := make(attrs)
+	for len(b) >= nlaHdrLen {
+		n := int(nativeEndian.Uint16(b[0:]))
+		typ := nativeEndian.Uint16(b[2:]) & 0x3FFF
+		if n < nlaHdrLen || n > len(b) {
+			return nil, errors.New("parseAttrs: malformed attribute")
+		}
+		a[typ] = b[nlaHdrLen:n]
+		if align(n) > len(b) {
+			break
+		}
+		b = b[align(n):]
+	}
+	return a, nil
+}
+
+// message is a generic netlink message.
+type message struct {
+	typ   uint16 // Family, or nlmsgError and nlmsgDone
+	flags uint16
+	seq   uint32
+	cmd   byte
+	attrs []attr
+	data  []byte // Payload after the netlink header
+}
+
+// marshal serializes the message with its generic netlink header.
+func (msg *message) marshal() []byte {
+	payload := append([]byte{msg.cmd, genlVersion, 0, 0},
+		marshalAttrs(msg.attrs)...)
+	buf := make([]byte, nlmsgHdrLen, nlmsgHdrLen+len(payload))
+	nativeEndian.PutUint32(buf[0:], uint32(nlmsgHdrLen+len(payload)))
+	nativeEndian.PutUint16(buf[4:], msg.typ)
+	nativeEndian.PutUint16(buf[6:], msg.flags)
+	nativeEndian.PutUint32(buf[8:], msg.seq)
+	return append(buf, payload...)
+}
+
+// genl returns the command and the attributes of a generic netlink
+// message.
+func (msg *message) genl() (byte, attrs, error) {
+	if len(msg.data) < genlHdrLen {
+		return 0, nil, errors.New("message.genl: message too short")
+	}
+	a, err := parseAttrs(msg.data[genlHdrLen:])
+	return msg.data[0], a, err
+}
+
+// err returns the error carried by an nlmsgError message, which is
+// nil for acknowledgements.
+func (msg *message) err() error {
+	if msg.typ != nlmsgError {
+		return nil
+	}
+	if len(msg.data) < 4 {
+		return errors.New("message.err: malformed error message")
+	}
+	if code := int32(nativeEndian.Uint32(msg.data)); code != 0 {
+		return syscall.Errno(-code)
+	}
+	return nil
+}
+
+// parseMessages splits a buffer read from a netlink socket in
+// messages.
+func parseMessages(b []byte) ([]*message, error) {
+	var msgs []*message
+	for len(b) >= nlmsgHdrLen {
+		n := int(nativeEndian.Uint32(b[0:]))
+		if n < nlmsgHdrLen || n > len(b) {
+			return nil, errors.New("parseMessages: malformed message")
+		}
+		msgs = append(msgs, &message{
+			typ:   nativeEndian.Uint16(b[4:]),
+			flags: nativeEndian.Uint16(b[6:]),
+			seq:   nativeEndian.Uint32(b[8:]),
+			data:  b[nlmsgHdrLen:n],
+		})
+		if align(n) > len(b) {
+			break
+		}
+		b = b[align(n):]
+	}
+	return msgs, nil
+}
+
+// parseFamily returns the id of a generic netlink family and the id
+// of the given multicast group from a CTRL_CMD_GETFAMILY reply.
+func parseFamily(a attrs, group string) (uint16, uint32, error) {
+	id := a.u16(ctrlAttrFamilyID)
+	if id == 0 {
+		return 0, 0, errors.New("parseFamily: no family id")
+	}
+	groups, err := parseAttrs(a[ctrlAttrMcastGroups])
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, g := range groups {
+		ga, err := parseAttrs(g)
+		if err != nil {
+			return 0, 0, err
+		}
+		if ga.string(ctrlAttrMcastGrpNam) == group {
+			return id, ga.u32(ctrlAttrMcastGrpID), nil
+		}
+	}
+	return 0, 0, errors.New("parseFamily: multicast group not found")
+}
+
+// device is an NFC device registered in the kernel.
+type device struct {
+	index     uint32
+	name      string
+	protocols uint32
+}
+
+func parseDevice(a attrs) device {
+	return device{
+		index:     a.u32(nfcAttrDeviceIndex),
+		name:      a.string(nfcAttrDeviceName),
+		protocols: a.u32(nfcAttrProtocols),
+	}
+}
+
+// target is a target found by an NFC device.
+type target struct {
+	index     uint32
+	protocols uint32
+	sensRes   uint16
+	selRes    byte
+	nfcid1    []byte
+	sensbRes  []byte
+}
+
+func parseTarget(a attrs) target {
+	return target{
+		index:     a.u32(nfcAttrTargetIndex),
+		protocols: a.u32(nfcAttrProtocols),
+		sensRes:   a.u16(nfcAttrTargetSensRes),
+		selRes:    a.u8(nfcAttrTargetSelRes),
+		nfcid1:    a[nfcAttrTargetNFCID1],
+		sensbRes:  a[nfcAttrTargetSensbRes],
+	}
+}
+
+// protocol returns the ISO-DEP protocol to use with the target, or 0
+// if it supports none.
+func (tgt target) protocol() uint32 {
+	switch {
+	case tgt.protocols&nfcProtoISO14443Mask != 0:
+		return nfcProtoISO14443
+	case tgt.protocols&nfcProtoISO14443BMask != 0:
+		return nfcProtoISO14443B
+	}
+	return 0
+}
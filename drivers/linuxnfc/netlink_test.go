@@ -0,0 +1,134 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package linuxnfc
+
+import (
+	"bytes"
+	"syscall"
+	"testing"
+)
+
+func TestMessage(t *testing.T) {
+	msg := &message{
+		typ:   0x1C,
+		flags: nlmFRequest,
+		seq:   7,
+		cmd:   nfcCmdGetTarget,
+		attrs: []attr{
+			u32Attr(nfcAttrDeviceIndex, 2),
+			{nfcAttrTargetNFCID1, []byte{0x01, 0x02, 0x03}},
+		},
+	}
+	b := msg.marshal()
+	if len(b)%4 != 0 {
+		t.Error("messages should be aligned to 4 bytes")
+	}
+	msgs, err := parseMessages(append(b, b...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 2 {
+		t.Fatal("expected 2 messages but got", len(msgs))
+	}
+	if msgs[1].typ != 0x1C || msgs[1].seq != 7 {
+		t.Error("unexpected header:", msgs[1])
+	}
+	cmd, a, err := msgs[1].genl()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cmd != nfcCmdGetTarget || a.u32(nfcAttrDeviceIndex) != 2 ||
+		!bytes.Equal(a[nfcAttrTargetNFCID1], []byte{0x01, 0x02, 0x03}) {
+		t.Errorf("unexpected message: %d %v", cmd, a)
+	}
+
+	if _, err := parseMessages(b[:20]); err == nil {
+		t.Error("expected an error for a truncated message")
+	}
+}
+
+func TestMessage_err(t *testing.T) {
+	ack := &message{typ: nlmsgError, data: make([]byte, 20)}
+	if err := ack.err(); err != nil {
+		t.Error("unexpected error:", err)
+	}
+	nack := &message{typ: nlmsgError, data: make([]byte, 20)}
+	code := -int32(syscall.EALREADY)
+	nativeEndian.PutUint32(nack.data, uint32(code))
+	if err := nack.err(); err != syscall.EALREADY {
+		t.Error("expected EALREADY but got:", err)
+	}
+}
+
+func TestParseFamily(t *testing.T) {
+	group := func(name string, id uint32) attr {
+		return attr{0, marshalAttrs([]attr{
+			stringAttr(ctrlAttrMcastGrpNam, name),
+			u32Attr(ctrlAttrMcastGrpID, id),
+		})}
+	}
+	id := make([]byte, 2)
+	nativeEndian.PutUint16(id, 0x1C)
+	a, err := parseAttrs(marshalAttrs([]attr{
+		{ctrlAttrFamilyID, id},
+		stringAttr(ctrlAttrFamilyName, nfcFamilyName),
+		{ctrlAttrMcastGroups, marshalAttrs([]attr{
+			group("other", 3),
+			group(nfcEventsGroup, 9),
+		})},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	family, groupID, err := parseFamily(a, nfcEventsGroup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if family != 0x1C || groupID != 9 {
+		t.Error("unexpected family and group:", family, groupID)
+	}
+	if _, _, err := parseFamily(a, "missing"); err == nil {
+		t.Error("expected an error for a missing group")
+	}
+}
+
+func TestParseTarget(t *testing.T) {
+	sensRes := make([]byte, 2)
+	nativeEndian.PutUint16(sensRes, 0x0004)
+	a, err := parseAttrs(marshalAttrs([]attr{
+		u32Attr(nfcAttrTargetIndex, 1),
+		u32Attr(nfcAttrProtocols, 1<<2|nfcProtoISO14443Mask),
+		{nfcAttrTargetSensRes, sensRes},
+		{nfcAttrTargetSelRes, []byte{0x20}},
+		{nfcAttrTargetNFCID1, []byte{0x01, 0x02, 0x03, 0x04}},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tgt := parseTarget(a)
+	if tgt.index != 1 || tgt.sensRes != 0x0004 || tgt.selRes != 0x20 ||
+		len(tgt.nfcid1) != 4 {
+		t.Errorf("unexpected target: %+v", tgt)
+	}
+	if tgt.protocol() != nfcProtoISO14443 {
+		t.Error("the target should use ISO14443")
+	}
+	if (target{protocols: 1 << 2}).protocol() != 0 {
+		t.Error("a MIFARE target does not support ISO-DEP")
+	}
+}
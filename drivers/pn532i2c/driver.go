@@ -0,0 +1,183 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+// Package pn532i2c provides a CommandDriver implementation which
+// talks directly to a NXP PN532 NFC controller connected to an I2C
+// bus, as usual in embedded boards like the Raspberry Pi, without the
+// need of libnfc.
+//
+// The driver uses the PN532 host protocol: it configures the SAM,
+// detects an ISO/IEC 14443-4 Type A target with InListPassiveTarget
+// and exchanges APDUs with it using InDataExchange.
+package pn532i2c
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/hsanjuan/go-nfctype4"
+	"github.com/hsanjuan/go-nfctype4/drivers/internal/pn532"
+)
+
+// Common errors
+var (
+	ErrNoTargetsDetected = pn532.ErrNoTargetsDetected
+	ErrNotISO14443_4     = pn532.ErrNotISO14443_4
+	ErrNotReady          = errors.New("the PN532 is not ready")
+)
+
+// Default values for the Driver configuration.
+const (
+	DefaultBus     = "/dev/i2c-1"
+	DefaultAddress = 0x24
+	DefaultTimeout = time.Second
+)
+
+// pollInterval is the time to wait between checks of the ready
+// status of the PN532.
+const pollInterval = 5 * time.Millisecond
+
+// statusReady is set in the status byte which precedes the frames
+// read from the PN532 when it has a frame ready.
+const statusReady = 0x01
+
+// Driver implements the CommandDriver interface for a PN532 connected
+// to an I2C bus. It allows `Device` to communicate with the first
+// ISO/IEC 14443-4 Type A tag found by the reader.
+//
+// The tag must be in the field of the reader when Initialize is
+// called.
+type Driver struct {
+	Bus     string        // I2C bus device. Defaults to DefaultBus
+	Address uint16        // Address of the PN532. Defaults to DefaultAddress
+	Timeout time.Duration // Time to wait for responses. Defaults to DefaultTimeout
+	// Conn, when set, is used to communicate with the PN532 instead
+	// of opening Bus. Every Write and Read call must perform a
+	// single I2C transaction. It is not closed by Close.
+	Conn io.ReadWriteCloser
+	// Trace, when set, receives the bytes exchanged with the tag.
+	Trace nfctype4.Tracer
+
+	conn  io.ReadWriteCloser
+	pn532 *pn532.PN532
+}
+
+// Initialize opens the I2C bus, configures the PN532 and selects the
+// first target available (or fails).
+//
+// It returns an error when some step fails.
+func (driver *Driver) Initialize() error {
+	conn := driver.Conn
+	if conn == nil {
+		bus := driver.Bus
+		if bus == "" {
+			bus = DefaultBus
+		}
+		address := driver.Address
+		if address == 0 {
+			address = DefaultAddress
+		}
+		var err error
+		conn, err = openI2C(bus, address)
+		if err != nil {
+			return err
+		}
+	}
+	driver.conn = conn
+
+	timeout := driver.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	driver.pn532 = pn532.New(&i2cConn{conn, timeout})
+	return driver.pn532.Setup()
+}
+
+// String returns information about the PN532 and the selected target.
+// It should be used after calling Initialize().
+func (driver *Driver) String() string {
+	str := fmt.Sprintf("PN532 I2C Driver. Bus: %s. Address: %02xh\n",
+		driver.Bus, driver.Address)
+	if driver.pn532 != nil {
+		str += driver.pn532.String()
+	}
+	return str
+}
+
+// TransceiveBytes sends the bytes to the target with InDataExchange
+// and returns the response. Data longer than what fits in a single
+// InDataExchange command is chained.
+//
+// It returns an error if the PN532 reports an error or if the
+// response is longer than rxLen.
+func (driver *Driver) TransceiveBytes(tx []byte, rxLen int) ([]byte, error) {
+	if driver.conn == nil {
+		return nil, errors.New("Driver.TransceiveBytes: " +
+			"Driver not initialized")
+	}
+	driver.Trace.Trace(true, tx)
+	rx, err := driver.pn532.TransceiveBytes(tx, rxLen)
+	if err != nil {
+		return nil, err
+	}
+	driver.Trace.Trace(false, rx)
+	return rx, nil
+}
+
+// Close closes the I2C bus. Conn is left open, as it belongs to the
+// caller.
+func (driver *Driver) Close() {
+	if driver.conn != nil && driver.Conn == nil {
+		driver.conn.Close()
+	}
+	driver.conn = nil
+}
+
+// i2cConn implements pn532.Conn over I2C. Every read from the PN532
+// starts with a status byte which indicates whether a frame is ready.
+type i2cConn struct {
+	io.ReadWriter
+	timeout time.Duration
+}
+
+// NextFrame waits until the PN532 has a frame ready and reads it.
+func (conn *i2cConn) NextFrame() (io.Reader, error) {
+	deadline := time.Now().Add(conn.timeout)
+	status := make([]byte, 1)
+	for {
+		if _, err := conn.Read(status); err != nil {
+			return nil, err
+		}
+		if status[0]&statusReady != 0 {
+			buf := make([]byte, 1+pn532.MaxFrameLen)
+			n, err := conn.Read(buf)
+			if err != nil {
+				return nil, err
+			}
+			if n > 0 && buf[0]&statusReady != 0 {
+				return bytes.NewReader(buf[1:n]), nil
+			}
+		}
+		if time.Now().After(deadline) {
+			return nil, ErrNotReady
+		}
+		time.Sleep(pollInterval)
+	}
+}
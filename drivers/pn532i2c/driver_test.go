@@ -0,0 +1,126 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package pn532i2c
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hsanjuan/go-ndef"
+	"github.com/hsanjuan/go-nfctype4"
+	"github.com/hsanjuan/go-nfctype4/drivers/internal/pn532"
+	"github.com/hsanjuan/go-nfctype4/drivers/internal/pn532/pn532test"
+	"github.com/hsanjuan/go-nfctype4/tags"
+	"github.com/hsanjuan/go-nfctype4/tags/static"
+)
+
+// fakeI2C emulates a PN532 attached to an I2C bus. Every frame is
+// only ready after the status has been polled once.
+type fakeI2C struct {
+	emu     *pn532test.Emulator
+	pending [][]byte
+	polled  bool
+	silent  bool // never ready
+}
+
+func newFakeI2C(target []byte, tag tags.Tag) *fakeI2C {
+	return &fakeI2C{
+		emu: &pn532test.Emulator{Target: target, Tag: tag},
+	}
+}
+
+func (fake *fakeI2C) Write(p []byte) (int, error) {
+	data, _, err := pn532.ReadFrame(bytes.NewReader(p))
+	if err != nil {
+		return 0, err
+	}
+	fake.pending = append(fake.pending, pn532.AckFrame,
+		pn532.MarshalFrame(fake.emu.Handle(data)))
+	return len(p), nil
+}
+
+func (fake *fakeI2C) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	if fake.silent || len(fake.pending) == 0 || !fake.polled {
+		fake.polled = true
+		return len(p), nil
+	}
+	p[0] = statusReady
+	copy(p[1:], fake.pending[0])
+	if len(p) > 1 {
+		fake.pending = fake.pending[1:]
+		fake.polled = false
+	}
+	return len(p), nil
+}
+
+func (fake *fakeI2C) Close() error {
+	return nil
+}
+
+func TestDriver(t *testing.T) {
+	tag := static.New()
+	if err := tag.SetMaxDataLengths(0x0400, 0x0400); err != nil {
+		t.Fatal(err)
+	}
+	driver := &Driver{Conn: newFakeI2C(pn532test.ISOTarget, tag)}
+	device := nfctype4.New(driver)
+
+	msg := ndef.NewTextMessage(strings.Repeat("pn532 ", 100), "en")
+	if err := device.Update(msg); err != nil {
+		t.Fatal(err)
+	}
+	readMsg, err := device.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if readMsg.String() != msg.String() {
+		t.Error("unexpected message:", readMsg)
+	}
+	if !strings.Contains(driver.String(), "01 02 03 04") {
+		t.Error("String should include the target UID")
+	}
+}
+
+func TestDriver_Initialize(t *testing.T) {
+	driver := &Driver{Conn: newFakeI2C(pn532test.NoTarget, static.New())}
+	if err := driver.Initialize(); err != ErrNoTargetsDetected {
+		t.Error("expected ErrNoTargetsDetected but got:", err)
+	}
+
+	driver = &Driver{Conn: newFakeI2C(pn532test.MifareTarget, static.New())}
+	if err := driver.Initialize(); err != ErrNotISO14443_4 {
+		t.Error("expected ErrNotISO14443_4 but got:", err)
+	}
+
+	fake := newFakeI2C(pn532test.ISOTarget, static.New())
+	fake.silent = true
+	driver = &Driver{Conn: fake, Timeout: 20 * time.Millisecond}
+	if err := driver.Initialize(); err != ErrNotReady {
+		t.Error("expected ErrNotReady but got:", err)
+	}
+
+	driver = &Driver{}
+	if _, err := driver.TransceiveBytes([]byte{0x00}, 2); err == nil {
+		t.Error("TransceiveBytes should fail before Initialize")
+	}
+}
@@ -0,0 +1,48 @@
+//go:build linux
+
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package pn532i2c
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+)
+
+// i2cSlave is the ioctl request to set the address of the device in
+// the I2C bus.
+const i2cSlave = 0x0703
+
+// openI2C opens an I2C bus and sets the address of the device used
+// for further reads and writes.
+func openI2C(bus string, address uint16) (io.ReadWriteCloser, error) {
+	f, err := os.OpenFile(bus, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(),
+		i2cSlave, uintptr(address))
+	if errno != 0 {
+		f.Close()
+		return nil, fmt.Errorf("openI2C: cannot set address %02xh: %s",
+			address, errno)
+	}
+	return f, nil
+}
@@ -0,0 +1,31 @@
+//go:build !linux
+
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package pn532i2c
+
+import (
+	"errors"
+	"io"
+)
+
+// openI2C is only implemented on Linux. Other systems can use the
+// Conn field of the Driver.
+func openI2C(bus string, address uint16) (io.ReadWriteCloser, error) {
+	return nil, errors.New("openI2C: I2C is only supported on Linux")
+}
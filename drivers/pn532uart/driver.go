@@ -0,0 +1,154 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+// Package pn532uart provides a CommandDriver implementation which
+// talks directly to a NXP PN532 NFC controller connected through a
+// serial port (HSU/UART), without the need of libnfc.
+//
+// The driver uses the PN532 host protocol: it configures the SAM,
+// detects an ISO/IEC 14443-4 Type A target with InListPassiveTarget
+// and exchanges APDUs with it using InDataExchange.
+package pn532uart
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/hsanjuan/go-nfctype4"
+	"github.com/hsanjuan/go-nfctype4/drivers/internal/pn532"
+	"github.com/hsanjuan/go-nfctype4/drivers/internal/serial"
+)
+
+// Common errors
+var (
+	ErrNoTargetsDetected = pn532.ErrNoTargetsDetected
+	ErrNotISO14443_4     = pn532.ErrNotISO14443_4
+)
+
+// Default values for the Driver configuration.
+const (
+	DefaultBaudRate = 115200
+	DefaultTimeout  = time.Second
+)
+
+// wakeUp is sent before the first command to bring the PN532 out of
+// its low power mode.
+var wakeUp = []byte{0x55, 0x55, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
+
+// Driver implements the CommandDriver interface for a PN532 connected
+// to a serial port. It allows `Device` to communicate with the first
+// ISO/IEC 14443-4 Type A tag found by the reader.
+//
+// The tag must be in the field of the reader when Initialize is
+// called.
+type Driver struct {
+	Port     string        // Serial port, i.e. /dev/ttyUSB0
+	BaudRate int           // Defaults to DefaultBaudRate
+	Timeout  time.Duration // Defaults to DefaultTimeout
+	// Conn, when set, is used to communicate with the PN532 instead
+	// of opening Port. It allows to use other kinds of links. It is
+	// not closed by Close.
+	Conn io.ReadWriteCloser
+	// Trace, when set, receives the bytes exchanged with the tag.
+	Trace nfctype4.Tracer
+
+	conn  io.ReadWriteCloser
+	pn532 *pn532.PN532
+}
+
+// Initialize opens the serial port, wakes up the PN532, configures
+// it and selects the first target available (or fails).
+//
+// It returns an error when some step fails.
+func (driver *Driver) Initialize() error {
+	conn := driver.Conn
+	if conn == nil {
+		baudRate := driver.BaudRate
+		if baudRate == 0 {
+			baudRate = DefaultBaudRate
+		}
+		timeout := driver.Timeout
+		if timeout == 0 {
+			timeout = DefaultTimeout
+		}
+		var err error
+		conn, err = serial.Open(driver.Port, baudRate, timeout)
+		if err != nil {
+			return err
+		}
+	}
+	driver.conn = conn
+
+	if _, err := driver.conn.Write(wakeUp); err != nil {
+		return err
+	}
+	driver.pn532 = pn532.New(&uartConn{conn})
+	return driver.pn532.Setup()
+}
+
+// String returns information about the PN532 and the selected target.
+// It should be used after calling Initialize().
+func (driver *Driver) String() string {
+	str := fmt.Sprintf("PN532 UART Driver. Port: %s\n", driver.Port)
+	if driver.pn532 != nil {
+		str += driver.pn532.String()
+	}
+	return str
+}
+
+// TransceiveBytes sends the bytes to the target with InDataExchange
+// and returns the response. Data longer than what fits in a single
+// InDataExchange command is chained.
+//
+// It returns an error if the PN532 reports an error or if the
+// response is longer than rxLen.
+func (driver *Driver) TransceiveBytes(tx []byte, rxLen int) ([]byte, error) {
+	if driver.conn == nil {
+		return nil, errors.New("Driver.TransceiveBytes: " +
+			"Driver not initialized")
+	}
+	driver.Trace.Trace(true, tx)
+	rx, err := driver.pn532.TransceiveBytes(tx, rxLen)
+	if err != nil {
+		return nil, err
+	}
+	driver.Trace.Trace(false, rx)
+	return rx, nil
+}
+
+// Close closes the serial port. Conn is left open, as it belongs to
+// the caller.
+func (driver *Driver) Close() {
+	if driver.conn != nil && driver.Conn == nil {
+		driver.conn.Close()
+	}
+	driver.conn = nil
+}
+
+// uartConn implements pn532.Conn over a serial link, where the frames
+// are received as a stream.
+type uartConn struct {
+	io.ReadWriter
+}
+
+// NextFrame returns the serial link itself.
+func (conn *uartConn) NextFrame() (io.Reader, error) {
+	return conn.ReadWriter, nil
+}
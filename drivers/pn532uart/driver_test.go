@@ -0,0 +1,101 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package pn532uart
+
+import (
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/hsanjuan/go-ndef"
+	"github.com/hsanjuan/go-nfctype4"
+	"github.com/hsanjuan/go-nfctype4/drivers/internal/pn532"
+	"github.com/hsanjuan/go-nfctype4/drivers/internal/pn532/pn532test"
+	"github.com/hsanjuan/go-nfctype4/tags"
+	"github.com/hsanjuan/go-nfctype4/tags/static"
+)
+
+// newFakePN532 returns a link with an emulated PN532 with the given
+// tag in its field.
+func newFakePN532(t *testing.T, target []byte, tag tags.Tag) io.ReadWriteCloser {
+	hostConn, pn532Conn := net.Pipe()
+	emu := &pn532test.Emulator{Target: target, Tag: tag}
+	go func() {
+		for {
+			data, ack, err := pn532.ReadFrame(pn532Conn)
+			if err != nil {
+				return
+			}
+			if ack {
+				t.Error("unexpected ACK from the host")
+				return
+			}
+			pn532Conn.Write(pn532.AckFrame)
+			pn532Conn.Write(pn532.MarshalFrame(emu.Handle(data)))
+		}
+	}()
+	return hostConn
+}
+
+func TestDriver(t *testing.T) {
+	tag := static.New()
+	if err := tag.SetMaxDataLengths(0x0400, 0x0400); err != nil {
+		t.Fatal(err)
+	}
+	conn := newFakePN532(t, pn532test.ISOTarget, tag)
+	defer conn.Close()
+	driver := &Driver{Conn: conn}
+	device := nfctype4.New(driver)
+
+	msg := ndef.NewTextMessage(strings.Repeat("pn532 ", 100), "en")
+	if err := device.Update(msg); err != nil {
+		t.Fatal(err)
+	}
+	readMsg, err := device.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if readMsg.String() != msg.String() {
+		t.Error("unexpected message:", readMsg)
+	}
+	if !strings.Contains(driver.String(), "01 02 03 04") {
+		t.Error("String should include the target UID")
+	}
+}
+
+func TestDriver_Initialize(t *testing.T) {
+	conn := newFakePN532(t, pn532test.NoTarget, static.New())
+	driver := &Driver{Conn: conn}
+	if err := driver.Initialize(); err != ErrNoTargetsDetected {
+		t.Error("expected ErrNoTargetsDetected but got:", err)
+	}
+	conn.Close()
+
+	conn = newFakePN532(t, pn532test.MifareTarget, static.New())
+	driver = &Driver{Conn: conn}
+	if err := driver.Initialize(); err != ErrNotISO14443_4 {
+		t.Error("expected ErrNotISO14443_4 but got:", err)
+	}
+	conn.Close()
+
+	driver = &Driver{}
+	if _, err := driver.TransceiveBytes([]byte{0x00}, 2); err == nil {
+		t.Error("TransceiveBytes should fail before Initialize")
+	}
+}
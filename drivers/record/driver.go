@@ -0,0 +1,158 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package record
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/hsanjuan/go-nfctype4"
+)
+
+// Recorder implements the CommandDriver interface by wrapping another
+// driver and writing every exchange performed with it to Output.
+type Recorder struct {
+	Driver nfctype4.CommandDriver
+	Output io.Writer
+
+	mux sync.Mutex
+}
+
+// NewRecorder returns a new *Recorder which records the exchanges
+// performed with the given driver to w.
+func NewRecorder(driver nfctype4.CommandDriver, w io.Writer) *Recorder {
+	return &Recorder{
+		Driver: driver,
+		Output: w,
+	}
+}
+
+// Initialize initializes the wrapped driver.
+func (rec *Recorder) Initialize() error {
+	return rec.Driver.Initialize()
+}
+
+// String returns information about this driver.
+func (rec *Recorder) String() string {
+	return fmt.Sprintf("Recorder driver. Wrapping: %s", rec.Driver)
+}
+
+// TransceiveBytes performs the exchange with the wrapped driver and
+// records it. It returns an error when the wrapped driver fails or
+// when the entry cannot be written to Output.
+func (rec *Recorder) TransceiveBytes(tx []byte, rxLen int) ([]byte, error) {
+	rx, err := rec.Driver.TransceiveBytes(tx, rxLen)
+	e := Entry{
+		Time: time.Now(),
+		TX:   tx,
+		RX:   rx,
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	line, mErr := json.Marshal(e)
+	if mErr != nil {
+		return nil, mErr
+	}
+	rec.mux.Lock()
+	defer rec.mux.Unlock()
+	if _, wErr := rec.Output.Write(append(line, '\n')); wErr != nil {
+		return nil, wErr
+	}
+	return rx, err
+}
+
+// Close closes the wrapped driver.
+func (rec *Recorder) Close() {
+	rec.Driver.Close()
+}
+
+// Replayer implements the CommandDriver interface by serving the
+// responses recorded in a transcript, in order. It checks that the
+// bytes sent match the recorded ones, so that any change in the
+// communication with the tag is detected.
+type Replayer struct {
+	Entries []Entry
+	Pos     int // Index of the next Entry to replay
+}
+
+// NewReplayer returns a new *Replayer for the given entries.
+func NewReplayer(entries []Entry) *Replayer {
+	return &Replayer{
+		Entries: entries,
+	}
+}
+
+// NewReplayerFromTranscript returns a new *Replayer for the
+// transcript read from r. It returns an error if the transcript
+// cannot be parsed.
+func NewReplayerFromTranscript(r io.Reader) (*Replayer, error) {
+	entries, err := ReadTranscript(r)
+	if err != nil {
+		return nil, err
+	}
+	return NewReplayer(entries), nil
+}
+
+// Initialize does nothing.
+func (rep *Replayer) Initialize() error {
+	return nil
+}
+
+// String returns information about this driver.
+func (rep *Replayer) String() string {
+	return fmt.Sprintf("Replayer driver. Entry %d of %d.",
+		rep.Pos, len(rep.Entries))
+}
+
+// TransceiveBytes returns the response (or the error) of the next
+// recorded entry.
+//
+// It returns an error if all entries have been replayed already or if
+// the bytes sent are not the recorded ones.
+func (rep *Replayer) TransceiveBytes(tx []byte, rxLen int) ([]byte, error) {
+	if rep.Pos >= len(rep.Entries) {
+		return nil, fmt.Errorf("Replayer.TransceiveBytes: "+
+			"no entries left (index %d)", rep.Pos)
+	}
+	e := rep.Entries[rep.Pos]
+	if !bytes.Equal(e.TX, tx) {
+		return nil, fmt.Errorf("Replayer.TransceiveBytes: "+
+			"entry %d expected % X but got % X", rep.Pos, e.TX, tx)
+	}
+	rep.Pos++
+	if e.Error != "" {
+		return nil, errors.New(e.Error)
+	}
+	return e.RX, nil
+}
+
+// Close does nothing.
+func (rep *Replayer) Close() {
+	return
+}
+
+// Done returns true when all the entries have been replayed.
+func (rep *Replayer) Done() bool {
+	return rep.Pos >= len(rep.Entries)
+}
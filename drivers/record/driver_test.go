@@ -0,0 +1,104 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package record
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/hsanjuan/go-ndef"
+	"github.com/hsanjuan/go-nfctype4"
+	"github.com/hsanjuan/go-nfctype4/drivers/swtag"
+	"github.com/hsanjuan/go-nfctype4/tags/static"
+)
+
+type failingDriver struct {
+	swtag.Driver
+}
+
+func (driver *failingDriver) TransceiveBytes(tx []byte, rxLen int) ([]byte, error) {
+	return nil, errors.New("tag lost")
+}
+
+func TestRecordReplay(t *testing.T) {
+	tag := static.New()
+	msg := ndef.NewTextMessage(strings.Repeat("recorded ", 30), "en")
+	tag.SetMessage(msg)
+
+	var transcript bytes.Buffer
+	rec := NewRecorder(&swtag.Driver{Tag: tag}, &transcript)
+	readMsg, err := nfctype4.New(rec).Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if readMsg.String() != msg.String() {
+		t.Fatal("unexpected message:", readMsg)
+	}
+
+	rep, err := NewReplayerFromTranscript(&transcript)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rep.Entries) == 0 || rep.Entries[0].Time.IsZero() {
+		t.Fatal("entries not recorded correctly")
+	}
+	readMsg, err = nfctype4.New(rep).Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if readMsg.String() != msg.String() {
+		t.Error("unexpected replayed message:", readMsg)
+	}
+	if !rep.Done() {
+		t.Error("all entries should have been replayed")
+	}
+	_ = rep.String()
+	_ = rec.String()
+
+	// Replaying a different communication fails
+	rep.Pos = 0
+	if err := nfctype4.New(rep).Update(msg); err == nil {
+		t.Error("replaying an update should fail")
+	}
+	if _, err := rep.TransceiveBytes(nil, 2); err == nil {
+		t.Error("replaying past the end should fail")
+	}
+}
+
+func TestRecordReplay_errors(t *testing.T) {
+	var transcript bytes.Buffer
+	rec := NewRecorder(&failingDriver{}, &transcript)
+	if _, err := rec.TransceiveBytes([]byte{0x00, 0xA4}, 2); err == nil {
+		t.Fatal("expected an error")
+	}
+	rep, err := NewReplayerFromTranscript(&transcript)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = rep.TransceiveBytes([]byte{0x00, 0xA4}, 2)
+	if err == nil || err.Error() != "tag lost" {
+		t.Error("expected the recorded error but got:", err)
+	}
+
+	_, err = ReadTranscript(strings.NewReader("\n{\"tx\": \"ZZ\"}\n"))
+	if err == nil || !strings.HasPrefix(err.Error(), "ReadTranscript: line 2") {
+		t.Error("expected a parsing error but got:", err)
+	}
+}
@@ -0,0 +1,116 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+// Package record provides CommandDriver decorators to record the
+// communication with a tag into a transcript and to replay it later.
+//
+// This allows to turn interactions with real tags into reproducible
+// regression tests: the Recorder wraps the driver for a real reader
+// and writes every exchange to a file, and the Replayer serves the
+// recorded responses, checking that the same bytes are sent.
+//
+// Transcripts are written as JSON lines, one Entry per line.
+package record
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Entry is a single exchange with the tag: the bytes sent, the bytes
+// received (or the error obtained) and when it happened.
+type Entry struct {
+	Time  time.Time
+	TX    []byte
+	RX    []byte
+	Error string
+}
+
+// entryJSON is the JSON representation of an Entry, with the bytes
+// hex-encoded.
+type entryJSON struct {
+	Time  time.Time `json:"time"`
+	TX    string    `json:"tx"`
+	RX    string    `json:"rx,omitempty"`
+	Error string    `json:"error,omitempty"`
+}
+
+// MarshalJSON returns the JSON representation of the Entry, where the
+// bytes are hex-encoded.
+func (e Entry) MarshalJSON() ([]byte, error) {
+	return json.Marshal(entryJSON{
+		Time:  e.Time,
+		TX:    strings.ToUpper(hex.EncodeToString(e.TX)),
+		RX:    strings.ToUpper(hex.EncodeToString(e.RX)),
+		Error: e.Error,
+	})
+}
+
+// UnmarshalJSON parses the JSON representation of an Entry, as
+// produced by MarshalJSON.
+func (e *Entry) UnmarshalJSON(buf []byte) error {
+	var j entryJSON
+	if err := json.Unmarshal(buf, &j); err != nil {
+		return err
+	}
+	tx, err := hex.DecodeString(j.TX)
+	if err != nil {
+		return fmt.Errorf("Entry: bad hex value for tx: %s", err)
+	}
+	rx, err := hex.DecodeString(j.RX)
+	if err != nil {
+		return fmt.Errorf("Entry: bad hex value for rx: %s", err)
+	}
+	*e = Entry{
+		Time:  j.Time,
+		TX:    tx,
+		RX:    rx,
+		Error: j.Error,
+	}
+	return nil
+}
+
+// ReadTranscript parses a transcript written by a Recorder. Empty
+// lines are ignored.
+func ReadTranscript(r io.Reader) ([]Entry, error) {
+	var entries []Entry
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal([]byte(text), &e); err != nil {
+			return nil, fmt.Errorf("ReadTranscript: line %d: %s",
+				line, err)
+		}
+		entries = append(entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
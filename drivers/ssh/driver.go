@@ -0,0 +1,240 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+// Package ssh provides a CommandDriver implementation which reaches a
+// reader attached to a remote machine through SSH. It is handy to
+// debug readers connected to headless boxes.
+//
+// The driver runs the ssh client of the system, so the usual
+// configuration (keys, agent, known hosts, jump hosts...) applies. By
+// default, it opens a tunnel (ssh -W) to a tcp.Server listening on
+// the remote machine and uses the tcp driver protocol through it.
+// Alternatively, it can launch a remote agent command which speaks
+// the same protocol on its standard input and output, for example,
+// a program calling tcp.Server.ServeConn with them.
+package ssh
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hsanjuan/go-nfctype4"
+	"github.com/hsanjuan/go-nfctype4/drivers/tcp"
+)
+
+// Default values for the Driver configuration.
+const (
+	DefaultAddress = "localhost:4444"
+	DefaultSSH     = "ssh"
+)
+
+// maxStderr limits the output of ssh kept to report errors.
+const maxStderr = 4096
+
+// Driver implements the CommandDriver interface forwarding the bytes
+// through SSH to a remote tcp.Server or agent.
+type Driver struct {
+	Host string // SSH destination, i.e. "pi@raspberrypi"
+	// Address of the tcp.Server, as seen from the remote machine.
+	// Defaults to DefaultAddress.
+	Address string
+	// Command, when set, is run on the remote machine instead of
+	// opening a tunnel to Address. It must speak the tcp driver
+	// protocol on its standard input and output.
+	Command string
+	SSH     string   // ssh client to run. Defaults to DefaultSSH
+	Args    []string // Extra arguments for ssh, i.e. "-p", "2222"
+	// Timeout is the time to wait for the remote side to initialize
+	// its driver. Defaults to tcp.DefaultTimeout.
+	Timeout time.Duration
+	// Trace, when set, receives the bytes exchanged with the tag.
+	Trace nfctype4.Tracer
+
+	conn   *cmdConn
+	remote *tcp.Driver
+}
+
+// Initialize starts ssh and waits for the remote side to initialize
+// its driver.
+//
+// It returns an error, including the output of ssh, if the connection
+// fails or if the remote driver cannot be initialized.
+func (driver *Driver) Initialize() error {
+	driver.Close()
+	if driver.Host == "" {
+		return errors.New("Driver.Initialize: no Host set")
+	}
+	conn, err := startSSH(driver.SSH, driver.args())
+	if err != nil {
+		return err
+	}
+	driver.conn = conn
+
+	timeout := driver.Timeout
+	if timeout == 0 {
+		timeout = tcp.DefaultTimeout
+	}
+	driver.remote = &tcp.Driver{Conn: conn}
+	errCh := make(chan error, 1)
+	go func() { errCh <- driver.remote.Initialize() }()
+	select {
+	case err = <-errCh:
+	case <-time.After(timeout):
+		err = errors.New("timeout")
+	}
+	if err != nil {
+		// Once ssh has exited, all its output is in the buffer
+		driver.Close()
+		stderr := conn.stderr()
+		if stderr != "" {
+			return fmt.Errorf("Driver.Initialize: %s (ssh: %s)",
+				err, stderr)
+		}
+		return fmt.Errorf("Driver.Initialize: %s", err)
+	}
+	return nil
+}
+
+// args returns the arguments for ssh.
+func (driver *Driver) args() []string {
+	args := append([]string{}, driver.Args...)
+	if driver.Command != "" {
+		// Avoid a terminal, which would mangle the binary data
+		return append(args, "-T", "--", driver.Host, driver.Command)
+	}
+	address := driver.Address
+	if address == "" {
+		address = DefaultAddress
+	}
+	return append(args, "-W", address, "--", driver.Host)
+}
+
+// String returns information about this driver.
+func (driver *Driver) String() string {
+	str := fmt.Sprintf("SSH Driver. Host: %s. ", driver.Host)
+	if driver.conn == nil {
+		str += "Not connected."
+	} else {
+		str += "Connected."
+	}
+	return str
+}
+
+// TransceiveBytes sends the bytes to the remote side and returns the
+// bytes received by it from the tag.
+//
+// It returns an error if the Driver is not connected, if the
+// communication fails or if the remote driver returns an error.
+func (driver *Driver) TransceiveBytes(tx []byte, rxLen int) ([]byte, error) {
+	if driver.remote == nil {
+		return nil, errors.New("Driver.TransceiveBytes: " +
+			"Driver not initialized")
+	}
+	driver.Trace.Trace(true, tx)
+	rx, err := driver.remote.TransceiveBytes(tx, rxLen)
+	if err != nil {
+		return nil, err
+	}
+	driver.Trace.Trace(false, rx)
+	return rx, nil
+}
+
+// Close ends the ssh session, which closes the remote driver.
+func (driver *Driver) Close() {
+	if driver.conn != nil {
+		driver.conn.Close()
+	}
+	driver.conn = nil
+	driver.remote = nil
+}
+
+// cmdConn is a connection through the standard input and output of
+// a command.
+type cmdConn struct {
+	io.Reader
+	io.WriteCloser
+	cmd    *exec.Cmd
+	errBuf *limitedBuffer
+}
+
+func startSSH(ssh string, args []string) (*cmdConn, error) {
+	if ssh == "" {
+		ssh = DefaultSSH
+	}
+	conn := &cmdConn{
+		cmd:    exec.Command(ssh, args...),
+		errBuf: &limitedBuffer{},
+	}
+	var err error
+	conn.Reader, err = conn.cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	conn.WriteCloser, err = conn.cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	conn.cmd.Stderr = conn.errBuf
+	if err := conn.cmd.Start(); err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+// stderr returns the beginning of the standard error of the command.
+func (conn *cmdConn) stderr() string {
+	return strings.TrimSpace(conn.errBuf.String())
+}
+
+// Close closes the standard input, which ends the session, and stops
+// the command.
+func (conn *cmdConn) Close() error {
+	conn.WriteCloser.Close()
+	conn.cmd.Process.Kill()
+	conn.cmd.Wait()
+	return nil
+}
+
+// limitedBuffer keeps the first maxStderr bytes written to it.
+type limitedBuffer struct {
+	mux sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	if room := maxStderr - b.buf.Len(); room > 0 {
+		if len(p) < room {
+			room = len(p)
+		}
+		b.buf.Write(p[:room])
+	}
+	return len(p), nil
+}
+
+func (b *limitedBuffer) String() string {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	return b.buf.String()
+}
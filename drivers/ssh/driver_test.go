@@ -0,0 +1,107 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package ssh
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hsanjuan/go-ndef"
+	"github.com/hsanjuan/go-nfctype4"
+	"github.com/hsanjuan/go-nfctype4/drivers/tcp"
+	"github.com/hsanjuan/go-nfctype4/tags/persistent"
+	"github.com/hsanjuan/go-nfctype4/tags/static"
+)
+
+// TestMain lets the test binary act as a fake ssh client, which
+// serves a software tag stored in the FAKE_SSH directory on its standard
+// input and output.
+func TestMain(m *testing.M) {
+	if os.Getenv("FAKE_SSH") == "" {
+		os.Exit(m.Run())
+	}
+	args := strings.Join(os.Args[1:], " ")
+	if !strings.HasSuffix(args, "-W localhost:4444 -- pi@host") &&
+		!strings.HasSuffix(args, "-T -- pi@host agent") {
+		fmt.Fprintln(os.Stderr, "bad arguments:", args)
+		os.Exit(255)
+	}
+	tag, err := persistent.New(os.Getenv("FAKE_SSH"), static.Options{})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	tcp.NewTagServer(tag).ServeConn(stdio{})
+	os.Exit(0)
+}
+
+type stdio struct{}
+
+func (stdio) Read(b []byte) (int, error)  { return os.Stdin.Read(b) }
+func (stdio) Write(b []byte) (int, error) { return os.Stdout.Write(b) }
+
+func fakeSSH(t *testing.T) string {
+	t.Setenv("FAKE_SSH", filepath.Join(t.TempDir(), "tag"))
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return exe
+}
+
+func TestDriver(t *testing.T) {
+	for _, cmd := range []string{"", "agent"} {
+		driver := &Driver{
+			Host:    "pi@host",
+			Command: cmd,
+			SSH:     fakeSSH(t),
+			Args:    []string{"-p", "2222"},
+		}
+		device := nfctype4.New(driver)
+		msg := ndef.NewTextMessage(strings.Repeat("ssh ", 100), "en")
+		if err := device.Update(msg); err != nil {
+			t.Fatal(err)
+		}
+		readMsg, err := device.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if readMsg.String() != msg.String() {
+			t.Error("unexpected message:", readMsg)
+		}
+	}
+}
+
+func TestDriver_Initialize(t *testing.T) {
+	driver := &Driver{Host: "other@host", SSH: fakeSSH(t)}
+	err := driver.Initialize()
+	if err == nil || !strings.Contains(err.Error(), "bad arguments") {
+		t.Error("expected the output of ssh in the error but got:", err)
+	}
+
+	driver = &Driver{}
+	if err := driver.Initialize(); err == nil {
+		t.Error("Initialize should fail without Host")
+	}
+	if _, err := driver.TransceiveBytes([]byte{0x00}, 2); err == nil {
+		t.Error("TransceiveBytes should fail before Initialize")
+	}
+}
@@ -22,11 +22,18 @@ package swtag
 
 import (
 	"errors"
+	"fmt"
+	"math/rand"
+	"time"
 
 	"github.com/hsanjuan/go-nfctype4/apdu"
 	"github.com/hsanjuan/go-nfctype4/tags"
 )
 
+// ErrInjected is returned by TransceiveBytes when an error is injected
+// according to Driver.ErrorRate.
+var ErrInjected = errors.New("swtag: injected error")
+
 // Driver implements a CommandDriver to interface with a software tag
 // (something that implements the Tag interface from the tags module).
 //
@@ -43,10 +50,38 @@ import (
 // a reader. This driver makes it trivial to provide a libnfc device in
 // Target mode with full-fledged Type 4 Tag behaviour.
 //
-// An example of how this is done can be seen visiting the following
-// snippet: https://gitlab.com/snippets/18718
+// The libnfc driver does this with Driver.EmulateTag().
 type Driver struct {
 	Tag tags.Tag
+	// Trace, when set, receives the bytes exchanged with the tag.
+	// It takes a nfctype4.Tracer (this package cannot import
+	// nfctype4, which uses it in its tests).
+	Trace func(sent bool, data []byte)
+	// MaxFrameSize, when set, limits the size of the frames carried
+	// by the simulated link (like the FSC of an ISO/IEC 14443-4
+	// link), SW bytes included. Oversized commands and responses
+	// cause an error, unless Chaining is set.
+	MaxFrameSize int
+	// Chaining, along with MaxFrameSize, allows exchanges which do
+	// not fit in a frame: commands with the apdu.CLAChaining bit set
+	// are buffered and joined with the next ones before handing them
+	// to the Tag, and oversized responses are split, with the rest
+	// of the data provided with GET RESPONSE (SW1 = 61h).
+	Chaining bool
+	// Latency is the time that every exchange takes, to simulate
+	// the speed of a real link.
+	Latency time.Duration
+	// ErrorRate is the probability (0 to 1) that an exchange fails
+	// with ErrInjected. The command does not reach the Tag.
+	ErrorRate float64
+	// Seed for the random number generator used with ErrorRate,
+	// which makes the injected errors reproducible.
+	Seed int64
+
+	rand      *rand.Rand
+	chain     *apdu.CAPDU // Command being chained
+	remaining []byte      // Response data waiting for GET RESPONSE
+	lastSW    [2]byte     // Status of the split response
 }
 
 // Initialize does nothing because software Tags don't need initialization.
@@ -70,25 +105,53 @@ func (driver *Driver) String() string {
 // serialized and returned.
 //
 // It returns an error if the Tag field has not been set, if the APDUs
-// cannot be serialized or deserialized, or if the response size
-// is bigger than the expected size.
+// cannot be serialized or deserialized, if the Tag does not provide
+// a response (nil) or if the response size is bigger than the
+// expected size. It also fails when the frames do not fit in
+// MaxFrameSize and when an error is injected (see ErrorRate).
 func (driver *Driver) TransceiveBytes(tx []byte, rxLen int) ([]byte, error) {
 	if driver.Tag == nil {
 		return nil, errors.New("Driver.TransceiveBytes: " +
 			"Driver.Tag is not set.")
 	}
 
+	driver.trace(true, tx)
+	if driver.Latency > 0 {
+		time.Sleep(driver.Latency)
+	}
+	if driver.fail() {
+		return nil, ErrInjected
+	}
+	if driver.MaxFrameSize > 0 && len(tx) > driver.MaxFrameSize {
+		return nil, fmt.Errorf("Driver.TransceiveBytes: "+
+			"the command (%d bytes) exceeds the maximum frame "+
+			"size (%d bytes)", len(tx), driver.MaxFrameSize)
+	}
 	capdu := new(apdu.CAPDU)
 	if _, err := capdu.Unmarshal(tx); err != nil {
 		return nil, err
 	}
-	// fmt.Println(capdu)
-	rapdu := driver.Tag.Command(capdu)
-	// fmt.Println(rapdu)
+	rapdu := driver.command(capdu)
+	if rapdu == nil {
+		return nil, errors.New("Driver.TransceiveBytes: " +
+			"The tag did not respond")
+	}
 	rxBuf, err := rapdu.Marshal()
 	if err != nil {
 		return nil, err
 	}
+	if driver.MaxFrameSize > 0 && len(rxBuf) > driver.MaxFrameSize {
+		if !driver.Chaining {
+			return nil, fmt.Errorf("Driver.TransceiveBytes: "+
+				"the response (%d bytes) exceeds the maximum "+
+				"frame size (%d bytes)", len(rxBuf),
+				driver.MaxFrameSize)
+		}
+		driver.remaining = rapdu.ResponseBody
+		driver.lastSW = [2]byte{rapdu.SW1, rapdu.SW2}
+		rxBuf = driver.nextChunk(driver.MaxFrameSize - 2)
+	}
+	driver.trace(false, rxBuf)
 
 	if len(rxBuf) > rxLen {
 		return rxBuf, errors.New("Driver.TransceiveBytes: " +
@@ -97,6 +160,80 @@ func (driver *Driver) TransceiveBytes(tx []byte, rxLen int) ([]byte, error) {
 	return rxBuf, nil
 }
 
+// command handles the chaining of commands and responses, when
+// enabled, and passes the rest of commands to the Tag.
+func (driver *Driver) command(capdu *apdu.CAPDU) *apdu.RAPDU {
+	if !driver.Chaining || driver.MaxFrameSize <= 0 {
+		return driver.Tag.Command(capdu)
+	}
+
+	if capdu.INS == apdu.INSGetResponse && driver.remaining != nil {
+		n := driver.MaxFrameSize - 2
+		if le := capdu.GetLe(); le > 0 && le < n {
+			n = le
+		}
+		rapdu := new(apdu.RAPDU)
+		rapdu.Unmarshal(driver.nextChunk(n))
+		return rapdu
+	}
+	driver.remaining = nil
+
+	if driver.chain != nil {
+		if capdu.CLA&^apdu.CLAChaining != driver.chain.CLA ||
+			capdu.INS != driver.chain.INS {
+			driver.chain = nil
+			return apdu.NewRAPDUStatus(apdu.SWLastCommandExpected)
+		}
+		capdu.Data = append(driver.chain.Data, capdu.Data...)
+		capdu.SetLc(len(capdu.Data))
+	}
+	if capdu.CLA&apdu.CLAChaining != 0 {
+		capdu.CLA &^= apdu.CLAChaining
+		driver.chain = capdu
+		return apdu.NewRAPDU(apdu.RAPDUCommandCompleted)
+	}
+	driver.chain = nil
+	return driver.Tag.Command(capdu)
+}
+
+// nextChunk returns up to n bytes of the remaining response data,
+// followed by 61XXh when there is more data, or by the status of the
+// original response otherwise.
+func (driver *Driver) nextChunk(n int) []byte {
+	if n > len(driver.remaining) {
+		n = len(driver.remaining)
+	}
+	chunk := append([]byte{}, driver.remaining[:n]...)
+	driver.remaining = driver.remaining[n:]
+	if len(driver.remaining) == 0 {
+		driver.remaining = nil
+		return append(chunk, driver.lastSW[0], driver.lastSW[1])
+	}
+	sw2 := byte(0) // 256 bytes or more
+	if len(driver.remaining) < 256 {
+		sw2 = byte(len(driver.remaining))
+	}
+	return append(chunk, 0x61, sw2)
+}
+
+// fail returns true with the probability given by ErrorRate.
+func (driver *Driver) fail() bool {
+	if driver.ErrorRate <= 0 {
+		return false
+	}
+	if driver.rand == nil {
+		driver.rand = rand.New(rand.NewSource(driver.Seed))
+	}
+	return driver.rand.Float64() < driver.ErrorRate
+}
+
+// trace calls Trace, when set.
+func (driver *Driver) trace(sent bool, data []byte) {
+	if driver.Trace != nil {
+		driver.Trace(sent, data)
+	}
+}
+
 // Close does nothing.
 func (driver *Driver) Close() {
 	return
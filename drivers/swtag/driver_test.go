@@ -18,9 +18,15 @@
 package swtag
 
 import (
+	"bytes"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/hsanjuan/go-ndef"
+	"github.com/hsanjuan/go-nfctype4"
 	"github.com/hsanjuan/go-nfctype4/apdu"
+	"github.com/hsanjuan/go-nfctype4/tags/static"
 )
 
 type MockTag struct{}
@@ -31,11 +37,11 @@ func (t *MockTag) Command(capdu *apdu.CAPDU) *apdu.RAPDU {
 
 func TestDriver(t *testing.T) {
 	d := new(Driver)
-	d.String()
+	_ = d.String()
 	d.Tag = new(MockTag)
-	d.String()
+	_ = d.String()
 	d.Initialize()
-	d.String()
+	_ = d.String()
 	capdu := apdu.NewNDEFTagApplicationSelectAPDU()
 	capduBytes, _ := capdu.Marshal()
 	rx, _ := d.TransceiveBytes(capduBytes, 2)
@@ -49,3 +55,153 @@ func TestDriver(t *testing.T) {
 	}
 	d.Close()
 }
+
+func TestDriver_Trace(t *testing.T) {
+	var sent, received []byte
+	d := &Driver{
+		Tag: new(MockTag),
+		Trace: func(s bool, data []byte) {
+			if s {
+				sent = data
+			} else {
+				received = data
+			}
+		},
+	}
+	capduBytes, _ := apdu.NewNDEFTagApplicationSelectAPDU().Marshal()
+	if _, err := d.TransceiveBytes(capduBytes, 2); err != nil {
+		t.Fatal(err)
+	}
+	if len(sent) != len(capduBytes) || len(received) != 2 {
+		t.Errorf("unexpected trace: % X / % X", sent, received)
+	}
+}
+
+func TestDriver_MaxFrameSize(t *testing.T) {
+	tag := static.New()
+	msg := ndef.NewTextMessage(strings.Repeat("a", 200), "en")
+	tag.SetMessage(msg)
+	// Larger than what fits in a frame
+	if err := tag.SetMaxDataLengths(0xFF, 0xFF); err != nil {
+		t.Fatal(err)
+	}
+	d := &Driver{
+		Tag:          tag,
+		MaxFrameSize: 32,
+	}
+	if _, err := nfctype4.New(d).Read(); err == nil {
+		t.Error("oversized responses should be rejected")
+	}
+
+	d.Chaining = true
+	readMsg, err := nfctype4.New(d).Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if readMsg.String() != msg.String() {
+		t.Error("unexpected message:", readMsg)
+	}
+
+	long := make([]byte, 40)
+	capduBytes, _ := apdu.NewUpdateBinaryAPDU(long, 0).Marshal()
+	if _, err := d.TransceiveBytes(capduBytes, 2); err == nil {
+		t.Error("oversized commands should be rejected")
+	}
+}
+
+func TestDriver_Chaining(t *testing.T) {
+	var received *apdu.CAPDU
+	d := &Driver{
+		Tag: tagFunc(func(capdu *apdu.CAPDU) *apdu.RAPDU {
+			received = capdu
+			return apdu.NewRAPDU(apdu.RAPDUCommandCompleted)
+		}),
+		MaxFrameSize: 16,
+		Chaining:     true,
+	}
+	first := apdu.NewUpdateBinaryAPDU([]byte{1, 2, 3, 4}, 0)
+	first.CLA |= apdu.CLAChaining
+	last := apdu.NewUpdateBinaryAPDU([]byte{5, 6}, 0)
+	for _, capdu := range []*apdu.CAPDU{first, last} {
+		capduBytes, _ := capdu.Marshal()
+		rx, err := d.TransceiveBytes(capduBytes, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(rx, []byte{0x90, 0x00}) {
+			t.Fatalf("unexpected response: % X", rx)
+		}
+	}
+	if received == nil || received.CLA != 0x00 ||
+		!bytes.Equal(received.Data, []byte{1, 2, 3, 4, 5, 6}) ||
+		received.GetLc() != 6 {
+		t.Fatal("the chained command was not joined:", received)
+	}
+
+	// A different command in the middle of a chain
+	capduBytes, _ := first.Marshal()
+	d.TransceiveBytes(capduBytes, 2)
+	capduBytes, _ = apdu.NewSelectAPDU(0xE103).Marshal()
+	rx, err := d.TransceiveBytes(capduBytes, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(rx, []byte{0x68, 0x83}) {
+		t.Errorf("unexpected response: % X", rx)
+	}
+}
+
+type tagFunc func(*apdu.CAPDU) *apdu.RAPDU
+
+func (f tagFunc) Command(capdu *apdu.CAPDU) *apdu.RAPDU {
+	return f(capdu)
+}
+
+func TestDriver_ErrorRate(t *testing.T) {
+	capduBytes, _ := apdu.NewNDEFTagApplicationSelectAPDU().Marshal()
+	run := func() []bool {
+		d := &Driver{
+			Tag:       new(MockTag),
+			ErrorRate: 0.5,
+			Seed:      42,
+		}
+		var results []bool
+		for i := 0; i < 50; i++ {
+			_, err := d.TransceiveBytes(capduBytes, 2)
+			if err != nil && err != ErrInjected {
+				t.Fatal(err)
+			}
+			results = append(results, err == nil)
+		}
+		return results
+	}
+	first := run()
+	second := run()
+	var failures int
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatal("errors should be reproducible with the same seed")
+		}
+		if !first[i] {
+			failures++
+		}
+	}
+	if failures == 0 || failures == len(first) {
+		t.Error("unexpected number of failures:", failures)
+	}
+}
+
+func TestDriver_Latency(t *testing.T) {
+	d := &Driver{
+		Tag:     new(MockTag),
+		Latency: 20 * time.Millisecond,
+	}
+	capduBytes, _ := apdu.NewNDEFTagApplicationSelectAPDU().Marshal()
+	start := time.Now()
+	if _, err := d.TransceiveBytes(capduBytes, 2); err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(start) < d.Latency {
+		t.Error("the exchange should take at least Latency")
+	}
+}
@@ -0,0 +1,128 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package tcp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// DefaultTimeout is the timeout used by the Driver when none is set.
+const DefaultTimeout = 10 * time.Second
+
+// Driver implements the CommandDriver interface forwarding the bytes
+// to a Server, which sends them to the tag using its own driver.
+type Driver struct {
+	Address string        // Address of the Server, i.e. "host:4444"
+	Timeout time.Duration // Timeout for every operation
+	// Conn, when set, is used to talk to the Server instead of
+	// dialing Address, i.e. a tunnel. The Timeout only applies if it
+	// supports deadlines. It is not closed by Close.
+	Conn io.ReadWriteCloser
+
+	conn io.ReadWriteCloser
+}
+
+// deadliner is implemented by the connections supporting deadlines.
+type deadliner interface {
+	SetDeadline(t time.Time) error
+}
+
+// Initialize connects to the Server and waits for it to initialize
+// its driver.
+//
+// It returns an error if the connection fails or if the remote driver
+// cannot be initialized.
+func (driver *Driver) Initialize() error {
+	conn := driver.Conn
+	if conn == nil {
+		netConn, err := net.DialTimeout("tcp", driver.Address,
+			driver.timeout())
+		if err != nil {
+			return err
+		}
+		conn = netConn
+	}
+	driver.conn = conn
+	driver.setDeadline()
+	if _, err := readResponse(conn); err != nil {
+		driver.Close()
+		return err
+	}
+	return nil
+}
+
+// String returns information about this driver.
+func (driver *Driver) String() string {
+	str := fmt.Sprintf("TCP Driver. Server: %s. ", driver.Address)
+	if driver.conn == nil {
+		str += "Not connected."
+	} else {
+		str += "Connected."
+	}
+	return str
+}
+
+// TransceiveBytes sends the bytes to the Server and returns the bytes
+// received by it from the tag.
+//
+// It returns an error if the Driver is not connected, if the
+// communication with the Server fails or if the remote driver returns
+// an error.
+func (driver *Driver) TransceiveBytes(tx []byte, rxLen int) ([]byte, error) {
+	if driver.conn == nil {
+		return nil, errors.New("Driver.TransceiveBytes: " +
+			"Driver not initialized")
+	}
+	driver.setDeadline()
+	req := make([]byte, 4+len(tx))
+	binary.BigEndian.PutUint32(req, uint32(rxLen))
+	copy(req[4:], tx)
+	if err := writeMessage(driver.conn, req); err != nil {
+		return nil, err
+	}
+	return readResponse(driver.conn)
+}
+
+// Close closes the connection with the Server, which closes its
+// driver. Conn is left open, as it belongs to the caller.
+func (driver *Driver) Close() {
+	if driver.conn != nil && driver.Conn == nil {
+		driver.conn.Close()
+	}
+	driver.conn = nil
+}
+
+// setDeadline sets the deadline for the next operation, when the
+// connection supports it.
+func (driver *Driver) setDeadline() {
+	if d, ok := driver.conn.(deadliner); ok {
+		d.SetDeadline(time.Now().Add(driver.timeout()))
+	}
+}
+
+func (driver *Driver) timeout() time.Duration {
+	if driver.Timeout == 0 {
+		return DefaultTimeout
+	}
+	return driver.Timeout
+}
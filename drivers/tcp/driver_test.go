@@ -0,0 +1,156 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package tcp
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hsanjuan/go-ndef"
+	"github.com/hsanjuan/go-nfctype4"
+	"github.com/hsanjuan/go-nfctype4/drivers/swtag"
+	"github.com/hsanjuan/go-nfctype4/tags/static"
+)
+
+type failingDriver struct {
+	swtag.Driver
+}
+
+func (driver *failingDriver) Initialize() error {
+	return errors.New("no reader")
+}
+
+func serve(t *testing.T, srv *Server) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go srv.Serve(l)
+	return l.Addr().String()
+}
+
+func TestDriver(t *testing.T) {
+	tag := static.New()
+	addr := serve(t, NewTagServer(tag))
+	device := nfctype4.New(&Driver{Address: addr})
+
+	msg := ndef.NewTextMessage(strings.Repeat("remote ", 50), "en")
+	if err := device.Update(msg); err != nil {
+		t.Fatal(err)
+	}
+	if tag.GetMessage().String() != msg.String() {
+		t.Error("the message did not reach the tag")
+	}
+	readMsg, err := device.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if readMsg.String() != msg.String() {
+		t.Error("unexpected message:", readMsg)
+	}
+}
+
+func TestDriver_errors(t *testing.T) {
+	driver := &Driver{}
+	if _, err := driver.TransceiveBytes([]byte{0x00}, 2); err == nil {
+		t.Error("TransceiveBytes should fail before Initialize")
+	}
+
+	addr := serve(t, NewServer(&failingDriver{}))
+	driver = &Driver{Address: addr}
+	err := driver.Initialize()
+	if err == nil || err.Error() != "remote: no reader" {
+		t.Error("expected the remote error but got:", err)
+	}
+
+	// Errors from the remote driver are forwarded
+	addr = serve(t, NewServer(&swtag.Driver{}))
+	driver = &Driver{Address: addr}
+	if err := driver.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	defer driver.Close()
+	_, err = driver.TransceiveBytes([]byte{0x00, 0xA4, 0x00, 0x0C}, 2)
+	if err == nil || !strings.HasPrefix(err.Error(), "remote: ") {
+		t.Error("expected a remote error but got:", err)
+	}
+}
+
+func TestDriver_Conn(t *testing.T) {
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	tag := static.New()
+	go func() {
+		defer serverConn.Close()
+		NewTagServer(tag).ServeConn(serverConn)
+	}()
+
+	device := nfctype4.New(&Driver{Conn: clientConn})
+	msg := ndef.NewTextMessage("tunneled", "en")
+	if err := device.Update(msg); err != nil {
+		t.Fatal(err)
+	}
+	if tag.GetMessage().String() != msg.String() {
+		t.Error("the message did not reach the tag")
+	}
+}
+
+func TestServer_limits(t *testing.T) {
+	srv := NewTagServer(static.New())
+	srv.IdleTimeout = 50 * time.Millisecond
+	addr := serve(t, srv)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := readResponse(conn); err != nil {
+		t.Fatal(err)
+	}
+	req := make([]byte, 4, 8)
+	binary.BigEndian.PutUint32(req, 0xFFFFFFFF)
+	req = append(req, 0x00, 0xB0, 0x00, 0x00)
+	if err := writeMessage(conn, req); err != nil {
+		t.Fatal(err)
+	}
+	_, err = readResponse(conn)
+	if err == nil || !strings.Contains(err.Error(), "too large") {
+		t.Error("expected a response length error but got:", err)
+	}
+
+	// An idle client does not block the rest
+	idle, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idle.Close()
+	if _, err := readResponse(idle); err != nil {
+		t.Fatal(err)
+	}
+	driver := &Driver{Address: addr, Timeout: time.Second}
+	if err := driver.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	driver.Close()
+}
@@ -0,0 +1,110 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+// Package tcp provides a CommandDriver implementation which forwards
+// the communication with a tag to a remote server over TCP, along with
+// the Server, which bridges the incoming connections to a local
+// CommandDriver or to a software Tag.
+//
+// This allows to use NFC readers attached to other machines, or to
+// expose software tags to remote devices.
+//
+// The protocol is simple: every message is preceded by its length as
+// a 4-byte big-endian integer. When a connection is accepted, the
+// Server initializes its driver and sends a response message with the
+// result. Then, the client sends requests, made of the maximum
+// response length (4 bytes) and the bytes to send to the tag, and the
+// Server answers each of them with a response. Responses start with a
+// status byte: 00h followed by the bytes received from the tag, or
+// 01h followed by an error message.
+//
+// The protocol has no authentication or encryption: anyone who can
+// reach the Server can talk to its reader or tag. Only listen on
+// trusted networks, or use the grpc driver, which supports TLS and
+// tokens, instead.
+package tcp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Status bytes of the responses.
+const (
+	statusOK    = byte(0x00)
+	statusError = byte(0x01)
+)
+
+// maxMessageLen limits the size of the messages accepted.
+const maxMessageLen = 1 << 20
+
+// writeMessage writes a length-prefixed message.
+func writeMessage(w io.Writer, msg []byte) error {
+	buf := make([]byte, 4+len(msg))
+	binary.BigEndian.PutUint32(buf, uint32(len(msg)))
+	copy(buf[4:], msg)
+	_, err := w.Write(buf)
+	return err
+}
+
+// readMessage reads a length-prefixed message.
+func readMessage(r io.Reader) ([]byte, error) {
+	lenBytes := make([]byte, 4)
+	if _, err := io.ReadFull(r, lenBytes); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(lenBytes)
+	if n > maxMessageLen {
+		return nil, fmt.Errorf("readMessage: message too long (%d bytes)", n)
+	}
+	msg := make([]byte, n)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// writeResponse writes a response with the given data, or with the
+// error message if err is not nil.
+func writeResponse(w io.Writer, data []byte, err error) error {
+	if err != nil {
+		return writeMessage(w, append([]byte{statusError}, err.Error()...))
+	}
+	return writeMessage(w, append([]byte{statusOK}, data...))
+}
+
+// readResponse reads a response and returns its data, or an error
+// with the message sent by the server.
+func readResponse(r io.Reader) ([]byte, error) {
+	msg, err := readMessage(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(msg) == 0 {
+		return nil, errors.New("readResponse: empty response")
+	}
+	switch msg[0] {
+	case statusOK:
+		return msg[1:], nil
+	case statusError:
+		return nil, fmt.Errorf("remote: %s", msg[1:])
+	default:
+		return nil, fmt.Errorf("readResponse: unknown status %02xh", msg[0])
+	}
+}
@@ -0,0 +1,160 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package tcp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/hsanjuan/go-nfctype4"
+	"github.com/hsanjuan/go-nfctype4/drivers/swtag"
+	"github.com/hsanjuan/go-nfctype4/tags"
+)
+
+// DefaultIdleTimeout is the IdleTimeout used by the Server when none
+// is set.
+const DefaultIdleTimeout = time.Minute
+
+// maxRxLen is the largest response length which clients can request:
+// 65536 bytes of data (extended Le) and the status word.
+const maxRxLen = 65536 + 2
+
+// Server accepts connections from Drivers and bridges them to a local
+// CommandDriver.
+//
+// The local driver is initialized for every connection and closed
+// when it ends. Connections are served one at a time: while a client
+// is connected, the rest wait for their turn.
+type Server struct {
+	Driver nfctype4.CommandDriver
+	// IdleTimeout is how long the Server waits for the next request
+	// of a client before closing its connection, so that idle
+	// clients do not keep the rest waiting forever. It only applies
+	// to connections supporting read deadlines, like net.Conn.
+	IdleTimeout time.Duration
+
+	mux sync.Mutex
+}
+
+// readDeadliner is implemented by the connections supporting read
+// deadlines.
+type readDeadliner interface {
+	SetReadDeadline(t time.Time) error
+}
+
+// NewServer returns a new *Server which bridges the connections to
+// the given driver.
+func NewServer(driver nfctype4.CommandDriver) *Server {
+	return &Server{
+		Driver: driver,
+	}
+}
+
+// NewTagServer returns a new *Server which bridges the connections to
+// the given software Tag.
+func NewTagServer(tag tags.Tag) *Server {
+	return NewServer(&swtag.Driver{Tag: tag})
+}
+
+// ListenAndServe listens on the given TCP address and serves the
+// incoming connections.
+func (srv *Server) ListenAndServe(address string) error {
+	l, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+	return srv.Serve(l)
+}
+
+// Serve accepts connections on the Listener and serves each of them
+// in a new goroutine. It returns when the Listener fails, for
+// example, because it has been closed.
+func (srv *Server) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go func() {
+			defer conn.Close()
+			srv.ServeConn(conn)
+		}()
+	}
+}
+
+// ServeConn serves a single connection until the client closes it or
+// stays idle for longer than the IdleTimeout. It returns nil when the
+// connection ends normally.
+func (srv *Server) ServeConn(conn io.ReadWriter) error {
+	srv.mux.Lock()
+	defer srv.mux.Unlock()
+
+	if srv.Driver == nil {
+		err := errors.New("Server.ServeConn: Driver not set")
+		writeResponse(conn, nil, err)
+		return err
+	}
+	if err := srv.Driver.Initialize(); err != nil {
+		writeResponse(conn, nil, err)
+		return err
+	}
+	defer srv.Driver.Close()
+	if err := writeResponse(conn, nil, nil); err != nil {
+		return err
+	}
+
+	for {
+		if d, ok := conn.(readDeadliner); ok {
+			d.SetReadDeadline(time.Now().Add(srv.idleTimeout()))
+		}
+		req, err := readMessage(conn)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if len(req) < 4 {
+			return errors.New("Server.ServeConn: malformed request")
+		}
+		rxLen := binary.BigEndian.Uint32(req)
+		if rxLen > maxRxLen {
+			err := fmt.Errorf("Server.ServeConn: response length "+
+				"too large (%d bytes)", rxLen)
+			writeResponse(conn, nil, err)
+			return err
+		}
+		rx, err := srv.Driver.TransceiveBytes(req[4:], int(rxLen))
+		if err := writeResponse(conn, rx, err); err != nil {
+			return err
+		}
+	}
+}
+
+func (srv *Server) idleTimeout() time.Duration {
+	if srv.IdleTimeout == 0 {
+		return DefaultIdleTimeout
+	}
+	return srv.IdleTimeout
+}
@@ -0,0 +1,245 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+// Package ufr provides a CommandDriver implementation for the Digital
+// Logic uFR readers (uFR Nano, uFR Classic...), which are common in
+// access control deployments and are not supported by libnfc.
+//
+// The driver talks the serial protocol of the readers: 7-byte
+// command packets (55h ... AAh), optionally followed by an extension
+// once the reader acknowledges them, and response packets (DEh ...
+// EDh) or error packets (ECh ... CEh). It switches the card to
+// ISO/IEC 14443-4 mode and exchanges APDUs with the APDU transceive
+// command. APDUs and responses are limited to 254 bytes.
+package ufr
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/hsanjuan/go-nfctype4"
+	"github.com/hsanjuan/go-nfctype4/drivers/internal/serial"
+)
+
+// Common errors
+var (
+	ErrNoTargetsDetected = errors.New("no targets detected")
+)
+
+// Default values for the Driver configuration.
+const (
+	DefaultBaudRate = 1000000 // uFR Nano. The uFR Classic uses 115200.
+	DefaultTimeout  = time.Second
+)
+
+// Driver implements the CommandDriver interface for a uFR reader. It
+// allows `Device` to communicate with the ISO/IEC 14443-4 card in the
+// field of the reader.
+//
+// The tag must be in the field of the reader when Initialize is
+// called.
+type Driver struct {
+	Port     string        // Serial port, i.e. /dev/ttyUSB0
+	BaudRate int           // Defaults to DefaultBaudRate
+	Timeout  time.Duration // Defaults to DefaultTimeout
+	// Conn, when set, is used to communicate with the reader instead
+	// of opening Port. It is not closed by Close.
+	Conn io.ReadWriteCloser
+	// Trace, when set, receives the bytes exchanged with the tag.
+	Trace nfctype4.Tracer
+
+	conn       io.ReadWriteCloser
+	readerType uint32
+	uid        []byte
+	sak        byte
+}
+
+// Initialize opens the serial port, reads the UID of the card in the
+// field and switches it to ISO/IEC 14443-4 mode.
+//
+// It returns ErrNoTargetsDetected when there is no card, or an error
+// when some other step fails.
+func (driver *Driver) Initialize() error {
+	driver.Close()
+	conn := driver.Conn
+	if conn == nil {
+		baudRate := driver.BaudRate
+		if baudRate == 0 {
+			baudRate = DefaultBaudRate
+		}
+		timeout := driver.Timeout
+		if timeout == 0 {
+			timeout = DefaultTimeout
+		}
+		var err error
+		conn, err = serial.Open(driver.Port, baudRate, timeout)
+		if err != nil {
+			return err
+		}
+	}
+	driver.conn = conn
+
+	err := driver.setup()
+	if err == errNoCard {
+		err = ErrNoTargetsDetected
+	}
+	if err != nil {
+		driver.Close()
+	}
+	return err
+}
+
+func (driver *Driver) setup() error {
+	_, ext, err := driver.command(cmdGetReaderType, 0, 0, nil)
+	if err != nil {
+		return err
+	}
+	if len(ext) >= 4 {
+		driver.readerType = binary.LittleEndian.Uint32(ext)
+	}
+
+	// Values: card type (SAK) and UID length. Ext: UID (padded)
+	rsp, ext, err := driver.command(cmdGetCardIDEx, 0, 0, nil)
+	if err != nil {
+		return err
+	}
+	if int(rsp.par1) > len(ext) {
+		return errors.New("Driver.Initialize: malformed card ID")
+	}
+	driver.sak = rsp.par0
+	driver.uid = ext[:rsp.par1]
+
+	_, _, err = driver.command(cmdSetISO14443_4Mode, 0, 0, nil)
+	return err
+}
+
+// command sends a command with an optional extension and returns
+// the response packet and its extension.
+func (driver *Driver) command(cmd, par0, par1 byte, ext []byte) (*packet, []byte, error) {
+	if len(ext) > maxExtData {
+		return nil, nil, errors.New("Driver: command too long")
+	}
+	req := &packet{header: cmdHeader, code: cmd, par0: par0, par1: par1}
+	if ext != nil {
+		req.extLen = byte(len(ext) + 1)
+	}
+	if _, err := driver.conn.Write(req.marshal()); err != nil {
+		return nil, nil, err
+	}
+
+	// The extension is sent once the reader acknowledges the command
+	if ext != nil {
+		ack, err := readPacket(driver.conn)
+		if err != nil {
+			return nil, nil, err
+		}
+		if ack.header == errHeader {
+			return nil, nil, ufrError(ack.code)
+		}
+		if ack.header != ackHeader || ack.code != cmd {
+			return nil, nil, errors.New("Driver: " +
+				"acknowledgement expected")
+		}
+		if _, err := driver.conn.Write(marshalExt(ext)); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	rsp, err := readPacket(driver.conn)
+	if err != nil {
+		return nil, nil, err
+	}
+	if rsp.header == errHeader {
+		// Error packets may carry an extension too
+		readExt(driver.conn, int(rsp.extLen))
+		return nil, nil, ufrError(rsp.code)
+	}
+	if rsp.header != rspHeader || rsp.code != cmd {
+		return nil, nil, fmt.Errorf("Driver: unexpected response to "+
+			"command %02xh", cmd)
+	}
+	rspExt, err := readExt(driver.conn, int(rsp.extLen))
+	if err != nil {
+		return nil, nil, err
+	}
+	return rsp, rspExt, nil
+}
+
+// String returns information about the reader and the card.
+// It should be used after calling Initialize().
+func (driver *Driver) String() string {
+	str := fmt.Sprintf("uFR Driver. Port: %s\n", driver.Port)
+	if driver.readerType != 0 {
+		str += fmt.Sprintf("Reader type: %08xh\n", driver.readerType)
+	}
+	if driver.uid != nil {
+		str += fmt.Sprintf("Target UID: % 02x\n", driver.uid)
+	} else {
+		str += fmt.Sprintln("No target information.")
+	}
+	return str
+}
+
+// TargetInfo returns the UID and SAK of the card.
+func (driver *Driver) TargetInfo() (nfctype4.TargetInfo, error) {
+	if driver.uid == nil {
+		return nfctype4.TargetInfo{}, errors.New("Driver.TargetInfo: " +
+			"no target information")
+	}
+	return nfctype4.TargetInfo{UID: driver.uid, SAK: driver.sak}, nil
+}
+
+// TransceiveBytes sends the APDU to the card with the APDU transceive
+// command and returns the response.
+//
+// It returns an error if the reader reports an error or if the
+// response is longer than rxLen.
+func (driver *Driver) TransceiveBytes(tx []byte, rxLen int) ([]byte, error) {
+	if driver.conn == nil {
+		return nil, errors.New("Driver.TransceiveBytes: " +
+			"Driver not initialized")
+	}
+	driver.Trace.Trace(true, tx)
+	_, rx, err := driver.command(cmdAPDUTransceive, 0, 0, tx)
+	if err != nil {
+		return nil, err
+	}
+	driver.Trace.Trace(false, rx)
+	if len(rx) > rxLen {
+		return rx, errors.New("Driver.TransceiveBytes: " +
+			"The length of the response is larger than expected")
+	}
+	return rx, nil
+}
+
+// Close deselects the card and closes the serial port. Conn is left
+// open, as it belongs to the caller.
+func (driver *Driver) Close() {
+	if driver.conn != nil && driver.uid != nil {
+		driver.command(cmdSBlockDeselect, 0, 0, nil)
+	}
+	if driver.conn != nil && driver.Conn == nil {
+		driver.conn.Close()
+	}
+	driver.conn = nil
+	driver.readerType = 0
+	driver.uid = nil
+	driver.sak = 0
+}
@@ -0,0 +1,175 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package ufr
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/hsanjuan/go-ndef"
+	"github.com/hsanjuan/go-nfctype4"
+	"github.com/hsanjuan/go-nfctype4/drivers/swtag"
+	"github.com/hsanjuan/go-nfctype4/tags"
+	"github.com/hsanjuan/go-nfctype4/tags/static"
+)
+
+// newFakeReader returns a link with an emulated uFR reader with the
+// given tag in its field, or no tag if nil.
+func newFakeReader(t *testing.T, tag tags.Tag) io.ReadWriteCloser {
+	hostConn, readerConn := net.Pipe()
+	driver := &swtag.Driver{Tag: tag}
+	reply := func(header, code byte, par0, par1 byte, ext []byte) {
+		rsp := &packet{header: header, code: code, par0: par0, par1: par1}
+		if ext != nil {
+			rsp.extLen = byte(len(ext) + 1)
+		}
+		readerConn.Write(rsp.marshal())
+		if ext != nil {
+			readerConn.Write(marshalExt(ext))
+		}
+	}
+	go func() {
+		for {
+			req, err := readPacket(readerConn)
+			if err != nil {
+				return
+			}
+			if req.header != cmdHeader {
+				t.Error("unexpected packet from the host")
+				return
+			}
+			var ext []byte
+			if req.extLen > 0 {
+				reply(ackHeader, req.code, 0, 0, nil)
+				ext, err = readExt(readerConn, int(req.extLen))
+				if err != nil {
+					t.Error(err)
+					return
+				}
+			}
+			if tag == nil && req.code != cmdGetReaderType {
+				reply(errHeader, byte(errNoCard), 0, 0, nil)
+				continue
+			}
+			switch req.code {
+			case cmdGetReaderType:
+				reply(rspHeader, req.code, 0, 0,
+					[]byte{0x01, 0x00, 0xE2, 0xD1})
+			case cmdGetCardIDEx:
+				uid := make([]byte, 10)
+				copy(uid, []byte{0x04, 0x11, 0x22, 0x33, 0x44, 0x55, 0x66})
+				reply(rspHeader, req.code, 0x20, 7, uid)
+			case cmdSetISO14443_4Mode, cmdSBlockDeselect:
+				reply(rspHeader, req.code, 0, 0, nil)
+			case cmdAPDUTransceive:
+				rx, err := driver.TransceiveBytes(ext, 65538)
+				if err != nil || len(rx) > maxExtData {
+					reply(errHeader, 0x05, 0, 0, nil)
+					break
+				}
+				reply(rspHeader, req.code, 0, 0, rx)
+			default:
+				reply(errHeader, 0x09, 0, 0, nil)
+			}
+		}
+	}()
+	return hostConn
+}
+
+func TestDriver(t *testing.T) {
+	tag := static.New()
+	conn := newFakeReader(t, tag)
+	defer conn.Close()
+	driver := &Driver{Conn: conn}
+	device := nfctype4.New(driver)
+
+	msg := ndef.NewTextMessage(strings.Repeat("ufr ", 100), "en")
+	if err := device.Update(msg); err != nil {
+		t.Fatal(err)
+	}
+	readMsg, err := device.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if readMsg.String() != msg.String() {
+		t.Error("unexpected message:", readMsg)
+	}
+}
+
+func TestDriver_Initialize(t *testing.T) {
+	conn := newFakeReader(t, nil)
+	driver := &Driver{Conn: conn}
+	if err := driver.Initialize(); err != ErrNoTargetsDetected {
+		t.Error("expected ErrNoTargetsDetected but got:", err)
+	}
+	conn.Close()
+
+	conn = newFakeReader(t, static.New())
+	defer conn.Close()
+	driver = &Driver{Conn: conn}
+	if err := driver.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	info, err := driver.TargetInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	uid := []byte{0x04, 0x11, 0x22, 0x33, 0x44, 0x55, 0x66}
+	if !bytes.Equal(info.UID, uid) || info.SAK != 0x20 {
+		t.Errorf("unexpected target info: %+v", info)
+	}
+	if !strings.Contains(driver.String(), "d1e20001") {
+		t.Error("String should include the reader type")
+	}
+	if _, err := driver.TransceiveBytes(make([]byte, 300), 2); err == nil {
+		t.Error("expected an error for a long APDU")
+	}
+	driver.Close()
+
+	if _, err := driver.TransceiveBytes([]byte{0x00}, 2); err == nil {
+		t.Error("TransceiveBytes should fail before Initialize")
+	}
+}
+
+func TestReadPacket(t *testing.T) {
+	pkt := &packet{header: cmdHeader, code: cmdGetCardIDEx, extLen: 3,
+		par0: 0xAA, par1: 0xCC}
+	b := pkt.marshal()
+	if !bytes.Equal(b, []byte{0x55, 0x2C, 0xAA, 0x03, 0xAA, 0xCC, 0xBD}) {
+		t.Errorf("unexpected packet: % 02x", b)
+	}
+	read, err := readPacket(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *read != *pkt {
+		t.Errorf("unexpected packet: %+v", read)
+	}
+
+	b[6]++
+	if _, err := readPacket(bytes.NewReader(b)); err == nil {
+		t.Error("expected a checksum error")
+	}
+	b[0] = 0x00
+	if _, err := readPacket(bytes.NewReader(b)); err == nil {
+		t.Error("expected an error for an unknown header")
+	}
+}
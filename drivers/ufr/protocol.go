@@ -0,0 +1,158 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package ufr
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Headers and trailers of the packets.
+const (
+	cmdHeader  = byte(0x55)
+	cmdTrailer = byte(0xAA)
+	ackHeader  = byte(0xAC)
+	ackTrailer = byte(0xCA)
+	rspHeader  = byte(0xDE)
+	rspTrailer = byte(0xED)
+	errHeader  = byte(0xEC)
+	errTrailer = byte(0xCE)
+)
+
+// trailers maps the headers to their trailers.
+var trailers = map[byte]byte{
+	cmdHeader: cmdTrailer,
+	ackHeader: ackTrailer,
+	rspHeader: rspTrailer,
+	errHeader: errTrailer,
+}
+
+// Commands used by the driver.
+const (
+	cmdGetReaderType     = byte(0x10)
+	cmdGetCardIDEx       = byte(0x2C)
+	cmdSBlockDeselect    = byte(0x92)
+	cmdSetISO14443_4Mode = byte(0x93)
+	cmdAPDUTransceive    = byte(0x94)
+)
+
+// packetLen is the length of every packet, without the extension.
+const packetLen = 7
+
+// maxExtData is the maximum amount of data in an extension, which
+// is followed by its checksum and whose length is a single byte.
+const maxExtData = 0xFF - 1
+
+// errNoCard is the error code sent by the reader when there is no
+// card in the field.
+const errNoCard = ufrError(0x08)
+
+// ufrError is an error code sent by the reader.
+type ufrError byte
+
+var ufrErrorNames = map[ufrError]string{
+	0x01:      "communication error",
+	0x02:      "checksum error",
+	0x03:      "reading error",
+	0x04:      "writing error",
+	0x05:      "buffer overflow",
+	0x06:      "max address exceeded",
+	0x07:      "max key index exceeded",
+	errNoCard: "no card",
+	0x09:      "command not supported",
+}
+
+func (e ufrError) Error() string {
+	if name, ok := ufrErrorNames[e]; ok {
+		return fmt.Sprintf("uFR error %02xh: %s", byte(e), name)
+	}
+	return fmt.Sprintf("uFR error %02xh", byte(e))
+}
+
+// checksum is the XOR of the bytes plus 7.
+func checksum(b []byte) byte {
+	var sum byte
+	for _, c := range b {
+		sum ^= c
+	}
+	return sum + 0x07
+}
+
+// packet is a command, acknowledgement, response or error packet:
+// header, code (command or error), trailer, length of the extension,
+// two parameters (or values) and checksum.
+type packet struct {
+	header byte
+	code   byte
+	extLen byte
+	par0   byte
+	par1   byte
+}
+
+func (pkt *packet) marshal() []byte {
+	buf := []byte{pkt.header, pkt.code, trailers[pkt.header], pkt.extLen,
+		pkt.par0, pkt.par1}
+	return append(buf, checksum(buf))
+}
+
+// readPacket reads a packet and checks its framing.
+func readPacket(r io.Reader) (*packet, error) {
+	buf := make([]byte, packetLen)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	trailer, ok := trailers[buf[0]]
+	if !ok {
+		return nil, fmt.Errorf("readPacket: unknown header %02xh", buf[0])
+	}
+	if buf[2] != trailer {
+		return nil, errors.New("readPacket: bad trailer")
+	}
+	if checksum(buf[:6]) != buf[6] {
+		return nil, errors.New("readPacket: bad checksum")
+	}
+	return &packet{
+		header: buf[0],
+		code:   buf[1],
+		extLen: buf[3],
+		par0:   buf[4],
+		par1:   buf[5],
+	}, nil
+}
+
+// marshalExt returns the extension with its checksum.
+func marshalExt(data []byte) []byte {
+	return append(append([]byte{}, data...), checksum(data))
+}
+
+// readExt reads an extension of n bytes (checksum included) and
+// returns its data.
+func readExt(r io.Reader, n int) ([]byte, error) {
+	if n == 0 {
+		return nil, nil
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	if checksum(buf[:n-1]) != buf[n-1] {
+		return nil, errors.New("readExt: bad checksum")
+	}
+	return buf[:n-1], nil
+}
@@ -0,0 +1,179 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+// Package websocket provides a CommandDriver implementation which
+// uses a WebSocket client as transport. This allows a browser page
+// (for example, using WebNFC or a WebUSB gateway) or an Electron
+// application to provide access to the tag, while this library runs
+// on the server side.
+//
+// The Driver is an http.Handler. Clients connect to it and exchange
+// binary WebSocket messages: the Driver sends the bytes for the tag
+// (a Command APDU) and the client answers with the bytes received
+// from the tag (a Response APDU). A client can answer with a text
+// message instead to signal an error, which is returned by
+// TransceiveBytes.
+package websocket
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// DefaultTimeout is the timeout used by the Driver when none is set.
+const DefaultTimeout = 10 * time.Second
+
+// Driver implements the CommandDriver interface sending the bytes to
+// a WebSocket client. Only one client is used at a time: when a new
+// client connects, it replaces the previous one.
+//
+// The connection with the client is kept open after Close(), so that
+// it can be re-used by the next Initialize().
+type Driver struct {
+	// Timeout for Initialize to wait for a client and for every
+	// operation with it.
+	Timeout time.Duration
+	// CheckOrigin decides whether the origin of a request is
+	// accepted. When nil, only requests whose Origin matches the
+	// Host are accepted.
+	CheckOrigin func(r *http.Request) bool
+
+	conns       chan *websocket.Conn
+	conn        *websocket.Conn
+	initialized bool
+}
+
+// New returns a new *Driver ready to accept connections.
+func New() *Driver {
+	return &Driver{
+		conns: make(chan *websocket.Conn, 1),
+	}
+}
+
+// ServeHTTP upgrades the request to a WebSocket connection and makes
+// it available to the Driver.
+func (driver *Driver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	upgrader := websocket.Upgrader{CheckOrigin: driver.CheckOrigin}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade has already replied to the client
+		return
+	}
+	// Replace any client which has not been picked up yet
+	for {
+		select {
+		case driver.conns <- conn:
+			return
+		case old := <-driver.conns:
+			old.Close()
+		}
+	}
+}
+
+// Initialize waits for a client to be connected. It returns an error
+// if no client connects before the timeout.
+func (driver *Driver) Initialize() error {
+	if driver.conns == nil {
+		return errors.New("Driver.Initialize: " +
+			"Driver not created with New()")
+	}
+	select {
+	case conn := <-driver.conns:
+		driver.setConn(conn)
+	default:
+		if driver.conn == nil {
+			select {
+			case conn := <-driver.conns:
+				driver.setConn(conn)
+			case <-time.After(driver.timeout()):
+				return errors.New("Driver.Initialize: " +
+					"no client connected")
+			}
+		}
+	}
+	driver.initialized = true
+	return nil
+}
+
+// String returns information about this driver.
+func (driver *Driver) String() string {
+	str := "WebSocket Driver. "
+	if driver.conn == nil {
+		str += "No client connected."
+	} else {
+		str += fmt.Sprintf("Client: %s.", driver.conn.RemoteAddr())
+	}
+	return str
+}
+
+// TransceiveBytes sends the bytes to the client in a binary message
+// and returns the bytes in its answer.
+//
+// It returns an error if the Driver is not initialized, if the
+// communication with the client fails, if the client answers with a
+// text message or if the answer is longer than rxLen. When the
+// communication fails, the client is disconnected.
+func (driver *Driver) TransceiveBytes(tx []byte, rxLen int) ([]byte, error) {
+	if !driver.initialized || driver.conn == nil {
+		return nil, errors.New("Driver.TransceiveBytes: " +
+			"Driver not initialized")
+	}
+	driver.conn.SetWriteDeadline(time.Now().Add(driver.timeout()))
+	if err := driver.conn.WriteMessage(websocket.BinaryMessage, tx); err != nil {
+		driver.setConn(nil)
+		return nil, err
+	}
+	driver.conn.SetReadDeadline(time.Now().Add(driver.timeout()))
+	msgType, rx, err := driver.conn.ReadMessage()
+	if err != nil {
+		driver.setConn(nil)
+		return nil, err
+	}
+	if msgType == websocket.TextMessage {
+		return nil, fmt.Errorf("remote: %s", rx)
+	}
+	if len(rx) > rxLen {
+		return nil, fmt.Errorf("Driver.TransceiveBytes: "+
+			"received %d bytes but expected %d at most", len(rx), rxLen)
+	}
+	return rx, nil
+}
+
+// Close releases the Driver. The client stays connected.
+func (driver *Driver) Close() {
+	driver.initialized = false
+}
+
+// setConn replaces the current client connection, closing the
+// previous one.
+func (driver *Driver) setConn(conn *websocket.Conn) {
+	if driver.conn != nil && driver.conn != conn {
+		driver.conn.Close()
+	}
+	driver.conn = conn
+}
+
+func (driver *Driver) timeout() time.Duration {
+	if driver.Timeout == 0 {
+		return DefaultTimeout
+	}
+	return driver.Timeout
+}
@@ -0,0 +1,118 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package websocket
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/hsanjuan/go-ndef"
+	"github.com/hsanjuan/go-nfctype4"
+	"github.com/hsanjuan/go-nfctype4/drivers/swtag"
+	"github.com/hsanjuan/go-nfctype4/tags/static"
+)
+
+// client connects to the driver and answers its messages with the
+// given function, as a browser would.
+func client(t *testing.T, driver *Driver, answer func([]byte) (int, []byte)) {
+	srv := httptest.NewServer(driver)
+	t.Cleanup(srv.Close)
+	url := "ws" + strings.TrimPrefix(srv.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		for {
+			_, msg, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			msgType, rx := answer(msg)
+			if err := conn.WriteMessage(msgType, rx); err != nil {
+				return
+			}
+		}
+	}()
+}
+
+func TestDriver(t *testing.T) {
+	tag := static.New()
+	tagDriver := &swtag.Driver{Tag: tag}
+	tagDriver.Initialize()
+	driver := New()
+	client(t, driver, func(tx []byte) (int, []byte) {
+		rx, err := tagDriver.TransceiveBytes(tx, 256)
+		if err != nil {
+			return websocket.TextMessage, []byte(err.Error())
+		}
+		return websocket.BinaryMessage, rx
+	})
+	device := nfctype4.New(driver)
+
+	msg := ndef.NewTextMessage(strings.Repeat("browser ", 50), "en")
+	if err := device.Update(msg); err != nil {
+		t.Fatal(err)
+	}
+	if tag.GetMessage().String() != msg.String() {
+		t.Error("the message did not reach the tag")
+	}
+	readMsg, err := device.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if readMsg.String() != msg.String() {
+		t.Error("unexpected message:", readMsg)
+	}
+}
+
+func TestDriver_errors(t *testing.T) {
+	driver := New()
+	driver.Timeout = 50 * time.Millisecond
+	if _, err := driver.TransceiveBytes([]byte{0x00}, 2); err == nil {
+		t.Error("TransceiveBytes should fail before Initialize")
+	}
+	if err := driver.Initialize(); err == nil {
+		t.Error("Initialize should fail without clients")
+	}
+	if err := (&Driver{}).Initialize(); err == nil {
+		t.Error("Initialize should fail when not created with New()")
+	}
+
+	client(t, driver, func(tx []byte) (int, []byte) {
+		if len(tx) == 1 {
+			return websocket.BinaryMessage, []byte{0x90, 0x00, 0x00}
+		}
+		return websocket.TextMessage, []byte("no tag")
+	})
+	if err := driver.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	defer driver.Close()
+	_, err := driver.TransceiveBytes([]byte{0x00, 0xA4}, 2)
+	if err == nil || err.Error() != "remote: no tag" {
+		t.Error("expected the remote error but got:", err)
+	}
+	if _, err := driver.TransceiveBytes([]byte{0x00}, 2); err == nil {
+		t.Error("TransceiveBytes should fail with long answers")
+	}
+}
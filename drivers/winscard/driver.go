@@ -0,0 +1,239 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+// Package winscard provides a CommandDriver implementation which uses
+// the PC/SC API of Windows (winscard.dll) directly, without cgo, to
+// talk to the contactless readers installed in the system.
+//
+// The driver can wait for a tag to be placed on a reader (and for
+// readers to be plugged in) by monitoring the reader states with
+// SCardGetStatusChange, instead of polling.
+package winscard
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hsanjuan/go-nfctype4"
+)
+
+// Common errors
+var (
+	ErrNoReadersDetected = errors.New("no PC/SC readers detected")
+	ErrNoTargetsDetected = errors.New("no card present in the reader")
+)
+
+// Driver implements the CommandDriver interface for the PC/SC readers
+// of a Windows system. It allows `Device` to communicate with the
+// card (tag) present in the reader.
+type Driver struct {
+	// Reader selects the reader whose name contains the given
+	// string. Defaults to the first reader.
+	Reader string
+	// WaitForCard makes Initialize wait until a card is present in
+	// one of the readers, instead of failing.
+	WaitForCard bool
+	// WaitTimeout limits the time that Initialize waits for a card.
+	// 0 means no limit.
+	WaitTimeout time.Duration
+	// Trace, when set, receives the bytes exchanged with the tag.
+	Trace nfctype4.Tracer
+
+	ctx    scardContext
+	card   scardCard
+	reader string
+}
+
+// Initialize establishes a PC/SC context and connects to the card in
+// the reader, waiting for it when WaitForCard is set.
+//
+// It returns ErrNoReadersDetected or ErrNoTargetsDetected when no
+// reader or card is available, or an error when some other step
+// fails.
+func (driver *Driver) Initialize() error {
+	driver.Close()
+	ctx, err := establishContext()
+	if err != nil {
+		return err
+	}
+	driver.ctx = ctx
+
+	var reader string
+	if driver.WaitForCard {
+		reader, err = driver.waitForCard()
+	} else {
+		reader, err = driver.findReader()
+	}
+	if err != nil {
+		driver.Close()
+		return err
+	}
+	card, err := ctx.connect(reader)
+	if err == errNoSmartcard || err == errRemovedCard {
+		err = ErrNoTargetsDetected
+	}
+	if err != nil {
+		driver.Close()
+		return err
+	}
+	driver.card = card
+	driver.reader = reader
+	return nil
+}
+
+// ListReaders returns the names of the PC/SC readers connected to the
+// system, which can be used to select them with the Reader field.
+func ListReaders() ([]string, error) {
+	ctx, err := establishContext()
+	if err != nil {
+		return nil, err
+	}
+	defer ctx.release()
+	readers, err := ctx.listReaders()
+	if err == errNoReaders {
+		return nil, nil
+	}
+	return readers, err
+}
+
+// readers lists the readers matching the Reader field.
+func (driver *Driver) readers() ([]string, error) {
+	all, err := driver.ctx.listReaders()
+	if err == errNoReaders {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var readers []string
+	for _, r := range all {
+		if strings.Contains(r, driver.Reader) {
+			readers = append(readers, r)
+		}
+	}
+	return readers, nil
+}
+
+// findReader returns the first matching reader.
+func (driver *Driver) findReader() (string, error) {
+	readers, err := driver.readers()
+	if err != nil {
+		return "", err
+	}
+	if len(readers) == 0 {
+		return "", ErrNoReadersDetected
+	}
+	return readers[0], nil
+}
+
+// waitForCard waits until a card is present in one of the matching
+// readers and returns the name of that reader. Readers plugged in
+// while waiting are taken into account.
+func (driver *Driver) waitForCard() (string, error) {
+	var deadline time.Time
+	if driver.WaitTimeout > 0 {
+		deadline = time.Now().Add(driver.WaitTimeout)
+	}
+	known := make(map[string]uint32)
+	for {
+		readers, err := driver.readers()
+		if err != nil {
+			return "", err
+		}
+		states := []readerState{{
+			reader:       pnpNotification,
+			currentState: known[pnpNotification],
+		}}
+		for _, r := range readers {
+			states = append(states, readerState{
+				reader:       r,
+				currentState: known[r],
+			})
+		}
+
+		timeout := infinite
+		if !deadline.IsZero() {
+			timeout = time.Until(deadline)
+			if timeout < 0 {
+				timeout = 0
+			}
+		}
+		err = driver.ctx.getStatusChange(states, timeout)
+		if err == errTimeout {
+			return "", ErrNoTargetsDetected
+		}
+		if err != nil {
+			return "", err
+		}
+
+		for _, st := range states {
+			if st.reader != pnpNotification &&
+				st.eventState&statePresent != 0 &&
+				st.eventState&stateMute == 0 {
+				return st.reader, nil
+			}
+			known[st.reader] = st.eventState &^ stateChanged
+		}
+	}
+}
+
+// String returns information about the reader.
+// It should be used after calling Initialize().
+func (driver *Driver) String() string {
+	if driver.reader == "" {
+		return fmt.Sprintln("WinSCard Driver. No reader information.")
+	}
+	return fmt.Sprintf("WinSCard Driver. Reader: %s\n", driver.reader)
+}
+
+// TransceiveBytes sends the bytes to the card with SCardTransmit and
+// returns the response.
+//
+// It returns an error if the reader reports an error or if the
+// response is longer than rxLen.
+func (driver *Driver) TransceiveBytes(tx []byte, rxLen int) ([]byte, error) {
+	if driver.card == nil {
+		return nil, errors.New("Driver.TransceiveBytes: " +
+			"Driver not initialized")
+	}
+	driver.Trace.Trace(true, tx)
+	rx, err := driver.card.transmit(tx, rxLen)
+	if err == errInsufficientBuffer {
+		return nil, errors.New("Driver.TransceiveBytes: " +
+			"The length of the response is larger than expected")
+	}
+	if err != nil {
+		return nil, err
+	}
+	driver.Trace.Trace(false, rx)
+	return rx, nil
+}
+
+// Close disconnects from the card and releases the PC/SC context.
+func (driver *Driver) Close() {
+	if driver.card != nil {
+		driver.card.disconnect()
+	}
+	if driver.ctx != nil {
+		driver.ctx.release()
+	}
+	driver.card = nil
+	driver.ctx = nil
+	driver.reader = ""
+}
@@ -0,0 +1,222 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package winscard
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf16"
+
+	"github.com/hsanjuan/go-ndef"
+	"github.com/hsanjuan/go-nfctype4"
+	"github.com/hsanjuan/go-nfctype4/drivers/swtag"
+	"github.com/hsanjuan/go-nfctype4/tags/static"
+)
+
+// fakeContext emulates a PC/SC system where a reader is plugged in
+// and then a card is placed on it, after some status changes.
+type fakeContext struct {
+	tag      *swtag.Driver
+	readers  []string
+	changes  int // Status changes until the card is present
+	waits    int
+	released bool
+}
+
+func (ctx *fakeContext) listReaders() ([]string, error) {
+	if len(ctx.readers) == 0 {
+		return nil, errNoReaders
+	}
+	return ctx.readers, nil
+}
+
+func (ctx *fakeContext) getStatusChange(states []readerState, timeout time.Duration) error {
+	ctx.waits++
+	if ctx.changes == 0 && timeout != infinite {
+		return errTimeout
+	}
+	ctx.changes--
+	for i := range states {
+		states[i].eventState = stateChanged
+	}
+	if len(ctx.readers) == 0 {
+		// A reader is plugged in
+		ctx.readers = []string{"ACS ACR122 0", "Other Reader 0"}
+		states[0].eventState |= 0x10000
+		return nil
+	}
+	if ctx.changes <= 0 {
+		for i := range states {
+			if states[i].reader == "ACS ACR122 0" {
+				states[i].eventState |= statePresent
+			}
+		}
+	}
+	return nil
+}
+
+func (ctx *fakeContext) connect(reader string) (scardCard, error) {
+	if ctx.changes > 0 {
+		return nil, errNoSmartcard
+	}
+	return &fakeCard{ctx.tag}, nil
+}
+
+func (ctx *fakeContext) release() error {
+	ctx.released = true
+	return nil
+}
+
+type fakeCard struct {
+	tag *swtag.Driver
+}
+
+func (card *fakeCard) transmit(tx []byte, rxLen int) ([]byte, error) {
+	rx, err := card.tag.TransceiveBytes(tx, 65538)
+	if err != nil {
+		return nil, err
+	}
+	if len(rx) > rxLen {
+		return nil, errInsufficientBuffer
+	}
+	return rx, nil
+}
+
+func (card *fakeCard) disconnect() error {
+	return nil
+}
+
+func useFakeContext(t *testing.T, ctx *fakeContext) {
+	orig := establishContext
+	establishContext = func() (scardContext, error) {
+		return ctx, nil
+	}
+	t.Cleanup(func() { establishContext = orig })
+}
+
+func TestDriver(t *testing.T) {
+	tag := static.New()
+	if err := tag.SetMaxDataLengths(0x0400, 0x0400); err != nil {
+		t.Fatal(err)
+	}
+	ctx := &fakeContext{
+		tag:     &swtag.Driver{Tag: tag},
+		readers: []string{"ACS ACR122 0"},
+	}
+	useFakeContext(t, ctx)
+	driver := &Driver{}
+	device := nfctype4.New(driver)
+
+	msg := ndef.NewTextMessage(strings.Repeat("winscard ", 100), "en")
+	if err := device.Update(msg); err != nil {
+		t.Fatal(err)
+	}
+	readMsg, err := device.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if readMsg.String() != msg.String() {
+		t.Error("unexpected message:", readMsg)
+	}
+	if !ctx.released {
+		t.Error("the context should have been released")
+	}
+}
+
+func TestDriver_Initialize(t *testing.T) {
+	useFakeContext(t, &fakeContext{})
+	driver := &Driver{}
+	if err := driver.Initialize(); err != ErrNoReadersDetected {
+		t.Error("expected ErrNoReadersDetected but got:", err)
+	}
+
+	useFakeContext(t, &fakeContext{
+		readers: []string{"ACS ACR122 0"},
+		changes: 1,
+	})
+	if err := driver.Initialize(); err != ErrNoTargetsDetected {
+		t.Error("expected ErrNoTargetsDetected but got:", err)
+	}
+
+	driver = &Driver{}
+	if _, err := driver.TransceiveBytes([]byte{0x00}, 2); err == nil {
+		t.Error("TransceiveBytes should fail before Initialize")
+	}
+}
+
+func TestDriver_WaitForCard(t *testing.T) {
+	ctx := &fakeContext{
+		tag:     &swtag.Driver{Tag: static.New()},
+		changes: 3,
+	}
+	useFakeContext(t, ctx)
+	driver := &Driver{Reader: "ACR122", WaitForCard: true}
+	if err := driver.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	defer driver.Close()
+	if ctx.waits != 3 {
+		t.Error("expected 3 status changes but got", ctx.waits)
+	}
+	if !strings.Contains(driver.String(), "ACS ACR122 0") {
+		t.Error("String should include the reader name")
+	}
+
+	ctx = &fakeContext{readers: []string{"ACS ACR122 0"}}
+	useFakeContext(t, ctx)
+	driver = &Driver{
+		WaitForCard: true,
+		WaitTimeout: time.Millisecond,
+	}
+	if err := driver.Initialize(); err != ErrNoTargetsDetected {
+		t.Error("expected ErrNoTargetsDetected but got:", err)
+	}
+}
+
+func TestParseMultiString(t *testing.T) {
+	buf := utf16.Encode([]rune("Reader A\x00Lector ñ\x00\x00"))
+	list := parseMultiString(buf)
+	if len(list) != 2 || list[0] != "Reader A" || list[1] != "Lector ñ" {
+		t.Errorf("unexpected list: %q", list)
+	}
+	if parseMultiString([]uint16{0, 0}) != nil {
+		t.Error("expected an empty list")
+	}
+}
+
+func TestListReaders(t *testing.T) {
+	ctx := &fakeContext{}
+	useFakeContext(t, ctx)
+	readers, err := ListReaders()
+	if err != nil || len(readers) != 0 {
+		t.Error("no readers expected:", readers, err)
+	}
+	if !ctx.released {
+		t.Error("the context should be released")
+	}
+
+	ctx.readers = []string{"ACS ACR122 0", "Other Reader 0"}
+	readers, err = ListReaders()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(readers) != 2 || readers[1] != "Other Reader 0" {
+		t.Error("unexpected readers:", readers)
+	}
+}
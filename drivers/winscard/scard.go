@@ -0,0 +1,108 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package winscard
+
+import (
+	"fmt"
+	"time"
+	"unicode/utf16"
+)
+
+// Reader states (SCARD_STATE_*).
+const (
+	stateChanged = 0x0002
+	statePresent = 0x0020
+	stateMute    = 0x0200
+)
+
+// pnpNotification is a pseudo-reader whose state changes when readers
+// are added or removed.
+const pnpNotification = `\\?PnP?\Notification`
+
+// infinite makes getStatusChange wait without timeout.
+const infinite = time.Duration(-1)
+
+// scardError is an error code returned by the PC/SC functions.
+type scardError uint32
+
+// PC/SC error codes used by the driver.
+const (
+	errInsufficientBuffer = scardError(0x80100008)
+	errTimeout            = scardError(0x8010000A)
+	errNoSmartcard        = scardError(0x8010000C)
+	errNoService          = scardError(0x8010001D)
+	errNoReaders          = scardError(0x8010002E)
+	errRemovedCard        = scardError(0x80100069)
+)
+
+var scardErrorNames = map[scardError]string{
+	errInsufficientBuffer: "insufficient buffer",
+	errTimeout:            "timeout",
+	errNoSmartcard:        "no smart card",
+	errNoService:          "service not running",
+	errNoReaders:          "no readers available",
+	errRemovedCard:        "card removed",
+}
+
+func (e scardError) Error() string {
+	if name, ok := scardErrorNames[e]; ok {
+		return fmt.Sprintf("PC/SC error %08xh: %s", uint32(e), name)
+	}
+	return fmt.Sprintf("PC/SC error %08xh", uint32(e))
+}
+
+// readerState mirrors SCARD_READERSTATE.
+type readerState struct {
+	reader       string
+	currentState uint32
+	eventState   uint32
+}
+
+// scardContext is a PC/SC resource manager context.
+type scardContext interface {
+	listReaders() ([]string, error)
+	// getStatusChange waits until the state of some reader differs
+	// from its currentState, and updates the eventStates.
+	getStatusChange(states []readerState, timeout time.Duration) error
+	connect(reader string) (scardCard, error)
+	release() error
+}
+
+// scardCard is a connection with a card.
+type scardCard interface {
+	transmit(tx []byte, rxLen int) ([]byte, error)
+	disconnect() error
+}
+
+// parseMultiString parses a list of UTF-16 strings separated and
+// terminated by NULs, as returned by SCardListReaders.
+func parseMultiString(buf []uint16) []string {
+	var list []string
+	start := 0
+	for i, c := range buf {
+		if c != 0 {
+			continue
+		}
+		if i == start {
+			break
+		}
+		list = append(list, string(utf16.Decode(buf[start:i])))
+		start = i + 1
+	}
+	return list
+}
@@ -0,0 +1,180 @@
+//go:build windows
+
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package winscard
+
+import (
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+var (
+	winscard                  = syscall.NewLazyDLL("winscard.dll")
+	procSCardEstablishContext = winscard.NewProc("SCardEstablishContext")
+	procSCardReleaseContext   = winscard.NewProc("SCardReleaseContext")
+	procSCardListReaders      = winscard.NewProc("SCardListReadersW")
+	procSCardGetStatusChange  = winscard.NewProc("SCardGetStatusChangeW")
+	procSCardConnect          = winscard.NewProc("SCardConnectW")
+	procSCardDisconnect       = winscard.NewProc("SCardDisconnect")
+	procSCardTransmit         = winscard.NewProc("SCardTransmit")
+)
+
+// PC/SC parameters.
+const (
+	scopeUser     = 0
+	shareShared   = 2
+	protocolT0    = 1
+	protocolT1    = 2
+	leaveCard     = 0
+	infiniteDelay = 0xFFFFFFFF
+)
+
+// scardReaderState mirrors SCARD_READERSTATEW.
+type scardReaderState struct {
+	reader       *uint16
+	userData     uintptr
+	currentState uint32
+	eventState   uint32
+	atrLen       uint32
+	atr          [36]byte
+}
+
+// scardIORequest mirrors SCARD_IO_REQUEST.
+type scardIORequest struct {
+	protocol  uint32
+	pciLength uint32
+}
+
+// call runs a PC/SC function and converts its result to an error.
+func call(proc *syscall.LazyProc, args ...uintptr) error {
+	if err := proc.Find(); err != nil {
+		return err
+	}
+	r, _, _ := proc.Call(args...)
+	if r != 0 {
+		return scardError(r)
+	}
+	return nil
+}
+
+type winContext struct {
+	handle uintptr
+}
+
+var establishContext = func() (scardContext, error) {
+	ctx := &winContext{}
+	err := call(procSCardEstablishContext, scopeUser, 0, 0,
+		uintptr(unsafe.Pointer(&ctx.handle)))
+	if err != nil {
+		return nil, err
+	}
+	return ctx, nil
+}
+
+func (ctx *winContext) listReaders() ([]string, error) {
+	var n uint32
+	err := call(procSCardListReaders, ctx.handle, 0, 0,
+		uintptr(unsafe.Pointer(&n)))
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]uint16, n)
+	err = call(procSCardListReaders, ctx.handle, 0,
+		uintptr(unsafe.Pointer(&buf[0])), uintptr(unsafe.Pointer(&n)))
+	if err != nil {
+		return nil, err
+	}
+	return parseMultiString(buf[:n]), nil
+}
+
+func (ctx *winContext) getStatusChange(states []readerState, timeout time.Duration) error {
+	ms := uint32(infiniteDelay)
+	if timeout >= 0 {
+		ms = uint32(timeout / time.Millisecond)
+	}
+	cStates := make([]scardReaderState, len(states))
+	for i, st := range states {
+		name, err := syscall.UTF16PtrFromString(st.reader)
+		if err != nil {
+			return err
+		}
+		cStates[i].reader = name
+		cStates[i].currentState = st.currentState
+	}
+	err := call(procSCardGetStatusChange, ctx.handle, uintptr(ms),
+		uintptr(unsafe.Pointer(&cStates[0])), uintptr(len(cStates)))
+	if err != nil {
+		return err
+	}
+	for i := range states {
+		states[i].eventState = cStates[i].eventState
+	}
+	return nil
+}
+
+func (ctx *winContext) connect(reader string) (scardCard, error) {
+	name, err := syscall.UTF16PtrFromString(reader)
+	if err != nil {
+		return nil, err
+	}
+	card := &winCard{}
+	err = call(procSCardConnect, ctx.handle,
+		uintptr(unsafe.Pointer(name)), shareShared,
+		protocolT0|protocolT1,
+		uintptr(unsafe.Pointer(&card.handle)),
+		uintptr(unsafe.Pointer(&card.protocol)))
+	if err != nil {
+		return nil, err
+	}
+	return card, nil
+}
+
+func (ctx *winContext) release() error {
+	return call(procSCardReleaseContext, ctx.handle)
+}
+
+type winCard struct {
+	handle   uintptr
+	protocol uint32
+}
+
+func (card *winCard) transmit(tx []byte, rxLen int) ([]byte, error) {
+	if len(tx) == 0 || rxLen <= 0 {
+		return nil, errInsufficientBuffer
+	}
+	pci := scardIORequest{
+		protocol:  card.protocol,
+		pciLength: uint32(unsafe.Sizeof(scardIORequest{})),
+	}
+	rx := make([]byte, rxLen)
+	n := uint32(rxLen)
+	err := call(procSCardTransmit, card.handle,
+		uintptr(unsafe.Pointer(&pci)),
+		uintptr(unsafe.Pointer(&tx[0])), uintptr(len(tx)), 0,
+		uintptr(unsafe.Pointer(&rx[0])), uintptr(unsafe.Pointer(&n)))
+	if err != nil {
+		return nil, err
+	}
+	return rx[:n], nil
+}
+
+func (card *winCard) disconnect() error {
+	return call(procSCardDisconnect, card.handle, leaveCard)
+}
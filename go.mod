@@ -4,5 +4,16 @@ go 1.19
 
 require (
 	github.com/clausecker/nfc/v2 v2.1.4
+	github.com/gorilla/websocket v1.5.0
 	github.com/hsanjuan/go-ndef v0.0.1
+	google.golang.org/grpc v1.64.1
+	google.golang.org/protobuf v1.33.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	golang.org/x/net v0.26.0 // indirect
+	golang.org/x/sys v0.21.0 // indirect
+	golang.org/x/text v0.16.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240318140521-94a12d6c2237 // indirect
 )
@@ -21,6 +21,7 @@ package helpers
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"runtime"
 )
 
@@ -47,6 +48,9 @@ func Uint16ToBytes(value uint16) [2]byte {
 // while this wrapper allows to catch out of bounds errors in
 // a single place and save dozens of "if error!=nil" blocks.
 func GetBytes(b *bytes.Buffer, n int) []byte {
+	if n < 0 || n > b.Len() {
+		panic(errors.New("Unexpected end of data."))
+	}
 	slice := make([]byte, n)
 	nread, err := b.Read(slice)
 	if err != nil || nread != n {
@@ -74,7 +78,10 @@ func HandleErrorPanic(err *error, functionName string) {
 		if _, ok := r.(runtime.Error); ok {
 			panic(r)
 		}
-		perr := r.(error)
+		perr, ok := r.(error)
+		if !ok {
+			perr = fmt.Errorf("%v", r)
+		}
 		*err = errors.New(functionName + ": " + perr.Error())
 	}
 }
@@ -92,3 +92,15 @@ func TestHandleErrorPanic(t *testing.T) {
 		t.Error("Expected an Ops error")
 	}
 }
+
+func TestHandleErrorPanic_notError(t *testing.T) {
+	var err error
+	a := func() error {
+		defer HandleErrorPanic(&err, "Test")
+		panic("Ops")
+	}
+	a()
+	if err == nil || err.Error() != "Test: Ops" {
+		t.Error("Expected an Ops error")
+	}
+}
@@ -0,0 +1,79 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hsanjuan/go-nfctype4"
+	"github.com/hsanjuan/go-nfctype4/apdu"
+)
+
+// doAPDU selects the target and sends the Command APDUs given as
+// arguments (in hexadecimal), printing the decoded responses. The
+// status of the responses is not checked, so that vendor commands can
+// be tried freely. With -json, the exchanges are output as a JSON
+// transcript.
+func doAPDU(args []string) error {
+	if len(args) == 0 {
+		argError("apdu needs at least one Command APDU in hexadecimal.")
+	}
+	cApdus := make([]*apdu.CAPDU, len(args))
+	for i, arg := range args {
+		cApdu := new(apdu.CAPDU)
+		hexAPDU := strings.Join(strings.Fields(arg), "")
+		if err := cApdu.UnmarshalText([]byte(hexAPDU)); err != nil {
+			return err
+		}
+		cApdus[i] = cApdu
+	}
+
+	driver := selectDriver()
+	if err := driver.Initialize(); err != nil {
+		return err
+	}
+	defer driver.Close()
+	cmder := &nfctype4.Commander{Driver: driver, Retries: retriesFlag}
+	var transcript []apdu.Exchange
+	for _, cApdu := range cApdus {
+		if !jsonFlag {
+			fmt.Println(">", cApdu.Dump())
+		}
+		rApdu, err := cmder.Transceive(cApdu)
+		if err != nil {
+			return err
+		}
+		if !jsonFlag {
+			fmt.Println("<", rApdu.Dump())
+		}
+		transcript = append(transcript, apdu.Exchange{
+			Command:  cApdu,
+			Response: rApdu,
+		})
+	}
+	if jsonFlag {
+		out, err := json.MarshalIndent(transcript, "", "  ")
+		if err != nil {
+			return err
+		}
+		output(out)
+	}
+	return nil
+}
@@ -0,0 +1,234 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package main
+
+import (
+	"crypto/rand"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/hsanjuan/go-ndef"
+	"github.com/hsanjuan/go-nfctype4"
+	"github.com/hsanjuan/go-nfctype4/drivers/auto"
+)
+
+// templateVar matches the variables in batch templates, i.e. {seq}.
+var templateVar = regexp.MustCompile(`\{([A-Za-z0-9_]+)\}`)
+
+// expandTemplate replaces the {name} variables in the template with
+// their values.
+//
+// It returns an error if a variable has no value.
+func expandTemplate(tmpl string, vars map[string]string) (string, error) {
+	var err error
+	out := templateVar.ReplaceAllStringFunc(tmpl, func(v string) string {
+		name := v[1 : len(v)-1]
+		value, ok := vars[name]
+		if !ok && err == nil {
+			err = fmt.Errorf("template: unknown variable %s", v)
+		}
+		return value
+	})
+	return out, err
+}
+
+// newUUID returns a random (version 4) UUID.
+func newUUID() (string, error) {
+	u := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, u); err != nil {
+		return "", err
+	}
+	u[6] = u[6]&0x0F | 0x40 // Version 4
+	u[8] = u[8]&0x3F | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x",
+		u[0:4], u[4:6], u[6:8], u[8:10], u[10:]), nil
+}
+
+// readCSV reads a CSV file whose first line names the columns. It
+// returns a map from column name to value for every other line.
+func readCSV(path string) ([]map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	lines, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 {
+		return nil, errors.New("csv: missing header line")
+	}
+	var rows []map[string]string
+	for _, line := range lines[1:] {
+		row := make(map[string]string)
+		for i, name := range lines[0] {
+			if i < len(line) {
+				row[name] = line[i]
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// batchVars returns the template variables for the n-th tag of the
+// batch: {seq}, {uuid} and the columns of the n-th CSV row.
+func batchVars(n int, rows []map[string]string) (map[string]string, error) {
+	vars := make(map[string]string)
+	if n < len(rows) {
+		for k, v := range rows[n] {
+			vars[k] = v
+		}
+	}
+	vars["seq"] = fmt.Sprint(startFlag + n)
+	uuid, err := newUUID()
+	if err != nil {
+		return nil, err
+	}
+	vars["uuid"] = uuid
+	return vars, nil
+}
+
+// waitForPresence initializes the driver once a tag is present in
+// the field.
+func waitForPresence(driver nfctype4.CommandDriver) error {
+	for {
+		err := driver.Initialize()
+		if !auto.IsNoTarget(err) {
+			return err
+		}
+		driver.Close()
+		time.Sleep(intervalFlag)
+	}
+}
+
+// waitForRemoval returns once there is no tag in the field.
+func waitForRemoval(driver nfctype4.CommandDriver) {
+	for {
+		err := driver.Initialize()
+		driver.Close()
+		if auto.IsNoTarget(err) {
+			return
+		}
+		time.Sleep(intervalFlag)
+	}
+}
+
+// doBatch programs successive tags, as they are presented to the
+// reader, with payloads built from a template. The UID of every tag
+// programmed and its payload are printed and, with -log, appended to a
+// CSV file.
+func doBatch(args []string) error {
+	if templateFlag == "" {
+		argError("batch needs a -template.")
+	}
+	var rows []map[string]string
+	if csvFlag != "" {
+		var err error
+		rows, err = readCSV(csvFlag)
+		if err != nil {
+			return err
+		}
+	}
+	count := countFlag
+	if count == 0 {
+		count = len(rows)
+	}
+	if count == 0 {
+		argError("batch needs a -count or a -csv file.")
+	}
+	tnf := tnfToCode(tnfFlag)
+
+	var logWriter *csv.Writer
+	if logFlag != "" {
+		f, err := os.OpenFile(logFlag,
+			os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		logWriter = csv.NewWriter(f)
+	}
+
+	driver := selectDriver()
+	for n := 0; n < count; {
+		vars, err := batchVars(n, rows)
+		if err != nil {
+			return err
+		}
+		payload, err := expandTemplate(templateFlag, vars)
+		if err != nil {
+			return err
+		}
+		msg := &ndef.Message{Records: []*ndef.Record{
+			makeRecord(tnf, typeFlag, "", "en", []byte(payload)),
+		}}
+
+		fmt.Fprintf(os.Stderr, "Present tag %d of %d...\n", n+1, count)
+		if err := waitForPresence(driver); err != nil {
+			return err
+		}
+		uid, err := programTag(driver, msg)
+		if err != nil {
+			// Try again with another tag (or the same one).
+			fmt.Fprintln(os.Stderr, err)
+			waitForRemoval(driver)
+			continue
+		}
+		fmt.Printf("%s %s\n", uid, payload)
+		if logWriter != nil {
+			logWriter.Write([]string{uid, payload})
+			logWriter.Flush()
+			if err := logWriter.Error(); err != nil {
+				return err
+			}
+		}
+		n++
+		waitForRemoval(driver)
+	}
+	return nil
+}
+
+// programTag writes the message to the tag selected by the driver,
+// which is closed afterwards, and returns its UID (or "unknown" when
+// the driver cannot provide it).
+func programTag(driver nfctype4.CommandDriver, msg *ndef.Message) (string, error) {
+	defer driver.Close()
+
+	uid := "unknown"
+	if info, err := targetInfo(driver); err == nil {
+		uid = fmt.Sprintf("%X", info.UID)
+	}
+	device := nfctype4.New(openDriver{driver})
+	device.Retries = retriesFlag
+	if err := device.Update(msg); err != nil {
+		return "", err
+	}
+	if verifyFlag {
+		if err := verifyMessage(device, msg); err != nil {
+			return "", err
+		}
+	}
+	return uid, nil
+}
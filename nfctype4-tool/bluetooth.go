@@ -0,0 +1,97 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/hsanjuan/go-ndef"
+)
+
+// BluetoothOOBType is the MIME type of the records carrying Bluetooth
+// BR/EDR Out-Of-Band pairing data.
+const BluetoothOOBType = "application/vnd.bluetooth.ep.oob"
+
+// Extended Inquiry Response data types.
+const (
+	eirShortName    = 0x08
+	eirCompleteName = 0x09
+)
+
+// maxEIRData is the maximum length of the data of an EIR structure.
+const maxEIRData = 0xFF - 1
+
+// parseBluetoothAddress parses a Bluetooth device address given as
+// six hexadecimal bytes separated by colons or dashes, i.e.
+// 00:11:22:33:44:55. The bytes are returned in transmission order
+// (least significant first), as used in the OOB data.
+func parseBluetoothAddress(addr string) ([]byte, error) {
+	parts := strings.FieldsFunc(addr, func(r rune) bool {
+		return r == ':' || r == '-'
+	})
+	if len(parts) != 6 {
+		return nil, fmt.Errorf("bad Bluetooth address %q", addr)
+	}
+	bdaddr := make([]byte, 6)
+	for i, p := range parts {
+		b, err := hex.DecodeString(p)
+		if err != nil || len(b) != 1 {
+			return nil, fmt.Errorf("bad Bluetooth address %q", addr)
+		}
+		bdaddr[5-i] = b[0]
+	}
+	return bdaddr, nil
+}
+
+// bluetoothOOB builds the Bluetooth BR/EDR OOB data for the given
+// address and device name: the total length (2 bytes, little endian),
+// the device address and, when a name is given, an EIR structure with
+// the local name.
+func bluetoothOOB(addr, name string) ([]byte, error) {
+	bdaddr, err := parseBluetoothAddress(addr)
+	if err != nil {
+		return nil, err
+	}
+	data := append([]byte{0, 0}, bdaddr...)
+	if name != "" {
+		nameType := byte(eirCompleteName)
+		if len(name) > maxEIRData {
+			nameType = eirShortName
+			name = name[:maxEIRData]
+		}
+		data = append(data, byte(len(name)+1), nameType)
+		data = append(data, name...)
+	}
+	data[0] = byte(len(data))
+	data[1] = byte(len(data) >> 8)
+	return data, nil
+}
+
+// bluetoothMessage builds a message with a Bluetooth OOB record which
+// allows phones to pair with the device by tapping the tag.
+func bluetoothMessage(addr, name string) (*ndef.Message, error) {
+	oob, err := bluetoothOOB(addr, name)
+	if err != nil {
+		return nil, err
+	}
+	return &ndef.Message{Records: []*ndef.Record{
+		makeRecord(ndef.MediaType, BluetoothOOBType, "", "", oob),
+	}}, nil
+}
@@ -0,0 +1,291 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+)
+
+// command is a subcommand of the tool. Every command has its own set
+// of flags, which are given after the command name.
+type command struct {
+	name    string
+	args    string // Description of the arguments for the usage line
+	summary string // One line description
+	help    string // Longer description for the command usage
+	flags   func(fs *flag.FlagSet)
+	run     func(args []string) error
+}
+
+// commands lists the subcommands of the tool, in the order in which
+// they are shown in the usage.
+var commands = []*command{
+	{
+		name:    "inspect",
+		summary: "print information about the NDEF Message.",
+		help: `Reads the NDEF Message from a tag and prints a detailed description of
+its records. With -json or -yaml, the records and the Capability
+Container are output in a machine-readable form. With -trust, the
+Signature records are verified and nothing is output unless they are
+valid and cover every record.`,
+		flags: func(fs *flag.FlagSet) {
+			outputFlags(fs)
+			yamlFlags(fs)
+			trustFlags(fs)
+		},
+		run: doInspect,
+	},
+	{
+		name:    "info",
+		summary: "identify the tag and print its Capability Container.",
+		help: `Prints the UID and ATS of the tag, a best-effort identification of its
+chip (NTAG 4xx, DESFire, ST25TA, YubiKey) and its decoded Capability
+Container. With -json or -yaml, the same information is output in a
+machine-readable form.`,
+		flags: func(fs *flag.FlagSet) {
+			outputFlags(fs)
+			yamlFlags(fs)
+		},
+		run: doInfo,
+	},
+	{
+		name:    "read",
+		summary: "read the contents from a tag.",
+		help: `Reads the NDEF Message from a tag. Unless -raw is given, the program
+tries to produce a printable output for it. With -extract-dir, the
+payloads of the records (images, vCards...) are written to separate
+files instead. With -trust, the Signature records are verified and
+nothing is output unless they are valid and cover every record.`,
+		flags: func(fs *flag.FlagSet) {
+			outputFlags(fs)
+			yamlFlags(fs)
+			trustFlags(fs)
+			fs.BoolVar(&rawFlag, "raw", false,
+				"Output raw NDEF File contents")
+			fs.StringVar(&extractFlag, "extract-dir", "",
+				"Write the payload of every record to a file in this directory, named by index and type")
+		},
+		run: doRead,
+	},
+	{
+		name:    "write",
+		args:    "[payload]",
+		summary: "update a tag with the given payload.",
+		help: `Writes a NDEF Message to a tag. The payload is taken from the argument
+or read from a file, or from stdin when the argument is "-" or
+missing. The TNF and Type fields can be controlled with their
+respective flags. With -smartposter, the payload is an URI which is
+written in a Smart Poster along with the -title and -action given.
+With -bluetooth, a Bluetooth pairing record is written instead, so
+that phones can pair with the device by tapping the tag. With
+-sign-key, a Signature record (NFC Forum Signature RTD) covering the
+written records is appended, so that the tag can be authenticated.`,
+		flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&fileFlag, "file", "",
+				"Read the payload from file (takes precedence over the payload argument and stdin)")
+			fs.BoolVar(&hexFlag, "hex", false,
+				"The payload is given in hexadecimal (i.e. 01:02:0a or 01020a)")
+			fs.StringVar(&rawNDEFFlag, "raw-ndef", "",
+				"Write the serialized NDEF Message in this file verbatim (takes precedence over the rest)")
+			fs.StringVar(&manifestFlag, "manifest", "",
+				"Write the records described in a YAML or JSON manifest (takes precedence over -file)")
+			recordFlags(fs)
+			fs.BoolVar(&posterFlag, "smartposter", false,
+				"Write a Smart Poster for the URI given as payload")
+			fs.Var(&titleFlag, "title",
+				"Title of the Smart Poster, as text or lang:text (can be repeated)")
+			fs.StringVar(&actionFlag, "action", "",
+				"Action of the Smart Poster: do, save or edit")
+			fs.StringVar(&btAddrFlag, "bluetooth", "",
+				"Write a Bluetooth pairing record for the device with this address (i.e. 00:11:22:33:44:55)")
+			fs.StringVar(&btNameFlag, "bluetooth-name", "",
+				"Name of the Bluetooth device")
+			fs.StringVar(&signKeyFlag, "sign-key", "",
+				"Append a Signature record made with the PEM private key (RSA 1024/2048, ECDSA P-224/P-256) in this file")
+			fs.StringVar(&signCertFlag, "sign-cert", "",
+				"Include the PEM certificate chain in this file in the Signature record, starting with the signer")
+			fs.BoolVar(&signPSSFlag, "sign-pss", false,
+				"Use RSASSA-PSS instead of RSASSA-PKCS1-v1_5 with RSA keys")
+			verifyFlags(fs)
+		},
+		run: doWrite,
+	},
+	{
+		name:    "format",
+		summary: "erase the contents of a tag.",
+		help:    "Erases the NDEF Message stored in a tag.",
+		flags:   verifyFlags,
+		run:     doFormat,
+	},
+	{
+		name:    "diff",
+		args:    "<file>",
+		summary: "compare the message in the tag with a reference file.",
+		help: `Reads the NDEF Message from a tag and compares it with the one in a
+reference file, which is a manifest (.json, .yaml or .yml) or a raw
+NDEF Message. The differences found are printed, and the program fails
+if there are any.`,
+		run: doDiff,
+	},
+	{
+		name:    "watch",
+		summary: "read every tag presented to the reader, printing it or running -exec.",
+		help: `Reads every tag presented to the reader until the program is
+interrupted. For each tag, a line with the message is printed or, with
+-exec, the given command is run with the payload on its stdin.`,
+		flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&execFlag, "exec", "",
+				"Command run for every tag, with the payload on stdin")
+			fs.DurationVar(&intervalFlag, "interval", 500*time.Millisecond,
+				"Time between polls")
+		},
+		run: doWatch,
+	},
+	{
+		name:    "batch",
+		summary: "program successive tags with payloads built from a template.",
+		help: `Programs successive tags, as they are presented to the reader, with
+the payload given by -template. The {seq} variable in the template is
+replaced by a counter, {uuid} by a random UUID and {column} by the
+value of that column in the line of the -csv file for the tag. The UID
+of every tag programmed is printed along with its payload and, with
+-log, appended to a CSV file.`,
+		flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&templateFlag, "template", "",
+				"Payload template, i.e. https://example.com/asset/{seq}")
+			fs.IntVar(&countFlag, "count", 0,
+				"Number of tags to program. Defaults to the number of lines in -csv")
+			fs.IntVar(&startFlag, "start", 1,
+				"First value of {seq}")
+			fs.StringVar(&csvFlag, "csv", "",
+				"CSV file, with a header line, providing values for the template")
+			fs.StringVar(&logFlag, "log", "",
+				"Append the UID and the payload of every tag to this CSV file")
+			recordFlags(fs)
+			fs.DurationVar(&intervalFlag, "interval", 500*time.Millisecond,
+				"Time between polls")
+			verifyFlags(fs)
+		},
+		run: doBatch,
+	},
+	{
+		name:    "apdu",
+		args:    "<apdu>...",
+		summary: "send the given Command APDUs (hex) to the tag and print the responses.",
+		help: `Selects the tag and sends the given Command APDUs, in hexadecimal,
+printing the decoded responses.`,
+		flags: outputFlags,
+		run:   doAPDU,
+	},
+	{
+		name:    "emulate",
+		args:    "<dir>",
+		summary: "emulate a tag with the reader, serving the one stored in a directory.",
+		help: `Puts the reader in target mode and emulates a tag, so that phones and
+other readers can read and update it, until the program is
+interrupted. The memory of the tag is kept in the given directory, so
+the updates survive between runs. With -message, the tag is loaded
+with the message in a manifest (.json, .yaml or .yml) or raw NDEF
+file first. The message is printed every time a reader releases the
+tag. Only the libnfc driver supports target mode.`,
+		flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&messageFlag, "message", "",
+				"Load the tag with the message in this manifest or raw NDEF file")
+			fs.BoolVar(&readOnlyFlag, "read-only", false,
+				"Reject the updates from the readers")
+		},
+		run: doEmulate,
+	},
+}
+
+// outputFlags adds the flags controlling the output of the commands
+// which print what they obtain from the tag.
+func outputFlags(fs *flag.FlagSet) {
+	fs.StringVar(&writeFlag, "output", "",
+		"Write output to path")
+	fs.BoolVar(&jsonFlag, "json", false,
+		"Output as JSON")
+}
+
+// yamlFlags adds the -yaml flag to the commands which can output the
+// same information as with -json.
+func yamlFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&yamlFlag, "yaml", false,
+		"Output as YAML")
+}
+
+// trustFlags adds the -trust flag to the commands which read the NDEF
+// Message.
+func trustFlags(fs *flag.FlagSet) {
+	fs.StringVar(&trustFlag, "trust", "",
+		"Verify the Signature records against the PEM certificates in this file and fail unless they are valid and cover every record")
+}
+
+// recordFlags adds the flags controlling the TNF and type of the
+// records written.
+func recordFlags(fs *flag.FlagSet) {
+	fs.StringVar(&tnfFlag, "tnf", "wkt",
+		"Type Name Format: "+
+			"wkt (Well-Known), "+
+			"ext (External), "+
+			"media (MIME)")
+	fs.StringVar(&typeFlag, "type", "T",
+		"The type of the message. Defaults to T[text]")
+}
+
+// verifyFlags adds the -verify flag to the commands which modify the
+// tag.
+func verifyFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&verifyFlag, "verify", false,
+		"Read the tag back afterwards and fail if the contents do not match")
+}
+
+// findCommand returns the command with the given name, or nil.
+func findCommand(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+// flagSet returns the flags of the command, with a usage function
+// describing it.
+func (cmd *command) flagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet(cmd.name, flag.ExitOnError)
+	if cmd.flags != nil {
+		cmd.flags(fs)
+	}
+	fs.Usage = func() {
+		line := "Usage: nfctype4-tool [options] " + cmd.name +
+			" [command options]"
+		if cmd.args != "" {
+			line += " " + cmd.args
+		}
+		fmt.Fprintf(os.Stderr, "%s\n\n", line)
+		fmt.Fprintf(os.Stderr, "%s\n\n", cmd.help)
+		fmt.Fprintf(os.Stderr, "Command options:\n")
+		fs.PrintDefaults()
+		fmt.Fprintln(os.Stderr)
+	}
+	return fs
+}
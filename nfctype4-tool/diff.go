@@ -0,0 +1,152 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/hsanjuan/go-ndef"
+)
+
+// readReference reads the message to compare with in diff: a manifest
+// (.json, .yaml or .yml) or a file with a raw NDEF Message.
+func readReference(path string) (*ndef.Message, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json", ".yaml", ".yml":
+		return readManifest(path)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	msg := new(ndef.Message)
+	if _, err := msg.Unmarshal(data); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return msg, nil
+}
+
+// describeRecord returns a one-line description of a record.
+func describeRecord(r *ndef.Record) string {
+	str := fmt.Sprintf("TNF %d, type %q", r.TNF(), r.Type())
+	if r.ID() != "" {
+		str += fmt.Sprintf(", ID %q", r.ID())
+	}
+	if pl, err := r.Payload(); err == nil {
+		str += fmt.Sprintf(": %q", pl.String())
+	}
+	return str
+}
+
+// diffRecords compares two records and returns the differences found,
+// one per line.
+func diffRecords(i int, tag, ref *ndef.Record) ([]string, error) {
+	var diffs []string
+	differs := func(field, t, r string) {
+		diffs = append(diffs, fmt.Sprintf(
+			"record %d: %s differs: tag %s, reference %s",
+			i, field, t, r))
+	}
+	if tag.TNF() != ref.TNF() {
+		differs("TNF", fmt.Sprint(tag.TNF()), fmt.Sprint(ref.TNF()))
+	}
+	if tag.Type() != ref.Type() {
+		differs("type", fmt.Sprintf("%q", tag.Type()),
+			fmt.Sprintf("%q", ref.Type()))
+	}
+	if tag.ID() != ref.ID() {
+		differs("ID", fmt.Sprintf("%q", tag.ID()),
+			fmt.Sprintf("%q", ref.ID()))
+	}
+	tagPl, err := tag.Payload()
+	if err != nil {
+		return nil, err
+	}
+	refPl, err := ref.Payload()
+	if err != nil {
+		return nil, err
+	}
+	tagBytes, refBytes := tagPl.Marshal(), refPl.Marshal()
+	if !bytes.Equal(tagBytes, refBytes) {
+		t, r := fmt.Sprintf("%q", tagPl.String()), fmt.Sprintf("%q", refPl.String())
+		if t == r { // Not visible in the printable form
+			t = fmt.Sprintf("% 02X", tagBytes)
+			r = fmt.Sprintf("% 02X", refBytes)
+		}
+		differs("payload", t, r)
+	}
+	return diffs, nil
+}
+
+// diffMessages compares the message read from the tag with the
+// reference and returns the differences found, one per line.
+func diffMessages(tag, ref *ndef.Message) ([]string, error) {
+	var diffs []string
+	for i := 0; i < len(tag.Records) || i < len(ref.Records); i++ {
+		switch {
+		case i >= len(ref.Records):
+			diffs = append(diffs, fmt.Sprintf(
+				"record %d: only in the tag: %s",
+				i, describeRecord(tag.Records[i])))
+		case i >= len(tag.Records):
+			diffs = append(diffs, fmt.Sprintf(
+				"record %d: only in the reference: %s",
+				i, describeRecord(ref.Records[i])))
+		default:
+			d, err := diffRecords(i, tag.Records[i], ref.Records[i])
+			if err != nil {
+				return nil, err
+			}
+			diffs = append(diffs, d...)
+		}
+	}
+	return diffs, nil
+}
+
+// doDiff reads the tag and compares its message with the one in the
+// reference file. It fails when they differ.
+func doDiff(args []string) error {
+	if len(args) != 1 {
+		argError("diff needs a reference file.")
+	}
+	ref, err := readReference(args[0])
+	if err != nil {
+		return err
+	}
+	device := makeDevice()
+	msg, err := device.Read()
+	if err != nil {
+		return err
+	}
+	diffs, err := diffMessages(msg, ref)
+	if err != nil {
+		return err
+	}
+	if len(diffs) == 0 {
+		fmt.Println("No differences.")
+		return nil
+	}
+	for _, d := range diffs {
+		fmt.Println(d)
+	}
+	return fmt.Errorf("the tag differs from %s", args[0])
+}
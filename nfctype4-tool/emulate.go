@@ -0,0 +1,84 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/hsanjuan/go-nfctype4"
+	"github.com/hsanjuan/go-nfctype4/tags"
+	"github.com/hsanjuan/go-nfctype4/tags/persistent"
+	"github.com/hsanjuan/go-nfctype4/tags/readonly"
+	"github.com/hsanjuan/go-nfctype4/tags/static"
+)
+
+// emulator is implemented by the drivers which can put the reader in
+// target mode to emulate a software tag.
+type emulator interface {
+	EmulateTag(tag tags.Tag) error
+}
+
+// doEmulate serves a persistent tag stored in the directory given as
+// argument to every reader which selects it, until the program is
+// interrupted.
+func doEmulate(args []string) error {
+	if len(args) != 1 {
+		argError("Error: the directory of the tag is missing.")
+	}
+
+	// Only the libnfc driver supports target mode, so use it
+	// unless told otherwise.
+	name := driverFlag
+	if name == "auto" {
+		name = "libnfc"
+	}
+	check(resolveReader())
+	driver, err := nfctype4.NewDriver(name)
+	if err != nil {
+		argError("Error: invalid driver selected.")
+	}
+	em, ok := driver.(emulator)
+	if !ok {
+		return fmt.Errorf("the %s driver cannot emulate tags", name)
+	}
+	tag, err := persistent.New(args[0], static.Options{})
+	if err != nil {
+		return err
+	}
+	if messageFlag != "" {
+		msg, err := readReference(messageFlag)
+		if err != nil {
+			return err
+		}
+		if err := tag.SetMessage(msg); err != nil {
+			return err
+		}
+	}
+	var served tags.Tag = tag
+	if readOnlyFlag {
+		served = readonly.New(tag)
+	}
+	for {
+		if err := em.EmulateTag(served); err != nil {
+			return err
+		}
+		if msg := tag.GetMessage(); msg != nil {
+			fmt.Println(msg)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hsanjuan/go-ndef"
+)
+
+// extensions for common record types which are not always known to the
+// mime package.
+var extensions = map[string]string{
+	"text/vcard":   ".vcf",
+	"text/x-vcard": ".vcf",
+	"text/plain":   ".txt",
+}
+
+// fileNameChars are the characters kept from the record types when
+// building file names.
+const fileNameChars = "abcdefghijklmnopqrstuvwxyz" +
+	"ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789.+-"
+
+// recordFileName returns the name of the file for the i-th record of
+// a message, made from its index and its type.
+func recordFileName(i int, r *ndef.Record) string {
+	typ := r.Type()
+	if typ == "" {
+		typ = "record"
+	}
+	name := strings.Map(func(c rune) rune {
+		if strings.ContainsRune(fileNameChars, c) {
+			return c
+		}
+		return '_'
+	}, typ)
+
+	ext := ".bin"
+	if r.TNF() == ndef.MediaType {
+		mimeType := strings.ToLower(typ)
+		if e, ok := extensions[mimeType]; ok {
+			ext = e
+		} else if exts, _ := mime.ExtensionsByType(mimeType); len(exts) > 0 {
+			ext = exts[0]
+		}
+	}
+	return fmt.Sprintf("%d-%s%s", i, name, ext)
+}
+
+// extractRecords writes the payload of every record of the message to
+// a separate file in dir, and prints the paths of the files written.
+func extractRecords(msg *ndef.Message, dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for i, r := range msg.Records {
+		pl, err := r.Payload()
+		if err != nil {
+			return err
+		}
+		path := filepath.Join(dir, recordFileName(i, r))
+		if err := ioutil.WriteFile(path, pl.Marshal(), 0644); err != nil {
+			return err
+		}
+		fmt.Println(path)
+	}
+	return nil
+}
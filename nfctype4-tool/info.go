@@ -0,0 +1,195 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/hsanjuan/go-nfctype4"
+	"github.com/hsanjuan/go-nfctype4/apdu"
+	"github.com/hsanjuan/go-nfctype4/drivers/isodep"
+)
+
+// manufacturers indexed by the first byte of 7-byte UIDs
+// (ISO/IEC 7816-6).
+var manufacturers = map[byte]string{
+	0x02: "STMicroelectronics",
+	0x04: "NXP",
+	0x05: "Infineon",
+	0x07: "Texas Instruments",
+}
+
+// openDriver wraps an initialized driver so that the Device operations
+// do not initialize or close it again.
+type openDriver struct {
+	nfctype4.CommandDriver
+}
+
+func (openDriver) Initialize() error { return nil }
+func (openDriver) Close()            {}
+
+// targetInfo obtains the information about the selected tag from the
+// driver or, when the driver does not provide it, with the GET DATA
+// pseudo-APDUs understood by PC/SC readers.
+func targetInfo(driver nfctype4.CommandDriver) (nfctype4.TargetInfo, error) {
+	if informer, ok := driver.(nfctype4.TargetInformer); ok {
+		return informer.TargetInfo()
+	}
+	cmder := &nfctype4.Commander{Driver: driver, Retries: retriesFlag}
+	getData := func(p1 byte) ([]byte, error) {
+		cApdu, err := apdu.NewCommand(0xFF, 0xCA).P1(p1).ExpectLen(256).Build()
+		if err != nil {
+			return nil, err
+		}
+		rApdu, err := cmder.Transceive(cApdu)
+		if err != nil {
+			return nil, err
+		}
+		if !rApdu.CommandCompleted() {
+			return nil, &apdu.StatusError{
+				Op:  "GET DATA",
+				SW1: rApdu.SW1,
+				SW2: rApdu.SW2,
+			}
+		}
+		return rApdu.ResponseBody, nil
+	}
+	uid, err := getData(0x00)
+	if err != nil {
+		return nfctype4.TargetInfo{}, err
+	}
+	ats, _ := getData(0x01) // Not supported by all readers
+	return nfctype4.TargetInfo{UID: uid, ATS: ats}, nil
+}
+
+// parseATS parses the ATS given by drivers, which may not include the
+// length byte (TL).
+func parseATS(b []byte) (*isodep.ATS, error) {
+	if len(b) == 0 {
+		return nil, errors.New("no ATS")
+	}
+	if int(b[0]) != len(b) {
+		b = append([]byte{byte(len(b) + 1)}, b...)
+	}
+	return isodep.ParseATS(b)
+}
+
+// identifyChip makes a best-effort guess of the chip of the tag from
+// its UID, SAK and ATS. It returns an empty string when the chip is
+// unknown.
+func identifyChip(info nfctype4.TargetInfo) string {
+	if ats, err := parseATS(info.ATS); err == nil &&
+		bytes.Contains(bytes.ToLower(ats.Historical), []byte("yubikey")) {
+		return "Yubico YubiKey"
+	}
+	if len(info.UID) != 7 {
+		return ""
+	}
+	switch info.UID[0] {
+	case 0x04:
+		// NTAG 413/424 DNA and DESFire EV1/EV2/EV3 share the
+		// historical bytes (80h) but not the interface bytes.
+		switch {
+		case bytes.HasPrefix(info.ATS, []byte{0x06, 0x77, 0x77, 0x71}),
+			bytes.HasPrefix(info.ATS, []byte{0x77, 0x77, 0x71}):
+			return "NXP NTAG 4xx DNA"
+		case bytes.HasPrefix(info.ATS, []byte{0x06, 0x75, 0x77, 0x81}),
+			bytes.HasPrefix(info.ATS, []byte{0x75, 0x77, 0x81}):
+			return "NXP MIFARE DESFire"
+		}
+	case 0x02:
+		if info.SAK == 0 || info.SAK&0x20 != 0 {
+			return "ST25TA / M24SR"
+		}
+	}
+	if m, ok := manufacturers[info.UID[0]]; ok {
+		return m + " (unknown chip)"
+	}
+	return ""
+}
+
+// doInfo prints the identification of the tag and its decoded
+// Capability Container.
+func doInfo(args []string) error {
+	driver := selectDriver()
+	if err := driver.Initialize(); err != nil {
+		return err
+	}
+	defer driver.Close()
+
+	info, infoErr := targetInfo(driver)
+
+	device := nfctype4.New(openDriver{driver})
+	device.Retries = retriesFlag
+	_, err := device.Read()
+	cc := device.CapabilityContainer()
+	if cc == nil {
+		return err
+	}
+
+	if jsonFlag || yamlFlag {
+		out := &jsonInfo{Tag: tagJSON(cc)}
+		if infoErr == nil {
+			out.UID = fmt.Sprintf("%X", info.UID)
+			if info.ATQA != [2]byte{} || info.SAK != 0 {
+				out.ATQA = fmt.Sprintf("%X", info.ATQA[:])
+				out.SAK = fmt.Sprintf("%02X", info.SAK)
+			}
+			out.ATS = fmt.Sprintf("%X", info.ATS)
+			if ats, err := parseATS(info.ATS); err == nil {
+				out.Historical = fmt.Sprintf("%X", ats.Historical)
+			}
+			out.Chip = identifyChip(info)
+		}
+		b, err := marshalOutput(out)
+		if err != nil {
+			return err
+		}
+		output(b)
+		return nil
+	}
+
+	if infoErr != nil {
+		fmt.Println("Target information not available:", infoErr)
+	} else {
+		printTargetInfo(info)
+	}
+	fmt.Println(strings.TrimSpace(cc.Inspect()))
+	return nil
+}
+
+func printTargetInfo(info nfctype4.TargetInfo) {
+	fmt.Printf("UID: % 02X\n", info.UID)
+	if info.ATQA != [2]byte{} || info.SAK != 0 {
+		fmt.Printf("ATQA: % 02X. SAK: %02X\n", info.ATQA[:], info.SAK)
+	}
+	if len(info.ATS) > 0 {
+		fmt.Printf("ATS: % 02X\n", info.ATS)
+		if ats, err := parseATS(info.ATS); err == nil {
+			fmt.Printf("Historical bytes: % 02X\n", ats.Historical)
+		}
+	}
+	chip := identifyChip(info)
+	if chip == "" {
+		chip = "unknown"
+	}
+	fmt.Println("Chip:", chip)
+}
@@ -0,0 +1,140 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"github.com/hsanjuan/go-ndef"
+	"github.com/hsanjuan/go-nfctype4/capabilitycontainer"
+	"gopkg.in/yaml.v3"
+)
+
+// binary is base64-encoded in JSON and YAML output.
+type binary []byte
+
+// MarshalYAML encodes the bytes in base64, as done for JSON.
+func (b binary) MarshalYAML() (interface{}, error) {
+	return base64.StdEncoding.EncodeToString(b), nil
+}
+
+// jsonRecord is the JSON (and YAML) representation of a NDEF Record.
+// The payload is base64-encoded.
+type jsonRecord struct {
+	TNF     byte   `json:"tnf" yaml:"tnf"`
+	Type    string `json:"type" yaml:"type"`
+	ID      string `json:"id,omitempty" yaml:"id,omitempty"`
+	Payload binary `json:"payload" yaml:"payload"`
+	// Value is the printable representation of the payload.
+	Value string `json:"value,omitempty" yaml:"value,omitempty"`
+}
+
+// jsonFile describes a NDEF File declared in the Capability Container.
+type jsonFile struct {
+	FileID          string `json:"file_id" yaml:"file_id"`
+	MaximumFileSize uint16 `json:"maximum_file_size" yaml:"maximum_file_size"`
+	ReadAccess      byte   `json:"read_access" yaml:"read_access"`
+	WriteAccess     byte   `json:"write_access" yaml:"write_access"`
+	ReadOnly        bool   `json:"read_only" yaml:"read_only"`
+}
+
+// jsonTag holds the information from the Capability Container.
+type jsonTag struct {
+	MappingVersion string     `json:"mapping_version" yaml:"mapping_version"`
+	MLe            uint16     `json:"mle" yaml:"mle"`
+	MLc            uint16     `json:"mlc" yaml:"mlc"`
+	NDEFFiles      []jsonFile `json:"ndef_files" yaml:"ndef_files"`
+}
+
+// jsonOutput is the output of the read and inspect commands with
+// -json or -yaml.
+type jsonOutput struct {
+	Tag     *jsonTag     `json:"tag,omitempty" yaml:"tag,omitempty"`
+	Records []jsonRecord `json:"records" yaml:"records"`
+}
+
+// jsonInfo is the output of the info command with -json or -yaml.
+type jsonInfo struct {
+	UID        string   `json:"uid,omitempty" yaml:"uid,omitempty"`
+	ATQA       string   `json:"atqa,omitempty" yaml:"atqa,omitempty"`
+	SAK        string   `json:"sak,omitempty" yaml:"sak,omitempty"`
+	ATS        string   `json:"ats,omitempty" yaml:"ats,omitempty"`
+	Historical string   `json:"historical_bytes,omitempty" yaml:"historical_bytes,omitempty"`
+	Chip       string   `json:"chip,omitempty" yaml:"chip,omitempty"`
+	Tag        *jsonTag `json:"tag,omitempty" yaml:"tag,omitempty"`
+}
+
+// marshalOutput returns the YAML representation of v with -yaml, and
+// the JSON one otherwise.
+func marshalOutput(v interface{}) ([]byte, error) {
+	if yamlFlag {
+		out, err := yaml.Marshal(v)
+		return bytes.TrimSuffix(out, []byte("\n")), err
+	}
+	return json.MarshalIndent(v, "", "  ")
+}
+
+// tagJSON returns the representation of the Capability Container.
+func tagJSON(cc *capabilitycontainer.CapabilityContainer) *jsonTag {
+	tag := &jsonTag{
+		MappingVersion: fmt.Sprintf("%d.%d",
+			cc.MajorVersion(), cc.MinorVersion()),
+		MLe:       cc.MLe,
+		MLc:       cc.MLc,
+		NDEFFiles: []jsonFile{},
+	}
+	for _, f := range cc.NDEFFiles() {
+		tlv := (*capabilitycontainer.ControlTLV)(f)
+		tag.NDEFFiles = append(tag.NDEFFiles, jsonFile{
+			FileID:          fmt.Sprintf("%04X", f.FileID),
+			MaximumFileSize: f.MaximumFileSize,
+			ReadAccess:      f.FileReadAccessCondition,
+			WriteAccess:     f.FileWriteAccessCondition,
+			ReadOnly:        tlv.IsFileReadOnly(),
+		})
+	}
+	return tag
+}
+
+// messageJSON returns the JSON (or YAML) representation of the message
+// and the tag it was read from.
+func messageJSON(msg *ndef.Message, cc *capabilitycontainer.CapabilityContainer) ([]byte, error) {
+	out := jsonOutput{
+		Records: []jsonRecord{},
+	}
+	for _, r := range msg.Records {
+		pl, err := r.Payload()
+		if err != nil {
+			return nil, err
+		}
+		out.Records = append(out.Records, jsonRecord{
+			TNF:     r.TNF(),
+			Type:    r.Type(),
+			ID:      r.ID(),
+			Payload: pl.Marshal(),
+			Value:   pl.String(),
+		})
+	}
+	if cc != nil {
+		out.Tag = tagJSON(cc)
+	}
+	return marshalOutput(out)
+}
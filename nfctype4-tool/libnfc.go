@@ -0,0 +1,42 @@
+//go:build !nolibnfc
+
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package main
+
+import (
+	"github.com/hsanjuan/go-nfctype4"
+	"github.com/hsanjuan/go-nfctype4/drivers/libnfc"
+)
+
+// libnfcSupport is shown in the usage when the tool is built without
+// the libnfc driver.
+const libnfcSupport = ""
+
+// registerLibnfc makes the libnfc driver available. Build with the
+// nolibnfc tag to leave it out, so that the tool does not need libnfc.
+func registerLibnfc() {
+	nfctype4.RegisterDriver("libnfc", func() nfctype4.CommandDriver {
+		return &libnfc.Driver{
+			Connstring:    readerFlag,
+			WaitForTarget: waitForTag(),
+			WaitTimeout:   timeoutFlag,
+		}
+	})
+	readerLists["libnfc"] = libnfc.ListDevices
+}
@@ -0,0 +1,145 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hsanjuan/go-ndef"
+	"gopkg.in/yaml.v3"
+)
+
+// manifestRecord describes a record in a manifest. The payload is
+// given inline or read from a file, relative to the manifest.
+type manifestRecord struct {
+	TNF     string `json:"tnf" yaml:"tnf"`
+	Type    string `json:"type" yaml:"type"`
+	ID      string `json:"id" yaml:"id"`
+	Lang    string `json:"lang" yaml:"lang"` // For text records
+	Payload string `json:"payload" yaml:"payload"`
+	File    string `json:"file" yaml:"file"`
+	// Records contained in a Smart Poster (type Sp)
+	Records []manifestRecord `json:"records" yaml:"records"`
+}
+
+// manifest describes a NDEF Message with several records, for
+// example:
+//
+//	records:
+//	  - tnf: wkt
+//	    type: U
+//	    payload: https://example.org
+//	  - tnf: media
+//	    type: image/png
+//	    file: logo.png
+//	  - tnf: wkt
+//	    type: Sp
+//	    records:
+//	      - tnf: wkt
+//	        type: U
+//	        payload: https://example.org
+//	      - tnf: wkt
+//	        type: T
+//	        payload: Example
+type manifest struct {
+	Records []manifestRecord `json:"records" yaml:"records"`
+}
+
+// readManifest reads a JSON or YAML manifest and builds the message it
+// describes.
+func readManifest(path string) (*ndef.Message, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var m manifest
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".json":
+		err = json.Unmarshal(data, &m)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &m)
+	default:
+		return nil, fmt.Errorf("manifest: unknown extension %q", ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("manifest: %s", err)
+	}
+	if len(m.Records) == 0 {
+		return nil, errors.New("manifest: no records")
+	}
+
+	records, err := manifestRecords(path, m.Records)
+	if err != nil {
+		return nil, err
+	}
+	return &ndef.Message{Records: records}, nil
+}
+
+// manifestRecords builds the records described in a manifest. Smart
+// Poster records are built from the records nested in them.
+func manifestRecords(path string, mRecords []manifestRecord) ([]*ndef.Record, error) {
+	var records []*ndef.Record
+	for i, r := range mRecords {
+		tnf, ok := parseTNF(r.TNF)
+		if !ok {
+			return nil, fmt.Errorf("manifest: record %d: "+
+				"non-supported TNF %q", i, r.TNF)
+		}
+		if tnf == ndef.NFCForumWellKnownType && r.Type == "Sp" {
+			if r.Payload != "" || r.File != "" || len(r.Records) == 0 {
+				return nil, fmt.Errorf("manifest: record %d: "+
+					"Smart Posters need records and no payload", i)
+			}
+			inner, err := manifestRecords(path, r.Records)
+			if err != nil {
+				return nil, err
+			}
+			records = append(records, smartPosterRecord(r.ID, inner))
+			continue
+		}
+		if len(r.Records) > 0 {
+			return nil, fmt.Errorf("manifest: record %d: "+
+				"only Smart Posters can contain records", i)
+		}
+
+		payload := []byte(r.Payload)
+		if r.File != "" {
+			if r.Payload != "" {
+				return nil, fmt.Errorf("manifest: record %d: "+
+					"payload and file are exclusive", i)
+			}
+			file := r.File
+			if !filepath.IsAbs(file) {
+				file = filepath.Join(filepath.Dir(path), file)
+			}
+			var err error
+			payload, err = os.ReadFile(file)
+			if err != nil {
+				return nil, err
+			}
+		}
+		records = append(records,
+			makeRecord(tnf, r.Type, r.ID, r.Lang, payload))
+	}
+	return records, nil
+}
@@ -0,0 +1,47 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// progressThreshold is the size of the transfers (in bytes) from which
+// a progress bar is displayed.
+const progressThreshold = 4096
+
+// progressWidth is the width of the progress bar.
+const progressWidth = 40
+
+// showProgress draws a progress bar on stderr for large transfers, so
+// that slow operations do not look frozen.
+func showProgress(done, total int) {
+	if total < progressThreshold {
+		return
+	}
+	filled := progressWidth * done / total
+	fmt.Fprintf(os.Stderr, "\r[%s%s] %3d%% (%d/%d bytes)",
+		strings.Repeat("=", filled),
+		strings.Repeat(" ", progressWidth-filled),
+		100*done/total, done, total)
+	if done >= total {
+		fmt.Fprintln(os.Stderr)
+	}
+}
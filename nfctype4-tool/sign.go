@@ -0,0 +1,169 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package main
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/hsanjuan/go-ndef"
+	"github.com/hsanjuan/go-nfctype4"
+	"github.com/hsanjuan/go-nfctype4/signature"
+)
+
+// loadKey reads a PEM-encoded private key in PKCS#8, PKCS#1 (RSA) or
+// SEC 1 (EC) form.
+func loadKey(path string) (crypto.Signer, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data found", path)
+	}
+
+	var key interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%s: unsupported key type", path)
+	}
+	return signer, nil
+}
+
+// loadCertificates reads the PEM-encoded certificates in a file, in
+// order.
+func loadCertificates(path string) ([]*x509.Certificate, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", path, err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("%s: no certificates found", path)
+	}
+	return certs, nil
+}
+
+// signMessage appends a Signature record to the message, made with the
+// key in -sign-key and carrying the certificates in -sign-cert.
+func signMessage(msg *ndef.Message) (*ndef.Message, error) {
+	key, err := loadKey(signKeyFlag)
+	if err != nil {
+		return nil, err
+	}
+	signer := &signature.Signer{
+		Key: key,
+		PSS: signPSSFlag,
+	}
+	if signCertFlag != "" {
+		signer.Certificates, err = loadCertificates(signCertFlag)
+		if err != nil {
+			return nil, err
+		}
+		pub, ok := signer.Certificates[0].PublicKey.(interface {
+			Equal(crypto.PublicKey) bool
+		})
+		if !ok || !pub.Equal(key.Public()) {
+			return nil, errors.New("the first certificate in " +
+				signCertFlag + " does not match the key")
+		}
+	}
+	return signer.SignMessage(msg)
+}
+
+// setVerifier configures the device to verify the Signature records
+// against the certificates in -trust.
+func setVerifier(device *nfctype4.Device) error {
+	certs, err := loadCertificates(trustFlag)
+	if err != nil {
+		return err
+	}
+	roots := x509.NewCertPool()
+	for _, cert := range certs {
+		roots.AddCert(cert)
+	}
+	device.Verifier = &signature.Verifier{Roots: roots}
+	return nil
+}
+
+// checkSignatures prints the status of the Signature records verified
+// during the last Read, which returned msg, to stderr. It fails unless
+// the message is signed, all the signatures are valid and every record
+// is covered by one of them.
+func checkSignatures(device *nfctype4.Device, msg *ndef.Message) error {
+	results := device.Signatures()
+	if len(results) == 0 {
+		return errors.New("the NDEF Message is not signed")
+	}
+	failed := 0
+	for _, res := range results {
+		fmt.Fprintf(os.Stderr, "Signature over records %d-%d: %s",
+			res.First+1, res.Index, res.Status)
+		if res.Certificate != nil {
+			fmt.Fprintf(os.Stderr, ". Signer: %s",
+				res.Certificate.Subject)
+		}
+		if res.Err != nil {
+			fmt.Fprintf(os.Stderr, " (%s)", res.Err)
+		}
+		fmt.Fprintln(os.Stderr)
+		if res.Status != signature.StatusValid {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d signatures could not be verified",
+			failed, len(results))
+	}
+	if unsigned := signature.Unsigned(msg, results); len(unsigned) > 0 {
+		return fmt.Errorf("record %d is not signed", unsigned[0]+1)
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hsanjuan/go-ndef"
+	"github.com/hsanjuan/go-ndef/types/generic"
+)
+
+// Smart Poster action record values.
+var smartPosterActions = map[string]byte{
+	"do":   0x00, // Do the action (open the URI)
+	"save": 0x01, // Save for later
+	"edit": 0x02, // Open for editing
+}
+
+// titleList collects the values of the -title flag, which can be
+// given several times.
+type titleList []string
+
+func (l *titleList) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *titleList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+// splitTitle separates the language from a title given as "lang:text".
+// Titles without a language prefix use "en".
+func splitTitle(title string) (lang, txt string) {
+	i := strings.Index(title, ":")
+	if i < 2 || i > 8 {
+		return "en", title
+	}
+	for _, c := range title[:i] {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '-') {
+			return "en", title
+		}
+	}
+	return title[:i], title[i+1:]
+}
+
+// smartPosterRecord builds a Smart Poster record which contains the
+// given records.
+func smartPosterRecord(id string, records []*ndef.Record) *ndef.Record {
+	inner := &ndef.Message{Records: records}
+	return ndef.NewRecord(ndef.NFCForumWellKnownType, "Sp", id,
+		ndef.NewSmartPosterPayload(inner))
+}
+
+// actionRecord builds the action record of a Smart Poster.
+func actionRecord(action string) (*ndef.Record, error) {
+	act, ok := smartPosterActions[action]
+	if !ok {
+		return nil, fmt.Errorf("unknown Smart Poster action %q "+
+			"(do, save or edit)", action)
+	}
+	return ndef.NewRecord(ndef.NFCForumWellKnownType, "act", "",
+		&generic.Payload{Payload: []byte{act}}), nil
+}
+
+// smartPosterMessage builds a message with a Smart Poster for the given
+// URI, titles and action (which can be empty).
+func smartPosterMessage(u string, titles []string, action string) (*ndef.Message, error) {
+	records := []*ndef.Record{
+		makeRecord(ndef.NFCForumWellKnownType, "U", "", "", []byte(u)),
+	}
+	for _, t := range titles {
+		lang, txt := splitTitle(t)
+		records = append(records,
+			makeRecord(ndef.NFCForumWellKnownType, "T", "", lang, []byte(txt)))
+	}
+	if action != "" {
+		act, err := actionRecord(action)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, act)
+	}
+	return &ndef.Message{Records: []*ndef.Record{
+		smartPosterRecord("", records),
+	}}, nil
+}
@@ -20,11 +20,16 @@ package main
 
 import (
 	"bytes"
+	"encoding/hex"
+	"errors"
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"strconv"
+	"strings"
 	"time"
+	"unicode"
 
 	"github.com/hsanjuan/go-ndef"
 	"github.com/hsanjuan/go-ndef/types/absoluteuri"
@@ -34,7 +39,11 @@ import (
 	"github.com/hsanjuan/go-ndef/types/wkt/text"
 	"github.com/hsanjuan/go-ndef/types/wkt/uri"
 	"github.com/hsanjuan/go-nfctype4"
-	"github.com/hsanjuan/go-nfctype4/drivers/libnfc"
+	"github.com/hsanjuan/go-nfctype4/drivers/auto"
+	"github.com/hsanjuan/go-nfctype4/drivers/ccid"
+	"github.com/hsanjuan/go-nfctype4/drivers/cryptotokenkit"
+	"github.com/hsanjuan/go-nfctype4/drivers/record"
+	"github.com/hsanjuan/go-nfctype4/drivers/winscard"
 )
 
 // Description provides a description of the functionality of the tool
@@ -42,66 +51,160 @@ import (
 const Description = `
 nfctype4-tool allows to easily read and write NFC Forum Type 4 Tags.
 
-Read operations will return the value read from the tag. If the -raw
-flag is not specified, the program tries to produce a printable output
-for the NDEF Message.
-
-Write operations can take the payload as a command line argument or read
-it from a file. The TNF and Type fields can be controlled with their respective
-flags.
+Every command has its own options, which are given after the command
+name. Use "nfctype4-tool <command> -h" to list them.
 
 `
 
 // Command line flags
 var (
-	driverFlag string
-	fileFlag   string
-	rawFlag    bool
-	tnfFlag    string
-	typeFlag   string
-	writeFlag  string
-	wait       bool
+	driverFlag   string
+	fileFlag     string
+	manifestFlag string
+	rawFlag      bool
+	tnfFlag      string
+	typeFlag     string
+	writeFlag    string
+	wait         bool
+	readerFlag   string
+	listFlag     bool
+	jsonFlag     bool
+	execFlag     string
+	verifyFlag   bool
+	posterFlag   bool
+	titleFlag    titleList
+	actionFlag   string
+	btAddrFlag   string
+	btNameFlag   string
+	intervalFlag time.Duration
+	timeoutFlag  time.Duration
+	retriesFlag  int
+	templateFlag string
+	countFlag    int
+	startFlag    int
+	csvFlag      string
+	logFlag      string
+	extractFlag  string
+	hexFlag      bool
+	rawNDEFFlag  string
+	yamlFlag     bool
+	signKeyFlag  string
+	signCertFlag string
+	signPSSFlag  bool
+	trustFlag    string
+	recordFlag   string
+	replayFlag   string
+	messageFlag  string
+	readOnlyFlag bool
 )
 
-var waitDelay = 200 * time.Millisecond
+// recordOutput receives the transcript of the exchanges with -record,
+// and replayer serves the transcript given with -replay.
+var (
+	recordOutput *os.File
+	replayer     *record.Replayer
+)
+
+// readerLists holds the functions which list the readers available
+// to the drivers supporting reader selection.
+var readerLists = map[string]func() ([]string, error){
+	"winscard":       winscard.ListReaders,
+	"cryptotokenkit": cryptotokenkit.ListReaders,
+	"ccid":           ccid.ListReaders,
+}
 
 func init() {
+	registerLibnfc()
+	nfctype4.RegisterDriver("winscard", func() nfctype4.CommandDriver {
+		return &winscard.Driver{
+			Reader:      readerFlag,
+			WaitForCard: waitForTag(),
+			WaitTimeout: timeoutFlag,
+		}
+	})
+	nfctype4.RegisterDriver("cryptotokenkit", func() nfctype4.CommandDriver {
+		return &cryptotokenkit.Driver{
+			Slot:        readerFlag,
+			WaitForCard: waitForTag(),
+			WaitTimeout: timeoutFlag,
+		}
+	})
+	nfctype4.RegisterDriver("ccid", func() nfctype4.CommandDriver {
+		return &ccid.Driver{Device: readerFlag}
+	})
+	nfctype4.RegisterDriver("auto", func() nfctype4.CommandDriver {
+		return &auto.Driver{Backends: autoBackends()}
+	})
+
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr,
 			"Usage: nfctype4-tool "+
-				"[options] <inspect|read|write|format> [payload]\n")
+				"[options] <command> [command options] [arguments]\n")
 		fmt.Fprintf(os.Stderr, Description)
+		fmt.Fprintf(os.Stderr, libnfcSupport)
 
-		fmt.Fprintf(os.Stderr, "Operations:\n")
-		fmt.Fprintf(os.Stderr, " - inspect: print information about the NDEF Message.\n")
-		fmt.Fprintf(os.Stderr, " - read: read the contents from a tag.\n")
-		fmt.Fprintf(os.Stderr, " - write: update a tag with the given payload.\n")
-		fmt.Fprintf(os.Stderr, " - format: erase the contents of a tag.\n")
+		fmt.Fprintf(os.Stderr, "Commands:\n")
+		for _, cmd := range commands {
+			fmt.Fprintf(os.Stderr, " - %s: %s\n", cmd.name, cmd.summary)
+		}
 		fmt.Fprintf(os.Stderr, "Options:\n")
 		flag.PrintDefaults()
 		fmt.Fprintln(os.Stderr)
 	}
-	flag.StringVar(&fileFlag, "file", "",
-		"Read the payload from file (takes precedence over the payload argument)")
-	flag.StringVar(&driverFlag, "driver", "libnfc",
-		"available drivers: libnfc")
+	usage = flag.Usage
+	flag.StringVar(&driverFlag, "driver", "auto",
+		"available drivers: "+strings.Join(nfctype4.Drivers(), ", "))
+	flag.StringVar(&readerFlag, "device", "",
+		"Device to use: its index in -list-devices, a libnfc connection string, "+
+			"or part of the reader name for the winscard, cryptotokenkit and ccid drivers")
+	flag.StringVar(&readerFlag, "reader", "", "Same as -device")
+	flag.BoolVar(&listFlag, "list-devices", false,
+		"List the devices available to the selected driver and exit")
+	flag.BoolVar(&listFlag, "list-readers", false, "Same as -list-devices")
 	flag.BoolVar(&wait, "wait", false, "Wait for the reader to detect the tag when not present")
-	flag.StringVar(&writeFlag, "output", "",
-		"Write output to path")
-	flag.BoolVar(&rawFlag, "raw", false, "Output raw NDEF File contents")
-	flag.StringVar(&tnfFlag, "tnf", "wkt",
-		"Type Name Format: "+
-			"wkt (Well-Known), "+
-			"ext (External), "+
-			"media (MIME)")
-	flag.StringVar(&typeFlag, "type", "T",
-		"The type of the message. Defaults to T[text]")
-	flag.Parse()
+	flag.DurationVar(&timeoutFlag, "timeout", 0,
+		"Maximum time to wait for a tag to be present (implies -wait)")
+	flag.IntVar(&retriesFlag, "retries", 0,
+		"Number of times that a command is sent again when the communication with the tag fails")
+	flag.StringVar(&recordFlag, "record", "",
+		"Write the transcript of the exchanges with the tag to this file")
+	flag.StringVar(&replayFlag, "replay", "",
+		"Replay the transcript in this file instead of using a reader (-driver is ignored)")
 }
 
+// autoBackends returns the backends tried by the auto driver. The
+// backends registered here as drivers are configured with the flags.
+func autoBackends() []auto.Backend {
+	registered := make(map[string]bool)
+	for _, name := range nfctype4.Drivers() {
+		registered[name] = true
+	}
+	backends := auto.Backends()
+	for i, b := range backends {
+		if !registered[b.Name] {
+			continue
+		}
+		name := b.Name
+		backends[i].New = func() nfctype4.CommandDriver {
+			driver, _ := nfctype4.NewDriver(name)
+			return driver
+		}
+	}
+	return backends
+}
+
+// waitForTag returns whether the drivers should wait for a tag to be
+// present.
+func waitForTag() bool {
+	return wait || timeoutFlag > 0
+}
+
+// usage prints the usage of the tool, or of the command being run.
+var usage func()
+
 func argError(msg string) {
 	fmt.Fprint(os.Stderr, msg+"\n\n")
-	flag.Usage()
+	usage()
 	os.Exit(2)
 }
 
@@ -113,145 +216,429 @@ func check(e error) {
 }
 
 func main() {
-	cmd := flag.Arg(0)
-	var err error
-	for {
-		switch cmd {
-		case "read":
-			err = doRead()
-		case "write":
-			err = doWrite()
-		case "format":
-			err = doFormat()
-		case "inspect":
-			err = doInspect()
-		case "":
-			argError("Command argument is missing.")
-		default:
-			argError("Unrecognized command " + cmd)
-		}
+	flag.Parse()
+	if listFlag {
+		check(doListReaders())
+		return
+	}
+	name := flag.Arg(0)
+	if name == "" {
+		argError("Command argument is missing.")
+	}
+	cmd := findCommand(name)
+	if cmd == nil {
+		argError("Unrecognized command " + name)
+	}
+	fs := cmd.flagSet()
+	usage = fs.Usage
+	fs.Parse(flag.Args()[1:])
+	check(openTranscripts())
+	if recordOutput != nil {
+		defer recordOutput.Close()
+	}
+	check(cmd.run(fs.Args()))
+	if replayer != nil && !replayer.Done() {
+		fmt.Fprintf(os.Stderr, "replay: %d exchanges were not replayed\n",
+			len(replayer.Entries)-replayer.Pos)
+	}
+}
 
-		if err == libnfc.ErrNoTargetsDetected {
-			time.Sleep(waitDelay)
-			continue
+// openTranscripts creates the -record file or reads the -replay one.
+func openTranscripts() error {
+	if recordFlag != "" && replayFlag != "" {
+		argError("-record and -replay cannot be used together.")
+	}
+	if recordFlag != "" {
+		f, err := os.Create(recordFlag)
+		if err != nil {
+			return err
 		}
-		check(err)
-		return
+		recordOutput = f
 	}
+	if replayFlag != "" {
+		f, err := os.Open(replayFlag)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		replayer, err = record.NewReplayerFromTranscript(f)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
+// selectDriver returns the driver registered with the name given in
+// the -driver flag. Drivers from other packages can be made available
+// by importing them, as long as they call nfctype4.RegisterDriver.
+//
+// With -replay, the driver replays the transcript instead. With
+// -record, the driver records the exchanges in the transcript.
 func selectDriver() nfctype4.CommandDriver {
-	switch driverFlag {
-	case "libnfc":
-		return new(libnfc.Driver)
-	default:
+	if replayer != nil {
+		return replayer
+	}
+	check(resolveReader())
+	driver, err := nfctype4.NewDriver(driverFlag)
+	if err != nil {
 		argError("Error: invalid driver selected.")
 	}
+	if recordOutput != nil {
+		return record.NewRecorder(driver, recordOutput)
+	}
+	return driver
+}
+
+// listReaders returns the readers available to the selected driver.
+func listReaders() ([]string, error) {
+	list, ok := readerLists[driverFlag]
+	if !ok {
+		return nil, fmt.Errorf("the %s driver does not support "+
+			"listing devices", driverFlag)
+	}
+	return list()
+}
+
+func doListReaders() error {
+	readers, err := listReaders()
+	if err != nil {
+		return err
+	}
+	if len(readers) == 0 {
+		return errors.New("no devices found")
+	}
+	for i, r := range readers {
+		fmt.Printf("%d: %s\n", i, r)
+	}
+	return nil
+}
+
+// resolveReader replaces a device index given with -device by the
+// name of the device.
+func resolveReader() error {
+	index, err := strconv.Atoi(readerFlag)
+	if err != nil {
+		return nil // A name
+	}
+	readers, err := listReaders()
+	if err != nil {
+		return err
+	}
+	if index < 0 || index >= len(readers) {
+		return fmt.Errorf("device %d not found (%d devices available)",
+			index, len(readers))
+	}
+	readerFlag = readers[index]
 	return nil
 }
 
 func makeDevice() *nfctype4.Device {
 	driver := selectDriver()
 	device := nfctype4.New(driver)
+	device.Progress = showProgress
+	device.Retries = retriesFlag
 	return device
 }
 
-func doRead() error {
+func doRead(args []string) error {
 	device := makeDevice()
+	if trustFlag != "" {
+		if err := setVerifier(device); err != nil {
+			return err
+		}
+	}
 	ndefMessage, err := device.Read()
 	if err != nil {
 		return err
 	}
+	if trustFlag != "" {
+		if err := checkSignatures(device, ndefMessage); err != nil {
+			return err
+		}
+	}
 
+	if extractFlag != "" {
+		return extractRecords(ndefMessage, extractFlag)
+	}
+	if jsonFlag || yamlFlag {
+		return outputJSON(ndefMessage, device)
+	}
 	if rawFlag {
-		var buf bytes.Buffer
-		for _, r := range ndefMessage.Records {
-			pl, err := r.Payload()
-			if err != nil {
-				return err
-			}
-			buf.Write(pl.Marshal())
+		payload, err := rawPayload(ndefMessage)
+		if err != nil {
+			return err
 		}
-		output(buf.Bytes())
+		output(payload)
 	} else {
 		output([]byte(ndefMessage.String()))
 	}
 	return nil
 }
 
-func doWrite() error {
-	var payload []byte
+// rawPayload returns the payloads of all the records of the message.
+func rawPayload(msg *ndef.Message) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, r := range msg.Records {
+		pl, err := r.Payload()
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(pl.Marshal())
+	}
+	return buf.Bytes(), nil
+}
 
-	if fileFlag == "" {
-		payload = []byte(flag.Arg(1))
-		if len(payload) == 0 {
-			argError("Write operation needs a payload or --file.")
+func doWrite(args []string) error {
+	var msg *ndef.Message
+	switch {
+	case rawNDEFFlag != "":
+		if signKeyFlag != "" {
+			argError("Error: -raw-ndef messages cannot be signed")
 		}
-	} else {
+		return writeRawNDEF(rawNDEFFlag)
+	case manifestFlag != "":
 		var err error
-		payload, err = ioutil.ReadFile(fileFlag)
+		msg, err = readManifest(manifestFlag)
+		if err != nil {
+			return err
+		}
+	case btAddrFlag != "":
+		var err error
+		msg, err = bluetoothMessage(btAddrFlag, btNameFlag)
+		if err != nil {
+			return err
+		}
+	case posterFlag:
+		if len(args) == 0 {
+			argError("Smart Poster needs a URI as payload.")
+		}
+		var err error
+		msg, err = smartPosterMessage(args[0], titleFlag, actionFlag)
+		if err != nil {
+			return err
+		}
+	default:
+		payload, err := readPayload(args)
+		if err != nil {
+			return err
+		}
+		msg = &ndef.Message{Records: []*ndef.Record{
+			makeRecord(tnfToCode(tnfFlag), typeFlag, "", "en", payload),
+		}}
+	}
+
+	if signKeyFlag != "" {
+		var err error
+		msg, err = signMessage(msg)
 		if err != nil {
 			return err
 		}
 	}
+
 	device := makeDevice()
+	err := device.Update(msg)
+	if err != nil {
+		return err
+	}
+	if verifyFlag {
+		if err := verifyMessage(device, msg); err != nil {
+			return err
+		}
+	}
+	fmt.Println("Updated successful.")
+	return nil
+}
 
+// writeRawNDEF writes the serialized NDEF Message in the file
+// verbatim, after checking that it can be parsed.
+func writeRawNDEF(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
 	msg := new(ndef.Message)
-	msg.Records = make([]*ndef.Record, 1)
+	n, err := msg.Unmarshal(data)
+	if err != nil {
+		return fmt.Errorf("%s: %s", path, err)
+	}
+	if n != len(data) {
+		return fmt.Errorf("%s: %d trailing bytes after the NDEF Message",
+			path, len(data)-n)
+	}
+
+	device := makeDevice()
+	if err := device.UpdateBytes(data); err != nil {
+		return err
+	}
+	if verifyFlag {
+		if err := verifyMessage(device, msg); err != nil {
+			return err
+		}
+	}
+	fmt.Println("Updated successful.")
+	return nil
+}
+
+// readPayload returns the payload for write: the contents of -file,
+// the argument, or stdin when the argument is "-" or missing. With
+// -hex, the payload is decoded from hexadecimal.
+func readPayload(args []string) ([]byte, error) {
+	var payload []byte
+	var err error
+	switch {
+	case fileFlag != "":
+		payload, err = ioutil.ReadFile(fileFlag)
+	case len(args) == 0 || args[0] == "-":
+		if len(args) == 0 && isTerminal(os.Stdin) {
+			argError("Write operation needs a payload, --file or --manifest.")
+		}
+		payload, err = ioutil.ReadAll(os.Stdin)
+	default:
+		payload = []byte(args[0])
+	}
+	if err != nil || !hexFlag {
+		return payload, err
+	}
+	return decodeHex(string(payload))
+}
+
+// decodeHex decodes a hexadecimal string. Whitespace and the usual
+// byte separators (":" and "-") are ignored.
+func decodeHex(s string) ([]byte, error) {
+	s = strings.Map(func(c rune) rune {
+		if unicode.IsSpace(c) || c == ':' || c == '-' {
+			return -1
+		}
+		return c
+	}, s)
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("bad hex payload: %s", err)
+	}
+	return b, nil
+}
+
+// isTerminal returns whether the file is a terminal (and not a pipe
+// or a regular file).
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// verifyMessage reads the tag back and checks that it contains the
+// given message.
+func verifyMessage(device *nfctype4.Device, msg *ndef.Message) error {
+	expected, err := msg.Marshal()
+	if err != nil {
+		return err
+	}
+	readMsg, err := device.Read()
+	if err != nil {
+		return fmt.Errorf("verify: %s", err)
+	}
+	read, err := readMsg.Marshal()
+	if err != nil {
+		return fmt.Errorf("verify: %s", err)
+	}
+	if !bytes.Equal(expected, read) {
+		return errors.New("verify: the message read from the tag " +
+			"does not match the one written")
+	}
+	return nil
+}
+
+// verifyFormat reads the tag back and checks that it does not contain
+// a message.
+func verifyFormat(device *nfctype4.Device) error {
+	_, err := device.Read()
+	if err == nil {
+		return errors.New("verify: the tag still contains a message")
+	}
+	if !strings.Contains(err.Error(), "no NDEF Message detected") {
+		return fmt.Errorf("verify: %s", err)
+	}
+	return nil
+}
+
+// makeRecord builds a record with the given TNF, type, ID and payload.
+// The lang is used for text records.
+func makeRecord(tnf byte, typ, id, lang string, payload []byte) *ndef.Record {
 	var recordPayload ndef.RecordPayload
 
-	switch tnfToCode(tnfFlag) {
+	switch tnf {
 	case ndef.NFCForumWellKnownType:
-		switch typeFlag {
+		switch typ {
 		case "U":
 			recordPayload = uri.New(string(payload))
 		case "T":
-			recordPayload = text.New(string(payload), "en")
+			if lang == "" {
+				lang = "en"
+			}
+			recordPayload = text.New(string(payload), lang)
 		default:
 			recordPayload = &generic.Payload{
 				Payload: []byte(payload),
 			}
 		}
 	case ndef.AbsoluteURI:
-		recordPayload = absoluteuri.New(typeFlag, payload)
+		recordPayload = absoluteuri.New(typ, payload)
 	case ndef.MediaType:
-		recordPayload = media.New(typeFlag, payload)
+		recordPayload = media.New(typ, payload)
 	case ndef.NFCForumExternalType:
-		recordPayload = ext.New(typeFlag, payload)
+		recordPayload = ext.New(typ, payload)
 	}
 
-	record := ndef.NewRecord(tnfToCode(tnfFlag), typeFlag, "", recordPayload)
-
-	msg.Records[0] = record
-
-	err := device.Update(msg)
-	if err != nil {
-		return err
-	}
-	fmt.Println("Updated successful.")
-	return nil
+	return ndef.NewRecord(tnf, typ, id, recordPayload)
 }
 
-func doFormat() error {
+func doFormat(args []string) error {
 	device := makeDevice()
 	err := device.Format()
 	if err != nil {
 		return err
 	}
+	if verifyFlag {
+		if err := verifyFormat(device); err != nil {
+			return err
+		}
+	}
 	fmt.Println("Format operation successful.")
 	return nil
 }
 
-func doInspect() error {
+func doInspect(args []string) error {
 	device := makeDevice()
+	if trustFlag != "" {
+		if err := setVerifier(device); err != nil {
+			return err
+		}
+	}
 	ndefMessage, err := device.Read()
 	if err != nil {
 		return err
 	}
+	if trustFlag != "" {
+		if err := checkSignatures(device, ndefMessage); err != nil {
+			return err
+		}
+	}
+	if jsonFlag || yamlFlag {
+		return outputJSON(ndefMessage, device)
+	}
 	output([]byte(ndefMessage.Inspect()))
 	return nil
 }
 
+func outputJSON(msg *ndef.Message, device *nfctype4.Device) error {
+	out, err := messageJSON(msg, device.CapabilityContainer())
+	if err != nil {
+		return err
+	}
+	output(out)
+	return nil
+}
+
 func output(t []byte) {
 	if writeFlag != "" {
 		err := ioutil.WriteFile(writeFlag, t, 0644)
@@ -262,17 +649,24 @@ func output(t []byte) {
 }
 
 func tnfToCode(tnf string) byte {
+	code, ok := parseTNF(tnf)
+	if !ok {
+		argError("Error: non-supported TNF provided")
+	}
+	return code
+}
+
+func parseTNF(tnf string) (byte, bool) {
 	switch tnf {
 	case "wkt":
-		return ndef.NFCForumWellKnownType
+		return ndef.NFCForumWellKnownType, true
 	case "ext":
-		return ndef.NFCForumExternalType
+		return ndef.NFCForumExternalType, true
 	case "media":
-		return ndef.MediaType
+		return ndef.MediaType, true
 	case "uri":
-		return ndef.AbsoluteURI
+		return ndef.AbsoluteURI, true
 	default:
-		argError("Error: non-supported TNF provided")
+		return 0, false
 	}
-	return 0
 }
@@ -0,0 +1,85 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/hsanjuan/go-ndef"
+	"github.com/hsanjuan/go-nfctype4/drivers/auto"
+)
+
+// doWatch reads every tag presented to the reader until the program
+// is interrupted. For each tag, it prints a line with the message or,
+// with -exec, runs the hook command with the payload on its stdin.
+// A tag is only read again after it has been removed.
+func doWatch(args []string) error {
+	device := makeDevice()
+	present := false
+	for {
+		msg, err := device.Read()
+		switch {
+		case err == nil:
+			if !present {
+				handleTag(msg)
+			}
+			present = true
+		case auto.IsNoTarget(err):
+			present = false
+		default:
+			if !present {
+				fmt.Fprintln(os.Stderr, err)
+			}
+			present = true
+		}
+		time.Sleep(intervalFlag)
+	}
+}
+
+// handleTag prints the message or runs the hook command with it.
+func handleTag(msg *ndef.Message) {
+	line := strings.Replace(msg.String(), "\n", " ", -1)
+	if execFlag == "" {
+		fmt.Printf("%s %s\n", time.Now().Format(time.RFC3339), line)
+		return
+	}
+	payload, err := rawPayload(msg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", execFlag)
+	} else {
+		cmd = exec.Command("sh", "-c", execFlag)
+	}
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), "NFCTYPE4_MESSAGE="+line)
+	if err := cmd.Run(); err != nil {
+		fmt.Fprintf(os.Stderr, "hook: %s\n", err)
+	}
+}
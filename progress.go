@@ -0,0 +1,35 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package nfctype4
+
+// Progress receives updates during transfers which need several
+// ReadBinary or UpdateBinary commands, with the number of bytes
+// transferred so far and the total number of bytes of the transfer.
+// It allows to display the progress of the long operations on large
+// tags.
+//
+// Device and Commander offer a Progress field of this type. A nil
+// Progress does nothing.
+type Progress func(done, total int)
+
+// Report calls the Progress, if it is not nil.
+func (progress Progress) Report(done, total int) {
+	if progress != nil {
+		progress(done, total)
+	}
+}
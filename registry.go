@@ -0,0 +1,81 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package nfctype4
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// DriverFactory returns a new, not initialized, CommandDriver.
+type DriverFactory func() CommandDriver
+
+var (
+	driversMux sync.Mutex
+	drivers    = make(map[string]DriverFactory)
+)
+
+// RegisterDriver makes a CommandDriver available under the given
+// name, so that applications (like nfctype4-tool) can let their users
+// select it with NewDriver. Driver packages do not register
+// themselves, since most drivers need configuration (a device, an
+// address...): applications register the drivers they support from
+// their own init function, with factories which configure them, as
+// nfctype4-tool does with its command-line flags.
+//
+// It panics if the name is empty, if the factory is nil or if a driver
+// with the same name has been registered already.
+func RegisterDriver(name string, factory DriverFactory) {
+	driversMux.Lock()
+	defer driversMux.Unlock()
+	if name == "" || factory == nil {
+		panic("RegisterDriver: empty name or nil factory")
+	}
+	if _, ok := drivers[name]; ok {
+		panic("RegisterDriver: driver registered twice: " + name)
+	}
+	drivers[name] = factory
+}
+
+// NewDriver returns a new CommandDriver created with the factory
+// registered under the given name.
+//
+// It returns an error if no driver has been registered with that
+// name.
+func NewDriver(name string) (CommandDriver, error) {
+	driversMux.Lock()
+	factory, ok := drivers[name]
+	driversMux.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("NewDriver: unknown driver %q", name)
+	}
+	return factory(), nil
+}
+
+// Drivers returns the sorted names of the registered drivers.
+func Drivers() []string {
+	driversMux.Lock()
+	defer driversMux.Unlock()
+	names := make([]string, 0, len(drivers))
+	for name := range drivers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
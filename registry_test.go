@@ -0,0 +1,68 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package nfctype4
+
+import (
+	"testing"
+
+	"github.com/hsanjuan/go-nfctype4/drivers/dummy"
+)
+
+func TestRegisterDriver(t *testing.T) {
+	RegisterDriver("test-dummy", func() CommandDriver {
+		return new(dummy.Driver)
+	})
+	defer func() {
+		driversMux.Lock()
+		delete(drivers, "test-dummy")
+		driversMux.Unlock()
+	}()
+
+	d, err := NewDriver("test-dummy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := d.(*dummy.Driver); !ok {
+		t.Error("unexpected driver type")
+	}
+	found := false
+	for _, name := range Drivers() {
+		if name == "test-dummy" {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("the driver should be listed")
+	}
+
+	if _, err := NewDriver("missing"); err == nil {
+		t.Error("unknown drivers should fail")
+	}
+
+	expectPanic := func(name string, factory DriverFactory) {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("registering %q should panic", name)
+			}
+		}()
+		RegisterDriver(name, factory)
+	}
+	expectPanic("test-dummy", func() CommandDriver { return nil })
+	expectPanic("", func() CommandDriver { return nil })
+	expectPanic("test-nil", nil)
+}
@@ -0,0 +1,177 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package signature
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"errors"
+
+	"github.com/hsanjuan/go-ndef"
+	"github.com/hsanjuan/go-ndef/types/generic"
+)
+
+// Signer signs NDEF Records with a private key, producing Signature
+// records. RSA keys of 1024 and 2048 bits and ECDSA keys on the P-224
+// and P-256 curves are supported.
+type Signer struct {
+	Key crypto.Signer
+	// Certificates is the chain included in the Signature
+	// records, starting with the certificate of Key. It is
+	// optional.
+	Certificates []*x509.Certificate
+	// PSS selects RSASSA-PSS instead of RSASSA-PKCS1-v1_5 for RSA
+	// keys.
+	PSS bool
+}
+
+// SignedData returns the data covered by a Signature record for the
+// given records: the concatenation of their Type, ID and Payload
+// fields.
+func SignedData(records []*ndef.Record) ([]byte, error) {
+	var buffer bytes.Buffer
+	for _, r := range records {
+		pl, err := r.Payload()
+		if err != nil {
+			return nil, err
+		}
+		buffer.WriteString(r.Type())
+		buffer.WriteString(r.ID())
+		buffer.Write(pl.Marshal())
+	}
+	return buffer.Bytes(), nil
+}
+
+// IsSignatureRecord returns true when the record is a Signature
+// record.
+func IsSignatureRecord(r *ndef.Record) bool {
+	return r.TNF() == ndef.NFCForumWellKnownType && r.Type() == RecordType
+}
+
+// Sign signs the given records and returns the resulting Signature.
+func (s *Signer) Sign(records []*ndef.Record) (*Signature, error) {
+	if s.Key == nil {
+		return nil, errors.New("Signer.Sign: no key provided")
+	}
+	sigType, opts, err := s.signatureType()
+	if err != nil {
+		return nil, err
+	}
+	data, err := SignedData(records)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256(data)
+	sigBytes, err := s.Key.Sign(rand.Reader, digest[:], opts)
+	if err != nil {
+		return nil, err
+	}
+
+	sig := &Signature{
+		Version:           Version,
+		Type:              sigType,
+		HashType:          HashSHA256,
+		Signature:         sigBytes,
+		CertificateFormat: CertificateX509,
+	}
+	for _, cert := range s.Certificates {
+		sig.Certificates = append(sig.Certificates, cert.Raw)
+	}
+	return sig, nil
+}
+
+// Record signs the given records and returns the Signature record
+// which should follow them.
+func (s *Signer) Record(records []*ndef.Record) (*ndef.Record, error) {
+	sig, err := s.Sign(records)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := sig.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	return ndef.NewRecord(ndef.NFCForumWellKnownType, RecordType, "",
+		&generic.Payload{Payload: payload}), nil
+}
+
+// SignMessage returns a new Message with the records of msg followed
+// by a Signature record covering those after the last Signature record
+// in msg (or all of them).
+func (s *Signer) SignMessage(msg *ndef.Message) (*ndef.Message, error) {
+	start := 0
+	for i, r := range msg.Records {
+		if IsSignatureRecord(r) {
+			start = i + 1
+		}
+	}
+	if start == len(msg.Records) {
+		return nil, errors.New("Signer.SignMessage: " +
+			"no records to sign")
+	}
+	sigRecord, err := s.Record(msg.Records[start:])
+	if err != nil {
+		return nil, err
+	}
+	records := make([]*ndef.Record, 0, len(msg.Records)+1)
+	records = append(records, msg.Records...)
+	records = append(records, sigRecord)
+	return ndef.NewMessageFromRecords(records...), nil
+}
+
+// signatureType returns the Signature type and the signing options
+// corresponding to the Key.
+func (s *Signer) signatureType() (byte, crypto.SignerOpts, error) {
+	switch pub := s.Key.Public().(type) {
+	case *rsa.PublicKey:
+		var pss, pkcs1 byte
+		switch pub.N.BitLen() {
+		case 1024:
+			pss, pkcs1 = TypeRSASSAPSS1024, TypeRSASSAPKCS1v151024
+		case 2048:
+			pss, pkcs1 = TypeRSASSAPSS2048, TypeRSASSAPKCS1v152048
+		default:
+			return 0, nil, errors.New("Signer.Sign: " +
+				"RSA keys must be 1024 or 2048 bits long")
+		}
+		if s.PSS {
+			return pss, &rsa.PSSOptions{
+				SaltLength: rsa.PSSSaltLengthEqualsHash,
+				Hash:       crypto.SHA256,
+			}, nil
+		}
+		return pkcs1, crypto.SHA256, nil
+	case *ecdsa.PublicKey:
+		switch pub.Curve {
+		case elliptic.P224():
+			return TypeECDSAP224, crypto.SHA256, nil
+		case elliptic.P256():
+			return TypeECDSAP256, crypto.SHA256, nil
+		}
+		return 0, nil, errors.New("Signer.Sign: " +
+			"ECDSA keys must use the P-224 or P-256 curves")
+	default:
+		return 0, nil, errors.New("Signer.Sign: unsupported key type")
+	}
+}
@@ -0,0 +1,169 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package signature
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/hsanjuan/go-ndef"
+)
+
+func testCertificate(t *testing.T, key crypto.Signer) *x509.Certificate {
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template,
+		key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestSignedData(t *testing.T) {
+	records := ndef.NewTextMessage("hello", "en").Records
+	data, err := SignedData(records)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "T\x02enhello" {
+		t.Errorf("unexpected signed data: % 02X", data)
+	}
+}
+
+func TestSigner_ECDSA(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := testCertificate(t, key)
+	signer := &Signer{Key: key, Certificates: []*x509.Certificate{cert}}
+
+	msg := ndef.NewURIMessage("https://example.org")
+	signed, err := signer.SignMessage(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(signed.Records) != 2 || !IsSignatureRecord(signed.Records[1]) {
+		t.Fatal("expected a Signature record after the URI record")
+	}
+	if _, err := signed.Marshal(); err != nil {
+		t.Fatal(err)
+	}
+
+	pl, err := signed.Records[1].Payload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := new(Signature)
+	if _, err := sig.Unmarshal(pl.Marshal()); err != nil {
+		t.Fatal(err)
+	}
+	if sig.Type != TypeECDSAP256 || len(sig.Certificates) != 1 {
+		t.Errorf("unexpected signature: %s", sig)
+	}
+
+	data, _ := SignedData(msg.Records)
+	digest := sha256.Sum256(data)
+	if !ecdsa.VerifyASN1(&key.PublicKey, digest[:], sig.Signature) {
+		t.Error("the signature does not verify")
+	}
+}
+
+func TestSigner_RSA(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := ndef.NewTextMessage("hello", "en")
+	data, _ := SignedData(msg.Records)
+	digest := sha256.Sum256(data)
+
+	signer := &Signer{Key: key}
+	sig, err := signer.Sign(msg.Records)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sig.Type != TypeRSASSAPKCS1v151024 {
+		t.Errorf("unexpected signature type %02xh", sig.Type)
+	}
+	err = rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:],
+		sig.Signature)
+	if err != nil {
+		t.Error(err)
+	}
+
+	signer.PSS = true
+	sig, err = signer.Sign(msg.Records)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sig.Type != TypeRSASSAPSS1024 {
+		t.Errorf("unexpected signature type %02xh", sig.Type)
+	}
+	err = rsa.VerifyPSS(&key.PublicKey, crypto.SHA256, digest[:],
+		sig.Signature, nil)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSigner_Errors(t *testing.T) {
+	msg := ndef.NewTextMessage("hello", "en")
+	if _, err := new(Signer).Sign(msg.Records); err == nil {
+		t.Error("expected an error without key")
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (&Signer{Key: key}).Sign(msg.Records); err == nil {
+		t.Error("expected an error with a P-384 key")
+	}
+
+	key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := &Signer{Key: key}
+	signed, err := signer.SignMessage(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := signer.SignMessage(signed); err == nil {
+		t.Error("expected an error when there is nothing to sign")
+	}
+}
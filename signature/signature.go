@@ -0,0 +1,253 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+// Package signature provides support for the NFC Forum Signature
+// Record Type Definition (RTD-Signature 2.0), which allows to sign
+// the records of a NDEF Message so that readers can authenticate them.
+//
+// A Signature record covers the records which precede it in the
+// message, up to the previous Signature record (or the beginning of the
+// message). The signed data is the concatenation of the Type, ID and
+// Payload fields of the covered records.
+package signature
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/hsanjuan/go-nfctype4/helpers"
+)
+
+// RecordType is the NFC Forum Well Known Type of Signature records.
+const RecordType = "Sig"
+
+// Version is the version of the Signature RTD implemented by this
+// package.
+const Version = byte(0x20)
+
+// Signature types as defined in the Signature RTD. TypeNotPresent is
+// used by Signature records which only mark the beginning of the
+// signed records.
+const (
+	TypeNotPresent         = byte(0x00)
+	TypeRSASSAPSS1024      = byte(0x01)
+	TypeRSASSAPKCS1v151024 = byte(0x02)
+	TypeDSA1024            = byte(0x03)
+	TypeECDSAP192          = byte(0x04)
+	TypeRSASSAPSS2048      = byte(0x05)
+	TypeRSASSAPKCS1v152048 = byte(0x06)
+	TypeDSA2048            = byte(0x07)
+	TypeECDSAP224          = byte(0x08)
+	TypeECDSAK233          = byte(0x09)
+	TypeECDSAB233          = byte(0x0A)
+	TypeECDSAP256          = byte(0x0B)
+)
+
+// HashSHA256 is the hash type for SHA-256, the only one defined by the
+// Signature RTD.
+const HashSHA256 = byte(0x02)
+
+// Certificate formats.
+const (
+	CertificateX509 = byte(0x00)
+	CertificateM2M  = byte(0x01)
+)
+
+// MaxCertificates is the maximum number of certificates in the chain
+// of a Signature record.
+const MaxCertificates = 15
+
+// Signature is the payload of a Signature record. It carries the
+// signature (or a URI to obtain it) and, optionally, the certificate
+// chain to validate it.
+type Signature struct {
+	Version  byte // Signature RTD version. Set to Version
+	Type     byte // Signature type
+	HashType byte // Hash type. Only HashSHA256 is defined
+	// Signature holds the signature, unless URI is set.
+	Signature []byte
+	// URI, when set, indicates where the signature can be retrieved
+	// from, and Signature is empty.
+	URI string
+	// CertificateFormat is the format of the Certificates.
+	CertificateFormat byte
+	// Certificates holds the certificate chain, starting with the
+	// certificate of the signer.
+	Certificates [][]byte
+	// CertificateURI, when set, points to the next certificate in
+	// the chain.
+	CertificateURI string
+}
+
+// Reset clears the fields of the Signature to their default values.
+func (sig *Signature) Reset() {
+	sig.Version = 0
+	sig.Type = 0
+	sig.HashType = 0
+	sig.Signature = nil
+	sig.URI = ""
+	sig.CertificateFormat = 0
+	sig.Certificates = nil
+	sig.CertificateURI = ""
+}
+
+// String returns a short description of the Signature.
+func (sig *Signature) String() string {
+	if sig.Type == TypeNotPresent {
+		return "Signature not present"
+	}
+	str := fmt.Sprintf("Signature type %02xh", sig.Type)
+	if sig.URI != "" {
+		str += fmt.Sprintf(" at %s", sig.URI)
+	}
+	return str + fmt.Sprintf(", %d certificate(s)", len(sig.Certificates))
+}
+
+// Unmarshal parses a Signature record payload and sets the fields of
+// the Signature. It always resets the Signature before parsing.
+//
+// It returns the number of bytes read and an error if the payload
+// is malformed.
+func (sig *Signature) Unmarshal(buf []byte) (rLen int, err error) {
+	defer helpers.HandleErrorPanic(&err, "Signature.Unmarshal")
+	bytesBuf := bytes.NewBuffer(buf)
+	sig.Reset()
+
+	sig.Version = helpers.GetByte(bytesBuf)
+	if sig.Version != Version {
+		return 1, fmt.Errorf("Signature.Unmarshal: "+
+			"unsupported version %02xh", sig.Version)
+	}
+
+	sigType := helpers.GetByte(bytesBuf)
+	sig.Type = sigType & 0x7F
+	if sig.Type == TypeNotPresent {
+		return len(buf) - bytesBuf.Len(), nil
+	}
+	sig.HashType = helpers.GetByte(bytesBuf)
+	sigValue := getField(bytesBuf)
+	if sigType&0x80 != 0 {
+		sig.URI = string(sigValue)
+	} else {
+		sig.Signature = sigValue
+	}
+
+	certField := helpers.GetByte(bytesBuf)
+	sig.CertificateFormat = (certField >> 4) & 0x07
+	nCerts := int(certField & 0x0F)
+	for i := 0; i < nCerts; i++ {
+		sig.Certificates = append(sig.Certificates, getField(bytesBuf))
+	}
+	if certField&0x80 != 0 {
+		sig.CertificateURI = string(getField(bytesBuf))
+	}
+	return len(buf) - bytesBuf.Len(), nil
+}
+
+// Marshal returns the byte slice representation of the Signature,
+// to be used as payload of a Signature record.
+//
+// It returns an error if the fields break the specification.
+func (sig *Signature) Marshal() ([]byte, error) {
+	if err := sig.check(); err != nil {
+		return nil, err
+	}
+	var buffer bytes.Buffer
+	buffer.WriteByte(sig.Version)
+	if sig.Type == TypeNotPresent {
+		buffer.WriteByte(TypeNotPresent)
+		return buffer.Bytes(), nil
+	}
+
+	if sig.URI != "" {
+		buffer.WriteByte(0x80 | sig.Type)
+		buffer.WriteByte(sig.HashType)
+		putField(&buffer, []byte(sig.URI))
+	} else {
+		buffer.WriteByte(sig.Type)
+		buffer.WriteByte(sig.HashType)
+		putField(&buffer, sig.Signature)
+	}
+
+	certField := sig.CertificateFormat<<4 | byte(len(sig.Certificates))
+	if sig.CertificateURI != "" {
+		certField |= 0x80
+	}
+	buffer.WriteByte(certField)
+	for _, cert := range sig.Certificates {
+		putField(&buffer, cert)
+	}
+	if sig.CertificateURI != "" {
+		putField(&buffer, []byte(sig.CertificateURI))
+	}
+	return buffer.Bytes(), nil
+}
+
+// check verifies that the fields can be serialized.
+func (sig *Signature) check() error {
+	if sig.Version != Version {
+		return fmt.Errorf("Signature.check: "+
+			"unsupported version %02xh", sig.Version)
+	}
+	if sig.Type > 0x7F {
+		return errors.New("Signature.check: invalid signature type")
+	}
+	if sig.Type == TypeNotPresent {
+		return nil
+	}
+	if sig.URI != "" && len(sig.Signature) > 0 {
+		return errors.New("Signature.check: " +
+			"both Signature and URI are set")
+	}
+	if len(sig.Signature) > 0xFFFF || len(sig.URI) > 0xFFFF {
+		return errors.New("Signature.check: signature too long")
+	}
+	if sig.CertificateFormat > 0x07 {
+		return errors.New("Signature.check: " +
+			"invalid certificate format")
+	}
+	if len(sig.Certificates) > MaxCertificates {
+		return errors.New("Signature.check: too many certificates")
+	}
+	for _, cert := range sig.Certificates {
+		if len(cert) > 0xFFFF {
+			return errors.New("Signature.check: " +
+				"certificate too long")
+		}
+	}
+	if len(sig.CertificateURI) > 0xFFFF {
+		return errors.New("Signature.check: " +
+			"certificate URI too long")
+	}
+	return nil
+}
+
+// getField reads a field preceded by its 2-byte length.
+func getField(b *bytes.Buffer) []byte {
+	n := helpers.BytesToUint16([2]byte{
+		helpers.GetByte(b),
+		helpers.GetByte(b)})
+	return helpers.GetBytes(b, int(n))
+}
+
+// putField writes a field preceded by its 2-byte length.
+func putField(b *bytes.Buffer, field []byte) {
+	n := helpers.Uint16ToBytes(uint16(len(field)))
+	b.Write(n[:])
+	b.Write(field)
+}
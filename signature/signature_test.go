@@ -0,0 +1,127 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package signature
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSignatureMarshalUnmarshal(t *testing.T) {
+	testcases := []*Signature{
+		{
+			Version: Version,
+			Type:    TypeNotPresent,
+		},
+		{
+			Version:           Version,
+			Type:              TypeECDSAP256,
+			HashType:          HashSHA256,
+			Signature:         []byte{0x01, 0x02, 0x03},
+			CertificateFormat: CertificateX509,
+			Certificates:      [][]byte{{0xAA}, {0xBB, 0xCC}},
+		},
+		{
+			Version:           Version,
+			Type:              TypeRSASSAPSS2048,
+			HashType:          HashSHA256,
+			URI:               "https://example.org/sig",
+			CertificateFormat: CertificateM2M,
+			CertificateURI:    "https://example.org/ca",
+		},
+	}
+	for _, c := range testcases {
+		b, err := c.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig := new(Signature)
+		n, err := sig.Unmarshal(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != len(b) {
+			t.Errorf("parsed %d bytes out of %d", n, len(b))
+		}
+		b2, err := sig.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Logf("Expected: % 02X", b)
+		t.Logf("Got     : % 02X", b2)
+		if !bytes.Equal(b, b2) {
+			t.Error("the Signature does not survive a round trip")
+		}
+	}
+}
+
+func TestSignatureUnmarshalBytes(t *testing.T) {
+	b := []byte{
+		0x20,             // Version
+		0x0B,             // ECDSA-P256
+		0x02,             // SHA-256
+		0x00, 0x02, 0x01, // Signature length and value
+		0x02,
+		0x81,             // Certificate URI, X.509, 1 certificate
+		0x00, 0x01, 0xAA, // Certificate
+		0x00, 0x01, 'u', // Certificate URI
+	}
+	sig := new(Signature)
+	if _, err := sig.Unmarshal(b); err != nil {
+		t.Fatal(err)
+	}
+	if sig.Type != TypeECDSAP256 || sig.HashType != HashSHA256 ||
+		!bytes.Equal(sig.Signature, []byte{0x01, 0x02}) ||
+		len(sig.Certificates) != 1 || sig.CertificateURI != "u" {
+		t.Errorf("unexpected result: %+v", sig)
+	}
+}
+
+func TestSignatureUnmarshalErrors(t *testing.T) {
+	testcases := [][]byte{
+		nil,
+		{0x10, 0x00},                   // Bad version
+		{0x20, 0x0B, 0x02, 0x00, 0x05}, // Short signature
+		{0x20, 0x0B, 0x02, 0x00, 0x00}, // No certificate field
+		{0x20, 0x0B, 0x02, 0x00, 0x00, 0x02, 0x00, 0x01, 0xAA},
+	}
+	for _, c := range testcases {
+		sig := new(Signature)
+		if _, err := sig.Unmarshal(c); err == nil {
+			t.Errorf("% 02X: expected an error", c)
+		}
+	}
+}
+
+func TestSignatureCheck(t *testing.T) {
+	testcases := []*Signature{
+		{Version: 0x10},
+		{Version: Version, Type: 0x80},
+		{Version: Version, Type: TypeECDSAP256,
+			Signature: []byte{0x01}, URI: "u"},
+		{Version: Version, Type: TypeECDSAP256,
+			CertificateFormat: 0x08},
+		{Version: Version, Type: TypeECDSAP256,
+			Certificates: make([][]byte, MaxCertificates+1)},
+	}
+	for _, c := range testcases {
+		if _, err := c.Marshal(); err == nil {
+			t.Errorf("%+v: expected an error", c)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package signature
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hsanjuan/go-ndef"
+)
+
+// Status is the result of verifying a Signature record.
+type Status int
+
+// Signature statuses.
+const (
+	// StatusValid indicates that the signature matches the records
+	// and that the certificate of the signer is trusted.
+	StatusValid Status = iota
+	// StatusUntrusted indicates that the signature matches the
+	// records, but the certificate of the signer could not be
+	// validated against the trust anchors.
+	StatusUntrusted
+	// StatusInvalid indicates that the signature does not match
+	// the records, or that the Signature record is malformed.
+	StatusInvalid
+	// StatusUnsupported indicates that the signature cannot be
+	// verified: it is only available through a URI, it does not
+	// carry a X.509 certificate or it uses an unsupported algorithm.
+	StatusUnsupported
+)
+
+// String returns the name of the status.
+func (s Status) String() string {
+	switch s {
+	case StatusValid:
+		return "valid"
+	case StatusUntrusted:
+		return "untrusted"
+	case StatusInvalid:
+		return "invalid"
+	case StatusUnsupported:
+		return "unsupported"
+	default:
+		return "unknown"
+	}
+}
+
+// Result describes the verification of a Signature record.
+type Result struct {
+	// Index is the position of the Signature record in the message.
+	Index int
+	// First is the position of the first record covered by the
+	// signature. The covered records go from First to Index - 1.
+	First int
+	// Signature is the parsed Signature record, or nil if it is
+	// malformed.
+	Signature *Signature
+	// Certificate is the certificate of the signer, when
+	// available.
+	Certificate *x509.Certificate
+	Status      Status
+	// Err explains why the Status is not StatusValid.
+	Err error
+}
+
+// Verifier verifies the Signature records of NDEF Messages.
+type Verifier struct {
+	// Roots is the set of trust anchors used to validate the
+	// certificates of the signers. When nil, the system roots are
+	// used.
+	Roots *x509.CertPool
+	// CurrentTime is used to check the validity of the
+	// certificates. Defaults to the current time.
+	CurrentTime time.Time
+	// KeyUsages lists the accepted extended key usages of the
+	// certificates. By default, any usage is accepted.
+	KeyUsages []x509.ExtKeyUsage
+}
+
+// Verify verifies every Signature record in the message and returns
+// a Result for each of them, in order. Signature records without a
+// signature only mark the beginning of the signed records and are not
+// reported. Records after the last Signature record are not signed.
+func (v *Verifier) Verify(msg *ndef.Message) []Result {
+	var results []Result
+	first := 0
+	for i, r := range msg.Records {
+		if !IsSignatureRecord(r) {
+			continue
+		}
+		res := Result{Index: i, First: first}
+		first = i + 1
+
+		pl, err := r.Payload()
+		if err != nil {
+			res.Status, res.Err = StatusInvalid, err
+			results = append(results, res)
+			continue
+		}
+		sig := new(Signature)
+		if _, err := sig.Unmarshal(pl.Marshal()); err != nil {
+			res.Status, res.Err = StatusInvalid, err
+			results = append(results, res)
+			continue
+		}
+		if sig.Type == TypeNotPresent {
+			continue
+		}
+		res.Signature = sig
+		res.Certificate, res.Status, res.Err = v.verify(sig,
+			msg.Records[res.First:i])
+		results = append(results, res)
+	}
+	return results
+}
+
+// Unsigned returns the positions of the records of the message which
+// are not covered by any valid signature among the given results (as
+// returned by Verify). Signature records themselves are not reported.
+// Records after the last Signature record are never signed.
+func Unsigned(msg *ndef.Message, results []Result) []int {
+	covered := make(map[int]bool)
+	for _, res := range results {
+		if res.Status != StatusValid {
+			continue
+		}
+		for i := res.First; i < res.Index; i++ {
+			covered[i] = true
+		}
+	}
+	var unsigned []int
+	for i, r := range msg.Records {
+		if !covered[i] && !IsSignatureRecord(r) {
+			unsigned = append(unsigned, i)
+		}
+	}
+	return unsigned
+}
+
+// verify checks the signature of the given records and validates the
+// certificate of the signer.
+func (v *Verifier) verify(sig *Signature, records []*ndef.Record) (*x509.Certificate, Status, error) {
+	if sig.URI != "" {
+		return nil, StatusUnsupported, errors.New(
+			"signatures referenced by URI are not supported")
+	}
+	if sig.HashType != HashSHA256 {
+		return nil, StatusUnsupported, fmt.Errorf(
+			"unsupported hash type %02xh", sig.HashType)
+	}
+	if sig.CertificateFormat != CertificateX509 ||
+		len(sig.Certificates) == 0 {
+		return nil, StatusUnsupported, errors.New(
+			"no X.509 certificate to verify the signature")
+	}
+
+	var certs []*x509.Certificate
+	for _, der := range sig.Certificates {
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, StatusInvalid, err
+		}
+		certs = append(certs, cert)
+	}
+	cert := certs[0]
+
+	data, err := SignedData(records)
+	if err != nil {
+		return cert, StatusInvalid, err
+	}
+	digest := sha256.Sum256(data)
+	if status, err := checkSignature(cert.PublicKey, sig, digest[:]); err != nil {
+		return cert, status, err
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, c := range certs[1:] {
+		intermediates.AddCert(c)
+	}
+	keyUsages := v.KeyUsages
+	if keyUsages == nil {
+		keyUsages = []x509.ExtKeyUsage{x509.ExtKeyUsageAny}
+	}
+	_, err = cert.Verify(x509.VerifyOptions{
+		Roots:         v.Roots,
+		Intermediates: intermediates,
+		CurrentTime:   v.CurrentTime,
+		KeyUsages:     keyUsages,
+	})
+	if err != nil {
+		return cert, StatusUntrusted, err
+	}
+	return cert, StatusValid, nil
+}
+
+// checkSignature verifies the signature of the digest with the public
+// key, according to the signature type.
+func checkSignature(pub crypto.PublicKey, sig *Signature, digest []byte) (Status, error) {
+	errMismatch := errors.New("the signature does not match the records")
+	switch sig.Type {
+	case TypeRSASSAPSS1024, TypeRSASSAPSS2048,
+		TypeRSASSAPKCS1v151024, TypeRSASSAPKCS1v152048:
+		key, ok := pub.(*rsa.PublicKey)
+		if !ok {
+			return StatusInvalid, errors.New(
+				"the certificate does not hold a RSA key")
+		}
+		bits := 2048
+		if sig.Type == TypeRSASSAPSS1024 || sig.Type == TypeRSASSAPKCS1v151024 {
+			bits = 1024
+		}
+		if key.N.BitLen() != bits {
+			return StatusInvalid, fmt.Errorf("signature type %02xh "+
+				"requires a %d-bit RSA key", sig.Type, bits)
+		}
+		var err error
+		if sig.Type == TypeRSASSAPSS1024 || sig.Type == TypeRSASSAPSS2048 {
+			err = rsa.VerifyPSS(key, crypto.SHA256, digest,
+				sig.Signature, nil)
+		} else {
+			err = rsa.VerifyPKCS1v15(key, crypto.SHA256, digest,
+				sig.Signature)
+		}
+		if err != nil {
+			return StatusInvalid, errMismatch
+		}
+		return StatusValid, nil
+	case TypeECDSAP224, TypeECDSAP256:
+		key, ok := pub.(*ecdsa.PublicKey)
+		if !ok {
+			return StatusInvalid, errors.New(
+				"the certificate does not hold an ECDSA key")
+		}
+		curve := elliptic.P256()
+		if sig.Type == TypeECDSAP224 {
+			curve = elliptic.P224()
+		}
+		if key.Curve != curve {
+			return StatusInvalid, fmt.Errorf("signature type %02xh "+
+				"requires a %s key", sig.Type, curve.Params().Name)
+		}
+		if !ecdsa.VerifyASN1(key, digest, sig.Signature) {
+			return StatusInvalid, errMismatch
+		}
+		return StatusValid, nil
+	default:
+		return StatusUnsupported, fmt.Errorf(
+			"unsupported signature type %02xh", sig.Type)
+	}
+}
@@ -0,0 +1,240 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package signature
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"testing"
+
+	"github.com/hsanjuan/go-ndef"
+	"github.com/hsanjuan/go-ndef/types/generic"
+)
+
+func testSignedMessage(t *testing.T) (*ndef.Message, *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := testCertificate(t, key)
+	signer := &Signer{Key: key, Certificates: []*x509.Certificate{cert}}
+	msg, err := signer.SignMessage(ndef.NewTextMessage("hello", "en"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg, cert
+}
+
+func TestVerifier_Verify(t *testing.T) {
+	msg, cert := testSignedMessage(t)
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+
+	results := (&Verifier{Roots: roots}).Verify(msg)
+	if len(results) != 1 {
+		t.Fatalf("expected 1 result, got %d", len(results))
+	}
+	res := results[0]
+	if res.Status != StatusValid || res.Err != nil {
+		t.Errorf("expected a valid signature: %s %v", res.Status, res.Err)
+	}
+	if res.Index != 1 || res.First != 0 {
+		t.Errorf("unexpected covered records: %d-%d", res.First, res.Index)
+	}
+	if !res.Certificate.Equal(cert) {
+		t.Error("unexpected signer certificate")
+	}
+
+	results = (&Verifier{Roots: x509.NewCertPool()}).Verify(msg)
+	if results[0].Status != StatusUntrusted {
+		t.Errorf("expected an untrusted signature: %s", results[0].Status)
+	}
+}
+
+func TestVerifier_Tampered(t *testing.T) {
+	msg, cert := testSignedMessage(t)
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+
+	msg.Records[0] = ndef.NewTextMessage("bye", "en").Records[0]
+	msg = ndef.NewMessageFromRecords(msg.Records...)
+	results := (&Verifier{Roots: roots}).Verify(msg)
+	if len(results) != 1 || results[0].Status != StatusInvalid {
+		t.Fatal("expected an invalid signature")
+	}
+	t.Log(results[0].Err)
+}
+
+func TestVerifier_Unsupported(t *testing.T) {
+	testcases := []*Signature{
+		{
+			Version:  Version,
+			Type:     TypeECDSAP256,
+			HashType: HashSHA256,
+			URI:      "https://example.org/sig",
+		},
+		{
+			Version:   Version,
+			Type:      TypeECDSAP256,
+			HashType:  HashSHA256,
+			Signature: []byte{0x01},
+		},
+	}
+	for _, c := range testcases {
+		payload, err := c.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg := ndef.NewMessageFromRecords(
+			ndef.NewTextMessage("hello", "en").Records[0],
+			ndef.NewRecord(ndef.NFCForumWellKnownType, RecordType, "",
+				&generic.Payload{Payload: payload}),
+		)
+		results := new(Verifier).Verify(msg)
+		if len(results) != 1 || results[0].Status != StatusUnsupported {
+			t.Errorf("%s: expected an unsupported signature", c)
+		}
+	}
+}
+
+func TestVerifier_Ranges(t *testing.T) {
+	signed, cert := testSignedMessage(t)
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+
+	marker, err := (&Signature{Version: Version}).Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := ndef.NewMessageFromRecords(
+		ndef.NewURIMessage("https://example.org").Records[0],
+		ndef.NewRecord(ndef.NFCForumWellKnownType, RecordType, "",
+			&generic.Payload{Payload: marker}),
+		signed.Records[0],
+		signed.Records[1],
+		ndef.NewTextMessage("unsigned", "en").Records[0],
+	)
+	results := (&Verifier{Roots: roots}).Verify(msg)
+	if len(results) != 1 {
+		t.Fatalf("expected 1 result, got %d", len(results))
+	}
+	if results[0].First != 2 || results[0].Index != 3 ||
+		results[0].Status != StatusValid {
+		t.Errorf("unexpected result: %+v", results[0])
+	}
+
+	// The URI before the marker and the trailing text are not signed
+	unsigned := Unsigned(msg, results)
+	if len(unsigned) != 2 || unsigned[0] != 0 || unsigned[1] != 4 {
+		t.Errorf("expected records 0 and 4 to be unsigned. Got %v", unsigned)
+	}
+}
+
+func TestUnsigned(t *testing.T) {
+	signed, cert := testSignedMessage(t)
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	v := &Verifier{Roots: roots}
+
+	if unsigned := Unsigned(signed, v.Verify(signed)); len(unsigned) != 0 {
+		t.Errorf("expected every record to be signed. Got %v", unsigned)
+	}
+
+	msg := ndef.NewMessageFromRecords(
+		signed.Records[0],
+		signed.Records[1],
+		ndef.NewURIMessage("https://example.org").Records[0],
+	)
+	results := v.Verify(msg)
+	if len(results) != 1 || results[0].Status != StatusValid {
+		t.Fatal("expected a valid signature")
+	}
+	unsigned := Unsigned(msg, results)
+	if len(unsigned) != 1 || unsigned[0] != 2 {
+		t.Errorf("expected the trailing record to be unsigned. Got %v", unsigned)
+	}
+
+	// Records under an untrusted signature are not signed either
+	results = (&Verifier{Roots: x509.NewCertPool()}).Verify(msg)
+	if unsigned := Unsigned(msg, results); len(unsigned) != 2 {
+		t.Errorf("expected 2 unsigned records. Got %v", unsigned)
+	}
+}
+
+func TestVerifier_KeyMismatch(t *testing.T) {
+	msg := ndef.NewTextMessage("hello", "en")
+	data, _ := SignedData(msg.Records)
+	digest := sha256.Sum256(data)
+
+	p224, err := ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testcases := []struct {
+		key     crypto.Signer
+		sigType byte
+		opts    crypto.SignerOpts
+	}{
+		{p224, TypeECDSAP256, crypto.SHA256},
+		{rsaKey, TypeRSASSAPKCS1v151024, crypto.SHA256},
+		{rsaKey, TypeRSASSAPSS1024, &rsa.PSSOptions{
+			SaltLength: rsa.PSSSaltLengthEqualsHash,
+			Hash:       crypto.SHA256,
+		}},
+	}
+	for _, c := range testcases {
+		sigBytes, err := c.key.Sign(rand.Reader, digest[:], c.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert := testCertificate(t, c.key)
+		sig := &Signature{
+			Version:           Version,
+			Type:              c.sigType,
+			HashType:          HashSHA256,
+			Signature:         sigBytes,
+			CertificateFormat: CertificateX509,
+			Certificates:      [][]byte{cert.Raw},
+		}
+		payload, err := sig.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		signed := ndef.NewMessageFromRecords(msg.Records[0],
+			ndef.NewRecord(ndef.NFCForumWellKnownType, RecordType, "",
+				&generic.Payload{Payload: payload}))
+		roots := x509.NewCertPool()
+		roots.AddCert(cert)
+		results := (&Verifier{Roots: roots}).Verify(signed)
+		if len(results) != 1 || results[0].Status != StatusInvalid {
+			t.Errorf("type %02xh: expected an invalid signature", c.sigType)
+			continue
+		}
+		t.Log(results[0].Err)
+	}
+}
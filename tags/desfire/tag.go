@@ -0,0 +1,229 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+// Package desfire provides a software-based NFC Forum Type 4 Tag which
+// behaves like a MIFARE DESFire card formatted with the NDEF mapping.
+//
+// DESFire cards implement the Type 4 Tag operations on top of their
+// native file system and show some quirks which other tags do not
+// have. This tag reproduces them so that devices can be tested
+// against DESFire-based badges:
+//
+//   - The Capability Container and the NDEF File are standard data
+//     files which are only reachable through their ISO File IDs (E103h
+//     and E104h) once the NDEF Application has been selected.
+//   - Selecting the NDEF Application, or a file with P2 set to 00h,
+//     returns File Control Information (FCI).
+//   - The CC advertises the small MLe and MLc values used by DESFire
+//     cards (003Bh and 0034h) and its file is larger than CCLEN,
+//     padded with zeros.
+//   - Files have a fixed size: reading past the data written always
+//     returns zeros until the end of the file.
+package desfire
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+
+	"github.com/hsanjuan/go-ndef"
+	"github.com/hsanjuan/go-nfctype4/apdu"
+	"github.com/hsanjuan/go-nfctype4/capabilitycontainer"
+	"github.com/hsanjuan/go-nfctype4/helpers"
+	"github.com/hsanjuan/go-nfctype4/tags"
+	"github.com/hsanjuan/go-nfctype4/tags/internal/filesystem"
+)
+
+// Values used by DESFire cards formatted with the NDEF mapping.
+const (
+	// NDEFFileAddress is the ISO File ID of the NDEF File.
+	NDEFFileAddress = uint16(0xE104)
+	// MLe is the maximum data length for ReadBinary commands.
+	MLe = uint16(0x003B)
+	// MLc is the maximum data length for UpdateBinary commands.
+	MLc = uint16(0x0034)
+	// CCFileSize is the size of the file holding the Capability
+	// Container, which is larger than CCLEN.
+	CCFileSize = 0x20
+	// DefaultNDEFFileSize is the size of the NDEF File used by New.
+	DefaultNDEFFileSize = uint16(0x0800)
+)
+
+// Tag implements a NFC Type 4 Tag with the behaviour of a DESFire
+// card. It implements the `tags.Tag` interface and it is safe for
+// concurrent use.
+//
+// Please use desfire.New() or desfire.NewWithSize() to create tags.
+type Tag struct {
+	mux         sync.Mutex
+	appSelected bool
+	fs          filesystem.FileSystem
+}
+
+// New returns a new *Tag with an empty NDEF File of
+// DefaultNDEFFileSize bytes.
+func New() *Tag {
+	tag, _ := NewWithSize(DefaultNDEFFileSize)
+	return tag
+}
+
+// NewWithSize returns a new *Tag with an empty NDEF File of the given
+// size (0005h-FFFEh).
+func NewWithSize(ndefFileSize uint16) (*Tag, error) {
+	cc := &capabilitycontainer.CapabilityContainer{
+		MappingVersion: 0x20,
+		MLe:            MLe,
+		MLc:            MLc,
+		NDEFFileControlTLV: &capabilitycontainer.NDEFFileControlTLV{
+			T:                        capabilitycontainer.TypeNDEFFileControlTLV,
+			L:                        0x06,
+			FileID:                   NDEFFileAddress,
+			MaximumFileSize:          ndefFileSize,
+			FileReadAccessCondition:  0x00,
+			FileWriteAccessCondition: 0x00,
+		},
+	}
+	if err := cc.Finalize(); err != nil {
+		return nil, err
+	}
+	ccBytes, err := cc.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	ccFile := make([]byte, CCFileSize)
+	copy(ccFile, ccBytes)
+
+	tag := new(Tag)
+	tag.fs.Storage = tags.NewMemoryStorage()
+	tag.fs.MLe = MLe
+	tag.fs.MLc = MLc
+	tag.fs.Files = file
+	if err := filesystem.WriteFile(tag.fs.Storage, capabilitycontainer.CCID, ccFile); err != nil {
+		return nil, err
+	}
+	if err := tag.fs.Storage.Truncate(NDEFFileAddress, int(ndefFileSize)); err != nil {
+		return nil, err
+	}
+	return tag, nil
+}
+
+// file returns the limits and access conditions of a file. DESFire
+// files have a fixed size.
+func file(fileID uint16) filesystem.File {
+	if fileID == capabilitycontainer.CCID {
+		return filesystem.File{Fixed: true, WriteAccess: 0xFF}
+	}
+	return filesystem.File{Fixed: true}
+}
+
+// SetMessage stores a message in the NDEF File of the tag.
+// It returns an error if the message cannot be serialized or if it
+// does not fit in the file.
+func (tag *Tag) SetMessage(m *ndef.Message) error {
+	mBytes, err := m.Marshal()
+	if err != nil {
+		return err
+	}
+	tag.mux.Lock()
+	defer tag.mux.Unlock()
+	size, err := tag.fs.Storage.Size(NDEFFileAddress)
+	if err != nil {
+		return err
+	}
+	if len(mBytes) > size-2 {
+		return errors.New("Tag.SetMessage: message too long")
+	}
+	nlen := helpers.Uint16ToBytes(uint16(len(mBytes)))
+	return tag.fs.Storage.Put(NDEFFileAddress, 0, append(nlen[:], mBytes...))
+}
+
+// GetMessage allows to retrieve the NDEF message stored
+// in the tag.
+// It returns nil when there is nothing stored.
+func (tag *Tag) GetMessage() *ndef.Message {
+	tag.mux.Lock()
+	file, err := filesystem.ReadFile(tag.fs.Storage, NDEFFileAddress)
+	tag.mux.Unlock()
+	if err != nil || len(file) < 2 {
+		return nil
+	}
+	nlen := int(helpers.BytesToUint16([2]byte{file[0], file[1]}))
+	if nlen == 0 || nlen > len(file)-2 {
+		return nil
+	}
+	msg := new(ndef.Message)
+	if _, err := msg.Unmarshal(file[2 : 2+nlen]); err != nil {
+		return nil
+	}
+	return msg
+}
+
+// Command lets the Software tag receive Commands (CAPDUs) and
+// provide responses (RAPDUs) according to each command.
+func (tag *Tag) Command(capdu *apdu.CAPDU) *apdu.RAPDU {
+	tag.mux.Lock()
+	defer tag.mux.Unlock()
+
+	switch capdu.INS {
+	case apdu.INSSelect:
+		return tag.doSelect(capdu)
+	case apdu.INSRead:
+		return tag.fs.Read(capdu)
+	case apdu.INSUpdate:
+		return tag.fs.Update(capdu)
+	default:
+		return apdu.NewRAPDUINSNotSupported()
+	}
+}
+
+func (tag *Tag) doSelect(capdu *apdu.CAPDU) *apdu.RAPDU {
+	switch {
+	case capdu.P1 == 0x04:
+		tag.appSelected = false
+		tag.fs.Deselect()
+		if !bytes.Equal(capdu.Data, filesystem.NDEFApplication) {
+			return apdu.NewRAPDU(apdu.RAPDUFileNotFound)
+		}
+		tag.appSelected = true
+		rapdu := apdu.NewRAPDU(apdu.RAPDUCommandCompleted)
+		if capdu.P2 == 0x00 && len(capdu.Le) > 0 {
+			rapdu.ResponseBody = fci(0x84, filesystem.NDEFApplication)
+		}
+		return rapdu
+	case capdu.P1 == 0x00 || capdu.P1 == 0x02:
+		if len(capdu.Data) != 2 {
+			return apdu.NewRAPDUStatus(apdu.SWLcInconsistentWithP1P2)
+		}
+		fileID := helpers.BytesToUint16([2]byte{capdu.Data[0], capdu.Data[1]})
+		if !tag.appSelected || !tag.fs.SelectFile(fileID) {
+			return apdu.NewRAPDU(apdu.RAPDUFileNotFound)
+		}
+		rapdu := apdu.NewRAPDU(apdu.RAPDUCommandCompleted)
+		if capdu.P2 == 0x00 && len(capdu.Le) > 0 {
+			rapdu.ResponseBody = fci(0x83, capdu.Data)
+		}
+		return rapdu
+	default:
+		return apdu.NewRAPDUStatus(apdu.SWIncorrectP1P2)
+	}
+}
+
+// fci returns a FCI template (6Fh) containing a data object with the
+// given tag, which is 84h for DF names and 83h for File IDs.
+func fci(tag byte, value []byte) []byte {
+	return apdu.MarshalDataObject(0x6F, apdu.MarshalDataObject(tag, value))
+}
@@ -0,0 +1,131 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package desfire
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/hsanjuan/go-ndef"
+	"github.com/hsanjuan/go-nfctype4"
+	"github.com/hsanjuan/go-nfctype4/apdu"
+	"github.com/hsanjuan/go-nfctype4/capabilitycontainer"
+	"github.com/hsanjuan/go-nfctype4/drivers/swtag"
+	"github.com/hsanjuan/go-nfctype4/tags"
+	"github.com/hsanjuan/go-nfctype4/tags/tagtest"
+)
+
+func TestTag_device(t *testing.T) {
+	tag := New()
+	device := nfctype4.New(&swtag.Driver{Tag: tag})
+	if _, err := device.Read(); err == nil {
+		t.Error("reading an empty tag should fail")
+	}
+
+	msg := ndef.NewURIMessage("https://example.org/badge/1234")
+	if err := device.Update(msg); err != nil {
+		t.Fatal(err)
+	}
+	if tag.GetMessage().String() != msg.String() {
+		t.Error("the message was not written")
+	}
+	readMsg, err := device.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if readMsg.String() != msg.String() {
+		t.Error("unexpected message:", readMsg)
+	}
+}
+
+func TestTag_quirks(t *testing.T) {
+	tag := New()
+
+	// Files are not reachable before selecting the application
+	rapdu := tag.Command(apdu.NewSelectAPDU(capabilitycontainer.CCID))
+	if !rapdu.FileNotFound() {
+		t.Errorf("expected 6A82h but got %04Xh", rapdu.Status())
+	}
+
+	rapdu = tag.Command(apdu.NewNDEFTagApplicationSelectAPDU())
+	expected := []byte{0x6F, 0x09, 0x84, 0x07,
+		0xD2, 0x76, 0x00, 0x00, 0x85, 0x01, 0x01}
+	if !rapdu.CommandCompleted() || !bytes.Equal(rapdu.ResponseBody, expected) {
+		t.Errorf("unexpected application FCI: %s", rapdu)
+	}
+
+	rapdu = tag.Command(apdu.NewSelectAPDU(capabilitycontainer.CCID))
+	if !rapdu.CommandCompleted() || len(rapdu.ResponseBody) != 0 {
+		t.Error("selecting with P2=0Ch should not return FCI")
+	}
+	selectFCI := apdu.NewSelectAPDU(NDEFFileAddress)
+	selectFCI.P2 = 0x00
+	selectFCI.SetLe(256)
+	rapdu = tag.Command(selectFCI)
+	expected = []byte{0x6F, 0x04, 0x83, 0x02, 0xE1, 0x04}
+	if !rapdu.CommandCompleted() || !bytes.Equal(rapdu.ResponseBody, expected) {
+		t.Errorf("unexpected file FCI: %s", rapdu)
+	}
+
+	tag.Command(apdu.NewSelectAPDU(capabilitycontainer.CCID))
+	rapdu = tag.Command(apdu.NewReadBinaryAPDU(0, 0xFF))
+	if len(rapdu.ResponseBody) != CCFileSize || !rapdu.EndOfFile() {
+		t.Error("the whole CC file should be read")
+	}
+	cc := new(capabilitycontainer.CapabilityContainer)
+	if _, err := cc.Unmarshal(rapdu.ResponseBody); err != nil {
+		t.Fatal(err)
+	}
+	if cc.MLe != MLe || cc.MLc != MLc {
+		t.Error("unexpected MLe or MLc")
+	}
+	if !bytes.Equal(rapdu.ResponseBody[cc.CCLEN:],
+		make([]byte, CCFileSize-int(cc.CCLEN))) {
+		t.Error("the CC file should be padded with zeros")
+	}
+
+	tag.Command(apdu.NewSelectAPDU(NDEFFileAddress))
+	rapdu = tag.Command(apdu.NewReadBinaryAPDU(0x07F0, 0xFF))
+	if len(rapdu.ResponseBody) != 0x10 || !rapdu.EndOfFile() {
+		t.Error("reads should reach the end of the fixed-size file")
+	}
+	rapdu = tag.Command(apdu.NewUpdateBinaryAPDU([]byte{1, 2, 3}, 0x07FE))
+	if rapdu.Status() != apdu.SWNotEnoughMemory {
+		t.Errorf("expected 6A84h but got %04Xh", rapdu.Status())
+	}
+}
+
+func TestNewWithSize(t *testing.T) {
+	if _, err := NewWithSize(2); err == nil {
+		t.Error("NewWithSize should fail with a too small file")
+	}
+	tag, err := NewWithSize(0x20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	big := ndef.NewTextMessage("this message does not fit in the file", "en")
+	if err := tag.SetMessage(big); err == nil {
+		t.Error("SetMessage should fail with a too long message")
+	}
+}
+
+func TestConformance(t *testing.T) {
+	tagtest.TestTag(t, func() (tags.Tag, error) {
+		return New(), nil
+	})
+}
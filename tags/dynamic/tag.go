@@ -0,0 +1,105 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+// Package dynamic provides a software-based NFC Forum Type 4 Tag whose
+// NDEF Message is generated by a callback every time the tag is read.
+//
+// This allows to emulate "smart" tags, which return, for example, a
+// counter, a timestamp or a one-time URL.
+package dynamic
+
+import (
+	"errors"
+
+	"github.com/hsanjuan/go-ndef"
+	"github.com/hsanjuan/go-nfctype4/apdu"
+	"github.com/hsanjuan/go-nfctype4/helpers"
+	"github.com/hsanjuan/go-nfctype4/tags/static"
+)
+
+// Generator is a function which returns the NDEF Message that the tag
+// should provide.
+type Generator func() (*ndef.Message, error)
+
+// Tag implements a NFC Type 4 Tag whose NDEF Message is obtained from
+// a Generator. It implements the `tags.Tag` interface.
+//
+// The Generator is called every time the NDEF File is selected, which
+// NFC Forum devices do once before reading it. The message stays the
+// same until the NDEF File is selected again, so the NLEN and the
+// contents read by a device are always consistent.
+//
+// The NDEF File is marked as read-only in the Capability Container
+// and UpdateBinary commands on it are rejected.
+//
+// Please use dynamic.New() to create tags.
+type Tag struct {
+	generator Generator
+	tag       *static.Tag
+}
+
+// New returns a new *Tag which uses the given Generator to produce
+// its NDEF Message.
+func New(generator Generator) (*Tag, error) {
+	if generator == nil {
+		return nil, errors.New("dynamic.New: a Generator is needed")
+	}
+	tag := &Tag{
+		generator: generator,
+		tag:       static.New(),
+	}
+	if err := tag.tag.SetAccessConditions(0x00, 0xFF); err != nil {
+		return nil, err
+	}
+	return tag, nil
+}
+
+// Command lets the Software tag receive Commands (CAPDUs) and
+// provide responses (RAPDUs) according to each command. When the
+// NDEF File is selected, a new NDEF Message is generated. If the
+// Generator fails, the tag responds with 6581h (memory failure).
+func (tag *Tag) Command(capdu *apdu.CAPDU) *apdu.RAPDU {
+	if isNDEFFileSelect(capdu) {
+		if err := tag.generate(); err != nil {
+			return apdu.NewRAPDUStatus(apdu.SWMemoryFailure)
+		}
+	}
+	return tag.tag.Command(capdu)
+}
+
+// generate obtains a new NDEF Message and stores it in the tag.
+func (tag *Tag) generate() error {
+	m, err := tag.generator()
+	if err != nil {
+		return err
+	}
+	if m == nil {
+		return errors.New("Tag.generate: no message generated")
+	}
+	return tag.tag.SetMessage(m)
+}
+
+// isNDEFFileSelect returns true when a CAPDU selects the NDEF File
+// by its ID.
+func isNDEFFileSelect(capdu *apdu.CAPDU) bool {
+	if capdu.INS != apdu.INSSelect || capdu.P1 != 0x00 ||
+		capdu.P2 != 0x0C || len(capdu.Data) != 2 {
+		return false
+	}
+	fileID := helpers.BytesToUint16([2]byte{capdu.Data[0], capdu.Data[1]})
+	return fileID == static.NDEFFileAddress
+}
@@ -0,0 +1,82 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package dynamic
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/hsanjuan/go-ndef"
+	"github.com/hsanjuan/go-nfctype4"
+	"github.com/hsanjuan/go-nfctype4/drivers/swtag"
+)
+
+func ExampleTag() {
+	counter := 0
+	tag, err := New(func() (*ndef.Message, error) {
+		counter++
+		msg := fmt.Sprintf("Read %d times", counter)
+		return ndef.NewTextMessage(msg, "en"), nil
+	})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	device := nfctype4.New(&swtag.Driver{Tag: tag})
+	for i := 0; i < 2; i++ {
+		msg, err := device.Read()
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		fmt.Println(msg)
+	}
+	// Output:
+	// urn:nfc:wkt:T:Read 1 times
+	// urn:nfc:wkt:T:Read 2 times
+}
+
+func TestTag(t *testing.T) {
+	if _, err := New(nil); err == nil {
+		t.Error("New should fail without Generator")
+	}
+
+	fail := false
+	tag, err := New(func() (*ndef.Message, error) {
+		if fail {
+			return nil, errors.New("generator failed")
+		}
+		return ndef.NewTextMessage("dynamic", "en"), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	device := nfctype4.New(&swtag.Driver{Tag: tag})
+
+	err = device.Update(ndef.NewTextMessage("update", "en"))
+	if err == nil || err.Error() != "Device.Update: the tag is read-only" {
+		t.Error("expected a read-only error but got:", err)
+	}
+
+	fail = true
+	if _, err := device.Read(); err == nil {
+		t.Error("Read should fail when the Generator does")
+	}
+}
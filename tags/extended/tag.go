@@ -0,0 +1,179 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+// Package extended provides a software-based NFC Forum Type 4 Tag
+// implementing the mapping version 3.0, whose NDEF File is an Extended
+// NDEF File.
+//
+// The Capability Container advertises the file with an Extended NDEF
+// File Control TLV and the NDEF Message is preceded by a 4-byte
+// length (ENLEN), which allows messages larger than 64KB. Offsets
+// beyond 7FFFh are accessed with the ReadBinary and UpdateBinary
+// commands using the odd instruction byte.
+//
+// A nfctype4.Device reads and updates these tags when its
+// MajorVersion is set to 3.
+package extended
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"sync"
+
+	"github.com/hsanjuan/go-ndef"
+	"github.com/hsanjuan/go-nfctype4/apdu"
+	"github.com/hsanjuan/go-nfctype4/capabilitycontainer"
+	"github.com/hsanjuan/go-nfctype4/tags"
+	"github.com/hsanjuan/go-nfctype4/tags/internal/filesystem"
+)
+
+// Version of the specification implemented by this tag
+const (
+	NFCForumMajorVersion = 3
+	NFCForumMinorVersion = 0
+)
+
+// NDEFFileAddress Address in which the Extended NDEF File is stored.
+const NDEFFileAddress = uint16(0xE104)
+
+// enlenSize is the size of the ENLEN field.
+const enlenSize = 4
+
+// Tag implements a NFC Type 4 Tag with an Extended NDEF File. It
+// implements the `tags.Tag` interface and it is safe for concurrent
+// use.
+//
+// Please use extended.New() to create tags.
+type Tag struct {
+	mux         sync.Mutex
+	fs          filesystem.FileSystem // the NDEF File holds ENLEN + NDEF Message
+	maxFileSize uint32
+}
+
+// New returns a new *Tag with an Extended NDEF File of the given
+// maximum size (00000005h-FFFFFFFEh). mle and mlc are the maximum data
+// lengths for ReadBinary and UpdateBinary commands advertised in the
+// Capability Container. The NDEF File is initialized with ENLEN set
+// to 0.
+func New(maxFileSize uint32, mle, mlc uint16) (*Tag, error) {
+	cc := &capabilitycontainer.CapabilityContainer{
+		MappingVersion: byte(NFCForumMajorVersion)<<4 |
+			byte(NFCForumMinorVersion),
+		MLe: mle,
+		MLc: mlc,
+		ExtendedNDEFFileControlTLV: &capabilitycontainer.ExtendedNDEFFileControlTLV{
+			T:                        capabilitycontainer.TypeExtendedNDEFFileControlTLV,
+			L:                        0x08,
+			FileID:                   NDEFFileAddress,
+			MaximumFileSize:          maxFileSize,
+			FileReadAccessCondition:  0x00,
+			FileWriteAccessCondition: 0x00,
+		},
+	}
+	if err := cc.Finalize(); err != nil {
+		return nil, err
+	}
+	ccBytes, err := cc.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	tag := &Tag{
+		maxFileSize: maxFileSize,
+	}
+	tag.fs.Storage = tags.NewMemoryStorage()
+	tag.fs.MLe = mle
+	tag.fs.MLc = mlc
+	tag.fs.Files = tag.file
+	if err := filesystem.WriteFile(tag.fs.Storage, capabilitycontainer.CCID, ccBytes); err != nil {
+		return nil, err
+	}
+	// ENLEN to 0
+	if err := filesystem.WriteFile(tag.fs.Storage, NDEFFileAddress, make([]byte, enlenSize)); err != nil {
+		return nil, err
+	}
+	return tag, nil
+}
+
+// file returns the limits and access conditions of a file.
+func (tag *Tag) file(fileID uint16) filesystem.File {
+	if fileID == capabilitycontainer.CCID {
+		return filesystem.File{WriteAccess: 0xFF}
+	}
+	return filesystem.File{MaximumSize: tag.maxFileSize}
+}
+
+// SetMessage stores a message in the NDEF File of the tag.
+// It returns an error if the message cannot be serialized or if it
+// does not fit in the file.
+func (tag *Tag) SetMessage(m *ndef.Message) error {
+	mBytes, err := m.Marshal()
+	if err != nil {
+		return err
+	}
+	if uint64(len(mBytes))+enlenSize > uint64(tag.maxFileSize) {
+		return errors.New("Tag.SetMessage: message too long")
+	}
+
+	var buf bytes.Buffer
+	enlen := make([]byte, enlenSize)
+	binary.BigEndian.PutUint32(enlen, uint32(len(mBytes)))
+	buf.Write(enlen)
+	buf.Write(mBytes)
+	tag.mux.Lock()
+	defer tag.mux.Unlock()
+	return filesystem.WriteFile(tag.fs.Storage, NDEFFileAddress, buf.Bytes())
+}
+
+// GetMessage allows to retrieve the NDEF message stored
+// in the tag.
+// It returns nil when there is nothing stored.
+func (tag *Tag) GetMessage() *ndef.Message {
+	tag.mux.Lock()
+	file, err := filesystem.ReadFile(tag.fs.Storage, NDEFFileAddress)
+	tag.mux.Unlock()
+	if err != nil || len(file) < enlenSize {
+		return nil
+	}
+	enlen := binary.BigEndian.Uint32(file)
+	if enlen == 0 || uint64(enlen) > uint64(len(file)-enlenSize) {
+		return nil
+	}
+	msg := new(ndef.Message)
+	if _, err := msg.Unmarshal(file[enlenSize : enlenSize+int(enlen)]); err != nil {
+		return nil
+	}
+	return msg
+}
+
+// Command lets the Software tag receive Commands (CAPDUs) and
+// provide responses (RAPDUs) according to each command.
+func (tag *Tag) Command(capdu *apdu.CAPDU) *apdu.RAPDU {
+	tag.mux.Lock()
+	defer tag.mux.Unlock()
+
+	switch capdu.INS {
+	case apdu.INSSelect:
+		return tag.fs.Select(capdu)
+	case apdu.INSRead, apdu.INSReadODO:
+		return tag.fs.Read(capdu)
+	case apdu.INSUpdate, apdu.INSUpdateODO:
+		return tag.fs.Update(capdu)
+	default:
+		return apdu.NewRAPDUINSNotSupported()
+	}
+}
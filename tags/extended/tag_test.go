@@ -0,0 +1,163 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package extended
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/hsanjuan/go-ndef"
+	"github.com/hsanjuan/go-nfctype4"
+	"github.com/hsanjuan/go-nfctype4/capabilitycontainer"
+	"github.com/hsanjuan/go-nfctype4/drivers/swtag"
+	"github.com/hsanjuan/go-nfctype4/tags"
+	"github.com/hsanjuan/go-nfctype4/tags/tagtest"
+)
+
+func TestNew(t *testing.T) {
+	if _, err := New(4, 0xFF, 0xFF); err == nil {
+		t.Error("New should fail with a too small file")
+	}
+	if _, err := New(0x20000, 0, 0xFF); err == nil {
+		t.Error("New should fail with an invalid MLe")
+	}
+}
+
+func TestTag(t *testing.T) {
+	tag, err := New(0x20000, 0xFFFF, 0xFFFF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tag.GetMessage() != nil {
+		t.Error("a new tag should not have a message")
+	}
+
+	cmder := &nfctype4.Commander{Driver: &swtag.Driver{Tag: tag}}
+	if err := cmder.NDEFApplicationSelect(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cmder.Select(capabilitycontainer.CCID); err != nil {
+		t.Fatal(err)
+	}
+	ccBytes, err := cmder.ReadBinary(0, 17)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cc := new(capabilitycontainer.CapabilityContainer)
+	if _, err := cc.Unmarshal(ccBytes); err != nil {
+		t.Fatal(err)
+	}
+	if cc.MajorVersion() != 3 || !cc.UsesExtendedNDEFFile() {
+		t.Error("the CC should use the mapping version 3.0")
+	}
+	if err := cmder.UpdateBinary([]byte{0x00}, 0); err == nil {
+		t.Error("the CC should not be writable")
+	}
+
+	msg := ndef.NewTextMessage(strings.Repeat("a", 70000), "en")
+	mBytes, _ := msg.Marshal()
+	if err := tag.SetMessage(msg); err != nil {
+		t.Fatal(err)
+	}
+	if err := cmder.Select(NDEFFileAddress); err != nil {
+		t.Fatal(err)
+	}
+	enlen, err := cmder.ReadBinary(0, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int(binary.BigEndian.Uint32(enlen)) != len(mBytes) {
+		t.Error("wrong ENLEN")
+	}
+
+	cmder.ExtendedLength = true
+	var read []byte
+	for len(read) < len(mBytes) {
+		chunk, err := cmder.ReadBinaryODO(uint32(4+len(read)), 0x8000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(chunk) == 0 {
+			break
+		}
+		read = append(read, chunk...)
+	}
+	if !bytes.Equal(read, mBytes) {
+		t.Error("the message read does not match")
+	}
+
+	// Overwrite the last bytes of the text with ODO updates
+	if err := cmder.UpdateBinaryODO([]byte("zz"), uint32(4+len(mBytes)-2)); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(tag.GetMessage().String(), "azz") {
+		t.Error("the update did not reach the message")
+	}
+
+	big := ndef.NewTextMessage(strings.Repeat("a", 0x20000), "en")
+	if err := tag.SetMessage(big); err == nil {
+		t.Error("SetMessage should fail with a too long message")
+	}
+}
+
+func TestTag_device(t *testing.T) {
+	tag, err := New(0x20000, 0xFFFF, 0xFFFF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	device := nfctype4.New(&swtag.Driver{Tag: tag})
+	msg := ndef.NewTextMessage(strings.Repeat("a", 70000), "en")
+	if err := device.Update(msg); !errors.Is(err, nfctype4.ErrUnsupportedVersion) {
+		t.Error("expected ErrUnsupportedVersion but got:", err)
+	}
+
+	device.MajorVersion = 3
+	if err := device.Update(msg); err != nil {
+		t.Fatal(err)
+	}
+	if tag.GetMessage().String() != msg.String() {
+		t.Error("the tag does not hold the message written")
+	}
+	readMsg, err := device.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if readMsg.String() != msg.String() {
+		t.Error("the message read does not match")
+	}
+
+	big := ndef.NewTextMessage(strings.Repeat("a", 0x20000), "en")
+	if err := device.Update(big); err == nil {
+		t.Error("Update should fail with a too long message")
+	}
+	if err := device.Format(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := device.Read(); err == nil {
+		t.Error("Read should fail after Format")
+	}
+}
+
+func TestConformance(t *testing.T) {
+	tagtest.TestTag(t, func() (tags.Tag, error) {
+		return New(0x20000, 0xFF, 0xFF)
+	})
+}
@@ -0,0 +1,142 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+// Package faulty provides a wrapper which injects faults in the
+// responses of a software NFC Forum Type 4 Tag.
+//
+// It is meant to test how devices and drivers cope with unreliable
+// tags and links: lost responses, corrupted data, unexpected errors
+// and slow answers.
+package faulty
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/hsanjuan/go-nfctype4/apdu"
+	"github.com/hsanjuan/go-nfctype4/tags"
+)
+
+// errorSW1 holds the SW1 values used for random error statuses.
+// 61h-63h (not errors) and 6Ch (wrong Le, which makes devices retry
+// with SW2 as length) are left out.
+var errorSW1 = []byte{0x64, 0x65, 0x67, 0x68, 0x69, 0x6A, 0x6B, 0x6D, 0x6E, 0x6F}
+
+// Policy describes which faults are injected. The zero value injects
+// no faults.
+type Policy struct {
+	// Every DropEvery-th response is dropped: the wrapped tag
+	// processes the command but no response is returned.
+	DropEvery int
+	// Every CorruptEvery-th response gets a random byte of its data
+	// (or SW2 when there is no data) altered.
+	CorruptEvery int
+	// Probability (0 to 1) of replacing a response with a random
+	// error status word (6XXXh).
+	ErrorRate float64
+	// Time to wait before returning every response.
+	Delay time.Duration
+	// Seed for the random number generator, which makes the
+	// injected faults reproducible.
+	Seed int64
+}
+
+// Tag wraps a tags.Tag and alters its responses according to a
+// Policy. It implements the `tags.Tag` interface.
+//
+// Dropped responses are signaled by returning a nil RAPDU, which the
+// swtag driver reports as an error.
+//
+// Please use faulty.New() to create tags.
+type Tag struct {
+	tag    tags.Tag
+	policy Policy
+
+	mux   sync.Mutex
+	rand  *rand.Rand
+	count int
+}
+
+// New returns a new *Tag which wraps the given one and injects faults
+// according to the given Policy.
+func New(tag tags.Tag, policy Policy) *Tag {
+	return &Tag{
+		tag:    tag,
+		policy: policy,
+		rand:   rand.New(rand.NewSource(policy.Seed)),
+	}
+}
+
+// Count returns the number of commands received so far.
+func (tag *Tag) Count() int {
+	tag.mux.Lock()
+	defer tag.mux.Unlock()
+	return tag.count
+}
+
+// Command forwards the CAPDU to the wrapped tag and returns its
+// response, possibly altered, delayed or dropped (nil).
+func (tag *Tag) Command(capdu *apdu.CAPDU) *apdu.RAPDU {
+	rapdu := tag.tag.Command(capdu)
+
+	tag.mux.Lock()
+	tag.count++
+	n := tag.count
+	policy := tag.policy
+	switch {
+	case rapdu == nil:
+		// Nothing to alter: the wrapped tag did not answer
+	case every(n, policy.DropEvery):
+		rapdu = nil
+	case policy.ErrorRate > 0 && tag.rand.Float64() < policy.ErrorRate:
+		sw1 := errorSW1[tag.rand.Intn(len(errorSW1))]
+		sw2 := byte(tag.rand.Intn(256))
+		rapdu = apdu.NewRAPDUStatus(uint16(sw1)<<8 | uint16(sw2))
+	case every(n, policy.CorruptEvery):
+		rapdu = tag.corrupt(rapdu)
+	}
+	tag.mux.Unlock()
+
+	if policy.Delay > 0 {
+		time.Sleep(policy.Delay)
+	}
+	return rapdu
+}
+
+// corrupt returns a copy of the RAPDU with one of its bytes altered.
+func (tag *Tag) corrupt(rapdu *apdu.RAPDU) *apdu.RAPDU {
+	corrupted := &apdu.RAPDU{
+		ResponseBody: append([]byte{}, rapdu.ResponseBody...),
+		SW1:          rapdu.SW1,
+		SW2:          rapdu.SW2,
+	}
+	mask := byte(tag.rand.Intn(255) + 1) // never 0
+	if len(corrupted.ResponseBody) == 0 {
+		corrupted.SW2 ^= mask
+		return corrupted
+	}
+	i := tag.rand.Intn(len(corrupted.ResponseBody))
+	corrupted.ResponseBody[i] ^= mask
+	return corrupted
+}
+
+// every returns true when n is a multiple of period. A period of 0
+// or less never matches.
+func every(n, period int) bool {
+	return period > 0 && n%period == 0
+}
@@ -0,0 +1,139 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package faulty
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/hsanjuan/go-ndef"
+	"github.com/hsanjuan/go-nfctype4"
+	"github.com/hsanjuan/go-nfctype4/apdu"
+	"github.com/hsanjuan/go-nfctype4/drivers/swtag"
+	"github.com/hsanjuan/go-nfctype4/tags"
+	"github.com/hsanjuan/go-nfctype4/tags/readonly"
+	"github.com/hsanjuan/go-nfctype4/tags/static"
+	"github.com/hsanjuan/go-nfctype4/tags/wear"
+)
+
+func TestTag_noFaults(t *testing.T) {
+	inner := static.New()
+	msg := ndef.NewTextMessage("reliable", "en")
+	inner.SetMessage(msg)
+	tag := New(inner, Policy{})
+	device := nfctype4.New(&swtag.Driver{Tag: tag})
+	readMsg, err := device.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if readMsg.String() != msg.String() {
+		t.Error("unexpected message:", readMsg)
+	}
+	if tag.Count() == 0 {
+		t.Error("commands should have been counted")
+	}
+}
+
+func TestTag_drop(t *testing.T) {
+	tag := New(static.New(), Policy{DropEvery: 2})
+	driver := &swtag.Driver{Tag: tag}
+	selectBytes, _ := apdu.NewNDEFTagApplicationSelectAPDU().Marshal()
+	if _, err := driver.TransceiveBytes(selectBytes, 2); err != nil {
+		t.Error("first response should not be dropped:", err)
+	}
+	if _, err := driver.TransceiveBytes(selectBytes, 2); err == nil {
+		t.Error("second response should be dropped")
+	}
+	if _, err := nfctype4.New(driver).Read(); err == nil {
+		t.Error("Read should fail when responses are dropped")
+	}
+}
+
+func TestTag_dropWrapped(t *testing.T) {
+	capdus := []*apdu.CAPDU{
+		apdu.NewNDEFTagApplicationSelectAPDU(),
+		apdu.NewSelectAPDU(0xE103),
+		apdu.NewReadBinaryAPDU(0, 15),
+	}
+	testcases := []tags.Tag{
+		readonly.New(New(static.New(), Policy{DropEvery: 1})),
+		wear.New(New(static.New(), Policy{DropEvery: 1}), 10),
+		New(New(static.New(), Policy{DropEvery: 1}), Policy{CorruptEvery: 1}),
+	}
+	for i, tag := range testcases {
+		for _, capdu := range capdus {
+			if rapdu := tag.Command(capdu); rapdu != nil {
+				t.Errorf("%d: expected no response. Got %s", i, rapdu)
+			}
+		}
+	}
+
+	// Drop the UpdateBinary response once the NDEF File is selected
+	tag := wear.New(New(static.New(), Policy{DropEvery: 3}), 10)
+	tag.Command(apdu.NewNDEFTagApplicationSelectAPDU())
+	tag.Command(apdu.NewSelectAPDU(static.NDEFFileAddress))
+	if rapdu := tag.Command(apdu.NewUpdateBinaryAPDU([]byte{0, 0}, 0)); rapdu != nil {
+		t.Error("expected no response. Got", rapdu)
+	}
+	if tag.Writes(static.NDEFFileAddress, 0) != 0 {
+		t.Error("a dropped update should not be counted")
+	}
+}
+
+func TestTag_corrupt(t *testing.T) {
+	inner := static.New()
+	tag := New(inner, Policy{CorruptEvery: 1, Seed: 42})
+	tag.Command(apdu.NewNDEFTagApplicationSelectAPDU()) // SW2 corrupted
+	inner.Command(apdu.NewNDEFTagApplicationSelectAPDU())
+	inner.Command(apdu.NewSelectAPDU(0xE103))
+
+	good := inner.Command(apdu.NewReadBinaryAPDU(0, 15))
+	bad := tag.Command(apdu.NewReadBinaryAPDU(0, 15))
+	if bytes.Equal(good.ResponseBody, bad.ResponseBody) {
+		t.Error("the response should have been corrupted")
+	}
+	if good.Status() != bad.Status() {
+		t.Error("the status should be kept when there is data")
+	}
+	if len(good.ResponseBody) != len(bad.ResponseBody) {
+		t.Error("the length should be kept")
+	}
+}
+
+func TestTag_errors(t *testing.T) {
+	tag := New(static.New(), Policy{ErrorRate: 1})
+	for i := 0; i < 50; i++ {
+		rapdu := tag.Command(apdu.NewNDEFTagApplicationSelectAPDU())
+		if !rapdu.IsError() || rapdu.SW1 < 0x64 || rapdu.WrongLe() {
+			t.Errorf("unexpected status %04Xh", rapdu.Status())
+		}
+	}
+}
+
+func TestTag_delay(t *testing.T) {
+	tag := New(static.New(), Policy{Delay: 20 * time.Millisecond})
+	start := time.Now()
+	rapdu := tag.Command(apdu.NewNDEFTagApplicationSelectAPDU())
+	if time.Since(start) < 20*time.Millisecond {
+		t.Error("the response should have been delayed")
+	}
+	if !rapdu.CommandCompleted() {
+		t.Error("a delayed response should not be altered")
+	}
+}
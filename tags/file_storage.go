@@ -0,0 +1,166 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package tags
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// FileStorage implements Storage by keeping every file of the tag in
+// a file with the same name (the file ID in hexadecimal, i.e. "E104")
+// inside a directory.
+type FileStorage struct {
+	dir string
+	mux sync.RWMutex
+}
+
+// NewFileStorage returns a new *FileStorage which keeps the files in
+// the given directory, creating it if needed.
+func NewFileStorage(dir string) (*FileStorage, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &FileStorage{dir: dir}, nil
+}
+
+func (s *FileStorage) path(fileID uint16) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%04X", fileID))
+}
+
+// Get returns up to length bytes from the file, starting at offset.
+func (s *FileStorage) Get(fileID uint16, offset, length int) ([]byte, error) {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	f, err := os.Open(s.path(fileID))
+	if err != nil {
+		return nil, notFound(err)
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if offset < 0 || length < 0 || int64(offset) > fi.Size() {
+		return nil, errors.New("FileStorage.Get: invalid offset")
+	}
+	buf := make([]byte, length)
+	n, err := f.ReadAt(buf, int64(offset))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+// Put writes data in the file at the given offset.
+func (s *FileStorage) Put(fileID uint16, offset int, data []byte) error {
+	if offset < 0 {
+		return errors.New("FileStorage.Put: invalid offset")
+	}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	f, err := os.OpenFile(s.path(fileID), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteAt(data, int64(offset)); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Size returns the size of the file.
+func (s *FileStorage) Size(fileID uint16) (int, error) {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	fi, err := os.Stat(s.path(fileID))
+	if err != nil {
+		return 0, notFound(err)
+	}
+	return int(fi.Size()), nil
+}
+
+// Truncate changes the size of the file.
+func (s *FileStorage) Truncate(fileID uint16, size int) error {
+	if size < 0 {
+		return errors.New("FileStorage.Truncate: invalid size")
+	}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	f, err := os.OpenFile(s.path(fileID), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	if err := f.Truncate(int64(size)); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Delete removes the file.
+func (s *FileStorage) Delete(fileID uint16) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	err := os.Remove(s.path(fileID))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// FileIDs returns the IDs of all the files, sorted. Files in the
+// directory whose name is not a file ID are ignored.
+func (s *FileStorage) FileIDs() ([]uint16, error) {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var fileIDs []uint16
+	for _, e := range entries {
+		if e.IsDir() || len(e.Name()) != 4 {
+			continue
+		}
+		fileID, err := strconv.ParseUint(e.Name(), 16, 16)
+		if err != nil {
+			continue
+		}
+		fileIDs = append(fileIDs, uint16(fileID))
+	}
+	sort.Slice(fileIDs, func(i, j int) bool {
+		return fileIDs[i] < fileIDs[j]
+	})
+	return fileIDs, nil
+}
+
+// notFound converts "does not exist" errors to ErrFileNotFound.
+func notFound(err error) error {
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrFileNotFound
+	}
+	return err
+}
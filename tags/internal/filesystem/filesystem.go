@@ -0,0 +1,274 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+// Package filesystem implements the ISO/IEC 7816-4 commands used by
+// NFC Forum Type 4 Tags (Select, ReadBinary and UpdateBinary) on top of
+// a tags.Storage, so that the software tags only need to describe
+// their files and the quirks of the cards they emulate.
+package filesystem
+
+import (
+	"bytes"
+
+	"github.com/hsanjuan/go-nfctype4/apdu"
+	"github.com/hsanjuan/go-nfctype4/helpers"
+	"github.com/hsanjuan/go-nfctype4/tags"
+)
+
+// NDEFApplication is the name of the NDEF Application.
+var NDEFApplication = []byte{0xD2, 0x76, 0x00, 0x00, 0x85, 0x01, 0x01}
+
+// File describes the limits and access conditions of a file.
+type File struct {
+	// MaximumSize is the maximum size of the file. UpdateBinary
+	// commands going beyond it fail with 6A84h. 0 means no limit.
+	MaximumSize uint32
+	// Fixed files always keep their size: offsets must be inside
+	// the file and UpdateBinary commands cannot extend it.
+	Fixed bool
+	// Access conditions: 00h for access granted. Any other value
+	// denies the access, as passwords are not supported.
+	ReadAccess  byte
+	WriteAccess byte
+	// ExactLe makes ReadBinary commands (even instruction byte)
+	// asking for more bytes than available fail with 6CXXh,
+	// indicating how many bytes can be read, instead of returning
+	// them with 6282h (end of file).
+	ExactLe bool
+}
+
+// FileSystem processes Select, ReadBinary and UpdateBinary commands on
+// the files kept in a Storage. It is not safe for concurrent use: tags
+// must process one command at a time.
+type FileSystem struct {
+	Storage tags.Storage
+	// Maximum data lengths for ReadBinary and UpdateBinary
+	MLe uint16
+	MLc uint16
+	// Files returns the description of the file with the given
+	// ID. When nil, every file can be read and written freely.
+	Files func(fileID uint16) File
+
+	// OnSelect, when set, is called after a file is selected.
+	OnSelect func(fileID uint16)
+	// OnRead, when set, is called after a successful ReadBinary
+	// command with a copy of the data read.
+	OnRead func(fileID uint16, offset int, data []byte)
+	// OnUpdate, when set, is called after a successful
+	// UpdateBinary command with a copy of the data written.
+	OnUpdate func(fileID uint16, offset int, data []byte)
+
+	selectedFileID uint16 // 0 when no file is selected
+}
+
+// Selected returns the ID of the selected file, or 0 when no file is
+// selected.
+func (fs *FileSystem) Selected() uint16 {
+	return fs.selectedFileID
+}
+
+// Deselect clears the file selection.
+func (fs *FileSystem) Deselect() {
+	fs.selectedFileID = 0
+}
+
+// SelectFile selects the file with the given ID. It returns false when
+// the file does not exist.
+func (fs *FileSystem) SelectFile(fileID uint16) bool {
+	if _, err := fs.Storage.Size(fileID); err != nil {
+		return false
+	}
+	fs.selectedFileID = fileID
+	if fs.OnSelect != nil {
+		fs.OnSelect(fileID)
+	}
+	return true
+}
+
+// Select processes a Select command for the NDEF Application (by
+// name) or for a file (by ID).
+func (fs *FileSystem) Select(capdu *apdu.CAPDU) *apdu.RAPDU {
+	switch {
+	case capdu.P1 == 0x04 && capdu.P2 == 0x00:
+		if !bytes.Equal(capdu.Data, NDEFApplication) {
+			return apdu.NewRAPDU(apdu.RAPDUFileNotFound)
+		}
+		return apdu.NewRAPDU(apdu.RAPDUCommandCompleted)
+	case capdu.P1 == 0x00 && capdu.P2 == 0x0C:
+		if len(capdu.Data) != 2 {
+			return apdu.NewRAPDUStatus(apdu.SWLcInconsistentWithP1P2)
+		}
+		fileID := helpers.BytesToUint16([2]byte{capdu.Data[0], capdu.Data[1]})
+		if !fs.SelectFile(fileID) {
+			return apdu.NewRAPDU(apdu.RAPDUFileNotFound)
+		}
+		return apdu.NewRAPDU(apdu.RAPDUCommandCompleted)
+	default:
+		return apdu.NewRAPDUStatus(apdu.SWIncorrectP1P2)
+	}
+}
+
+// file returns the description of a file.
+func (fs *FileSystem) file(fileID uint16) File {
+	if fs.Files == nil {
+		return File{}
+	}
+	return fs.Files(fileID)
+}
+
+// Read processes a ReadBinary command on the selected file. Never more
+// than MLe bytes are returned.
+func (fs *FileSystem) Read(capdu *apdu.CAPDU) *apdu.RAPDU {
+	fileID := fs.selectedFileID
+	size, err := fs.Storage.Size(fileID)
+	if fileID == 0 || err != nil {
+		return apdu.NewRAPDUStatus(apdu.SWNoCurrentFile)
+	}
+	offset, _, errRapdu := Offset(capdu)
+	if errRapdu != nil {
+		return errRapdu
+	}
+	f := fs.file(fileID)
+	if f.ReadAccess != 0x00 {
+		return apdu.NewRAPDUSecurityNotSatisfied()
+	}
+	if offset > size || (f.Fixed && offset == size) {
+		return apdu.NewRAPDUWrongP1P2()
+	}
+
+	odo := capdu.INS == apdu.INSReadODO
+	rLen := capdu.GetLe()
+	// Like real tags, never answer with more than MLe bytes
+	if rLen > int(fs.MLe) {
+		rLen = int(fs.MLe)
+	}
+	if odo {
+		// Leave room for the data object wrapping the response
+		le := rLen
+		for rLen > 0 && rLen+apdu.DataObjectOverhead(rLen) > le {
+			rLen--
+		}
+	}
+	rapdu := apdu.NewRAPDU(apdu.RAPDUCommandCompleted)
+	if offset+rLen > size {
+		if f.ExactLe && !odo && offset < size {
+			return apdu.NewRAPDUWrongLength(size - offset)
+		}
+		rLen = size - offset
+		rapdu = apdu.NewRAPDUEndOfFile(nil)
+	}
+	data, err := fs.Storage.Get(fileID, offset, rLen)
+	if err != nil {
+		return apdu.NewRAPDUStatus(apdu.SWMemoryFailure)
+	}
+	// The response outlives the command: never hand out storage memory
+	rapdu.ResponseBody = append([]byte{}, data...)
+	if fs.OnRead != nil {
+		fs.OnRead(fileID, offset, append([]byte{}, rapdu.ResponseBody...))
+	}
+	if odo {
+		rapdu.ResponseBody = apdu.MarshalDataObject(
+			apdu.TagDiscretionaryDataObject,
+			rapdu.ResponseBody)
+	}
+	return rapdu
+}
+
+// Update processes an UpdateBinary command on the selected file. The
+// command data cannot be longer than MLc.
+func (fs *FileSystem) Update(capdu *apdu.CAPDU) *apdu.RAPDU {
+	fileID := fs.selectedFileID
+	size, err := fs.Storage.Size(fileID)
+	if fileID == 0 || err != nil {
+		return apdu.NewRAPDUStatus(apdu.SWNoCurrentFile)
+	}
+	offset, data, errRapdu := Offset(capdu)
+	if errRapdu != nil {
+		return errRapdu
+	}
+	f := fs.file(fileID)
+	if f.WriteAccess != 0x00 {
+		return apdu.NewRAPDUSecurityNotSatisfied()
+	}
+	if len(capdu.Data) == 0 || len(capdu.Data) > int(fs.MLc) {
+		return apdu.NewRAPDUStatus(apdu.SWWrongLength)
+	}
+	if capdu.INS == apdu.INSUpdateODO {
+		doTag, value, _, err := apdu.UnmarshalDataObject(data)
+		if err != nil || doTag != apdu.TagDiscretionaryDataObject {
+			return apdu.NewRAPDUStatus(apdu.SWIncorrectData)
+		}
+		data = value
+	}
+	if offset > size || (f.Fixed && offset == size) {
+		return apdu.NewRAPDUWrongP1P2()
+	}
+	newSize := uint64(offset + len(data))
+	if (f.MaximumSize > 0 && newSize > uint64(f.MaximumSize)) ||
+		(f.Fixed && newSize > uint64(size)) {
+		return apdu.NewRAPDUStatus(apdu.SWNotEnoughMemory)
+	}
+	if err := fs.Storage.Put(fileID, offset, data); err != nil {
+		return apdu.NewRAPDUStatus(apdu.SWMemoryFailure)
+	}
+	if fs.OnUpdate != nil {
+		fs.OnUpdate(fileID, offset, append([]byte{}, data...))
+	}
+	return apdu.NewRAPDU(apdu.RAPDUCommandCompleted)
+}
+
+// Offset returns the offset indicated by a ReadBinary or UpdateBinary
+// command and the rest of its data field, or an error response. P1 bit
+// 8 (short EF identifiers) is not supported with the even instruction
+// bytes, and commands with the odd instruction bytes can only address
+// the current file.
+func Offset(capdu *apdu.CAPDU) (int, []byte, *apdu.RAPDU) {
+	switch capdu.INS {
+	case apdu.INSReadODO, apdu.INSUpdateODO:
+		if capdu.P1 != 0 || capdu.P2 != 0 {
+			return 0, nil, apdu.NewRAPDUStatus(apdu.SWIncorrectP1P2)
+		}
+		odoOffset, rest, err := apdu.ParseOffsetDataObject(capdu.Data)
+		if err != nil {
+			return 0, nil, apdu.NewRAPDUStatus(apdu.SWIncorrectData)
+		}
+		return int(odoOffset), rest, nil
+	default:
+		if capdu.P1&0x80 != 0 {
+			return 0, nil, apdu.NewRAPDUStatus(apdu.SWIncorrectP1P2)
+		}
+		return int(helpers.BytesToUint16([2]byte{capdu.P1, capdu.P2})),
+			capdu.Data, nil
+	}
+}
+
+// ReadFile returns the whole contents of a file in the storage.
+func ReadFile(storage tags.Storage, fileID uint16) ([]byte, error) {
+	size, err := storage.Size(fileID)
+	if err != nil {
+		return nil, err
+	}
+	return storage.Get(fileID, 0, size)
+}
+
+// WriteFile replaces the contents of a file in the storage.
+func WriteFile(storage tags.Storage, fileID uint16, data []byte) error {
+	if err := storage.Truncate(fileID, len(data)); err != nil {
+		return err
+	}
+	return storage.Put(fileID, 0, data)
+}
@@ -0,0 +1,80 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package filesystem
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/hsanjuan/go-nfctype4/apdu"
+	"github.com/hsanjuan/go-nfctype4/tags"
+)
+
+func TestFileSystem(t *testing.T) {
+	files := map[uint16]File{
+		0x0001: {MaximumSize: 6},
+		0x0002: {Fixed: true},
+		0x0003: {ExactLe: true, ReadAccess: 0xFF, WriteAccess: 0xFF},
+	}
+	fs := &FileSystem{
+		Storage: tags.NewMemoryStorage(),
+		MLe:     0x10,
+		MLc:     0x10,
+		Files:   func(fileID uint16) File { return files[fileID] },
+	}
+	for fileID := range files {
+		WriteFile(fs.Storage, fileID, []byte{1, 2, 3, 4})
+	}
+
+	type testcase struct {
+		fileID   uint16
+		capdu    *apdu.CAPDU
+		expected []byte
+	}
+	testcases := []testcase{
+		{0x0001, apdu.NewReadBinaryAPDU(0, 2), []byte{1, 2, 0x90, 0x00}},
+		{0x0001, apdu.NewReadBinaryAPDU(2, 4), []byte{3, 4, 0x62, 0x82}},
+		{0x0001, apdu.NewReadBinaryAPDU(4, 1), []byte{0x62, 0x82}},
+		{0x0001, apdu.NewUpdateBinaryAPDU([]byte{5, 6}, 4), []byte{0x90, 0x00}},
+		{0x0001, apdu.NewUpdateBinaryAPDU([]byte{7}, 6), []byte{0x6A, 0x84}},
+		{0x0002, apdu.NewReadBinaryAPDU(4, 1), []byte{0x6B, 0x00}},
+		{0x0002, apdu.NewUpdateBinaryAPDU([]byte{5, 6}, 3), []byte{0x6A, 0x84}},
+		{0x0003, apdu.NewReadBinaryAPDU(0, 1), []byte{0x69, 0x82}},
+		{0x0003, apdu.NewUpdateBinaryAPDU([]byte{5}, 0), []byte{0x69, 0x82}},
+		{0x0004, apdu.NewReadBinaryAPDU(0, 1), []byte{0x69, 0x86}},
+	}
+	for i, tc := range testcases {
+		fs.Deselect()
+		fs.SelectFile(tc.fileID)
+		var rapdu *apdu.RAPDU
+		if tc.capdu.INS == apdu.INSRead {
+			rapdu = fs.Read(tc.capdu)
+		} else {
+			rapdu = fs.Update(tc.capdu)
+		}
+		rapduBytes, _ := rapdu.Marshal()
+		if !bytes.Equal(rapduBytes, tc.expected) {
+			t.Errorf("%d: expected % 02X. Got % 02X", i, tc.expected, rapduBytes)
+		}
+	}
+
+	data, err := ReadFile(fs.Storage, 0x0001)
+	if err != nil || !bytes.Equal(data, []byte{1, 2, 3, 4, 5, 6}) {
+		t.Errorf("unexpected file contents: % 02X (%v)", data, err)
+	}
+}
@@ -0,0 +1,207 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+// Package multifile provides a software-based NFC Forum Type 4 Tag
+// which hosts several NDEF and proprietary files.
+//
+// Every file has its own ID, maximum size and access conditions, and is
+// advertised in the Capability Container: the first NDEF File in the
+// NDEF File Control TLV and the rest in optional TLV blocks.
+package multifile
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/hsanjuan/go-nfctype4/apdu"
+	"github.com/hsanjuan/go-nfctype4/capabilitycontainer"
+	"github.com/hsanjuan/go-nfctype4/tags"
+	"github.com/hsanjuan/go-nfctype4/tags/internal/filesystem"
+)
+
+// Version of the specification implemented by this tag
+const (
+	NFCForumMajorVersion = 2
+	NFCForumMinorVersion = 0
+)
+
+// File describes one of the files hosted by the tag.
+type File struct {
+	ID uint16
+	// Proprietary marks the file as a Proprietary File instead
+	// of a NDEF File.
+	Proprietary bool
+	// MaximumFileSize is the size of the file. 0005h-FFFEh.
+	MaximumFileSize uint16
+	// Access conditions for the file: 00h for access granted, FFh
+	// for no access. Proprietary values (80h-FEh) deny the access
+	// too, as this tag does not support verifying passwords.
+	ReadAccessCondition  byte
+	WriteAccessCondition byte
+	// Data holds the initial contents of the file. For NDEF Files,
+	// it includes NLEN. When empty, NDEF Files are initialized
+	// with NLEN set to 0.
+	Data []byte
+}
+
+// Tag implements a NFC Type 4 Tag which hosts several files. It
+// implements the `tags.Tag` interface and it is safe for concurrent
+// use.
+//
+// Please use multifile.New() to create tags.
+type Tag struct {
+	mux   sync.Mutex
+	fs    filesystem.FileSystem
+	files map[uint16]File // without Data, which is kept in fs.Storage
+}
+
+// New returns a new *Tag hosting the given files, which must include
+// at least one NDEF File. mle and mlc are the maximum data lengths
+// for ReadBinary and UpdateBinary commands advertised in the
+// Capability Container.
+//
+// It returns an error if the files cannot be advertised in a valid
+// Capability Container or if they are repeated.
+func New(mle, mlc uint16, files []File) (*Tag, error) {
+	tag := &Tag{
+		files: make(map[uint16]File),
+	}
+	tag.fs.Storage = tags.NewMemoryStorage()
+	tag.fs.MLe = mle
+	tag.fs.MLc = mlc
+	tag.fs.Files = tag.file
+
+	cc := &capabilitycontainer.CapabilityContainer{
+		MappingVersion: byte(NFCForumMajorVersion)<<4 |
+			byte(NFCForumMinorVersion),
+		MLe: mle,
+		MLc: mlc,
+	}
+	for i := range files {
+		f := files[i]
+		if _, ok := tag.files[f.ID]; ok || f.ID == capabilitycontainer.CCID {
+			return nil, fmt.Errorf("multifile.New: repeated file ID %04Xh",
+				f.ID)
+		}
+		if len(f.Data) > int(f.MaximumFileSize) {
+			return nil, fmt.Errorf("multifile.New: "+
+				"file %04Xh is larger than its maximum size", f.ID)
+		}
+		data := f.Data
+		if !f.Proprietary && len(data) < 2 {
+			data = []byte{0x00, 0x00} // NLEN to 0
+		}
+		if err := filesystem.WriteFile(tag.fs.Storage, f.ID, data); err != nil {
+			return nil, err
+		}
+		f.Data = nil
+		tag.files[f.ID] = f
+
+		cTLV := &capabilitycontainer.ControlTLV{
+			T:                        capabilitycontainer.TypeNDEFFileControlTLV,
+			L:                        0x06,
+			FileID:                   f.ID,
+			MaximumFileSize:          f.MaximumFileSize,
+			FileReadAccessCondition:  f.ReadAccessCondition,
+			FileWriteAccessCondition: f.WriteAccessCondition,
+		}
+		if f.Proprietary {
+			cTLV.T = capabilitycontainer.TypePropietaryFileControlTLV
+		}
+		if !f.Proprietary && cc.NDEFFileControlTLV == nil {
+			cc.NDEFFileControlTLV = (*capabilitycontainer.NDEFFileControlTLV)(cTLV)
+			continue
+		}
+		cc.TLVBlocks = append(cc.TLVBlocks, cTLV)
+	}
+	if cc.NDEFFileControlTLV == nil {
+		return nil, errors.New("multifile.New: a NDEF File is needed")
+	}
+	if err := cc.Finalize(); err != nil {
+		return nil, err
+	}
+	ccBytes, err := cc.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	tag.files[capabilitycontainer.CCID] = File{
+		ID:                   capabilitycontainer.CCID,
+		MaximumFileSize:      uint16(len(ccBytes)),
+		WriteAccessCondition: 0xFF,
+	}
+	if err := filesystem.WriteFile(tag.fs.Storage, capabilitycontainer.CCID, ccBytes); err != nil {
+		return nil, err
+	}
+	return tag, nil
+}
+
+// file returns the limits and access conditions of a file.
+func (tag *Tag) file(fileID uint16) filesystem.File {
+	f := tag.files[fileID]
+	return filesystem.File{
+		MaximumSize: uint32(f.MaximumFileSize),
+		ReadAccess:  f.ReadAccessCondition,
+		WriteAccess: f.WriteAccessCondition,
+	}
+}
+
+// FileData returns a copy of the contents of the file with the given
+// ID, or nil if the file does not exist.
+func (tag *Tag) FileData(fileID uint16) []byte {
+	tag.mux.Lock()
+	defer tag.mux.Unlock()
+	data, err := filesystem.ReadFile(tag.fs.Storage, fileID)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// SetFileData replaces the contents of the file with the given ID,
+// regardless of its access conditions. It returns an error if the file
+// does not exist or if the data is larger than its maximum size.
+func (tag *Tag) SetFileData(fileID uint16, data []byte) error {
+	tag.mux.Lock()
+	defer tag.mux.Unlock()
+	f, ok := tag.files[fileID]
+	if !ok || fileID == capabilitycontainer.CCID {
+		return fmt.Errorf("Tag.SetFileData: file %04Xh not found", fileID)
+	}
+	if len(data) > int(f.MaximumFileSize) {
+		return errors.New("Tag.SetFileData: data too long")
+	}
+	return filesystem.WriteFile(tag.fs.Storage, fileID, data)
+}
+
+// Command lets the Software tag receive Commands (CAPDUs) and
+// provide responses (RAPDUs) according to each command.
+func (tag *Tag) Command(capdu *apdu.CAPDU) *apdu.RAPDU {
+	tag.mux.Lock()
+	defer tag.mux.Unlock()
+
+	switch capdu.INS {
+	case apdu.INSSelect:
+		return tag.fs.Select(capdu)
+	case apdu.INSRead, apdu.INSReadODO:
+		return tag.fs.Read(capdu)
+	case apdu.INSUpdate, apdu.INSUpdateODO:
+		return tag.fs.Update(capdu)
+	default:
+		return apdu.NewRAPDUINSNotSupported()
+	}
+}
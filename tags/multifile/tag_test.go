@@ -0,0 +1,146 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package multifile
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/hsanjuan/go-ndef"
+	"github.com/hsanjuan/go-nfctype4"
+	"github.com/hsanjuan/go-nfctype4/apdu"
+	"github.com/hsanjuan/go-nfctype4/drivers/swtag"
+	"github.com/hsanjuan/go-nfctype4/tags"
+	"github.com/hsanjuan/go-nfctype4/tags/tagtest"
+)
+
+func newTestTag(t *testing.T) *Tag {
+	msgBytes, _ := ndef.NewTextMessage("read-only", "en").Marshal()
+	tag, err := New(0x20, 0x20, []File{
+		{
+			ID:                   0xE104,
+			MaximumFileSize:      0x0100,
+			WriteAccessCondition: 0xFF,
+			Data:                 append([]byte{0x00, byte(len(msgBytes))}, msgBytes...),
+		},
+		{
+			ID:              0xE105,
+			Proprietary:     true,
+			MaximumFileSize: 0x0010,
+			Data:            []byte{0x01, 0x02, 0x03},
+		},
+		{
+			ID:              0xE106,
+			MaximumFileSize: 0x0100,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tag
+}
+
+func TestTag_Device(t *testing.T) {
+	tag := newTestTag(t)
+	device := nfctype4.New(&swtag.Driver{Tag: tag})
+
+	msg, err := device.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.String() != "urn:nfc:wkt:T:read-only" {
+		t.Error("unexpected message:", msg)
+	}
+	if err := device.Update(ndef.NewTextMessage("update", "en")); err == nil {
+		t.Error("the first NDEF File should be read-only")
+	}
+
+	device.NDEFFileID = 0xE106
+	if err := device.Update(ndef.NewTextMessage("second file", "en")); err != nil {
+		t.Fatal(err)
+	}
+	msg, err = device.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.String() != "urn:nfc:wkt:T:second file" {
+		t.Error("unexpected message:", msg)
+	}
+}
+
+func TestTag_proprietaryFile(t *testing.T) {
+	tag := newTestTag(t)
+	cmder := &nfctype4.Commander{Driver: &swtag.Driver{Tag: tag}}
+	if err := cmder.NDEFApplicationSelect(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cmder.Select(0xE105); err != nil {
+		t.Fatal(err)
+	}
+	if err := cmder.UpdateBinary([]byte{0x04, 0x05}, 3); err != nil {
+		t.Fatal(err)
+	}
+	data, err := cmder.ReadBinary(0, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, []byte{1, 2, 3, 4, 5}) {
+		t.Errorf("unexpected data: % 02X", data)
+	}
+	if err := cmder.UpdateBinary(make([]byte, 0x10), 3); err == nil {
+		t.Error("writing past the maximum file size should fail")
+	}
+	if !bytes.Equal(tag.FileData(0xE105), data) {
+		t.Errorf("unexpected file data: % 02X", tag.FileData(0xE105))
+	}
+	if tag.FileData(0xE107) != nil {
+		t.Error("FileData should return nil for unknown files")
+	}
+
+	if err := tag.SetFileData(0xE105, make([]byte, 0x11)); err == nil {
+		t.Error("SetFileData should fail with too much data")
+	}
+	if err := tag.SetFileData(0xE105, []byte{0x06}); err != nil {
+		t.Fatal(err)
+	}
+	rapdu := tag.Command(apdu.NewReadBinaryAPDU(0, 2))
+	if rapdu.Status() != apdu.SWEndOfFile || !bytes.Equal(rapdu.ResponseBody, []byte{0x06}) {
+		t.Errorf("unexpected response: %s", rapdu)
+	}
+}
+
+func TestNew_errors(t *testing.T) {
+	if _, err := New(0x20, 0x20, []File{{ID: 0xE105, Proprietary: true, MaximumFileSize: 0x10}}); err == nil {
+		t.Error("New should fail without NDEF Files")
+	}
+	if _, err := New(0x20, 0x20, []File{{ID: 0xE104, MaximumFileSize: 0x10}, {ID: 0xE104, MaximumFileSize: 0x10}}); err == nil {
+		t.Error("New should fail with repeated files")
+	}
+	if _, err := New(0x20, 0x20, []File{{ID: 0xE104, MaximumFileSize: 0x02}}); err == nil {
+		t.Error("New should fail with RFU maximum file sizes")
+	}
+	if _, err := New(0x05, 0x20, []File{{ID: 0xE104, MaximumFileSize: 0x10}}); err == nil {
+		t.Error("New should fail with RFU MLe")
+	}
+}
+
+func TestConformance(t *testing.T) {
+	tagtest.TestTag(t, func() (tags.Tag, error) {
+		return New(0x20, 0x20, []File{{ID: 0xE104, MaximumFileSize: 0x0400}})
+	})
+}
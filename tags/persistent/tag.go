@@ -0,0 +1,99 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+// Package persistent provides a software-based NFC Forum Type 4 Tag
+// which stores its memory in a directory, so that its contents survive
+// process restarts.
+//
+// It is a static Tag (see the `static` module) backed by a
+// tags.FileStorage: every file of the tag is kept in a file of the
+// directory and written as soon as it changes. Combined with the
+// `swtag` driver and a reader in target mode, it can be used as a
+// long-running virtual tag.
+package persistent
+
+import (
+	"github.com/hsanjuan/go-ndef"
+	"github.com/hsanjuan/go-nfctype4/apdu"
+	"github.com/hsanjuan/go-nfctype4/tags"
+	"github.com/hsanjuan/go-nfctype4/tags/static"
+)
+
+// Tag implements a NFC Type 4 Tag backed by a directory. It implements
+// the `tags.Tag` interface.
+//
+// The directory holds a tags.FileStorage, with one file for the
+// Capability Container and one for the NDEF File. They are written by
+// every successful UpdateBinary command and every SetMessage call.
+// When they cannot be written, UpdateBinary commands are answered with
+// 6581h (memory failure).
+//
+// Please use persistent.New() to create tags.
+type Tag struct {
+	path string
+	tag  *static.Tag
+}
+
+// New returns a new *Tag stored in the directory at the given path. If
+// the directory holds a tag, its memory is used. Otherwise, an empty
+// static Tag is created with the given options (the Storage option is
+// ignored) and saved to the directory, which is created if needed.
+//
+// It returns an error if the directory cannot be created or if the tag
+// stored in it cannot be read or parsed.
+func New(path string, opts static.Options) (*Tag, error) {
+	storage, err := tags.NewFileStorage(path)
+	if err != nil {
+		return nil, err
+	}
+	opts.Storage = storage
+	tag, err := static.NewWithOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Tag{
+		path: path,
+		tag:  tag,
+	}, nil
+}
+
+// Path returns the path of the directory backing the tag.
+func (tag *Tag) Path() string {
+	return tag.path
+}
+
+// SetMessage programs the NDEF message for this tag and saves it
+// to the directory. It returns an error if the message cannot be set
+// or if the file cannot be written.
+func (tag *Tag) SetMessage(m *ndef.Message) error {
+	return tag.tag.SetMessage(m)
+}
+
+// GetMessage allows to retrieve the NDEF message stored
+// in the tag.
+// It returns nil when there is nothing stored.
+func (tag *Tag) GetMessage() *ndef.Message {
+	return tag.tag.GetMessage()
+}
+
+// Command lets the Software tag receive Commands (CAPDUs) and
+// provide responses (RAPDUs) according to each command. It uses
+// a static Tag to process the commands, which writes the changes
+// to the directory.
+func (tag *Tag) Command(capdu *apdu.CAPDU) *apdu.RAPDU {
+	return tag.tag.Command(capdu)
+}
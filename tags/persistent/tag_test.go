@@ -0,0 +1,95 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package persistent
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hsanjuan/go-ndef"
+	"github.com/hsanjuan/go-nfctype4"
+	"github.com/hsanjuan/go-nfctype4/apdu"
+	"github.com/hsanjuan/go-nfctype4/drivers/swtag"
+	"github.com/hsanjuan/go-nfctype4/tags/static"
+)
+
+func TestTag(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tag")
+	tag, err := New(path, static.Options{MLe: 0x20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(path, "E103")); err != nil {
+		t.Fatal("the Capability Container should have been saved:", err)
+	}
+
+	device := nfctype4.New(&swtag.Driver{Tag: tag})
+	if err := device.Update(ndef.NewTextMessage("persisted across process restarts", "en")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Load the tag again from the file
+	tag2, err := New(path, static.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg := tag2.GetMessage(); msg == nil || msg.String() != "urn:nfc:wkt:T:persisted across process restarts" {
+		t.Error("unexpected message:", msg)
+	}
+	// The options come from the file
+	tag2.Command(apdu.NewSelectAPDU(static.NDEFFileAddress))
+	rapdu := tag2.Command(apdu.NewReadBinaryAPDU(0, 0x30))
+	if len(rapdu.ResponseBody) != 0x20 {
+		t.Errorf("expected MLe to be 20h. Got %d bytes", len(rapdu.ResponseBody))
+	}
+
+	if err := tag2.SetMessage(ndef.NewTextMessage("again", "en")); err != nil {
+		t.Fatal(err)
+	}
+	tag3, err := New(path, static.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg := tag3.GetMessage(); msg == nil || msg.String() != "urn:nfc:wkt:T:again" {
+		t.Error("unexpected message:", msg)
+	}
+}
+
+func TestNew_badFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tag")
+	if err := os.MkdirAll(path, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(path, "E103"), []byte{0x01}, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(path, "8888"), []byte{0x00, 0x00}, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New(path, static.Options{}); err == nil {
+		t.Error("New should fail with a corrupted Capability Container")
+	}
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New(file, static.Options{}); err == nil {
+		t.Error("New should fail when the directory cannot be created")
+	}
+}
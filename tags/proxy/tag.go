@@ -0,0 +1,87 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+// Package proxy provides a software NFC Forum Type 4 Tag which relays
+// every command to another tag through a CommandDriver.
+//
+// A proxy Tag can be attached to a reader in target mode (for example
+// with the swtag driver) while its CommandDriver talks to a physical
+// tag on a second reader. This allows to bridge two readers
+// transparently, or to experiment with relay setups.
+package proxy
+
+import (
+	"errors"
+
+	"github.com/hsanjuan/go-nfctype4"
+	"github.com/hsanjuan/go-nfctype4/apdu"
+)
+
+// Tag implements a NFC Type 4 Tag which forwards the Command APDUs
+// it receives to another tag using the configured Driver, and returns
+// the Response APDUs obtained from it. It implements the `tags.Tag`
+// interface.
+//
+// APDUs are relayed as they are: the proxy does not issue
+// GET RESPONSE commands nor interpret the status words, which is
+// left to the device talking to the proxy.
+//
+// The Driver must have been initialized before using the Tag.
+type Tag struct {
+	Driver nfctype4.CommandDriver
+}
+
+// New returns a new *Tag which relays commands through the given
+// CommandDriver.
+func New(driver nfctype4.CommandDriver) *Tag {
+	return &Tag{
+		Driver: driver,
+	}
+}
+
+// Command forwards the CAPDU to the remote tag and returns its
+// response. If the Driver is not set, the CAPDU cannot be serialized
+// or the remote tag does not provide a valid response, the tag
+// responds with 6F00h (no precise diagnosis).
+func (tag *Tag) Command(capdu *apdu.CAPDU) *apdu.RAPDU {
+	rapdu, err := tag.relay(capdu)
+	if err != nil {
+		return apdu.NewRAPDUStatus(apdu.SWNoPreciseDiagnosis)
+	}
+	return rapdu
+}
+
+// relay sends a CAPDU with the Driver and parses the response.
+func (tag *Tag) relay(capdu *apdu.CAPDU) (*apdu.RAPDU, error) {
+	if tag.Driver == nil {
+		return nil, errors.New("Tag.relay: Driver not set")
+	}
+	tx, err := capdu.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	rxLen := capdu.GetLe() + 2 // For SW bytes
+	rx, err := tag.Driver.TransceiveBytes(tx, rxLen)
+	if err != nil {
+		return nil, err
+	}
+	rapdu := new(apdu.RAPDU)
+	if _, err := rapdu.Unmarshal(rx); err != nil {
+		return nil, err
+	}
+	return rapdu, nil
+}
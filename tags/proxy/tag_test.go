@@ -0,0 +1,71 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package proxy
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/hsanjuan/go-ndef"
+	"github.com/hsanjuan/go-nfctype4"
+	"github.com/hsanjuan/go-nfctype4/apdu"
+	"github.com/hsanjuan/go-nfctype4/drivers/swtag"
+	"github.com/hsanjuan/go-nfctype4/tags/static"
+)
+
+type failingDriver struct {
+	swtag.Driver
+}
+
+func (driver *failingDriver) TransceiveBytes(tx []byte, rxLen int) ([]byte, error) {
+	return nil, errors.New("link lost")
+}
+
+func TestTag(t *testing.T) {
+	remote := static.New()
+	proxy := New(&swtag.Driver{Tag: remote})
+	device := nfctype4.New(&swtag.Driver{Tag: proxy})
+
+	// Status words are relayed untouched
+	rapdu := proxy.Command(apdu.NewReadBinaryAPDU(0, 2))
+	if rapdu.Status() != apdu.SWNoCurrentFile {
+		t.Errorf("expected 6986h but got %04Xh", rapdu.Status())
+	}
+
+	msg := ndef.NewTextMessage("relayed", "en")
+	if err := device.Update(msg); err != nil {
+		t.Fatal(err)
+	}
+	if remote.GetMessage().String() != msg.String() {
+		t.Error("the update did not reach the remote tag")
+	}
+	readMsg, err := device.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if readMsg.String() != msg.String() {
+		t.Error("unexpected message read through the proxy:", readMsg)
+	}
+
+	for _, p := range []*Tag{New(nil), New(&failingDriver{})} {
+		rapdu := p.Command(apdu.NewNDEFTagApplicationSelectAPDU())
+		if rapdu.Status() != apdu.SWNoPreciseDiagnosis {
+			t.Errorf("expected 6F00h but got %04Xh", rapdu.Status())
+		}
+	}
+}
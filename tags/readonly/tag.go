@@ -0,0 +1,200 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+// Package readonly provides a wrapper which turns any software
+// NFC Forum Type 4 Tag into a read-only tag.
+package readonly
+
+import (
+	"sync"
+
+	"github.com/hsanjuan/go-nfctype4/apdu"
+	"github.com/hsanjuan/go-nfctype4/capabilitycontainer"
+	"github.com/hsanjuan/go-nfctype4/helpers"
+	"github.com/hsanjuan/go-nfctype4/tags"
+	"github.com/hsanjuan/go-nfctype4/tags/internal/filesystem"
+)
+
+// ccReadLen is the chunk size used to read the Capability Container
+// of the wrapped tag. All tags must accept reads of this size
+// (MLe is at least 000Fh).
+const ccReadLen = 0x0F
+
+// Tag wraps a tags.Tag and prevents any modification of its contents.
+// It implements the `tags.Tag` interface.
+//
+// UpdateBinary commands are rejected with 6982h (security status not
+// satisfied) without reaching the wrapped tag. The Capability
+// Container served by the wrapped tag is rewritten on the fly so that
+// every file declares a write access condition of FFh (no write
+// access), which lets devices know in advance that the tag is
+// read-only.
+//
+// Please use readonly.New() to create tags.
+type Tag struct {
+	tag tags.Tag
+
+	mux        sync.Mutex
+	ccSelected bool
+	// Offsets of the write access condition bytes in the CC
+	writeAccessOffsets map[int]bool
+}
+
+// New returns a new *Tag which wraps the given one.
+func New(tag tags.Tag) *Tag {
+	return &Tag{
+		tag: tag,
+	}
+}
+
+// Command lets the Software tag receive Commands (CAPDUs) and
+// provide responses (RAPDUs) according to each command.
+//
+// UpdateBinary commands are rejected. Everything else is forwarded to
+// the wrapped tag, patching the responses to ReadBinary commands on
+// the Capability Container, with or without an offset data object.
+func (tag *Tag) Command(capdu *apdu.CAPDU) *apdu.RAPDU {
+	tag.mux.Lock()
+	defer tag.mux.Unlock()
+
+	switch capdu.INS {
+	case apdu.INSUpdate, apdu.INSUpdateODO:
+		return apdu.NewRAPDUSecurityNotSatisfied()
+	case apdu.INSSelect:
+		rapdu := tag.tag.Command(capdu)
+		if rapdu != nil && rapdu.CommandCompleted() {
+			tag.selected(capdu)
+		}
+		return rapdu
+	case apdu.INSRead, apdu.INSReadODO:
+		rapdu := tag.tag.Command(capdu)
+		if rapdu != nil && tag.ccSelected {
+			tag.patchRead(capdu, rapdu)
+		}
+		return rapdu
+	default:
+		return tag.tag.Command(capdu)
+	}
+}
+
+// selected updates the state of the wrapper after a successful
+// Select command. When the Capability Container is selected, it is
+// read from the wrapped tag to locate its write access conditions.
+// Those reads are extra ReadBinary commands which the wrapped tag
+// handles like any other, so they trigger its read hooks and count
+// as reads in wrappers such as tags/wear.
+func (tag *Tag) selected(capdu *apdu.CAPDU) {
+	tag.ccSelected = false
+	if capdu.P1 != 0x00 || len(capdu.Data) != 2 {
+		return
+	}
+	fileID := helpers.BytesToUint16([2]byte{capdu.Data[0], capdu.Data[1]})
+	if fileID != capabilitycontainer.CCID {
+		return
+	}
+	tag.ccSelected = true
+	tag.writeAccessOffsets = writeAccessOffsets(tag.readCC())
+}
+
+// readCC reads the Capability Container from the wrapped tag, which
+// must have it selected. It returns as many bytes as it could read,
+// stopping when the wrapped tag fails or does not answer.
+func (tag *Tag) readCC() []byte {
+	var cc []byte
+	ccLen := ccReadLen
+	for len(cc) < ccLen {
+		n := ccLen - len(cc)
+		if n > ccReadLen {
+			n = ccReadLen
+		}
+		rapdu := tag.tag.Command(apdu.NewReadBinaryAPDU(uint16(len(cc)), n))
+		if rapdu == nil || rapdu.IsError() || len(rapdu.ResponseBody) == 0 {
+			break
+		}
+		cc = append(cc, rapdu.ResponseBody...)
+		if len(cc) >= 2 {
+			ccLen = int(helpers.BytesToUint16([2]byte{cc[0], cc[1]}))
+		}
+	}
+	return cc
+}
+
+// writeAccessOffsets walks the TLV blocks of a serialized Capability
+// Container and returns the offsets of the write access condition
+// bytes of every file control TLV.
+func writeAccessOffsets(cc []byte) map[int]bool {
+	offsets := make(map[int]bool)
+	pos := 7 // TLV blocks start after CCLEN, Mapping Version, MLe and MLc
+	for pos < len(cc) {
+		t := cc[pos]
+		if t == capabilitycontainer.TypeNULLTLV {
+			pos++
+			continue
+		}
+		if t == capabilitycontainer.TypeTerminatorTLV || pos+1 >= len(cc) {
+			break
+		}
+		hdrLen := 2
+		l := int(cc[pos+1])
+		if l == 0xFF {
+			if pos+3 >= len(cc) {
+				break
+			}
+			hdrLen = 4
+			l = int(helpers.BytesToUint16([2]byte{cc[pos+2], cc[pos+3]}))
+		}
+		switch {
+		case (t == capabilitycontainer.TypeNDEFFileControlTLV ||
+			t == capabilitycontainer.TypePropietaryFileControlTLV) && l >= 6:
+			offsets[pos+hdrLen+5] = true
+		case t == capabilitycontainer.TypeExtendedNDEFFileControlTLV && l >= 8:
+			offsets[pos+hdrLen+7] = true
+		}
+		pos += hdrLen + l
+	}
+	return offsets
+}
+
+// patchRead patches the Capability Container chunk in the response
+// to a ReadBinary command. With an offset data object, the offset is
+// taken from it and the chunk is the value of the discretionary data
+// object wrapping the response.
+func (tag *Tag) patchRead(capdu *apdu.CAPDU, rapdu *apdu.RAPDU) {
+	offset, _, errRapdu := filesystem.Offset(capdu)
+	if errRapdu != nil {
+		return
+	}
+	data := rapdu.ResponseBody
+	if capdu.INS == apdu.INSReadODO {
+		_, value, rLen, err := apdu.UnmarshalDataObject(data)
+		if err != nil {
+			return
+		}
+		data = data[rLen-len(value) : rLen]
+	}
+	tag.patchCC(data, offset)
+}
+
+// patchCC sets to FFh the write access conditions contained in a
+// chunk of the Capability Container read at the given offset.
+func (tag *Tag) patchCC(data []byte, offset int) {
+	for i := range data {
+		if tag.writeAccessOffsets[offset+i] {
+			data[i] = 0xFF
+		}
+	}
+}
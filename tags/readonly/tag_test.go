@@ -0,0 +1,115 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package readonly
+
+import (
+	"testing"
+
+	"github.com/hsanjuan/go-ndef"
+	"github.com/hsanjuan/go-nfctype4"
+	"github.com/hsanjuan/go-nfctype4/apdu"
+	"github.com/hsanjuan/go-nfctype4/capabilitycontainer"
+	"github.com/hsanjuan/go-nfctype4/drivers/swtag"
+	"github.com/hsanjuan/go-nfctype4/tags/static"
+)
+
+func TestTag(t *testing.T) {
+	inner := static.New()
+	msg := ndef.NewTextMessage("immutable", "en")
+	if err := inner.SetMessage(msg); err != nil {
+		t.Fatal(err)
+	}
+	tag := New(inner)
+	device := nfctype4.New(&swtag.Driver{Tag: tag})
+
+	readMsg, err := device.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if readMsg.String() != msg.String() {
+		t.Error("unexpected message:", readMsg)
+	}
+
+	err = device.Update(ndef.NewTextMessage("changed", "en"))
+	if err == nil || err.Error() != "Device.Update: the tag is read-only" {
+		t.Error("expected a read-only error but got:", err)
+	}
+
+	// Write directly, bypassing the CC check
+	tag.Command(apdu.NewSelectAPDU(static.NDEFFileAddress))
+	rapdu := tag.Command(apdu.NewUpdateBinaryAPDU([]byte{0, 0}, 0))
+	if !rapdu.IsSecurityNotSatisfied() {
+		t.Errorf("expected 6982h but got %04Xh", rapdu.Status())
+	}
+	if inner.GetMessage().String() != msg.String() {
+		t.Error("the wrapped tag was modified")
+	}
+
+	// The CC is patched even when read in small chunks
+	tag.Command(apdu.NewSelectAPDU(capabilitycontainer.CCID))
+	var ccBytes []byte
+	for i := 0; i < 15; i += 5 {
+		rapdu := tag.Command(apdu.NewReadBinaryAPDU(uint16(i), 5))
+		ccBytes = append(ccBytes, rapdu.ResponseBody...)
+	}
+	cc := new(capabilitycontainer.CapabilityContainer)
+	if _, err := cc.Unmarshal(ccBytes); err != nil {
+		t.Fatal(err)
+	}
+	if cc.NDEFFileControlTLV.FileWriteAccessCondition != 0xFF {
+		t.Errorf("expected write access FFh but got %02Xh",
+			cc.NDEFFileControlTLV.FileWriteAccessCondition)
+	}
+
+	// And when read with an offset data object
+	rapdu = tag.Command(apdu.NewReadBinaryODOAPDU(14, 1))
+	_, value, _, err := apdu.UnmarshalDataObject(rapdu.ResponseBody)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(value) != 1 || value[0] != 0xFF {
+		t.Errorf("expected write access FFh but got % 02X", value)
+	}
+	if inner.Command(apdu.NewReadBinaryAPDU(14, 1)).ResponseBody[0] != 0x00 {
+		t.Error("the CC of the wrapped tag should not change")
+	}
+}
+
+// silentTag does not answer ReadBinary commands.
+type silentTag struct {
+	*static.Tag
+}
+
+func (tag *silentTag) Command(capdu *apdu.CAPDU) *apdu.RAPDU {
+	if capdu.INS == apdu.INSRead {
+		return nil
+	}
+	return tag.Tag.Command(capdu)
+}
+
+func TestTag_noAnswer(t *testing.T) {
+	tag := New(&silentTag{static.New()})
+	tag.Command(apdu.NewNDEFTagApplicationSelectAPDU())
+	rapdu := tag.Command(apdu.NewSelectAPDU(capabilitycontainer.CCID))
+	if rapdu == nil || !rapdu.CommandCompleted() {
+		t.Fatal("the CC should be selected:", rapdu)
+	}
+	if rapdu := tag.Command(apdu.NewReadBinaryAPDU(0, 15)); rapdu != nil {
+		t.Error("expected no answer but got:", rapdu)
+	}
+}
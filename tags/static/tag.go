@@ -24,18 +24,18 @@ package static
 
 import (
 	"bytes"
-	"encoding/binary"
 	"errors"
+	"fmt"
+	"sync"
 
 	"github.com/hsanjuan/go-ndef"
 	"github.com/hsanjuan/go-nfctype4/apdu"
 	"github.com/hsanjuan/go-nfctype4/capabilitycontainer"
 	"github.com/hsanjuan/go-nfctype4/helpers"
+	"github.com/hsanjuan/go-nfctype4/tags"
+	"github.com/hsanjuan/go-nfctype4/tags/internal/filesystem"
 )
 
-// BUG(hector): Tag is not super-strict with the error responses
-// in case of unexpected Commands.
-
 // NDEFFileAddress Address in which the NDEF File is stored.
 // It is initialized to a default of 0x8888.
 //
@@ -50,6 +50,16 @@ const (
 	NFCForumMinorVersion = 0
 )
 
+// Default memory and transfer limits of a Tag.
+//
+// FIXME: The MLe and MLc are actually important and should stay below
+// the maximum frame values specified in the RATs command.
+const (
+	DefaultMaximumFileSize = uint16(0xFFFE)
+	DefaultMLe             = uint16(0x000F) // We could put more... or less
+	DefaultMLc             = uint16(0x000F)
+)
+
 // NDEFAPPLICATION is the name for the NDEF Application.
 const NDEFAPPLICATION = uint64(0xD2760000850101)
 
@@ -64,52 +74,283 @@ const NDEFAPPLICATION = uint64(0xD2760000850101)
 //
 // Please use static.New() to create tags, or remember to do a Tag.Initialize()
 // as otherwise tags will refuse to work.
+//
+// The OnSelect, OnRead and OnUpdate hooks allow applications to react
+// to the commands received by the tag, for example, to log when the tag
+// is read or to regenerate its contents after a write.
+//
+// A Tag is safe for concurrent use. Commands are processed one at a
+// time, in the order they acquire the tag, and they share the file
+// selection, like with a real tag which supports a single logical
+// channel. Hooks are called after the command has been processed, with
+// copies of the data, so they can safely use the Tag methods. The hooks
+// themselves should be set before using the tag.
 type Tag struct {
-	// what has been selected
-	selectedFileID uint16
-	// A shadow buffer for updates
-	memory map[uint16][]byte
+	// OnSelect, when set, is called after a file is selected.
+	OnSelect func(fileID uint16)
+	// OnRead, when set, is called after a successful ReadBinary
+	// command with the data read.
+	OnRead func(fileID uint16, offset int, data []byte)
+	// OnUpdate, when set, is called after a successful UpdateBinary
+	// command with the data written.
+	OnUpdate func(fileID uint16, offset int, data []byte)
+
+	// The memory of the tag, the file selection and the MLe and
+	// MLc limits advertised in the CC
+	fs          filesystem.FileSystem
+	maxFileSize uint16
+	// Access conditions of the NDEF File
+	readAccess  byte
+	writeAccess byte
+	writableCC  bool
+
+	mux sync.Mutex
+	// hooks to run once the current command is processed
+	pendingHooks []func()
+}
+
+// Options allow to configure the memory and transfer limits of a Tag
+// created with NewWithOptions. Zero values are replaced by the
+// defaults.
+type Options struct {
+	// MaximumFileSize is the size of the NDEF File, including the
+	// 2 NLEN bytes. 0005h-FFFEh.
+	MaximumFileSize uint16
+	// MLe is the maximum data read with a single ReadBinary.
+	// 000Fh-FFFFh.
+	MLe uint16
+	// MLc is the maximum data written with a single UpdateBinary.
+	// 0001h-FFFFh.
+	MLc uint16
+	// WritableCC allows UpdateBinary commands on the Capability
+	// Container, for example, to lock the tag by changing the
+	// write access condition. They are rejected otherwise.
+	WritableCC bool
+	// Storage holds the memory of the tag. It defaults to a
+	// tags.MemoryStorage. When it already contains a Capability
+	// Container and a NDEF File, the tag uses them instead of
+	// starting empty, and the limits are read from the Capability
+	// Container.
+	Storage tags.Storage
+}
+
+// check returns an error if the options use RFU values.
+func (opts *Options) check() error {
+	switch {
+	case opts.MaximumFileSize != 0 &&
+		(opts.MaximumFileSize <= 0x0004 || opts.MaximumFileSize == 0xFFFF):
+		return errors.New("Options: MaximumFileSize is RFU")
+	case opts.MLe != 0 && opts.MLe < 0x000F:
+		return errors.New("Options: MLe is RFU")
+	}
+	return nil
 }
 
 // New returns a new *Tag in Initialized state (empty)
 func New() *Tag {
 	t := new(Tag)
-	t.Initialize()
+	t.Initialize() // Cannot fail with the defaults and memory storage
 	return t
 }
 
+// NewWithOptions returns a new *Tag in Initialized state (empty)
+// with the given memory and transfer limits. It returns an error
+// when the options are not valid or the storage fails.
+func NewWithOptions(opts Options) (*Tag, error) {
+	if err := opts.check(); err != nil {
+		return nil, err
+	}
+	t := &Tag{
+		maxFileSize: opts.MaximumFileSize,
+		writableCC:  opts.WritableCC,
+	}
+	t.fs.Storage = opts.Storage
+	t.fs.MLe = opts.MLe
+	t.fs.MLc = opts.MLc
+	if t.fs.Storage != nil {
+		ccBytes, err := filesystem.ReadFile(t.fs.Storage, capabilitycontainer.CCID)
+		if err == nil {
+			if _, err := t.fs.Storage.Size(NDEFFileAddress); err != nil {
+				return nil, err
+			}
+			if err := t.loadCC(ccBytes); err != nil {
+				return nil, err
+			}
+			t.setupFileSystem()
+			return t, nil
+		}
+		if !errors.Is(err, tags.ErrFileNotFound) {
+			return nil, err
+		}
+	}
+	if err := t.Initialize(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
 // Initialize resets a Tag to an initialized state (empty)
 // It will drop the memory contents if they previously existed
-// and de-select any files.
-func (tag *Tag) Initialize() {
-	tag.selectedFileID = 0
-	tag.memory = make(map[uint16][]byte)
+// and de-select any files. The configured limits are kept.
+// It returns an error if the new contents cannot be stored.
+func (tag *Tag) Initialize() error {
+	tag.mux.Lock()
+	defer tag.mux.Unlock()
+	tag.setupFileSystem()
+	tag.fs.Deselect()
+	if tag.fs.Storage == nil {
+		tag.fs.Storage = tags.NewMemoryStorage()
+	}
+	if fileIDs, err := tag.fs.Storage.FileIDs(); err == nil {
+		for _, fileID := range fileIDs {
+			tag.fs.Storage.Delete(fileID)
+		}
+	}
 
-	// Set the capability container
+	if tag.maxFileSize == 0 {
+		tag.maxFileSize = DefaultMaximumFileSize
+	}
+	if tag.fs.MLe == 0 {
+		tag.fs.MLe = DefaultMLe
+	}
+	if tag.fs.MLc == 0 {
+		tag.fs.MLc = DefaultMLc
+	}
+	if err := tag.writeCC(); err != nil {
+		return err
+	}
+
+	// Set an empty NDEF file
+	return filesystem.WriteFile(tag.fs.Storage, NDEFFileAddress, []byte{0, 0}) // NLEN to 0
+}
+
+// setupFileSystem describes the files of the tag to its FileSystem and
+// hooks it to the OnSelect, OnRead and OnUpdate hooks.
+func (tag *Tag) setupFileSystem() {
+	tag.fs.Files = tag.file
+	tag.fs.OnSelect = func(fileID uint16) {
+		if onSelect := tag.OnSelect; onSelect != nil {
+			tag.addHook(func() { onSelect(fileID) })
+		}
+	}
+	tag.fs.OnRead = func(fileID uint16, offset int, data []byte) {
+		if onRead := tag.OnRead; onRead != nil {
+			tag.addHook(func() { onRead(fileID, offset, data) })
+		}
+	}
+	tag.fs.OnUpdate = tag.updated
+}
+
+// file returns the limits and access conditions of a file.
+func (tag *Tag) file(fileID uint16) filesystem.File {
+	switch fileID {
+	case capabilitycontainer.CCID:
+		// Reading past the end of the CC indicates how many
+		// bytes can be read. No, you cannot write the CC, unless
+		// configured.
+		f := filesystem.File{ExactLe: true, WriteAccess: 0xFF}
+		if tag.writableCC {
+			f.WriteAccess = 0x00
+		}
+		return f
+	case NDEFFileAddress:
+		return filesystem.File{
+			MaximumSize: uint32(tag.maxFileSize),
+			ReadAccess:  tag.readAccess,
+			WriteAccess: tag.writeAccess,
+		}
+	default:
+		return filesystem.File{}
+	}
+}
+
+// updated is called by the FileSystem after a successful UpdateBinary
+// command.
+func (tag *Tag) updated(fileID uint16, offset int, data []byte) {
+	if fileID == capabilitycontainer.CCID {
+		// Apply the new limits and access conditions. A
+		// Capability Container written in several steps may
+		// not be valid until the last one.
+		if ccBytes, err := filesystem.ReadFile(tag.fs.Storage, capabilitycontainer.CCID); err == nil {
+			tag.loadCC(ccBytes)
+		}
+	}
+	if onUpdate := tag.OnUpdate; onUpdate != nil {
+		tag.addHook(func() { onUpdate(fileID, offset, data) })
+	}
+}
+
+// SetMaxDataLengths changes the MLe and MLc values advertised by
+// the tag in its Capability Container. Read Binary responses never
+// carry more than MLe bytes.
+//
+// It returns an error if the values are not valid according to the
+// specification.
+func (tag *Tag) SetMaxDataLengths(mle, mlc uint16) error {
+	tag.mux.Lock()
+	defer tag.mux.Unlock()
+	if tag.fs.Storage == nil {
+		return errors.New("Tag.SetMaxDataLengths: tag not initialized")
+	}
+	opts := Options{MLe: mle, MLc: mlc}
+	if err := opts.check(); err != nil || mle == 0 || mlc == 0 {
+		return errors.New("Tag.SetMaxDataLengths: MLe or MLc is RFU")
+	}
+	tag.fs.MLe = mle
+	tag.fs.MLc = mlc
+	return tag.writeCC()
+}
+
+// SetAccessConditions changes the read and write access conditions
+// of the NDEF File, as advertised in the Capability Container. Any
+// value other than 00h (access granted) makes the tag refuse the
+// corresponding operation with 6982h (security status not satisfied),
+// since this tag does not support verifying passwords.
+//
+// It returns an error if the values are RFU.
+func (tag *Tag) SetAccessConditions(read, write byte) error {
+	tag.mux.Lock()
+	defer tag.mux.Unlock()
+	if tag.fs.Storage == nil {
+		return errors.New("Tag.SetAccessConditions: tag not initialized")
+	}
+	if 0x01 <= read && read <= 0x7F {
+		return errors.New(
+			"Tag.SetAccessConditions: Read Access Condition is RFU")
+	}
+	if 0x01 <= write && write <= 0x7F {
+		return errors.New(
+			"Tag.SetAccessConditions: Write Access Condition is RFU")
+	}
+	tag.readAccess = read
+	tag.writeAccess = write
+	return tag.writeCC()
+}
+
+// writeCC stores the capability container in memory.
+func (tag *Tag) writeCC() error {
 	cc := &capabilitycontainer.CapabilityContainer{
-		CCLEN: 15,
 		MappingVersion: byte(NFCForumMajorVersion)<<4 |
 			byte(NFCForumMinorVersion),
-		// FIXME: This is actually important and should
-		// stay below the maximum frame values specified in
-		// the RATs command
-		MLe: 0x000F, // We could put more... or less
-		MLc: 0x000F,
+		MLe: tag.fs.MLe,
+		MLc: tag.fs.MLc,
 		NDEFFileControlTLV: &capabilitycontainer.NDEFFileControlTLV{
 			T:                        0x04,
 			L:                        0x06,
 			FileID:                   NDEFFileAddress,
-			MaximumFileSize:          0xFFFE,
-			FileReadAccessCondition:  0x00,
-			FileWriteAccessCondition: 0x00, // FIXME: Make configurable
-
+			MaximumFileSize:          tag.maxFileSize,
+			FileReadAccessCondition:  tag.readAccess,
+			FileWriteAccessCondition: tag.writeAccess,
 		},
 	}
-	ccBytes, _ := cc.Marshal()
-	tag.memory[capabilitycontainer.CCID] = ccBytes
-
-	// Set an empty NDEF file
-	tag.memory[NDEFFileAddress] = []byte{0, 0} // NLEN to 0
+	if err := cc.Finalize(); err != nil {
+		return err
+	}
+	ccBytes, err := cc.Marshal()
+	if err != nil {
+		return err
+	}
+	return filesystem.WriteFile(tag.fs.Storage, capabilitycontainer.CCID, ccBytes)
 }
 
 // SetMessage programs the NDEF message for this tag.
@@ -121,7 +362,10 @@ func (tag *Tag) SetMessage(m *ndef.Message) error {
 		return err
 	}
 	nlen := len(mBytes)
-	if nlen > 0xFFFE { // 0xFFFF is RFU accoring to specs
+	tag.mux.Lock()
+	maxFileSize := tag.maxFileSize
+	tag.mux.Unlock()
+	if nlen > int(maxFileSize)-2 {
 		return errors.New("Tag.SetMessage: message too long")
 	}
 
@@ -130,16 +374,19 @@ func (tag *Tag) SetMessage(m *ndef.Message) error {
 	nlenBytes := helpers.Uint16ToBytes(uint16(nlen))
 	buf.Write(nlenBytes[:])
 	buf.Write(mBytes)
-	tag.memory[NDEFFileAddress] = buf.Bytes()
-	return nil
+	tag.mux.Lock()
+	defer tag.mux.Unlock()
+	return filesystem.WriteFile(tag.fs.Storage, NDEFFileAddress, buf.Bytes())
 }
 
 // GetMessage allows to retrieve the NDEF message stored
 // in the tag.
 // It returns nil when there is nothing stored.
 func (tag *Tag) GetMessage() *ndef.Message {
-	file := tag.memory[NDEFFileAddress]
-	if len(file) < 2 {
+	tag.mux.Lock()
+	file, err := filesystem.ReadFile(tag.fs.Storage, NDEFFileAddress)
+	tag.mux.Unlock()
+	if err != nil || len(file) < 2 {
 		return nil
 	}
 
@@ -155,108 +402,154 @@ func (tag *Tag) GetMessage() *ndef.Message {
 	return msg
 }
 
-// Command lets the Software tag receive Commands (CAPDUs) and
-// provide respones (RAPDUs) according to each command.
-// It is the heart of the behaviour of a NFC Type 4 Tag.
-func (tag *Tag) Command(capdu *apdu.CAPDU) *apdu.RAPDU {
-	if tag.memory == nil {
-		return apdu.NewRAPDU(apdu.RAPDUInactiveState)
+// Marshal returns the byte slice representation of the memory of the
+// Tag, so that its exact state can be persisted or transferred and
+// later restored with Unmarshal. Every file is serialized as its ID
+// (2 bytes), its length (2 bytes) and its contents, sorted by ID.
+func (tag *Tag) Marshal() ([]byte, error) {
+	tag.mux.Lock()
+	defer tag.mux.Unlock()
+	if tag.fs.Storage == nil {
+		return nil, errors.New("Tag.Marshal: tag not initialized")
+	}
+	fileIDs, err := tag.fs.Storage.FileIDs()
+	if err != nil {
+		return nil, err
 	}
 
-	switch capdu.INS {
-	case apdu.INSSelect:
-		return tag.doSelect(capdu)
-	case apdu.INSRead:
-		return tag.doRead(capdu)
-	case apdu.INSUpdate:
-		return tag.doUpdate(capdu)
-	default:
-		return apdu.NewRAPDU(apdu.RAPDUCommandNotAllowed)
+	var buffer bytes.Buffer
+	for _, fileID := range fileIDs {
+		file, err := filesystem.ReadFile(tag.fs.Storage, fileID)
+		if err != nil {
+			return nil, err
+		}
+		if len(file) > 0xFFFF {
+			return nil, fmt.Errorf("Tag.Marshal: file %04Xh "+
+				"is too large", fileID)
+		}
+		idBytes := helpers.Uint16ToBytes(fileID)
+		buffer.Write(idBytes[:])
+		lenBytes := helpers.Uint16ToBytes(uint16(len(file)))
+		buffer.Write(lenBytes[:])
+		buffer.Write(file)
 	}
+	return buffer.Bytes(), nil
 }
 
-func (tag *Tag) doSelect(capdu *apdu.CAPDU) *apdu.RAPDU {
-	// We support 3 types of select: for the NDEFApp, for the CC and for
-	// the NDEF File
-	switch {
-	case capdu.P1 == 0x04 &&
-		capdu.P2 == 0x00 &&
-		capdu.GetLc() == 0x07:
-		// Convert data to Uint64
-		data8 := make([]byte, 8)
-		copy(data8[1:], capdu.Data)
-		dataVal := binary.BigEndian.Uint64(data8)
-		if dataVal == NDEFAPPLICATION {
-			// Selecting NDEF Application. Yes OK!
-			return apdu.NewRAPDU(apdu.RAPDUCommandCompleted)
+// Unmarshal parses a byte slice produced by Marshal and replaces the
+// memory of the Tag with it. The limits and access conditions of the
+// Tag are restored from the Capability Container, which must be
+// present and valid, along with the NDEF File. No file is selected
+// afterwards.
+//
+// It returns the number of bytes parsed and an error if something
+// looks wrong, in which case the Tag is not modified (unless the error
+// comes from the Storage).
+func (tag *Tag) Unmarshal(buf []byte) (rLen int, err error) {
+	defer helpers.HandleErrorPanic(&err, "Tag.Unmarshal")
+	bytesBuf := bytes.NewBuffer(buf)
+	memory := make(map[uint16][]byte)
+	for bytesBuf.Len() > 0 {
+		fileID := helpers.BytesToUint16([2]byte{
+			helpers.GetByte(bytesBuf),
+			helpers.GetByte(bytesBuf)})
+		fileLen := helpers.BytesToUint16([2]byte{
+			helpers.GetByte(bytesBuf),
+			helpers.GetByte(bytesBuf)})
+		file := make([]byte, fileLen)
+		copy(file, helpers.GetBytes(bytesBuf, int(fileLen)))
+		memory[fileID] = file
+	}
+	rLen = len(buf)
+
+	if _, ok := memory[NDEFFileAddress]; !ok {
+		return rLen, errors.New("Tag.Unmarshal: missing NDEF File")
+	}
+	tag.mux.Lock()
+	defer tag.mux.Unlock()
+	if err := tag.loadCC(memory[capabilitycontainer.CCID]); err != nil {
+		return rLen, err
+	}
+	tag.setupFileSystem()
+	tag.fs.Deselect()
+	if tag.fs.Storage == nil {
+		tag.fs.Storage = tags.NewMemoryStorage()
+	}
+	fileIDs, err := tag.fs.Storage.FileIDs()
+	if err != nil {
+		return rLen, err
+	}
+	for _, fileID := range fileIDs {
+		if _, ok := memory[fileID]; ok {
+			continue
 		}
-		return apdu.NewRAPDU(apdu.RAPDUFileNotFound)
-
-	case capdu.P1 == 0x00 && capdu.P2 == 0x0C:
-		if capdu.GetLc() != uint16(2) {
-			// Lc inconsistent with P1-P2
-			return &apdu.RAPDU{
-				SW1: 0x6A,
-				SW2: 0x87,
-			}
+		if err := tag.fs.Storage.Delete(fileID); err != nil {
+			return rLen, err
 		}
-		// Selecting by id
-		addr := helpers.BytesToUint16([2]byte{
-			capdu.Data[0],
-			capdu.Data[1]})
-		_, ok := tag.memory[addr]
-		if !ok {
-			return apdu.NewRAPDU(apdu.RAPDUFileNotFound)
+	}
+	for fileID, file := range memory {
+		if err := filesystem.WriteFile(tag.fs.Storage, fileID, file); err != nil {
+			return rLen, err
 		}
-
-		// We have something in that address
-		tag.selectedFileID = addr
-		return apdu.NewRAPDU(apdu.RAPDUCommandCompleted)
-	default:
-		return apdu.NewRAPDU(apdu.RAPDUFileNotFound)
 	}
+	return rLen, nil
 }
 
-func (tag *Tag) doRead(capdu *apdu.CAPDU) *apdu.RAPDU {
-	rBytes, ok := tag.memory[tag.selectedFileID]
-	if !ok {
-		return apdu.NewRAPDU(apdu.RAPDUFileNotFound)
+// loadCC parses a Capability Container and sets the limits and access
+// conditions of the Tag from it. The Tag is not modified on error.
+func (tag *Tag) loadCC(ccBytes []byte) error {
+	cc := new(capabilitycontainer.CapabilityContainer)
+	if _, err := cc.Unmarshal(ccBytes); err != nil {
+		return err
+	}
+	if cc.NDEFFileControlTLV == nil ||
+		cc.NDEFFileControlTLV.FileID != NDEFFileAddress {
+		return errors.New("Tag.loadCC: " +
+			"the Capability Container does not point to the NDEF File")
 	}
+	tag.maxFileSize = cc.NDEFFileControlTLV.MaximumFileSize
+	tag.fs.MLe = cc.MLe
+	tag.fs.MLc = cc.MLc
+	tag.readAccess = cc.NDEFFileControlTLV.FileReadAccessCondition
+	tag.writeAccess = cc.NDEFFileControlTLV.FileWriteAccessCondition
+	return nil
+}
 
-	// We have rBytes ready. Let's make sure the response
-	// adapts to the offset and Le provided in the CAPDU
-	offset := int(helpers.BytesToUint16([2]byte{capdu.P1, capdu.P2}))
-	rLen := int(capdu.GetLe())
-	rBytesLen := len(rBytes)
-	if rLen+offset > rBytesLen {
-		rLen = rBytesLen - offset
+// Command lets the Software tag receive Commands (CAPDUs) and
+// provide respones (RAPDUs) according to each command.
+// It is the heart of the behaviour of a NFC Type 4 Tag.
+func (tag *Tag) Command(capdu *apdu.CAPDU) *apdu.RAPDU {
+	tag.mux.Lock()
+	rapdu := tag.command(capdu)
+	hooks := tag.pendingHooks
+	tag.pendingHooks = nil
+	tag.mux.Unlock()
+
+	for _, hook := range hooks {
+		hook()
 	}
-	rapdu := apdu.NewRAPDU(apdu.RAPDUCommandCompleted)
-	rapdu.ResponseBody = rBytes[offset : offset+rLen]
 	return rapdu
 }
 
-func (tag *Tag) doUpdate(capdu *apdu.CAPDU) *apdu.RAPDU {
-	if tag.selectedFileID == capabilitycontainer.CCID {
-		// No, you cannot write the CC
-		apdu.NewRAPDU(apdu.RAPDUCommandNotAllowed)
-	}
-	_, ok := tag.memory[tag.selectedFileID]
-	if !ok {
-		return apdu.NewRAPDU(apdu.RAPDUFileNotFound)
+func (tag *Tag) command(capdu *apdu.CAPDU) *apdu.RAPDU {
+	if tag.fs.Storage == nil {
+		return apdu.NewRAPDU(apdu.RAPDUInactiveState)
 	}
 
-	offset := int(helpers.BytesToUint16([2]byte{capdu.P1, capdu.P2}))
-	data := capdu.Data
-
-	file := tag.memory[tag.selectedFileID]
-	newFileLen := offset + len(data)
-	if newFileLen > len(file) {
-		// increase the size of the file
-		newFile := make([]byte, newFileLen)
-		copy(newFile, file)
-		tag.memory[tag.selectedFileID] = newFile
+	switch capdu.INS {
+	case apdu.INSSelect:
+		return tag.fs.Select(capdu)
+	case apdu.INSRead, apdu.INSReadODO:
+		return tag.fs.Read(capdu)
+	case apdu.INSUpdate, apdu.INSUpdateODO:
+		return tag.fs.Update(capdu)
+	default:
+		return apdu.NewRAPDUINSNotSupported()
 	}
-	copy(tag.memory[tag.selectedFileID][offset:], data)
-	return apdu.NewRAPDU(apdu.RAPDUCommandCompleted)
+}
+
+// addHook schedules a hook to be called once the current command
+// has been processed.
+func (tag *Tag) addHook(hook func()) {
+	tag.pendingHooks = append(tag.pendingHooks, hook)
 }
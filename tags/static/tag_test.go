@@ -18,12 +18,20 @@
 package static
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"sync"
+	"testing"
 
 	"github.com/hsanjuan/go-ndef"
 	"github.com/hsanjuan/go-ndef/types/generic"
 	"github.com/hsanjuan/go-nfctype4"
+	"github.com/hsanjuan/go-nfctype4/apdu"
+	"github.com/hsanjuan/go-nfctype4/capabilitycontainer"
 	"github.com/hsanjuan/go-nfctype4/drivers/swtag"
+	"github.com/hsanjuan/go-nfctype4/tags"
+	"github.com/hsanjuan/go-nfctype4/tags/tagtest"
 )
 
 func ExampleTag_read() {
@@ -92,3 +100,416 @@ func ExampleTag_write() {
 	// Output:
 	// urn:nfc:wkt:T:This is a new message
 }
+
+func TestTag_readLimits(t *testing.T) {
+	tag := New()
+	tag.SetMessage(ndef.NewTextMessage("This message is longer than MLe", "en"))
+
+	tag.Command(apdu.NewSelectAPDU(NDEFFileAddress))
+	rapdu := tag.Command(apdu.NewReadBinaryAPDU(0, 100))
+	if !rapdu.CommandCompleted() || len(rapdu.ResponseBody) != 15 {
+		t.Errorf("expected 15 bytes (MLe). Got %s", rapdu)
+	}
+
+	// Reading past the end of the CC
+	tag.Command(apdu.NewSelectAPDU(capabilitycontainer.CCID))
+	rapdu = tag.Command(apdu.NewReadBinaryAPDU(10, 15))
+	if !rapdu.IsWrongLength() || rapdu.CorrectLe() != 5 {
+		t.Errorf("expected 6C05. Got %s", rapdu)
+	}
+
+	if err := tag.SetMaxDataLengths(0x00FF, 0x00FF); err != nil {
+		t.Fatal(err)
+	}
+	tag.Command(apdu.NewSelectAPDU(NDEFFileAddress))
+	rapdu = tag.Command(apdu.NewReadBinaryAPDU(0, 100))
+	if rapdu.Status() != apdu.SWEndOfFile || len(rapdu.ResponseBody) != 40 {
+		t.Errorf("expected the whole NDEF File. Got %s", rapdu)
+	}
+
+	if err := tag.SetMaxDataLengths(0x000E, 0x00FF); err == nil {
+		t.Error("MLe 000Eh should be rejected")
+	}
+}
+
+func TestTag_statusWords(t *testing.T) {
+	tag := New()
+	testcases := []struct {
+		name  string
+		capdu *apdu.CAPDU
+		sw    uint16
+	}{
+		{"read without file", apdu.NewReadBinaryAPDU(0, 2), apdu.SWNoCurrentFile},
+		{"update without file", apdu.NewUpdateBinaryAPDU([]byte{0}, 0), apdu.SWNoCurrentFile},
+		{"select file", apdu.NewSelectAPDU(NDEFFileAddress), apdu.SWCommandCompleted},
+		{"read beyond the file", apdu.NewReadBinaryAPDU(3, 2), apdu.SWWrongP1P2},
+		{"update beyond the file", apdu.NewUpdateBinaryAPDU([]byte{0}, 3), apdu.SWWrongP1P2},
+		{"read with short EF identifier", apdu.NewReadBinaryAPDU(0x8100, 2), apdu.SWIncorrectP1P2},
+		{"update without data", &apdu.CAPDU{INS: apdu.INSUpdate}, apdu.SWWrongLength},
+		{"select with bad P1-P2", &apdu.CAPDU{INS: apdu.INSSelect, P1: 0x02}, apdu.SWIncorrectP1P2},
+		{"unknown instruction", &apdu.CAPDU{INS: 0x60}, apdu.SWINSNotSupported},
+		{"select CC", apdu.NewSelectAPDU(capabilitycontainer.CCID), apdu.SWCommandCompleted},
+		{"update CC", apdu.NewUpdateBinaryAPDU([]byte{0}, 0), apdu.SWSecurityNotSatisfied},
+	}
+	for _, c := range testcases {
+		if sw := tag.Command(c.capdu).Status(); sw != c.sw {
+			t.Errorf("%s: expected %04X. Got %04X", c.name, c.sw, sw)
+		}
+	}
+}
+
+func TestTag_accessConditions(t *testing.T) {
+	tag := New()
+	tag.SetMessage(ndef.NewTextMessage("protected", "en"))
+	if err := tag.SetAccessConditions(0x80, 0xFF); err != nil {
+		t.Fatal(err)
+	}
+
+	tag.Command(apdu.NewSelectAPDU(NDEFFileAddress))
+	rapdu := tag.Command(apdu.NewReadBinaryAPDU(0, 2))
+	if rapdu.Status() != apdu.SWSecurityNotSatisfied {
+		t.Errorf("read: expected 6982. Got %s", rapdu)
+	}
+	rapdu = tag.Command(apdu.NewUpdateBinaryAPDU([]byte{0, 0}, 0))
+	if rapdu.Status() != apdu.SWSecurityNotSatisfied {
+		t.Errorf("update: expected 6982. Got %s", rapdu)
+	}
+
+	// The Device sees a read-only tag
+	if err := tag.SetAccessConditions(0x00, 0xFF); err != nil {
+		t.Fatal(err)
+	}
+	device := nfctype4.New(&swtag.Driver{Tag: tag})
+	err := device.Update(ndef.NewTextMessage("new", "en"))
+	if err == nil || err.Error() != "Device.Update: the tag is read-only" {
+		t.Error("expected a read-only error but got:", err)
+	}
+
+	if err := tag.SetAccessConditions(0x00, 0x7F); err == nil {
+		t.Error("Write Access Condition 7Fh should be rejected")
+	}
+}
+
+func TestNewWithOptions(t *testing.T) {
+	if _, err := NewWithOptions(Options{MLe: 0x05}); err == nil {
+		t.Error("MLe 0005h should be rejected")
+	}
+	if _, err := NewWithOptions(Options{MaximumFileSize: 0xFFFF}); err == nil {
+		t.Error("MaximumFileSize FFFFh should be rejected")
+	}
+
+	tag, err := NewWithOptions(Options{MaximumFileSize: 256, MLc: 0x34})
+	if err != nil {
+		t.Fatal(err)
+	}
+	device := nfctype4.New(&swtag.Driver{Tag: tag})
+
+	payload := &generic.Payload{Payload: make([]byte, 200)}
+	msg := ndef.NewMessage(ndef.NFCForumWellKnownType, "local", "", payload)
+	if err := device.Update(msg); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := device.Read(); err != nil {
+		t.Error(err)
+	}
+
+	payload = &generic.Payload{Payload: make([]byte, 300)}
+	msg = ndef.NewMessage(ndef.NFCForumWellKnownType, "local", "", payload)
+	if err := device.Update(msg); err == nil {
+		t.Error("a 300 bytes message should not fit in the tag")
+	}
+	if err := tag.SetMessage(msg); err == nil {
+		t.Error("SetMessage should fail with a too long message")
+	}
+
+	tag.Command(apdu.NewSelectAPDU(NDEFFileAddress))
+	rapdu := tag.Command(apdu.NewUpdateBinaryAPDU(make([]byte, 0x35), 0))
+	if rapdu.Status() != apdu.SWWrongLength {
+		t.Errorf("expected 6700 for data larger than MLc. Got %s", rapdu)
+	}
+	offset := uint16(0)
+	for rapdu.Status() != apdu.SWNotEnoughMemory && offset < 256 {
+		rapdu = tag.Command(apdu.NewUpdateBinaryAPDU(make([]byte, 0x34), offset))
+		offset += 0x34
+	}
+	if offset != 5*0x34 {
+		t.Errorf("expected 6A84 when writing past the file size. Got %s", rapdu)
+	}
+}
+
+func TestTag_MarshalUnmarshal(t *testing.T) {
+	tag, err := NewWithOptions(Options{MaximumFileSize: 256, MLe: 0x20, MLc: 0x34})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag.SetMessage(ndef.NewTextMessage("persisted", "en"))
+	if err := tag.SetAccessConditions(0x00, 0xFF); err != nil {
+		t.Fatal(err)
+	}
+	tagBytes, err := tag.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tag2 := New()
+	rLen, err := tag2.Unmarshal(tagBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rLen != len(tagBytes) {
+		t.Errorf("expected %d bytes parsed. Got %d", len(tagBytes), rLen)
+	}
+	if msg := tag2.GetMessage(); msg == nil || msg.String() != "urn:nfc:wkt:T:persisted" {
+		t.Error("unexpected message:", msg)
+	}
+	tag2Bytes, err := tag2.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(tagBytes, tag2Bytes) {
+		t.Errorf("expected % 02X. Got % 02X", tagBytes, tag2Bytes)
+	}
+	// Access conditions are restored
+	tag2.Command(apdu.NewSelectAPDU(NDEFFileAddress))
+	rapdu := tag2.Command(apdu.NewUpdateBinaryAPDU([]byte{0, 0}, 0))
+	if rapdu.Status() != apdu.SWSecurityNotSatisfied {
+		t.Errorf("expected a write-protected tag. Got %s", rapdu)
+	}
+
+	if _, err := tag2.Unmarshal(tagBytes[:len(tagBytes)-1]); err == nil {
+		t.Error("Unmarshal should fail with truncated data")
+	}
+	if _, err := tag2.Unmarshal([]byte{0x88, 0x88, 0x00, 0x00}); err == nil {
+		t.Error("Unmarshal should fail without Capability Container")
+	}
+	if tag2.GetMessage() == nil {
+		t.Error("a failed Unmarshal should not modify the tag")
+	}
+}
+
+func TestTag_writableCC(t *testing.T) {
+	lock := func(tag *Tag) *apdu.RAPDU {
+		tag.Command(apdu.NewSelectAPDU(capabilitycontainer.CCID))
+		// Write Access Condition is the last byte of the CC
+		return tag.Command(apdu.NewUpdateBinaryAPDU([]byte{0xFF}, 14))
+	}
+
+	tag := New()
+	if rapdu := lock(tag); rapdu.Status() != apdu.SWSecurityNotSatisfied {
+		t.Errorf("expected 6982 when writing the CC. Got %s", rapdu)
+	}
+
+	tag, err := NewWithOptions(Options{WritableCC: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rapdu := lock(tag); !rapdu.CommandCompleted() {
+		t.Fatalf("expected 9000 when writing the CC. Got %s", rapdu)
+	}
+	device := nfctype4.New(&swtag.Driver{Tag: tag})
+	err = device.Update(ndef.NewTextMessage("locked", "en"))
+	if err == nil || err.Error() != "Device.Update: the tag is read-only" {
+		t.Error("expected a read-only error but got:", err)
+	}
+	tag.Command(apdu.NewSelectAPDU(NDEFFileAddress))
+	rapdu := tag.Command(apdu.NewUpdateBinaryAPDU([]byte{0, 0}, 0))
+	if rapdu.Status() != apdu.SWSecurityNotSatisfied {
+		t.Errorf("expected 6982 on a locked tag. Got %s", rapdu)
+	}
+}
+
+func TestTag_hooks(t *testing.T) {
+	tag := New()
+	var selected []uint16
+	var read, updated int
+	tag.OnSelect = func(fileID uint16) {
+		selected = append(selected, fileID)
+	}
+	tag.OnUpdate = func(fileID uint16, offset int, data []byte) {
+		updated += len(data)
+	}
+
+	device := nfctype4.New(&swtag.Driver{Tag: tag})
+	msg := ndef.NewTextMessage("hooks", "en")
+	if err := device.Update(msg); err != nil {
+		t.Fatal(err)
+	}
+	msgBytes, _ := msg.Marshal()
+	// NLEN is written twice
+	if updated != len(msgBytes)+4 {
+		t.Errorf("expected %d bytes updated. Got %d", len(msgBytes)+4, updated)
+	}
+	if len(selected) != 2 || selected[0] != capabilitycontainer.CCID ||
+		selected[1] != NDEFFileAddress {
+		t.Errorf("unexpected selected files: %04X", selected)
+	}
+
+	tag.OnRead = func(fileID uint16, offset int, data []byte) {
+		if fileID == NDEFFileAddress && offset >= 2 {
+			read += len(data)
+		}
+	}
+	if _, err := device.Read(); err != nil {
+		t.Fatal(err)
+	}
+	if read != len(msgBytes) {
+		t.Errorf("expected %d bytes read. Got %d", len(msgBytes), read)
+	}
+}
+
+func TestTag_concurrentCommands(t *testing.T) {
+	tag := New()
+	tag.SetMessage(ndef.NewTextMessage("concurrent", "en"))
+	tag.OnRead = func(fileID uint16, offset int, data []byte) {
+		tag.GetMessage()
+	}
+	tag.Command(apdu.NewSelectAPDU(NDEFFileAddress))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if i%2 == 0 {
+					tag.Command(apdu.NewReadBinaryAPDU(0, 10))
+				} else {
+					tag.Command(apdu.NewUpdateBinaryAPDU([]byte{0, byte(j)}, 2))
+				}
+				tag.SetMessage(ndef.NewTextMessage("concurrent", "en"))
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if msg := tag.GetMessage(); msg == nil || msg.String() != "urn:nfc:wkt:T:concurrent" {
+		t.Error("unexpected message:", msg)
+	}
+}
+
+// sharedStorage returns its own memory from Get, which a Tag must not
+// hand out in its responses.
+type sharedStorage struct {
+	*tags.MemoryStorage
+	mux   sync.Mutex
+	files map[uint16][]byte
+}
+
+func (s *sharedStorage) Get(fileID uint16, offset, length int) ([]byte, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	data, err := s.MemoryStorage.Get(fileID, offset, length)
+	if err != nil {
+		return nil, err
+	}
+	if s.files[fileID] == nil {
+		s.files[fileID] = make([]byte, 0x100)
+	}
+	return s.files[fileID][:copy(s.files[fileID], data)], nil
+}
+
+func TestTag_concurrentReadUpdate(t *testing.T) {
+	storage := &sharedStorage{
+		MemoryStorage: tags.NewMemoryStorage(),
+		files:         make(map[uint16][]byte),
+	}
+	tag, err := NewWithOptions(Options{Storage: storage})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag.SetMessage(ndef.NewTextMessage("concurrent", "en"))
+	tag.Command(apdu.NewSelectAPDU(NDEFFileAddress))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if i%2 == 1 {
+					tag.Command(apdu.NewUpdateBinaryAPDU([]byte{byte(j)}, 2))
+					continue
+				}
+				rapdu := tag.Command(apdu.NewReadBinaryAPDU(0, 10))
+				// Reading the response races with the
+				// updates unless the tag copied it.
+				for k := range rapdu.ResponseBody {
+					rapdu.ResponseBody[k]++
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+// failingStorage fails to write.
+type failingStorage struct {
+	*tags.MemoryStorage
+}
+
+func (s *failingStorage) Put(fileID uint16, offset int, data []byte) error {
+	return errors.New("disk full")
+}
+
+func TestTag_storageErrors(t *testing.T) {
+	storage := &failingStorage{tags.NewMemoryStorage()}
+	if _, err := NewWithOptions(Options{Storage: storage}); err == nil {
+		t.Error("NewWithOptions should fail when the CC cannot be stored")
+	}
+
+	tag, err := NewWithOptions(Options{Storage: tags.NewMemoryStorage()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag.fs.Storage = storage
+	if err := tag.SetMaxDataLengths(0x20, 0x20); err == nil {
+		t.Error("SetMaxDataLengths should fail when the CC cannot be stored")
+	}
+	if err := tag.SetAccessConditions(0x00, 0xFF); err == nil {
+		t.Error("SetAccessConditions should fail when the CC cannot be stored")
+	}
+	if err := tag.Initialize(); err == nil {
+		t.Error("Initialize should fail when the CC cannot be stored")
+	}
+}
+
+func TestTag_storage(t *testing.T) {
+	storage, err := tags.NewFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag, err := NewWithOptions(Options{MLe: 0x20, Storage: storage})
+	if err != nil {
+		t.Fatal(err)
+	}
+	device := nfctype4.New(&swtag.Driver{Tag: tag})
+	if err := device.Update(ndef.NewTextMessage("stored", "en")); err != nil {
+		t.Fatal(err)
+	}
+
+	// A new tag with the same storage keeps the contents
+	tag2, err := NewWithOptions(Options{Storage: storage})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg := tag2.GetMessage(); msg == nil || msg.String() != "urn:nfc:wkt:T:stored" {
+		t.Error("unexpected message:", msg)
+	}
+	tag2Bytes, _ := tag2.Marshal()
+	tagBytes, _ := tag.Marshal()
+	if !bytes.Equal(tagBytes, tag2Bytes) {
+		t.Errorf("expected % 02X. Got % 02X", tagBytes, tag2Bytes)
+	}
+
+	// Initialize clears the storage
+	tag2.Initialize()
+	if tag.GetMessage() != nil {
+		t.Error("the storage should be empty after Initialize")
+	}
+}
+
+func TestConformance(t *testing.T) {
+	tagtest.TestTag(t, func() (tags.Tag, error) {
+		return New(), nil
+	})
+}
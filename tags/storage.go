@@ -0,0 +1,147 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package tags
+
+import (
+	"errors"
+	"sort"
+	"sync"
+)
+
+// ErrFileNotFound is returned by Storage implementations when a file
+// does not exist. Use errors.Is() to check for it.
+var ErrFileNotFound = errors.New("file not found")
+
+// Storage holds the files of a software tag, indexed by file ID.
+// Software tags use it to keep their memory, so that it can be backed
+// by anything from a map to a database shared by a fleet of emulated
+// tags.
+//
+// Implementations must be safe for concurrent use.
+type Storage interface {
+	// Get returns up to length bytes from the file, starting at
+	// offset. Fewer bytes are returned when the end of the file is
+	// reached. The returned slice belongs to the caller: the
+	// storage must not modify it afterwards.
+	Get(fileID uint16, offset, length int) ([]byte, error)
+	// Put writes data in the file at the given offset, creating
+	// the file or extending it as needed.
+	Put(fileID uint16, offset int, data []byte) error
+	// Size returns the size of the file.
+	Size(fileID uint16) (int, error)
+	// Truncate changes the size of the file, creating it if needed.
+	Truncate(fileID uint16, size int) error
+	// Delete removes the file.
+	Delete(fileID uint16) error
+	// FileIDs returns the IDs of all the files, sorted.
+	FileIDs() ([]uint16, error)
+}
+
+// MemoryStorage implements Storage by keeping the files in memory.
+type MemoryStorage struct {
+	mux   sync.RWMutex
+	files map[uint16][]byte
+}
+
+// NewMemoryStorage returns a new, empty, *MemoryStorage.
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{
+		files: make(map[uint16][]byte),
+	}
+}
+
+// Get returns up to length bytes from the file, starting at offset.
+func (s *MemoryStorage) Get(fileID uint16, offset, length int) ([]byte, error) {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	file, ok := s.files[fileID]
+	if !ok {
+		return nil, ErrFileNotFound
+	}
+	if offset < 0 || length < 0 || offset > len(file) {
+		return nil, errors.New("MemoryStorage.Get: invalid offset")
+	}
+	if offset+length > len(file) {
+		length = len(file) - offset
+	}
+	return append([]byte{}, file[offset:offset+length]...), nil
+}
+
+// Put writes data in the file at the given offset.
+func (s *MemoryStorage) Put(fileID uint16, offset int, data []byte) error {
+	if offset < 0 {
+		return errors.New("MemoryStorage.Put: invalid offset")
+	}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	file := s.files[fileID]
+	if newLen := offset + len(data); newLen > len(file) {
+		newFile := make([]byte, newLen)
+		copy(newFile, file)
+		file = newFile
+	}
+	copy(file[offset:], data)
+	s.files[fileID] = file
+	return nil
+}
+
+// Size returns the size of the file.
+func (s *MemoryStorage) Size(fileID uint16) (int, error) {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	file, ok := s.files[fileID]
+	if !ok {
+		return 0, ErrFileNotFound
+	}
+	return len(file), nil
+}
+
+// Truncate changes the size of the file.
+func (s *MemoryStorage) Truncate(fileID uint16, size int) error {
+	if size < 0 {
+		return errors.New("MemoryStorage.Truncate: invalid size")
+	}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	newFile := make([]byte, size)
+	copy(newFile, s.files[fileID])
+	s.files[fileID] = newFile
+	return nil
+}
+
+// Delete removes the file.
+func (s *MemoryStorage) Delete(fileID uint16) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	delete(s.files, fileID)
+	return nil
+}
+
+// FileIDs returns the IDs of all the files, sorted.
+func (s *MemoryStorage) FileIDs() ([]uint16, error) {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	fileIDs := make([]uint16, 0, len(s.files))
+	for fileID := range s.files {
+		fileIDs = append(fileIDs, fileID)
+	}
+	sort.Slice(fileIDs, func(i, j int) bool {
+		return fileIDs[i] < fileIDs[j]
+	})
+	return fileIDs, nil
+}
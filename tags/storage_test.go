@@ -0,0 +1,87 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package tags
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func testStorage(t *testing.T, s Storage) {
+	if _, err := s.Size(0xE104); !errors.Is(err, ErrFileNotFound) {
+		t.Error("expected ErrFileNotFound but got:", err)
+	}
+	if _, err := s.Get(0xE104, 0, 1); !errors.Is(err, ErrFileNotFound) {
+		t.Error("expected ErrFileNotFound but got:", err)
+	}
+
+	if err := s.Put(0xE104, 2, []byte{1, 2, 3}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put(0xE103, 0, []byte{4}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := s.Get(0xE104, 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, []byte{0, 1, 2, 3}) {
+		t.Errorf("unexpected data: % 02X", data)
+	}
+	if _, err := s.Get(0xE104, 6, 1); err == nil {
+		t.Error("Get should fail with offsets beyond the file")
+	}
+
+	if err := s.Truncate(0xE104, 2); err != nil {
+		t.Fatal(err)
+	}
+	if size, err := s.Size(0xE104); err != nil || size != 2 {
+		t.Error("expected size 2 but got:", size, err)
+	}
+
+	fileIDs, err := s.FileIDs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fileIDs) != 2 || fileIDs[0] != 0xE103 || fileIDs[1] != 0xE104 {
+		t.Errorf("unexpected file IDs: %04X", fileIDs)
+	}
+
+	if err := s.Delete(0xE104); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete(0xE104); err != nil {
+		t.Error("deleting a missing file should not fail:", err)
+	}
+	if _, err := s.Size(0xE104); !errors.Is(err, ErrFileNotFound) {
+		t.Error("expected ErrFileNotFound but got:", err)
+	}
+}
+
+func TestMemoryStorage(t *testing.T) {
+	testStorage(t, NewMemoryStorage())
+}
+
+func TestFileStorage(t *testing.T) {
+	s, err := NewFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStorage(t, s)
+}
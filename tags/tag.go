@@ -33,6 +33,10 @@ import (
 // It falls withing the Tag implementation to be consistent with the
 // specification. The modules under nfctype4/tags offer examples of Tags.
 //
+// Command may return nil to indicate that the Tag did not answer at
+// all, as a real tag that left the field would do. Tags wrapping other
+// Tags must expect nil responses and pass them on.
+//
 // The `nfctype4/drivers/swtag` driver provides binary communication
 // for software tags. Check the `swtag` documentation to get an overview
 // of its different applications.
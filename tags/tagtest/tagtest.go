@@ -0,0 +1,332 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+// Package tagtest provides a conformance test suite for software
+// NFC Forum Type 4 Tags implementing the tags.Tag interface.
+//
+// The suite talks to the tags through the swtag driver, using
+// nfctype4.Device and nfctype4.Commander, so the Command and Response
+// APDUs are serialized and parsed as they would be when the tag is
+// emulated with a real reader. Deviations from the specification are
+// reported as test errors.
+package tagtest
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/hsanjuan/go-ndef"
+	"github.com/hsanjuan/go-nfctype4"
+	"github.com/hsanjuan/go-nfctype4/apdu"
+	"github.com/hsanjuan/go-nfctype4/capabilitycontainer"
+	"github.com/hsanjuan/go-nfctype4/drivers/swtag"
+	"github.com/hsanjuan/go-nfctype4/tags"
+)
+
+// MakeTag creates a new Tag to be tested. Every test uses a fresh
+// Tag.
+type MakeTag func() (tags.Tag, error)
+
+// maxTestMessageLen limits the size of the messages written by the
+// suite.
+const maxTestMessageLen = 1024
+
+// TestTag runs the conformance tests on the Tags created by makeTag.
+// Each test runs as a subtest of t:
+//
+//   - ApplicationSelect: the NDEF Application is selectable and
+//     other applications are not found.
+//   - FileSelect: the CC is selectable and unknown files are not found.
+//   - NoCurrentFile: reading without a selected file fails.
+//   - CapabilityContainer: the CC follows the specification and its
+//     NDEF File is selectable.
+//   - BadOffsets: reads outside the file fail.
+//   - UnknownInstruction: unsupported commands fail with 6D00h.
+//   - AccessConditions: the access conditions in the CC are enforced.
+//   - ChunkedTransfer: messages larger than MLe and MLc are written
+//     and read back with several commands, when the NDEF File is
+//     writable.
+func TestTag(t *testing.T, makeTag MakeTag) {
+	tests := []struct {
+		name string
+		test func(*testing.T, tags.Tag)
+	}{
+		{"ApplicationSelect", testApplicationSelect},
+		{"FileSelect", testFileSelect},
+		{"NoCurrentFile", testNoCurrentFile},
+		{"CapabilityContainer", testCapabilityContainer},
+		{"BadOffsets", testBadOffsets},
+		{"UnknownInstruction", testUnknownInstruction},
+		{"AccessConditions", testAccessConditions},
+		{"ChunkedTransfer", testChunkedTransfer},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			tag, err := makeTag()
+			if err != nil {
+				t.Fatal(err)
+			}
+			test.test(t, tag)
+		})
+	}
+}
+
+// newCommander returns a Commander attached to the tag.
+func newCommander(tag tags.Tag) *nfctype4.Commander {
+	return &nfctype4.Commander{
+		Driver: &swtag.Driver{Tag: tag},
+	}
+}
+
+// transceive sends a CAPDU and fails the test if no valid response
+// is received.
+func transceive(t *testing.T, cmder *nfctype4.Commander, capdu *apdu.CAPDU) *apdu.RAPDU {
+	t.Helper()
+	rapdu, err := cmder.Transceive(capdu)
+	if err != nil {
+		t.Fatalf("%s: %s", capdu, err)
+	}
+	return rapdu
+}
+
+// readCC selects the NDEF Application and the CC file and returns the
+// parsed Capability Container. The CC file stays selected.
+func readCC(t *testing.T, cmder *nfctype4.Commander) *capabilitycontainer.CapabilityContainer {
+	t.Helper()
+	if err := cmder.NDEFApplicationSelect(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cmder.Select(capabilitycontainer.CCID); err != nil {
+		t.Fatal(err)
+	}
+	cclen, err := cmder.ReadBinary(0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cclen) != 2 {
+		t.Fatal("CCLEN could not be read")
+	}
+	cmder.MaxReadBinaryLen = 0x0F // minimum MLe
+	ccBytes, err := cmder.ReadBinary(0, uint16(cclen[0])<<8|uint16(cclen[1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cc := new(capabilitycontainer.CapabilityContainer)
+	if _, err := cc.Unmarshal(ccBytes); err != nil {
+		t.Fatal("invalid Capability Container: ", err)
+	}
+	return cc
+}
+
+// ndefFile returns the ID and the access conditions of the NDEF File
+// advertised in the CC.
+func ndefFile(cc *capabilitycontainer.CapabilityContainer) (fileID uint16, read, write byte) {
+	if cc.UsesExtendedNDEFFile() {
+		eTLV := cc.ExtendedNDEFFileControlTLV
+		return eTLV.FileID, eTLV.FileReadAccessCondition,
+			eTLV.FileWriteAccessCondition
+	}
+	fTLV := cc.NDEFFileControlTLV
+	return fTLV.FileID, fTLV.FileReadAccessCondition,
+		fTLV.FileWriteAccessCondition
+}
+
+func testApplicationSelect(t *testing.T, tag tags.Tag) {
+	cmder := newCommander(tag)
+	otherApp := []byte{0xD2, 0x76, 0x00, 0x00, 0x85, 0x01, 0x00}
+	rapdu := transceive(t, cmder, apdu.NewSelectByNameAPDU(otherApp))
+	if !rapdu.FileNotFound() {
+		t.Errorf("selecting an unknown application: "+
+			"expected 6A82h but got %04Xh", rapdu.Status())
+	}
+	if err := cmder.NDEFApplicationSelect(); err != nil {
+		t.Error("the NDEF Application cannot be selected: ", err)
+	}
+}
+
+func testFileSelect(t *testing.T, tag tags.Tag) {
+	cmder := newCommander(tag)
+	if err := cmder.NDEFApplicationSelect(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cmder.Select(capabilitycontainer.CCID); err != nil {
+		t.Error("the Capability Container cannot be selected: ", err)
+	}
+	// E102h is reserved, so it cannot be an existing file
+	rapdu := transceive(t, cmder, apdu.NewSelectAPDU(0xE102))
+	if !rapdu.FileNotFound() {
+		t.Errorf("selecting an unknown file: "+
+			"expected 6A82h but got %04Xh", rapdu.Status())
+	}
+}
+
+func testNoCurrentFile(t *testing.T, tag tags.Tag) {
+	cmder := newCommander(tag)
+	if err := cmder.NDEFApplicationSelect(); err != nil {
+		t.Fatal(err)
+	}
+	rapdu := transceive(t, cmder, apdu.NewReadBinaryAPDU(0, 2))
+	if !rapdu.IsError() {
+		t.Errorf("reading without a selected file: "+
+			"expected an error but got %04Xh", rapdu.Status())
+	}
+}
+
+func testCapabilityContainer(t *testing.T, tag tags.Tag) {
+	cmder := newCommander(tag)
+	cc := readCC(t, cmder)
+	if major := cc.MajorVersion(); major != 2 && major != 3 {
+		t.Errorf("unexpected mapping version %02Xh", cc.MappingVersion)
+	}
+	if cc.UsesExtendedNDEFFile() && cc.MajorVersion() != 3 {
+		t.Error("Extended NDEF Files need mapping version 3.0")
+	}
+	fileID, _, _ := ndefFile(cc)
+	if err := cmder.Select(fileID); err != nil {
+		t.Errorf("the NDEF File %04Xh cannot be selected: %s",
+			fileID, err)
+	}
+}
+
+func testBadOffsets(t *testing.T, tag tags.Tag) {
+	cmder := newCommander(tag)
+	readCC(t, cmder)
+	rapdu := transceive(t, cmder, apdu.NewReadBinaryAPDU(0x7FFF, 1))
+	if rapdu.CommandCompleted() {
+		t.Error("reading beyond the end of the CC should fail")
+	}
+	// Offsets with the highest bit set are not valid with B0h
+	rapdu = transceive(t, cmder, &apdu.CAPDU{
+		INS: apdu.INSRead,
+		P1:  0x80,
+		P2:  0x00,
+		Le:  []byte{0x01},
+	})
+	if !rapdu.IsError() {
+		t.Errorf("reading with P1 = 80h: "+
+			"expected an error but got %04Xh", rapdu.Status())
+	}
+}
+
+func testUnknownInstruction(t *testing.T, tag tags.Tag) {
+	cmder := newCommander(tag)
+	readCC(t, cmder)
+	rapdu := transceive(t, cmder, &apdu.CAPDU{
+		INS: 0x50,
+		Le:  []byte{0x01},
+	})
+	if rapdu.Status() != apdu.SWINSNotSupported {
+		t.Errorf("unknown instruction: expected 6D00h but got %04Xh",
+			rapdu.Status())
+	}
+}
+
+func testAccessConditions(t *testing.T, tag tags.Tag) {
+	cmder := newCommander(tag)
+	cc := readCC(t, cmder)
+	fileID, read, write := ndefFile(cc)
+	if err := cmder.Select(fileID); err != nil {
+		t.Fatal(err)
+	}
+
+	rapdu := transceive(t, cmder, apdu.NewReadBinaryAPDU(0, 2))
+	switch {
+	case read == 0x00 && rapdu.IsError():
+		t.Errorf("reading a readable NDEF File: got %04Xh",
+			rapdu.Status())
+	case read != 0x00 && !rapdu.IsError():
+		t.Errorf("reading a protected NDEF File: "+
+			"expected an error but got %04Xh", rapdu.Status())
+	}
+
+	if write == 0x00 {
+		return
+	}
+	rapdu = transceive(t, cmder, apdu.NewUpdateBinaryAPDU([]byte{0, 0}, 0))
+	if !rapdu.IsError() {
+		t.Errorf("writing a protected NDEF File: "+
+			"expected an error but got %04Xh", rapdu.Status())
+	}
+	if cc.UsesExtendedNDEFFile() {
+		return
+	}
+	device := nfctype4.New(&swtag.Driver{Tag: tag})
+	if err := device.Update(ndef.NewTextMessage("a", "en")); err == nil {
+		t.Error("Device.Update should fail on a protected NDEF File")
+	}
+}
+
+func testChunkedTransfer(t *testing.T, tag tags.Tag) {
+	cmder := newCommander(tag)
+	cc := readCC(t, cmder)
+	if cc.UsesExtendedNDEFFile() {
+		t.Skip("Device does not support Extended NDEF Files")
+	}
+	fTLV := cc.NDEFFileControlTLV
+	if fTLV.FileReadAccessCondition != 0x00 ||
+		fTLV.FileWriteAccessCondition != 0x00 {
+		t.Skip("the NDEF File is not readable and writable")
+	}
+
+	// A message needing several ReadBinary and UpdateBinary
+	// commands, as long as it fits in the NDEF File.
+	maxLen := int(fTLV.MaximumFileSize) - 2
+	if maxLen > maxTestMessageLen {
+		maxLen = maxTestMessageLen
+	}
+	n := 3*int(cc.MLc) + 10
+	var msg *ndef.Message
+	var mBytes []byte
+	for ; n > 0; n-- {
+		msg = ndef.NewTextMessage(strings.Repeat("x", n), "en")
+		mBytes, _ = msg.Marshal()
+		if len(mBytes) <= maxLen {
+			break
+		}
+	}
+	if n == 0 {
+		t.Skip("the NDEF File is too small")
+	}
+
+	device := nfctype4.New(&swtag.Driver{Tag: tag})
+	if err := device.Update(msg); err != nil {
+		t.Fatal("Device.Update: ", err)
+	}
+	readMsg, err := device.Read()
+	if err != nil {
+		t.Fatal("Device.Read: ", err)
+	}
+	if readMsg.String() != msg.String() {
+		t.Error("the message read does not match the message written")
+	}
+
+	// Read the NDEF File again in minimum-size chunks
+	if err := cmder.Select(fTLV.FileID); err != nil {
+		t.Fatal(err)
+	}
+	cmder.MaxReadBinaryLen = 0x0F
+	file, err := cmder.ReadBinary(0, uint16(len(mBytes)+2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := append([]byte{byte(len(mBytes) >> 8), byte(len(mBytes))}, mBytes...)
+	if !bytes.Equal(file, expected) {
+		t.Error("the NDEF File read in chunks does not match")
+	}
+}
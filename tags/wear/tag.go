@@ -0,0 +1,152 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+// Package wear provides a wrapper which simulates the limited write
+// endurance of the memory of a software NFC Forum Type 4 Tag.
+//
+// EEPROM cells in real tags wear out after a number of write cycles,
+// after which the tag fails to store data. This package allows to test
+// how applications behave when that happens.
+package wear
+
+import (
+	"sync"
+
+	"github.com/hsanjuan/go-nfctype4/apdu"
+	"github.com/hsanjuan/go-nfctype4/helpers"
+	"github.com/hsanjuan/go-nfctype4/tags"
+)
+
+// DefaultRegionSize is the size of the memory regions used by New,
+// similar to the page size of common tag memories.
+const DefaultRegionSize = 16
+
+// region identifies a memory region of a file.
+type region struct {
+	fileID uint16
+	index  int
+}
+
+// Tag wraps a tags.Tag and counts the UpdateBinary commands which
+// modify each region of its files. Once a region has been written
+// Endurance times, further UpdateBinary commands touching it fail with
+// 6581h (memory failure) and do not reach the wrapped tag. It
+// implements the `tags.Tag` interface.
+//
+// Please use wear.New() to create tags.
+type Tag struct {
+	tag        tags.Tag
+	regionSize int
+	endurance  int
+
+	mux            sync.Mutex
+	selectedFileID uint16 // 0 when no file is selected
+	writes         map[region]int
+}
+
+// New returns a new *Tag wrapping the given one, which allows
+// endurance writes on each region of DefaultRegionSize bytes.
+func New(tag tags.Tag, endurance int) *Tag {
+	return NewWithRegionSize(tag, endurance, DefaultRegionSize)
+}
+
+// NewWithRegionSize returns a new *Tag wrapping the given one, which
+// allows endurance writes on each region of regionSize bytes.
+func NewWithRegionSize(tag tags.Tag, endurance, regionSize int) *Tag {
+	if regionSize <= 0 {
+		regionSize = DefaultRegionSize
+	}
+	return &Tag{
+		tag:        tag,
+		regionSize: regionSize,
+		endurance:  endurance,
+		writes:     make(map[region]int),
+	}
+}
+
+// Writes returns how many times the region of the file containing the
+// given offset has been written.
+func (tag *Tag) Writes(fileID uint16, offset int) int {
+	tag.mux.Lock()
+	defer tag.mux.Unlock()
+	return tag.writes[region{fileID, offset / tag.regionSize}]
+}
+
+// Command lets the Software tag receive Commands (CAPDUs) and
+// provide responses (RAPDUs) according to each command.
+func (tag *Tag) Command(capdu *apdu.CAPDU) *apdu.RAPDU {
+	tag.mux.Lock()
+	defer tag.mux.Unlock()
+
+	switch capdu.INS {
+	case apdu.INSSelect:
+		rapdu := tag.tag.Command(capdu)
+		if rapdu != nil && rapdu.CommandCompleted() {
+			tag.selectedFileID = 0
+			if capdu.P1 == 0x00 && len(capdu.Data) == 2 {
+				tag.selectedFileID = helpers.BytesToUint16(
+					[2]byte{capdu.Data[0], capdu.Data[1]})
+			}
+		}
+		return rapdu
+	case apdu.INSUpdate, apdu.INSUpdateODO:
+		return tag.update(capdu)
+	default:
+		return tag.tag.Command(capdu)
+	}
+}
+
+// update forwards an UpdateBinary command unless one of the regions
+// it modifies is worn out, and records the write.
+func (tag *Tag) update(capdu *apdu.CAPDU) *apdu.RAPDU {
+	offset, length, ok := updateRange(capdu)
+	if !ok || length == 0 || tag.selectedFileID == 0 {
+		return tag.tag.Command(capdu)
+	}
+	first := offset / tag.regionSize
+	last := (offset + length - 1) / tag.regionSize
+	for i := first; i <= last; i++ {
+		if tag.writes[region{tag.selectedFileID, i}] >= tag.endurance {
+			return apdu.NewRAPDUStatus(apdu.SWMemoryFailure)
+		}
+	}
+	rapdu := tag.tag.Command(capdu)
+	if rapdu != nil && rapdu.CommandCompleted() {
+		for i := first; i <= last; i++ {
+			tag.writes[region{tag.selectedFileID, i}]++
+		}
+	}
+	return rapdu
+}
+
+// updateRange returns the offset and the length of the data written by
+// an UpdateBinary command. It returns false if they cannot be parsed.
+func updateRange(capdu *apdu.CAPDU) (offset, length int, ok bool) {
+	if capdu.INS == apdu.INSUpdate {
+		offset = int(helpers.BytesToUint16([2]byte{capdu.P1, capdu.P2}))
+		return offset, len(capdu.Data), true
+	}
+	odoOffset, rest, err := apdu.ParseOffsetDataObject(capdu.Data)
+	if err != nil {
+		return 0, 0, false
+	}
+	_, value, _, err := apdu.UnmarshalDataObject(rest)
+	if err != nil {
+		return 0, 0, false
+	}
+	return int(odoOffset), len(value), true
+}
@@ -0,0 +1,86 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package wear
+
+import (
+	"testing"
+
+	"github.com/hsanjuan/go-ndef"
+	"github.com/hsanjuan/go-nfctype4"
+	"github.com/hsanjuan/go-nfctype4/apdu"
+	"github.com/hsanjuan/go-nfctype4/drivers/swtag"
+	"github.com/hsanjuan/go-nfctype4/tags/static"
+)
+
+func TestTag(t *testing.T) {
+	tag := NewWithRegionSize(static.New(), 2, 4)
+	tag.Command(apdu.NewNDEFTagApplicationSelectAPDU())
+	tag.Command(apdu.NewSelectAPDU(static.NDEFFileAddress))
+
+	update := func(data []byte, offset uint16) uint16 {
+		return tag.Command(apdu.NewUpdateBinaryAPDU(data, offset)).Status()
+	}
+	if sw := update(make([]byte, 8), 0); sw != apdu.SWCommandCompleted {
+		t.Fatalf("unexpected status %04Xh", sw)
+	}
+	if sw := update([]byte{0, 0}, 0); sw != apdu.SWCommandCompleted {
+		t.Fatalf("unexpected status %04Xh", sw)
+	}
+	if sw := update([]byte{0, 0}, 2); sw != apdu.SWMemoryFailure {
+		t.Errorf("expected 6581h but got %04Xh", sw)
+	}
+	if tag.Writes(static.NDEFFileAddress, 3) != 2 {
+		t.Error("the region should have been written twice")
+	}
+
+	// The next region is still fine
+	if sw := update([]byte{1, 2, 3, 4}, 4); sw != apdu.SWCommandCompleted {
+		t.Errorf("unexpected status %04Xh", sw)
+	}
+	// But a write touching both regions fails
+	if sw := update([]byte{1, 2}, 3); sw != apdu.SWMemoryFailure {
+		t.Errorf("expected 6581h but got %04Xh", sw)
+	}
+	if tag.Writes(static.NDEFFileAddress, 4) != 2 {
+		t.Error("the second region should have been written twice")
+	}
+	odo := apdu.NewUpdateBinaryODOAPDU([]byte{1, 2}, 8)
+	if sw := tag.Command(odo).Status(); sw != apdu.SWCommandCompleted {
+		t.Errorf("unexpected status %04Xh", sw)
+	}
+	if tag.Writes(static.NDEFFileAddress, 8) != 1 {
+		t.Error("ODO writes should be counted")
+	}
+}
+
+func TestTag_device(t *testing.T) {
+	tag := New(static.New(), 10)
+	device := nfctype4.New(&swtag.Driver{Tag: tag})
+	msg := ndef.NewTextMessage("wear", "en")
+	var err error
+	for i := 0; i < 10 && err == nil; i++ {
+		err = device.Update(msg)
+	}
+	if err == nil {
+		t.Fatal("the tag should have worn out")
+	}
+	sErr, ok := err.(*apdu.StatusError)
+	if !ok || sErr.SW1 != 0x65 || sErr.SW2 != 0x81 {
+		t.Error("expected a memory failure but got: ", err)
+	}
+}
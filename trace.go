@@ -0,0 +1,55 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package nfctype4
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Tracer receives the bytes exchanged by a CommandDriver with the tag,
+// which allows to log or dump the communication. sent is true for the
+// bytes sent to the tag and false for the bytes received from it.
+//
+// Drivers offer a Trace field of this type. A nil Tracer does
+// nothing.
+type Tracer func(sent bool, data []byte)
+
+// Trace calls the Tracer, if it is not nil.
+func (tracer Tracer) Trace(sent bool, data []byte) {
+	if tracer != nil {
+		tracer(sent, data)
+	}
+}
+
+// NewWriterTracer returns a Tracer which writes the bytes exchanged to
+// w in hexadecimal, one line per exchange, prefixed by "T: " for the
+// bytes sent and "R: " for the bytes received.
+func NewWriterTracer(w io.Writer) Tracer {
+	var mux sync.Mutex
+	return func(sent bool, data []byte) {
+		prefix := "R"
+		if sent {
+			prefix = "T"
+		}
+		mux.Lock()
+		defer mux.Unlock()
+		fmt.Fprintf(w, "%s: % 02x\n", prefix, data)
+	}
+}
@@ -0,0 +1,36 @@
+/***
+    Copyright (c) 2020, Hector Sanjuan
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU Lesser General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU Lesser General Public License for more details.
+
+    You should have received a copy of the GNU Lesser General Public License
+    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+***/
+
+package nfctype4
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestTracer(t *testing.T) {
+	var nilTracer Tracer
+	nilTracer.Trace(true, []byte{0x00}) // does not panic
+
+	var buf bytes.Buffer
+	tracer := NewWriterTracer(&buf)
+	tracer.Trace(true, []byte{0x00, 0xa4})
+	tracer.Trace(false, []byte{0x90, 0x00})
+	if buf.String() != "T: 00 a4\nR: 90 00\n" {
+		t.Errorf("unexpected trace:\n%s", buf.String())
+	}
+}